@@ -11,7 +11,6 @@ import (
 
 	"github.com/ldsec/lattigo/v2/ckks"
 	"github.com/ldsec/lattigo/v2/ring"
-	"github.com/ldsec/lattigo/v2/rlwe"
 	"github.com/ldsec/lattigo/v2/utils"
 
 	"mk-lr/mkckks"
@@ -26,33 +25,21 @@ var (
 	// numTrain =
 	// numValidate =
 
-	numIter   = 4
+	numIter   = 8 // the weights are bootstrapped once the levels of the fresh ciphertexts are consumed
+	iterDepth = 4 // levels consumed by an iteration, which also hold the inference
 	batchSize = 2048
-	gamma     = 0.3                                       // learning rate
-	eta       = [4]float64{1, 1.61803, 2.193527, 2.74979} // weight
+	gamma     = 0.3                      // learning rate
+	eta       = nesterovWeights(numIter) // weight
 
 	c3 = -0.0015
 	c1 = 0.15
 	c0 = 0.5 // sigmoid(x) = c3*x^3 + c1*x + c0
 
 	// Variables for HE setting
-	slotNum   = int(math.Pow(2, 14))
-	PN15QP880 = ckks.ParametersLiteral{
-		LogN:     15,
-		LogSlots: 14,
-		Q: []uint64{ // 50 + 38 * 20
-			0x80000000080001,
-			0x4000170001, 0x40002f0001, 0x3fffe80001,
-			0x4000300001, 0x40003f0001, 0x3fffcf0001,
-			0x4000450001, 0x3fffc10001, 0x40004a0001, 0x3fffb80001,
-			0x3fffb70001, 0x4000510001, 0x3fffb20001, 0x4000540001,
-			0x3fffaf0001, 0x4000560001, 0x4000590001,
-			0x3fff810001, 0x40006b0001, 0x4000720001},
-		P: []uint64{ // 50 * 2
-			0x40000001b0001, 0x4000000270001},
-		Scale: 1 << 38,
-		Sigma: rlwe.DefaultSigma,
-	}
+	slotNum = int(math.Pow(2, 14))
+
+	// the weights repeat every 2^3 slots, which is the sparse packing bootstrapped by the preset
+	btpParams = mkckks.BootstrappingPN15QP1080
 )
 
 type testParams struct {
@@ -65,11 +52,13 @@ type testParams struct {
 	pkSet  *mkrlwe.PublicKeySet
 	rlkSet *mkrlwe.RelinearizationKeySet
 	rtkSet *mkrlwe.RotationKeySet
+	cjkSet *mkrlwe.ConjugationKeySet
 
-	encryptor *mkckks.Encryptor
-	decryptor *mkckks.Decryptor
-	evaluator *mkckks.Evaluator
-	idset     *mkrlwe.IDSet
+	encryptor    *mkckks.Encryptor
+	decryptor    *mkckks.Decryptor
+	evaluator    *mkckks.Evaluator
+	bootstrapper *mkckks.Bootstrapper
+	idset        *mkrlwe.IDSet
 }
 
 func main() {
@@ -91,7 +80,9 @@ func main() {
 	// Setting for HE
 	fmt.Println()
 	fmt.Println("Setting Parameters...")
-	ckks_params, err := ckks.NewParametersFromLiteral(PN15QP880)
+	literal := btpParams.ParametersLiteral
+	literal.LogSlots = 14
+	ckks_params, err := ckks.NewParametersFromLiteral(literal)
 	params := mkckks.NewParameters(ckks_params)
 
 	if err != nil {
@@ -201,13 +192,6 @@ func main() {
 		const4_pt[iter] = testContext.encryptor.EncodeMsgNew(const_msg)
 	}
 
-	// const5_ct = c1/c3
-	for i := 0; i < int(slotNum); i++ {
-		const_vector[i] = complex(c1/c3, 0)
-	}
-	const_msg.Value = const_vector
-	const5_ct := testContext.encryptor.EncryptMsgNew(const_msg, testContext.pkSet.GetPublicKey(id))
-
 	// const6_pt = (1 - eta)
 	const6_pt := make([]*ckks.Plaintext, numIter)
 	for iter := 0; iter < numIter; iter++ {
@@ -225,25 +209,21 @@ func main() {
 		const7_pt[iter] = testContext.encryptor.EncodeMsgNew(const_msg)
 	}
 
-	// const8_pt = c3
-	for i := 0; i < int(slotNum); i++ {
-		const_vector[i] = complex(c3, 0)
-	}
-	const_msg.Value = const_vector
-	const8_pt := testContext.encryptor.EncodeMsgNew(const_msg)
-
-	// const9_ct = c0
-	for i := 0; i < int(slotNum); i++ {
-		const_vector[i] = complex(c0, 0)
-	}
-	const_msg.Value = const_vector
-	const9_ct := testContext.encryptor.EncryptMsgNew(const_msg, testContext.pkSet.GetPublicKey(id))
+	// sigmoid approximation
+	sigmoidPoly := mkckks.NewPolynomial([]float64{c0, c1, 0, c3})
 
 	fmt.Println()
 	fmt.Println("Training...")
 	start := time.Now()
 	for a := 0; a < numIter; a++ {
 		fmt.Println(a, "-th Iteration")
+
+		if v.Level() < iterDepth {
+			fmt.Println("Bootstrapping...")
+			v = bootstrap(testContext, v)
+			beta = bootstrap(testContext, beta)
+		}
+
 		//////////////////////////// depth 1 //////////////////////////////////
 		// M_j = Z_j * V_j
 		m := testContext.evaluator.MulRelinNew(z, v, testContext.rlkSet)
@@ -261,13 +241,13 @@ func main() {
 		z4 := testContext.evaluator.MulPtxtNew(z, const4_pt[a])
 
 		///////////////////////////// depth 2 //////////////////////////////////
-		// M = \sum_j SumColVec(M_j)
-		m = SumColVec(testContext.evaluator, testContext.rlkSet, testContext.rtkSet, m, mask, int(math.Pow(2, 11.0)), int(math.Pow(2, 3.0)))
+		// M = \sum_j SumColumns(M_j)
+		m = testContext.evaluator.SumColumnsNew(m, mask, int(math.Pow(2, 3.0)), testContext.rtkSet)
 
 		///////////////////////////// depth 3 //////////////////////////////////
 		// M'' = M * M + c1/c3
 		m2 := testContext.evaluator.MulRelinNew(m, m, testContext.rlkSet)
-		m2 = testContext.evaluator.AddNew(m2, const5_ct)
+		m2 = testContext.evaluator.AddConstNew(m2, c1/c3)
 
 		// M' = M * Z3_j
 		m1 := testContext.evaluator.MulRelinNew(m, z3, testContext.rlkSet)
@@ -280,24 +260,21 @@ func main() {
 		g := testContext.evaluator.MulRelinNew(m1, m2, testContext.rlkSet)
 		g = testContext.evaluator.AddNew(g, z1)
 
-		// W+_j = V_j + SumRowVec(G_j)
+		// W+_j = V_j + SumRows(G_j)
 
-		for i := 1; i < 2048; i *= 2 {
-			g_rot := testContext.evaluator.RotateNew(g, 8*i, testContext.rtkSet)
-			g = testContext.evaluator.AddNew(g, g_rot)
-		}
+		g = testContext.evaluator.SumRowsNew(g, nil, 2048, 8, testContext.rtkSet)
 
 		beta_update := testContext.evaluator.AddNew(v, g)
 		// U_j = S_j * M'' + Z2_j
 		u := testContext.evaluator.MulRelinNew(s, m2, testContext.rlkSet)
 		u = testContext.evaluator.AddNew(u, z2)
 
-		// V+_j = eta * W_j + (1 - eta) * V_j + SumRowVec(U_j)
+		// V+_j = eta * W_j + (1 - eta) * V_j + SumRows(U_j)
 		v_update := testContext.evaluator.MulPtxtNew(v, const6_pt[a])
 		beta = testContext.evaluator.MulPtxtNew(beta, const7_pt[a])
 		v_update = testContext.evaluator.AddNew(v_update, beta)
 
-		u = SumRowVec(testContext.evaluator, testContext.rtkSet, u, int(math.Pow(2, 11.0)), int(math.Pow(2, 3.0)))
+		u = testContext.evaluator.SumRowsNew(u, nil, int(math.Pow(2, 11.0)), int(math.Pow(2, 3.0)), testContext.rtkSet)
 
 		v_update = testContext.evaluator.AddNew(v_update, u)
 
@@ -317,6 +294,10 @@ func main() {
 	elapsed := end.Sub(start)
 	fmt.Println("Training Time:", elapsed)
 
+	if beta.Level() < iterDepth {
+		beta = bootstrap(testContext, beta)
+	}
+
 	/*
 		// Inference in depth 3
 		fmt.Println()
@@ -336,24 +317,14 @@ func main() {
 			test_ct := testContext.encryptor.EncryptMsgNewExpand(test_msg, testContext.pkSet.GetPublicKey(id), idset)
 
 			// Compute inner product
-			inner_prod := testContext.evaluator.MulRelinNew(test_ct, beta, testContext.rlkSet)
-
-			for i := 1; i < numFeature; i *= 2 {
-				inner_prod_rot := testContext.evaluator.RotateNew(inner_prod, i, testContext.rtkSet)
-				inner_prod = testContext.evaluator.AddNew(inner_prod, inner_prod_rot)
-			}
+			inner_prod := testContext.evaluator.InnerProductNew(test_ct, beta, numFeature, testContext.rlkSet, testContext.rtkSet)
 
 			// Compute sigmoid
-			// term1 = inner_prod * inner_prod + c1/c3
-			term1 := testContext.evaluator.MulRelinNew(inner_prod, inner_prod, testContext.rlkSet)
-			term1 = testContext.evaluator.AddNew(term1, const5_ct)
-
-			// term2 = c3 * inner_prod
-			term2 := testContext.evaluator.MulPtxtNew(inner_prod, const8_pt)
-
-			// sigmoid = term1 * term2 + c0
-			sigmoid := testContext.evaluator.MulRelinNew(term1, term2, testContext.rlkSet)
-			sigmoid = testContext.evaluator.AddNew(sigmoid, const9_ct)
+			// sigmoid = c3*x^3 + c1*x + c0
+			sigmoid, err := testContext.evaluator.EvaluatePoly(inner_prod, sigmoidPoly, testContext.rlkSet)
+			if err != nil {
+				panic(err)
+			}
 
 			// Decrypt
 			result := testContext.decryptor.Decrypt(sigmoid, testContext.skSet)
@@ -384,24 +355,14 @@ func main() {
 	fmt.Println("Inference...")
 	start = time.Now()
 	// Compute inner product
-	inner_prod := testContext.evaluator.MulRelinNew(test_ct, beta, testContext.rlkSet)
-
-	for i := 1; i < numFeature; i *= 2 {
-		inner_prod_rot := testContext.evaluator.RotateNew(inner_prod, i, testContext.rtkSet)
-		inner_prod = testContext.evaluator.AddNew(inner_prod, inner_prod_rot)
-	}
+	inner_prod := testContext.evaluator.InnerProductNew(test_ct, beta, numFeature, testContext.rlkSet, testContext.rtkSet)
 
 	// Compute sigmoid
-	// term1 = inner_prod * inner_prod + c1/c3
-	term1 := testContext.evaluator.MulRelinNew(inner_prod, inner_prod, testContext.rlkSet)
-	term1 = testContext.evaluator.AddNew(term1, const5_ct)
-
-	// term2 = c3 * inner_prod
-	term2 := testContext.evaluator.MulPtxtNew(inner_prod, const8_pt)
-
-	// sigmoid = term1 * term2 + c0
-	sigmoid := testContext.evaluator.MulRelinNew(term1, term2, testContext.rlkSet)
-	sigmoid = testContext.evaluator.AddNew(sigmoid, const9_ct)
+	// sigmoid = c3*x^3 + c1*x + c0
+	sigmoid, err := testContext.evaluator.EvaluatePoly(inner_prod, sigmoidPoly, testContext.rlkSet)
+	if err != nil {
+		panic(err)
+	}
 
 	end = time.Now()
 	elapsed = end.Sub(start)
@@ -425,40 +386,23 @@ func main() {
 ///////  Functions for logistic regression  /////////
 /////////////////////////////////////////////////////
 
-func SumRowVec(eval *mkckks.Evaluator, rtkSet *mkrlwe.RotationKeySet, ctIn *mkckks.Ciphertext, numRow, numCol int) (ctOut *mkckks.Ciphertext) {
-	ctOut = ctIn
-	for i := 1; i < numRow; i *= 2 {
-		ctOut_rot := eval.RotateNew(ctOut, numCol*i, rtkSet)
-		ctOut = eval.AddNew(ctOut, ctOut_rot)
-	}
-	return
-}
-
-func SumColVec(eval *mkckks.Evaluator, rlkSet *mkrlwe.RelinearizationKeySet, rtkSet *mkrlwe.RotationKeySet, ctIn *mkckks.Ciphertext, mask *ckks.Plaintext, numRow, numCol int) (ctOut *mkckks.Ciphertext) {
-	ctOut = ctIn
-	for i := 1; i < numCol; i *= 2 {
-		ctOut_rot := eval.RotateNew(ctOut, i, rtkSet)
-		ctOut = eval.AddNew(ctOut, ctOut_rot)
-	}
-	ctOut = eval.MulPtxtNew(ctOut, mask)
-
-	for i := 1; i < numCol; i *= 2 {
-		ctOut_rot := eval.RotateNew(ctOut, -i, rtkSet)
-		ctOut = eval.AddNew(ctOut, ctOut_rot)
-	}
-	return
-}
-
 func genTestParams(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet) (testContext *testParams, err error) {
 	testContext = new(testParams)
 
 	testContext.params = defaultParam
 
-	rots := []int{14, 15, 384, 512, 640, 768, 896, 8191, 8190, 8188, 8184}
+	// plan the rotation keys of the sums over numRow x numCol matrices and of the inference
+	numCol := int(math.Pow(2, math.Ceil(math.Log2(float64(numFeature)))))
+	numRow := testContext.params.Slots() / numCol
 
-	for _, rot := range rots {
-		testContext.params.AddCRS(rot)
-	}
+	planner := mkrlwe.NewRotationPlanner(testContext.params.Parameters)
+	planner.AddRotations(testContext.params.RotationsForSumColumns(numCol)...)
+	planner.AddRotations(testContext.params.RotationsForInnerSum(numCol, numRow)...)
+	planner.AddRotations(testContext.params.RotationsForInnerProduct(numFeature)...)
+	planner.AddRotations(btpParams.Rotations()...)
+
+	plan := planner.Plan(0)
+	plan.AddCRS(&testContext.params.Parameters)
 
 	testContext.kgen = mkckks.NewKeyGenerator(testContext.params)
 
@@ -466,24 +410,20 @@ func genTestParams(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet) (testCon
 	testContext.pkSet = mkrlwe.NewPublicKeyKeySet()
 	testContext.rlkSet = mkrlwe.NewRelinearizationKeyKeySet(defaultParam.Parameters)
 	testContext.rtkSet = mkrlwe.NewRotationKeySet()
+	testContext.cjkSet = mkrlwe.NewConjugationKeySet()
 
-	for i := 0; i < testContext.params.LogN()-1; i++ {
-		rots = append(rots, 1<<i)
-	}
-
+	// the bootstrapping needs secret keys of the Hamming weight of its parameters
 	for id := range idset.Value {
-		sk, pk := testContext.kgen.GenKeyPair(id)
+		sk, pk := testContext.kgen.GenKeyPairSparse(btpParams.H, id)
 		r := testContext.kgen.GenSecretKey(id)
 		rlk := testContext.kgen.GenRelinearizationKey(sk, r)
 
-		for _, rot := range rots {
-			rk := testContext.kgen.GenRotationKey(rot, sk)
-			testContext.rtkSet.AddRotationKey(rk)
-		}
+		testContext.kgen.GenRotationKeysFromPlan(plan, sk, testContext.rtkSet)
 
 		testContext.skSet.AddSecretKey(sk)
 		testContext.pkSet.AddPublicKey(pk)
 		testContext.rlkSet.AddRelinearizationKey(rlk)
+		testContext.cjkSet.AddConjugationKey(testContext.kgen.GenConjugationKey(sk))
 	}
 
 	testContext.ringQ = defaultParam.RingQ()
@@ -496,9 +436,35 @@ func genTestParams(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet) (testCon
 	testContext.decryptor = mkckks.NewDecryptor(testContext.params)
 	testContext.evaluator = mkckks.NewEvaluator(testContext.params)
 
+	if testContext.bootstrapper, err = mkckks.NewBootstrapper(testContext.params, btpParams); err != nil {
+		return nil, err
+	}
+
+	//the gradient adds products rescaled by different moduli, whose scales differ slightly
+	testContext.evaluator.SetScaleTolerance(1.0 / (1 << 12))
+
 	return testContext, nil
 }
 
+// bootstrap refreshes ct, whose slots repeat every 2^3 slots, to the levels left by the bootstrapping parameters
+func bootstrap(testContext *testParams, ct *mkckks.Ciphertext) *mkckks.Ciphertext {
+	ctOut, err := testContext.bootstrapper.Bootstrap(ct, testContext.rlkSet, testContext.rtkSet, testContext.cjkSet)
+	if err != nil {
+		panic(err)
+	}
+	return ctOut
+}
+
+// nesterovWeights returns the n weights of the accelerated gradient descent, starting from 1
+func nesterovWeights(n int) []float64 {
+	eta := make([]float64, n)
+	eta[0] = 1
+	for i := 1; i < n; i++ {
+		eta[i] = (1 + math.Sqrt(1+4*eta[i-1]*eta[i-1])) / 2
+	}
+	return eta
+}
+
 func readData(filename string) ([][]complex128, []complex128) {
 	feature_data := make([][]complex128, numData)
 	label_data := make([]complex128, numData)
@@ -240,13 +240,6 @@ func main() {
 		const4_pt[iter] = testContext.encryptor.EncodeMsgNew(const_msg)
 	}
 
-	// const5_ct = c1/c3
-	for i := 0; i < int(numSlots); i++ {
-		const_vector[i] = complex(c1/c3, 0)
-	}
-	const_msg.Value = const_vector
-	const5_ct := testContext.encryptor.EncryptMsgNew(const_msg, testContext.pkSet.GetPublicKey(id))
-
 	// const6_pt = (1 - eta)
 	const6_pt := make([]*ckks.Plaintext, numIter)
 	for iter := 0; iter < numIter; iter++ {
@@ -264,19 +257,8 @@ func main() {
 		const7_pt[iter] = testContext.encryptor.EncodeMsgNew(const_msg)
 	}
 
-	// const8_pt = c3
-	for i := 0; i < int(numSlots); i++ {
-		const_vector[i] = complex(c3, 0)
-	}
-	const_msg.Value = const_vector
-	const8_pt := testContext.encryptor.EncodeMsgNew(const_msg)
-
-	// const9_ct = c0
-	for i := 0; i < int(numSlots); i++ {
-		const_vector[i] = complex(c0, 0)
-	}
-	const_msg.Value = const_vector
-	const9_ct := testContext.encryptor.EncryptMsgNew(const_msg, testContext.pkSet.GetPublicKey(id))
+	// sigmoid approximation
+	sigmoidPoly := mkckks.NewPolynomial([]float64{c0, c1, 0, c3})
 
 	fmt.Println()
 	fmt.Println("Training...")
@@ -307,13 +289,13 @@ func main() {
 			z4 := testContext.evaluator.MulPtxtNew(z[batchId][ctId], const4_pt[a])
 
 			///////////////////////////// depth 2 //////////////////////////////////
-			// M = \sum_j SumColVec(M_j)
-			m = SumColVec(testContext.evaluator, testContext.rlkSet, testContext.rtkSet, m, mask, numDataPerCt, slotsPerData)
+			// M = \sum_j SumColumns(M_j)
+			m = testContext.evaluator.SumColumnsNew(m, mask, slotsPerData, testContext.rtkSet)
 
 			///////////////////////////// depth 3 //////////////////////////////////
 			// M'' = M * M + c1/c3
 			m2 := testContext.evaluator.MulRelinNew(m, m, testContext.rlkSet)
-			m2 = testContext.evaluator.AddNew(m2, const5_ct)
+			m2 = testContext.evaluator.AddConstNew(m2, c1/c3)
 
 			// M' = M * Z3_j
 			m1 := testContext.evaluator.MulRelinNew(m, z3, testContext.rlkSet)
@@ -333,16 +315,16 @@ func main() {
 			u_acc = testContext.evaluator.AddNew(u_acc, u)
 		}
 
-		g_acc = SumRowVec(testContext.evaluator, testContext.rtkSet, g_acc, numDataPerCt, slotsPerData)
+		g_acc = testContext.evaluator.SumRowsNew(g_acc, nil, numDataPerCt, slotsPerData, testContext.rtkSet)
 
 		beta_update := testContext.evaluator.AddNew(v, g_acc)
 
-		// V+_j = eta * W_j + (1 - eta) * V_j + SumRowVec(U_j)
+		// V+_j = eta * W_j + (1 - eta) * V_j + SumRows(U_j)
 		v_update := testContext.evaluator.MulPtxtNew(v, const6_pt[a])
 		beta1 := testContext.evaluator.MulPtxtNew(beta, const7_pt[a])
 		v_update = testContext.evaluator.AddNew(v_update, beta1)
 
-		u_acc = SumRowVec(testContext.evaluator, testContext.rtkSet, u_acc, numDataPerCt, slotsPerData)
+		u_acc = testContext.evaluator.SumRowsNew(u_acc, nil, numDataPerCt, slotsPerData, testContext.rtkSet)
 		v_update = testContext.evaluator.AddNew(v_update, u_acc)
 
 		v = v_update
@@ -379,24 +361,14 @@ func main() {
 			test_ct := testContext.encryptor.EncryptMsgNewExpand(test_msg, testContext.pkSet.GetPublicKey(id), idset)
 
 			// Compute inner product
-			inner_prod := testContext.evaluator.MulRelinNew(test_ct, beta, testContext.rlkSet)
-
-			for i := 1; i < numFeature; i *= 2 {
-				inner_prod_rot := testContext.evaluator.RotateNew(inner_prod, i, testContext.rtkSet)
-				inner_prod = testContext.evaluator.AddNew(inner_prod, inner_prod_rot)
-			}
+			inner_prod := testContext.evaluator.InnerProductNew(test_ct, beta, numFeature, testContext.rlkSet, testContext.rtkSet)
 
 			// Compute sigmoid
-			// term1 = inner_prod * inner_prod + c1/c3
-			term1 := testContext.evaluator.MulRelinNew(inner_prod, inner_prod, testContext.rlkSet)
-			term1 = testContext.evaluator.AddNew(term1, const5_ct)
-
-			// term2 = c3 * inner_prod
-			term2 := testContext.evaluator.MulPtxtNew(inner_prod, const8_pt)
-
-			// sigmoid = term1 * term2 + c0
-			sigmoid := testContext.evaluator.MulRelinNew(term1, term2, testContext.rlkSet)
-			sigmoid = testContext.evaluator.AddNew(sigmoid, const9_ct)
+			// sigmoid = c3*x^3 + c1*x + c0
+			sigmoid, err := testContext.evaluator.EvaluatePoly(inner_prod, sigmoidPoly, testContext.rlkSet)
+			if err != nil {
+				panic(err)
+			}
 
 			// Decrypt
 			result := testContext.decryptor.Decrypt(sigmoid, testContext.skSet)
@@ -427,24 +399,14 @@ func main() {
 	fmt.Println("Inference...")
 	start = time.Now()
 	// Compute inner product
-	inner_prod := testContext.evaluator.MulRelinNew(test_ct, beta, testContext.rlkSet)
-
-	for i := 1; i < numFeature; i *= 2 {
-		inner_prod_rot := testContext.evaluator.RotateNew(inner_prod, i, testContext.rtkSet)
-		inner_prod = testContext.evaluator.AddNew(inner_prod, inner_prod_rot)
-	}
+	inner_prod := testContext.evaluator.InnerProductNew(test_ct, beta, numFeature, testContext.rlkSet, testContext.rtkSet)
 
 	// Compute sigmoid
-	// term1 = inner_prod * inner_prod + c1/c3
-	term1 := testContext.evaluator.MulRelinNew(inner_prod, inner_prod, testContext.rlkSet)
-	term1 = testContext.evaluator.AddNew(term1, const5_ct)
-
-	// term2 = c3 * inner_prod
-	term2 := testContext.evaluator.MulPtxtNew(inner_prod, const8_pt)
-
-	// sigmoid = term1 * term2 + c0
-	sigmoid := testContext.evaluator.MulRelinNew(term1, term2, testContext.rlkSet)
-	sigmoid = testContext.evaluator.AddNew(sigmoid, const9_ct)
+	// sigmoid = c3*x^3 + c1*x + c0
+	sigmoid, err := testContext.evaluator.EvaluatePoly(inner_prod, sigmoidPoly, testContext.rlkSet)
+	if err != nil {
+		panic(err)
+	}
 
 	end = time.Now()
 	elapsed = end.Sub(start)
@@ -464,40 +426,22 @@ func main() {
 	return
 }
 
-func SumRowVec(eval *mkckks.Evaluator, rtkSet *mkrlwe.RotationKeySet, ctIn *mkckks.Ciphertext, numRow, numCol int) (ctOut *mkckks.Ciphertext) {
-	ctOut = ctIn
-	for i := 1; i < numRow; i *= 2 {
-		ctOut_rot := eval.RotateNew(ctOut, numCol*i, rtkSet)
-		ctOut = eval.AddNew(ctOut, ctOut_rot)
-	}
-	return
-}
-
-func SumColVec(eval *mkckks.Evaluator, rlkSet *mkrlwe.RelinearizationKeySet, rtkSet *mkrlwe.RotationKeySet, ctIn *mkckks.Ciphertext, mask *ckks.Plaintext, numRow, numCol int) (ctOut *mkckks.Ciphertext) {
-	ctOut = ctIn
-	for i := 1; i < numCol; i *= 2 {
-		ctOut_rot := eval.RotateNew(ctOut, i, rtkSet)
-		ctOut = eval.AddNew(ctOut, ctOut_rot)
-	}
-	ctOut = eval.MulPtxtNew(ctOut, mask)
-
-	for i := 1; i < numCol; i *= 2 {
-		ctOut_rot := eval.RotateNew(ctOut, -i, rtkSet)
-		ctOut = eval.AddNew(ctOut, ctOut_rot)
-	}
-	return
-}
-
 func genTestParams(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet) (testContext *testParams, err error) {
 	testContext = new(testParams)
 
 	testContext.params = defaultParam
 
-	rots := []int{14, 15, 384, 512, 640, 768, 896, 8191, 8190, 8188, 8184}
+	// plan the rotation keys of the sums over numRow x numCol matrices and of the inference
+	numCol := int(math.Pow(2, math.Ceil(math.Log2(float64(numFeature)))))
+	numRow := testContext.params.Slots() / numCol
 
-	for _, rot := range rots {
-		testContext.params.AddCRS(rot)
-	}
+	planner := mkrlwe.NewRotationPlanner(testContext.params.Parameters)
+	planner.AddRotations(testContext.params.RotationsForSumColumns(numCol)...)
+	planner.AddRotations(testContext.params.RotationsForInnerSum(numCol, numRow)...)
+	planner.AddRotations(testContext.params.RotationsForInnerProduct(numFeature)...)
+
+	plan := planner.Plan(0)
+	plan.AddCRS(&testContext.params.Parameters)
 
 	testContext.kgen = mkckks.NewKeyGenerator(testContext.params)
 
@@ -506,19 +450,12 @@ func genTestParams(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet) (testCon
 	testContext.rlkSet = mkrlwe.NewRelinearizationKeyKeySet(defaultParam.Parameters)
 	testContext.rtkSet = mkrlwe.NewRotationKeySet()
 
-	for i := 0; i < testContext.params.LogN()-1; i++ {
-		rots = append(rots, 1<<i)
-	}
-
 	for id := range idset.Value {
 		sk, pk := testContext.kgen.GenKeyPair(id)
 		r := testContext.kgen.GenSecretKey(id)
 		rlk := testContext.kgen.GenRelinearizationKey(sk, r)
 
-		for _, rot := range rots {
-			rk := testContext.kgen.GenRotationKey(rot, sk)
-			testContext.rtkSet.AddRotationKey(rk)
-		}
+		testContext.kgen.GenRotationKeysFromPlan(plan, sk, testContext.rtkSet)
 
 		testContext.skSet.AddSecretKey(sk)
 		testContext.pkSet.AddPublicKey(pk)
@@ -535,6 +472,9 @@ func genTestParams(defaultParam mkckks.Parameters, idset *mkrlwe.IDSet) (testCon
 	testContext.decryptor = mkckks.NewDecryptor(testContext.params)
 	testContext.evaluator = mkckks.NewEvaluator(testContext.params)
 
+	//the gradient adds products rescaled by different moduli, whose scales differ slightly
+	testContext.evaluator.SetScaleTolerance(1.0 / (1 << 12))
+
 	return testContext, nil
 }
 
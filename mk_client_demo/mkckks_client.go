@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"math"
@@ -82,7 +83,9 @@ func decryptTest(clientName string) {
 	if err != nil {
 		panic(err)
 	}
-	params.UnmarshalBinary(paramsBytes)
+	if err = params.UnmarshalBinary(paramsBytes); err != nil {
+		panic(err)
+	}
 
 	var sk mkrlwe.SecretKey
 
@@ -91,27 +94,33 @@ func decryptTest(clientName string) {
 		panic(err)
 	}
 
-	sk.UnmarshalBinary(skBytes)
+	if err = sk.UnmarshalBinary(skBytes); err != nil {
+		panic(err)
+	}
 
 	var skSet mkrlwe.SecretKeySet
 	skSet.Value = make(map[string]*mkrlwe.SecretKey)
 
 	skSet.Value[clientName] = &sk
 
-	var ciphertexts mkckks.Ciphertext
+	var seeded mkckks.SeededCiphertext
 
 	cipherBytes, err := os.ReadFile(cipherDataFile)
 	if err != nil {
 		panic(err)
 	}
 
-	ciphertexts.UnmarshalBinary(cipherBytes)
+	if err = seeded.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
+
+	ciphertexts := seeded.Expand(params)
 
 	decryptor := mkckks.NewDecryptor(params)
 
-	msgOut := decryptor.Decrypt(&ciphertexts, &skSet)
+	msgOut := decryptor.Decrypt(ciphertexts, &skSet)
 
-	printDebug(&ciphertexts, msgOut.Value)
+	printDebug(ciphertexts, msgOut.Value)
 
 }
 
@@ -121,10 +130,8 @@ func mkgenerate(clientName string) {
 	sampleNum := 5
 
 	paramsFile := "ckks_params.dat"
-	pubFile := clientName + "_ckks_pubkey.dat"
 	secFile := clientName + "_ckks_seckey.dat"
-	rlkFile := clientName + "_ckks_rlkey.dat"
-	rtkFile := clientName + "_ckks_rtkey.dat"
+	evkFile := clientName + "_ckks_evkbundle.dat"
 
 	// This example packs random 8192 float64 values in the range [-8, 8]
 	// and approximates the function 1/(exp(-x) + 1) over the range [-8, 8].
@@ -138,7 +145,9 @@ func mkgenerate(clientName string) {
 		if err != nil {
 			panic(err)
 		}
-		params.UnmarshalBinary(paramsBytes)
+		if err = params.UnmarshalBinary(paramsBytes); err != nil {
+			panic(err)
+		}
 	} else {
 
 		ckksParams, err := ckks.NewParametersFromLiteral(PN15QP880)
@@ -162,29 +171,16 @@ func mkgenerate(clientName string) {
 
 	// Keys
 	kgen := mkckks.NewKeyGenerator(params)
-	sk, pk := kgen.GenKeyPair(clientName)
-
-	//辅助密钥，用于多密钥同态乘法中的再线性化
-	r := kgen.GenSecretKey(clientName)
-
-	// Relinearization key
-	rlk := kgen.GenRelinearizationKey(sk, r)
-
-	//生成旋转密钥
-	rtkSet := mkrlwe.NewRotationKeySet()
-
-	kgen.GenDefaultRotationKeys(sk, rtkSet)
+	sk := kgen.GenSecretKey(clientName)
 
-	//serialize pub key
-	pubBytes, err := pk.MarshalBinary()
-	if err != nil {
-		panic(err)
+	//生成公钥、再线性化密钥、共轭密钥和旋转密钥，并打包为一个评估密钥包
+	rotidxs := make([]int, 0)
+	for rotidx := 1; rotidx < params.N()/2; rotidx *= 2 {
+		rotidxs = append(rotidxs, rotidx)
 	}
 
-	err = os.WriteFile(pubFile, pubBytes, 0640)
-	if err != nil {
-		panic(err)
-	}
+	bundle := kgen.GenEvaluationKeyBundle(sk, rotidxs)
+	pk := bundle.PublicKey
 
 	//serialize sec key
 	secBytes, err := sk.MarshalBinary()
@@ -197,25 +193,22 @@ func mkgenerate(clientName string) {
 		panic(err)
 	}
 
-	//serialize rlk key
-	rlkBytes, err := rlk.MarshalBinary()
+	//serialize evaluation key bundle, one key at a time
+	evkOut, err := os.OpenFile(evkFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
 	if err != nil {
 		panic(err)
 	}
 
-	err = os.WriteFile(rlkFile, rlkBytes, 0640)
-	if err != nil {
+	evkWriter := bufio.NewWriter(evkOut)
+	if _, err = bundle.WriteTo(evkWriter); err != nil {
 		panic(err)
 	}
 
-	//serialize rotation keyset
-	rtkBytes, err := rtkSet.MarshalBinary()
-	if err != nil {
+	if err = evkWriter.Flush(); err != nil {
 		panic(err)
 	}
 
-	err = os.WriteFile(rtkFile, rtkBytes, 0640)
-	if err != nil {
+	if err = evkOut.Close(); err != nil {
 		panic(err)
 	}
 
@@ -233,7 +226,8 @@ func mkgenerate(clientName string) {
 
 	encryptor := mkckks.NewEncryptor(params)
 
-	ciphertexts := encryptor.EncryptMsgNew(msg, pk)
+	//the client encrypts its own data with its secret key, so that the uniform component is replaced by a seed
+	ciphertexts := encryptor.EncryptMsgSeededNew(msg, sk)
 
 	cipherDataFile := clientName + "_ckks_cipher_data.dat"
 
@@ -242,6 +236,13 @@ func mkgenerate(clientName string) {
 		panic(err)
 	}
 
+	fullBytes, err := encryptor.EncryptMsgNew(msg, pk).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("uploaded ciphertext: %d bytes (%d bytes without seed)\n", len(cipherBytes), len(fullBytes))
+
 	err = os.WriteFile(cipherDataFile, cipherBytes, 0640)
 	if err != nil {
 		panic(err)
@@ -60,7 +60,9 @@ func showClientData(client string) {
 	if err != nil {
 		panic(err)
 	}
-	params.UnmarshalBinary(paramsBytes)
+	if err = params.UnmarshalBinary(paramsBytes); err != nil {
+		panic(err)
+	}
 
 	var sk mkrlwe.SecretKey
 
@@ -69,30 +71,36 @@ func showClientData(client string) {
 		panic(err)
 	}
 
-	sk.UnmarshalBinary(skBytes)
+	if err = sk.UnmarshalBinary(skBytes); err != nil {
+		panic(err)
+	}
 
 	var skSet mkrlwe.SecretKeySet
 	skSet.Value = make(map[string]*mkrlwe.SecretKey)
 
 	skSet.Value[client] = &sk
 
-	var ciphertexts mkckks.Ciphertext
+	var seeded mkckks.SeededCiphertext
 
 	cipherBytes, err := os.ReadFile(cipherDataFile)
 	if err != nil {
 		panic(err)
 	}
 
-	ciphertexts.UnmarshalBinary(cipherBytes)
+	if err = seeded.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
+
+	ciphertexts := seeded.Expand(params)
 
 	decryptor := mkckks.NewDecryptor(params)
 
-	msgOut := decryptor.Decrypt(&ciphertexts, &skSet)
+	msgOut := decryptor.Decrypt(ciphertexts, &skSet)
 
 	fmt.Printf("%s decrypted data:", client)
 	fmt.Println()
 
-	printDebug(&ciphertexts, msgOut.Value)
+	printDebug(ciphertexts, msgOut.Value)
 
 }
 
@@ -168,7 +176,9 @@ func eval(client_1 string, client_2 string) {
 	if err != nil {
 		panic(err)
 	}
-	params.UnmarshalBinary(paramsBytes)
+	if err = params.UnmarshalBinary(paramsBytes); err != nil {
+		panic(err)
+	}
 
 	//读取双方私钥并构建联合私钥用于解密
 	var sk1 mkrlwe.SecretKey
@@ -179,14 +189,18 @@ func eval(client_1 string, client_2 string) {
 		panic(err)
 	}
 
-	sk1.UnmarshalBinary(skBytes)
+	if err = sk1.UnmarshalBinary(skBytes); err != nil {
+		panic(err)
+	}
 
 	skBytes, err = os.ReadFile(skFile_2)
 	if err != nil {
 		panic(err)
 	}
 
-	sk2.UnmarshalBinary(skBytes)
+	if err = sk2.UnmarshalBinary(skBytes); err != nil {
+		panic(err)
+	}
 
 	var skSet mkrlwe.SecretKeySet
 	skSet.Value = make(map[string]*mkrlwe.SecretKey)
@@ -207,42 +221,54 @@ func eval(client_1 string, client_2 string) {
 		panic(err)
 	}
 
-	ctSum.UnmarshalBinary(cipherBytes)
+	if err = ctSum.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
 
 	cipherBytes, err = os.ReadFile(cryptSubFile)
 	if err != nil {
 		panic(err)
 	}
 
-	ctSub.UnmarshalBinary(cipherBytes)
+	if err = ctSub.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
 
 	cipherBytes, err = os.ReadFile(cryptMulFile)
 	if err != nil {
 		panic(err)
 	}
 
-	ctMul.UnmarshalBinary(cipherBytes)
+	if err = ctMul.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
 
 	cipherBytes, err = os.ReadFile(cryptAllSumFile)
 	if err != nil {
 		panic(err)
 	}
 
-	ctAllSum.UnmarshalBinary(cipherBytes)
+	if err = ctAllSum.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
 
 	cipherBytes, err = os.ReadFile(cryptAllMulFile)
 	if err != nil {
 		panic(err)
 	}
 
-	ctAllMul.UnmarshalBinary(cipherBytes)
+	if err = ctAllMul.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
 
 	cipherBytes, err = os.ReadFile(cryptRotateFile)
 	if err != nil {
 		panic(err)
 	}
 
-	ctRot.UnmarshalBinary(cipherBytes)
+	if err = ctRot.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
 
 	decryptor := mkckks.NewDecryptor(params)
 
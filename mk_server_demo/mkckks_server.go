@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"mk-lr/mkckks"
@@ -24,14 +25,10 @@ var dataPath string = "/data/workspace/go_projects/share2gain/mk_client_demo"
 func calulation(client_1 string, client_2 string) {
 	paramsFile := path.Join(dataPath, "ckks_params.dat")
 
-	pubFile_1 := path.Join(dataPath, client_1+"_ckks_pubkey.dat")
-	rlkFile_1 := path.Join(dataPath, client_1+"_ckks_rlkey.dat")
-	rtkFile_1 := path.Join(dataPath, client_1+"_ckks_rtkey.dat")
+	evkFile_1 := path.Join(dataPath, client_1+"_ckks_evkbundle.dat")
 	cryptDataFile_1 := path.Join(dataPath, client_1+"_ckks_cipher_data.dat")
 
-	pubFile_2 := path.Join(dataPath, client_2+"_ckks_pubkey.dat")
-	rlkFile_2 := path.Join(dataPath, client_2+"_ckks_rlkey.dat")
-	rtkFile_2 := path.Join(dataPath, client_2+"_ckks_rtkey.dat")
+	evkFile_2 := path.Join(dataPath, client_2+"_ckks_evkbundle.dat")
 	cryptDataFile_2 := path.Join(dataPath, client_2+"_ckks_cipher_data.dat")
 
 	if !fileExists(paramsFile) {
@@ -39,18 +36,8 @@ func calulation(client_1 string, client_2 string) {
 		return
 	}
 
-	if !fileExists(pubFile_1) {
-		fmt.Printf("%s does not exist", pubFile_1)
-		return
-	}
-
-	if !fileExists(rlkFile_1) {
-		fmt.Printf("%s does not exist", rlkFile_1)
-		return
-	}
-
-	if !fileExists(rtkFile_1) {
-		fmt.Printf("%s does not exist", rtkFile_1)
+	if !fileExists(evkFile_1) {
+		fmt.Printf("%s does not exist", evkFile_1)
 		return
 	}
 
@@ -59,18 +46,8 @@ func calulation(client_1 string, client_2 string) {
 		return
 	}
 
-	if !fileExists(pubFile_2) {
-		fmt.Printf("%s does not exist", pubFile_1)
-		return
-	}
-
-	if !fileExists(rlkFile_2) {
-		fmt.Printf("%s does not exist", rlkFile_1)
-		return
-	}
-
-	if !fileExists(rtkFile_2) {
-		fmt.Printf("%s does not exist", rtkFile_2)
+	if !fileExists(evkFile_2) {
+		fmt.Printf("%s does not exist", evkFile_2)
 		return
 	}
 
@@ -85,80 +62,70 @@ func calulation(client_1 string, client_2 string) {
 	if err != nil {
 		panic(err)
 	}
-	params.UnmarshalBinary(paramsBytes)
-
-	//读取并反序列化双方的再线性化参数
-	var rlkBytes []byte
-	var rlk_1 mkrlwe.RelinearizationKey
-	var rlk_2 mkrlwe.RelinearizationKey
-
-	rlkBytes, err = os.ReadFile(rlkFile_1)
-	if err != nil {
-		panic(err)
-	}
-	rlk_1.UnmarshalBinary(rlkBytes)
-
-	rlkBytes, err = os.ReadFile(rlkFile_2)
-	if err != nil {
+	if err = params.UnmarshalBinary(paramsBytes); err != nil {
 		panic(err)
 	}
-	rlk_2.UnmarshalBinary(rlkBytes)
 
-	//使用双方的再线性化密钥构建一个联合再线性密钥集
-	rlkSet := mkrlwe.NewRelinearizationKeyKeySet(params.Parameters)
-	rlkSet.AddRelinearizationKey(&rlk_1)
-	rlkSet.AddRelinearizationKey(&rlk_2)
+	//读取并反序列化双方的评估密钥包，合并为联合密钥集
+	evkSet := mkrlwe.NewEvaluationKeySet(params.Parameters)
 
-	//读取并反序列化双方的旋转密钥
-	var rtkBytes []byte
-	var rtkset_1 mkrlwe.RotationKeySet
-	var rtkset_2 mkrlwe.RotationKeySet
+	for _, evkFile := range []string{evkFile_1, evkFile_2} {
+		evkIn, err := os.Open(evkFile)
+		if err != nil {
+			panic(err)
+		}
 
-	rtkBytes, err = os.ReadFile(rtkFile_1)
-	if err != nil {
-		panic(err)
-	}
-	rtkset_1.UnmarshalBinary(rtkBytes)
+		bundle := new(mkrlwe.EvaluationKeyBundle)
+		if _, err = bundle.ReadFrom(bufio.NewReader(evkIn)); err != nil {
+			panic(err)
+		}
+		evkIn.Close()
 
-	rtkBytes, err = os.ReadFile(rtkFile_2)
-	if err != nil {
-		panic(err)
+		if err = evkSet.AddBundle(bundle); err != nil {
+			panic(err)
+		}
 	}
-	rtkset_2.UnmarshalBinary(rtkBytes)
 
-	rtkSet := mkrlwe.NewRotationKeySet()
-	rtkSet.Value[client_1] = rtkset_1.Value[client_1]
-	rtkSet.Value[client_2] = rtkset_2.Value[client_2]
+	rlkSet := evkSet.RelinearizationKeySet
+	rtkSet := evkSet.RotationKeySet
 
 	//使用公共参数构建评估器
 	evaluator := mkckks.NewEvaluator(params)
 
 	//读取并反序列化双方的密文
-	var ct1 mkckks.Ciphertext
-	var ct2 mkckks.Ciphertext
+	//双方上传的是带种子的密文，先展开其均匀分量
+	var sct1 mkckks.SeededCiphertext
+	var sct2 mkckks.SeededCiphertext
 
 	cipherBytes, err := os.ReadFile(cryptDataFile_1)
 	if err != nil {
 		panic(err)
 	}
 
-	ct1.UnmarshalBinary(cipherBytes)
+	if err = sct1.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
 
 	cipherBytes, err = os.ReadFile(cryptDataFile_2)
 	if err != nil {
 		panic(err)
 	}
 
-	ct2.UnmarshalBinary(cipherBytes)
+	if err = sct2.UnmarshalBinary(cipherBytes); err != nil {
+		panic(err)
+	}
+
+	ct1 := sct1.Expand(params)
+	ct2 := sct2.Expand(params)
 
 	//对双方密文数组求和，对应位置上密文相加
-	ctAdd := evaluator.AddNew(&ct1, &ct2)
+	ctAdd := evaluator.AddNew(ct1, ct2)
 
 	//对双方密文数组求差，对应位置相加密文相减
-	ctSub := evaluator.SubNew(&ct1, &ct2)
+	ctSub := evaluator.SubNew(ct1, ct2)
 
 	//对双方密文数组求积，对应位置相加密文相乘
-	ctMul := evaluator.MulRelinNew(&ct1, &ct2, rlkSet)
+	ctMul := evaluator.MulRelinNew(ct1, ct2, rlkSet)
 
 	fmt.Print("Start to add and multiply all data")
 
@@ -0,0 +1,85 @@
+package mkbfv
+
+import "github.com/ldsec/lattigo/v2/bfv"
+import "mk-lr/mkrlwe"
+
+type Decryptor struct {
+	*mkrlwe.Decryptor
+	encoder  *Encoder
+	params   Parameters
+	ptxtPool *bfv.Plaintext
+}
+
+// NewDecryptor instantiates a Decryptor for the BFV scheme.
+func NewDecryptor(params Parameters) *Decryptor {
+	ret := new(Decryptor)
+	ret.Decryptor = mkrlwe.NewDecryptor(params.Parameters)
+	ret.encoder = NewEncoder(params)
+	ret.params = params
+	ret.ptxtPool = bfv.NewPlaintext(params.BFVParameters())
+	return ret
+}
+
+// PartialDecrypt partially decrypts the ct with single secretkey sk and update result inplace
+func (dec *Decryptor) PartialDecrypt(ct *Ciphertext, sk *mkrlwe.SecretKey) {
+	dec.Decryptor.PartialDecrypt(ct.Ciphertext, sk)
+}
+
+// GenDecryptionShare computes the decryption share of ct for the owner of sk.
+// No secret key leaves its owner, only the share is sent to the combiner.
+func (dec *Decryptor) GenDecryptionShare(ct *Ciphertext, sk *mkrlwe.SecretKey) (share *mkrlwe.DecryptionShare) {
+	return dec.Decryptor.GenDecryptionShare(ct.Ciphertext, sk)
+}
+
+// MergeDecryptionShares combines the decryption shares of every party engaged in ciphertext and decodes the result.
+// It returns an error if the shares do not match the ciphertext.
+func (dec *Decryptor) MergeDecryptionShares(ciphertext *Ciphertext, shares []*mkrlwe.DecryptionShare) (msg *Message, err error) {
+	if err = dec.Decryptor.MergeDecryptionShares(ciphertext.Ciphertext, shares, dec.ptxtPool.Plaintext); err != nil {
+		return nil, err
+	}
+
+	return dec.encoder.DecodeMsgNew(dec.ptxtPool), nil
+}
+
+// GenReencryptionShare computes the share of the owner of sk re-encrypting ct under the public key pk of a recipient.
+// Neither the secret key nor the plaintext is revealed, only the share is sent to the combiner.
+func (dec *Decryptor) GenReencryptionShare(ct *Ciphertext, sk *mkrlwe.SecretKey, pk *mkrlwe.PublicKey) (share *mkrlwe.ReencryptionShare) {
+	return dec.Decryptor.GenReencryptionShare(ct.Ciphertext, sk, pk)
+}
+
+// MergeReencryptionShares combines the re-encryption shares of every party engaged in ciphertext into a ciphertext
+// under the public key of the recipient only, who can then decrypt it alone.
+// It returns an error if the shares do not match the ciphertext.
+func (dec *Decryptor) MergeReencryptionShares(ciphertext *Ciphertext, shares []*mkrlwe.ReencryptionShare) (ctOut *Ciphertext, err error) {
+	ctOut = new(Ciphertext)
+	if ctOut.Ciphertext, err = dec.Decryptor.MergeReencryptionShares(ciphertext.Ciphertext, shares); err != nil {
+		return nil, err
+	}
+
+	return ctOut, nil
+}
+
+// ConvertToCollective combines the re-encryption shares towards cpk of the parties of the group engaged in ciphertext
+// into a ciphertext in which their components are replaced by a single component of the group.
+// It returns an error if the shares do not match the ciphertext or the group.
+func (dec *Decryptor) ConvertToCollective(ciphertext *Ciphertext, cpk *mkrlwe.CollectivePublicKey, shares []*mkrlwe.ReencryptionShare) (ctOut *Ciphertext, err error) {
+	ctOut = new(Ciphertext)
+	if ctOut.Ciphertext, err = dec.Decryptor.ConvertToCollective(ciphertext.Ciphertext, cpk, shares); err != nil {
+		return nil, err
+	}
+
+	return ctOut, nil
+}
+
+// GenCollectiveDecryptionShare computes the share of the owner of sk, a party of the group of cpk, for the decryption
+// of the component of the group in ct. The shares of the group are added with cpk.AggregateDecryptionShares.
+func (dec *Decryptor) GenCollectiveDecryptionShare(ct *Ciphertext, sk *mkrlwe.SecretKey, cpk *mkrlwe.CollectivePublicKey) (share *mkrlwe.DecryptionShare) {
+	return dec.Decryptor.GenCollectiveDecryptionShare(ct.Ciphertext, sk, cpk)
+}
+
+// Decrypt decrypts the ciphertext with given secretkey set and returns the decoded message.
+func (dec *Decryptor) Decrypt(ciphertext *Ciphertext, skSet *mkrlwe.SecretKeySet) (msg *Message) {
+	dec.Decryptor.Decrypt(ciphertext.Ciphertext, skSet, dec.ptxtPool.Plaintext)
+
+	return dec.encoder.DecodeMsgNew(dec.ptxtPool)
+}
@@ -0,0 +1,44 @@
+package mkbfv
+
+import "mk-lr/mkrlwe"
+
+// Ciphertext is a multi-key BFV ciphertext. Its components are out of the NTT domain.
+type Ciphertext struct {
+	*mkrlwe.Ciphertext
+}
+
+// NewCiphertext returns a new Element with zero values
+func NewCiphertext(params Parameters, idset *mkrlwe.IDSet) *Ciphertext {
+	el := new(Ciphertext)
+	el.Ciphertext = mkrlwe.NewCiphertext(params.Parameters, idset, params.MaxLevel())
+
+	return el
+}
+
+// CopyNew makes a deep copy of the receiver ciphertext and returns it.
+func (ct *Ciphertext) CopyNew() (ctc *Ciphertext) {
+	ctc = &Ciphertext{Ciphertext: ct.Ciphertext.CopyNew()}
+	return
+}
+
+// Degree returns the number of parties engaged in the ciphertext
+func (ct *Ciphertext) Degree() int {
+	return len(ct.Value) - 1
+}
+
+// Message is a vector of integers modulo the plaintext modulus T
+type Message struct {
+	Value []uint64
+}
+
+func NewMessage(params Parameters) *Message {
+
+	msg := new(Message)
+	msg.Value = make([]uint64, params.Slots())
+
+	return msg
+}
+
+func (msg *Message) Slots() int {
+	return len(msg.Value)
+}
@@ -0,0 +1,39 @@
+package mkbfv
+
+import "github.com/ldsec/lattigo/v2/bfv"
+
+// Encoder encodes Messages of integers modulo T on BFV plaintexts and decodes them back.
+// A Message has N slots arranged in two rows of N/2 slots.
+type Encoder struct {
+	encoder bfv.Encoder
+	params  Parameters
+}
+
+// NewEncoder instantiates an Encoder for the BFV scheme.
+func NewEncoder(params Parameters) *Encoder {
+	return &Encoder{encoder: bfv.NewEncoder(params.BFVParameters()), params: params}
+}
+
+// EncodeMsg encodes msg on pt, scaled up by Q/T.
+func (ecd *Encoder) EncodeMsg(msg *Message, pt *bfv.Plaintext) {
+	ecd.encoder.EncodeUint(msg.Value, pt)
+}
+
+// EncodeMsgNew encodes msg on a new plaintext scaled up by Q/T.
+func (ecd *Encoder) EncodeMsgNew(msg *Message) (pt *bfv.Plaintext) {
+	pt = bfv.NewPlaintext(ecd.params.BFVParameters())
+	ecd.EncodeMsg(msg, pt)
+	return
+}
+
+// DecodeMsg scales pt down by T/Q and decodes it in msg.
+func (ecd *Encoder) DecodeMsg(pt *bfv.Plaintext, msg *Message) {
+	ecd.encoder.DecodeUint(pt, msg.Value)
+}
+
+// DecodeMsgNew scales pt down by T/Q and decodes it in a new Message.
+func (ecd *Encoder) DecodeMsgNew(pt *bfv.Plaintext) (msg *Message) {
+	msg = NewMessage(ecd.params)
+	ecd.DecodeMsg(pt, msg)
+	return
+}
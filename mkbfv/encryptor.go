@@ -0,0 +1,44 @@
+package mkbfv
+
+import "github.com/ldsec/lattigo/v2/bfv"
+import "mk-lr/mkrlwe"
+
+type Encryptor struct {
+	*mkrlwe.Encryptor
+	encoder  *Encoder
+	params   Parameters
+	ptxtPool *bfv.Plaintext
+}
+
+// NewEncryptor instatiates a new Encryptor for the BFV scheme.
+func NewEncryptor(params Parameters) *Encryptor {
+	ret := new(Encryptor)
+	ret.Encryptor = mkrlwe.NewEncryptor(params.Parameters)
+	ret.encoder = NewEncoder(params)
+	ret.params = params
+	ret.ptxtPool = bfv.NewPlaintext(params.BFVParameters())
+	return ret
+}
+
+// EncryptPtxt encrypts the input plaintext with pk and write the result on ctOut.
+func (enc *Encryptor) EncryptPtxt(plaintext *bfv.Plaintext, pk *mkrlwe.PublicKey, ctOut *Ciphertext) {
+	enc.Encryptor.Encrypt(plaintext.Plaintext, pk, ctOut.Ciphertext)
+}
+
+// EncryptMsg encodes message and then encrypts it with pk and write the result on ctOut.
+// The values of msg should be in [0, T).
+func (enc *Encryptor) EncryptMsg(msg *Message, pk *mkrlwe.PublicKey, ctOut *Ciphertext) {
+	enc.encoder.EncodeMsg(msg, enc.ptxtPool)
+	enc.EncryptPtxt(enc.ptxtPool, pk, ctOut)
+}
+
+// EncryptMsgNew encodes message and then encrypts it with pk in a newly created ciphertext.
+// The values of msg should be in [0, T).
+func (enc *Encryptor) EncryptMsgNew(msg *Message, pk *mkrlwe.PublicKey) (ctOut *Ciphertext) {
+	idset := mkrlwe.NewIDSet()
+	idset.Add(pk.ID)
+	ctOut = NewCiphertext(enc.params, idset)
+	enc.EncryptMsg(msg, pk, ctOut)
+
+	return
+}
@@ -0,0 +1,306 @@
+package mkbfv
+
+import "math/big"
+
+import "mk-lr/mkrlwe"
+
+import "github.com/ldsec/lattigo/v2/ring"
+
+type Evaluator struct {
+	params            Parameters
+	ksw               *mkrlwe.KeySwitcher
+	ringQ             *ring.Ring
+	ringQMul          *ring.Ring
+	baseconverterQ1Q2 *ring.FastBasisExtender
+	pHalf             *big.Int
+
+	operandPoolQ    [2]*mkrlwe.Ciphertext
+	operandPoolQMul [2]*mkrlwe.Ciphertext
+	tensorPoolQ     map[[2]string]*ring.Poly
+	tensorPoolQMul  map[[2]string]*ring.Poly
+}
+
+// NewEvaluator creates a new Evaluator, that can be used to do homomorphic
+// operations on the Ciphertexts. It stores the buffers of the tensor products,
+// which grow with the IDs of the operands.
+func NewEvaluator(params Parameters) *Evaluator {
+	eval := new(Evaluator)
+	eval.params = params
+	eval.ksw = mkrlwe.NewKeySwitcher(params.Parameters)
+
+	eval.ringQ = params.RingQ()
+	eval.ringQMul = params.RingQMul()
+	eval.baseconverterQ1Q2 = ring.NewFastBasisExtender(eval.ringQ, eval.ringQMul)
+	eval.pHalf = new(big.Int).Rsh(eval.ringQMul.ModulusBigint, 1)
+
+	eval.allocatePools()
+
+	return eval
+}
+
+// allocatePools allocates the memory pools of the Evaluator
+func (eval *Evaluator) allocatePools() {
+	for i := range eval.operandPoolQ {
+		eval.operandPoolQ[i] = &mkrlwe.Ciphertext{Value: map[string]*ring.Poly{"0": eval.ringQ.NewPoly()}}
+		eval.operandPoolQMul[i] = &mkrlwe.Ciphertext{Value: map[string]*ring.Poly{"0": eval.ringQMul.NewPoly()}}
+	}
+
+	eval.tensorPoolQ = make(map[[2]string]*ring.Poly)
+	eval.tensorPoolQMul = make(map[[2]string]*ring.Poly)
+}
+
+// ShallowCopy creates a shallow copy of this Evaluator in which all the read-only data-structures are
+// shared with the receiver and the temporary buffers are reallocated. The receiver and the returned
+// Evaluator can be used concurrently.
+func (eval *Evaluator) ShallowCopy() *Evaluator {
+	evalCopy := &Evaluator{
+		params:            eval.params,
+		ksw:               eval.ksw.ShallowCopy(),
+		ringQ:             eval.ringQ,
+		ringQMul:          eval.ringQMul,
+		baseconverterQ1Q2: eval.baseconverterQ1Q2.ShallowCopy(),
+		pHalf:             eval.pHalf,
+	}
+
+	evalCopy.allocatePools()
+
+	return evalCopy
+}
+
+// SetWorkers sets the number of goroutines on which the per-ID loops of the key-switchings are spread.
+// Each worker holds its own key-switching buffers, so that the memory used grows linearly with n.
+func (eval *Evaluator) SetWorkers(n int) {
+	eval.ksw.SetWorkers(n)
+}
+
+func (eval *Evaluator) newCiphertextBinary(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	return NewCiphertext(eval.params, op0.IDSet().Union(op1.IDSet()))
+}
+
+// AddNew adds op0 to op1 and returns the result in a newly created element.
+func (eval *Evaluator) AddNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(op0, op1)
+	eval.add(op0, op1, ctOut)
+	return
+}
+
+// add adds op0 to op1 and returns the result in ctOut, which should contain the IDs of op0 and op1.
+func (eval *Evaluator) add(op0, op1 *Ciphertext, ctOut *Ciphertext) {
+	for id := range ctOut.Value {
+		c0, in0 := op0.Value[id]
+		c1, in1 := op1.Value[id]
+
+		switch {
+		case in0 && in1:
+			eval.ringQ.Add(c0, c1, ctOut.Value[id])
+		case in0:
+			ctOut.Value[id].Copy(c0)
+		case in1:
+			ctOut.Value[id].Copy(c1)
+		}
+	}
+}
+
+// SubNew subtracts op1 from op0 and returns the result in a newly created element.
+func (eval *Evaluator) SubNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(op0, op1)
+	eval.sub(op0, op1, ctOut)
+	return
+}
+
+// sub subtracts op1 from op0 and returns the result in ctOut, which should contain the IDs of op0 and op1.
+func (eval *Evaluator) sub(op0, op1 *Ciphertext, ctOut *Ciphertext) {
+	for id := range ctOut.Value {
+		c0, in0 := op0.Value[id]
+		c1, in1 := op1.Value[id]
+
+		switch {
+		case in0 && in1:
+			eval.ringQ.Sub(c0, c1, ctOut.Value[id])
+		case in0:
+			ctOut.Value[id].Copy(c0)
+		case in1:
+			eval.ringQ.Neg(c1, ctOut.Value[id])
+		}
+	}
+}
+
+// MulRelinNew multiplies op0 by op1 with relinearization and returns the result in a newly created element.
+// The tensor product is computed over Q*QMul and scaled down by T/Q before each of its quadratic
+// components is relinearized with the keys of the two parties it involves.
+// The procedure will panic if rlkSet lacks the relinearization key of a party engaged in op0 or op1.
+func (eval *Evaluator) MulRelinNew(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	ctTensor := eval.tensorAndRescale(op0, op1)
+
+	ctOut = NewCiphertext(eval.params, ctTensor.IDSet())
+	eval.ksw.Relinearize(ctTensor, rlkSet, ctOut.Ciphertext)
+
+	return
+}
+
+// tensorAndRescale returns the tensor product of op0 and op1 scaled down by T/Q.
+// As s_i * s_j = s_j * s_i, the component of s_i * s_j is only stored for i <= j.
+// The components of the output are backed by the tensoring buffers of the evaluator.
+func (eval *Evaluator) tensorAndRescale(op0, op1 *Ciphertext) (ctTensor *mkrlwe.TensoredCiphertext) {
+	ringQ := eval.ringQ
+	ringQMul := eval.ringQMul
+
+	c0Q, c0QMul := eval.modUpAndNTT(0, op0)
+	c1Q, c1QMul := eval.modUpAndNTT(1, op1)
+
+	for id := range c0Q {
+		ringQ.MForm(c0Q[id], c0Q[id])
+		ringQMul.MForm(c0QMul[id], c0QMul[id])
+	}
+
+	ctTensor = new(mkrlwe.TensoredCiphertext)
+	ctTensor.Value = make(map[string]*ring.Poly)
+	ctTensor.Quadratic = make(map[string]map[string]*ring.Poly)
+
+	// accumulators of the tensor product over Q*QMul
+	accQ := make(map[[2]string]*ring.Poly)
+	accQMul := make(map[[2]string]*ring.Poly)
+
+	for i := range c0Q {
+		for j := range c1Q {
+			key := tensorKey(i, j)
+
+			if _, in := accQ[key]; !in {
+				accQ[key], accQMul[key] = eval.tensorAccumulator(key)
+			}
+
+			ringQ.MulCoeffsMontgomeryAndAdd(c0Q[i], c1Q[j], accQ[key])
+			ringQMul.MulCoeffsMontgomeryAndAdd(c0QMul[i], c1QMul[j], accQMul[key])
+		}
+	}
+
+	for key := range accQ {
+
+		// the accumulator over Q is consumed before the output is written
+		eval.quantize(accQ[key], accQMul[key], accQ[key])
+
+		switch {
+		case key[0] == "0":
+			ctTensor.Value[key[1]] = accQ[key]
+		default:
+			if _, in := ctTensor.Quadratic[key[0]]; !in {
+				ctTensor.Quadratic[key[0]] = make(map[string]*ring.Poly)
+			}
+			ctTensor.Quadratic[key[0]][key[1]] = accQ[key]
+		}
+	}
+
+	return
+}
+
+// tensorAccumulator returns the zeroed buffers over Q and QMul of the component of the tensor product of given pair of IDs
+func (eval *Evaluator) tensorAccumulator(key [2]string) (accQ, accQMul *ring.Poly) {
+	if _, in := eval.tensorPoolQ[key]; !in {
+		eval.tensorPoolQ[key] = eval.ringQ.NewPoly()
+		eval.tensorPoolQMul[key] = eval.ringQMul.NewPoly()
+	}
+
+	accQ, accQMul = eval.tensorPoolQ[key], eval.tensorPoolQMul[key]
+	accQ.Zero()
+	accQMul.Zero()
+
+	return
+}
+
+// tensorKey returns the sorted pair of IDs of the tensor component of s_i * s_j,
+// where the ID "0" stands for the constant 1.
+func tensorKey(i, j string) [2]string {
+	switch {
+	case i == "0":
+		return [2]string{i, j}
+	case j == "0":
+		return [2]string{j, i}
+	case j < i:
+		return [2]string{j, i}
+	}
+	return [2]string{i, j}
+}
+
+// modUpAndNTT extends the basis of the components of ct from Q to Q*QMul and transforms them to NTT form.
+// They are backed by the i-th operand buffers of the evaluator.
+func (eval *Evaluator) modUpAndNTT(i int, ct *Ciphertext) (cQ, cQMul map[string]*ring.Poly) {
+	levelQ := len(eval.ringQ.Modulus) - 1
+	levelQMul := len(eval.ringQMul.Modulus) - 1
+
+	eval.operandPoolQ[i].PadCiphertext(ct.IDSet())
+	eval.operandPoolQMul[i].PadCiphertext(ct.IDSet())
+
+	cQ = make(map[string]*ring.Poly)
+	cQMul = make(map[string]*ring.Poly)
+
+	for id := range ct.Value {
+		cQ[id] = eval.operandPoolQ[i].Value[id]
+		cQMul[id] = eval.operandPoolQMul[i].Value[id]
+
+		eval.baseconverterQ1Q2.ModUpQtoP(levelQ, levelQMul, ct.Value[id], cQMul[id])
+		eval.ringQ.NTTLazy(ct.Value[id], cQ[id])
+		eval.ringQMul.NTTLazy(cQMul[id], cQMul[id])
+	}
+
+	return
+}
+
+// quantize scales the polynomial (cQ, cQMul) of Q*QMul down by T/Q and writes the result in cOut.
+// The inputs are in NTT form and are overwritten.
+func (eval *Evaluator) quantize(cQ, cQMul, cOut *ring.Poly) {
+	levelQ := len(eval.ringQ.Modulus) - 1
+	levelQMul := len(eval.ringQMul.Modulus) - 1
+
+	eval.ringQ.InvNTTLazy(cQ, cQ)
+	eval.ringQMul.InvNTTLazy(cQMul, cQMul)
+
+	// Extends the basis Q of c to the basis QMul and divides by Q
+	eval.baseconverterQ1Q2.ModDownQPtoP(levelQ, levelQMul, cQ, cQMul, cQMul)
+
+	// Centers c/Q by QMul/2 and extends it to the basis Q
+	eval.ringQMul.AddScalarBigint(cQMul, eval.pHalf, cQMul)
+	eval.baseconverterQ1Q2.ModUpPtoQ(levelQMul, levelQ, cQMul, cOut)
+	eval.ringQ.SubScalarBigint(cOut, eval.pHalf, cOut)
+
+	eval.ringQ.MulScalar(cOut, eval.params.T(), cOut)
+}
+
+// RotateNew rotates the columns of ct0 by k positions to the left, and returns the result in a newly created element.
+// A rotation key of every party engaged in ct0 needs to be provided for rotidx or for the rotations it decomposes into, see mkrlwe.Parameters.RotationDecomposition.
+func (eval *Evaluator) RotateNew(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct0.IDSet())
+	eval.rotate(ct0, rotidx, rkSet, ctOut)
+	return
+}
+
+// rotate rotates the columns of ct0 by k positions to the left and returns the result in ctOut.
+func (eval *Evaluator) rotate(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+
+	rotidx = eval.params.NormalizeRotation(rotidx)
+
+	if rotidx == 0 {
+		ctOut.Ciphertext.Copy(ct0.Ciphertext)
+		return
+	}
+
+	_, in := eval.params.CRS[rotidx]
+
+	if in {
+		eval.ksw.Rotate(ct0.Ciphertext, rotidx, rkSet, ctOut.Ciphertext)
+		return
+	}
+
+	ctTmp := ct0.CopyNew()
+	for _, k := range eval.params.RotationDecomposition(rotidx) {
+		eval.ksw.Rotate(ctTmp.Ciphertext, k, rkSet, ctOut.Ciphertext)
+		ctTmp.Ciphertext.Copy(ctOut.Ciphertext)
+	}
+}
+
+// ConjugateNew swaps the two rows of ct0 and returns the result in a newly created element.
+// A conjugation key of every party engaged in ct0 needs to be provided.
+func (eval *Evaluator) ConjugateNew(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct0.IDSet())
+	eval.ksw.Conjugate(ct0.Ciphertext, ckSet, ctOut.Ciphertext)
+	return
+}
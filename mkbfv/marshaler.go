@@ -0,0 +1,37 @@
+package mkbfv
+
+import "mk-lr/mkrlwe"
+
+// GetDataLen returns the length in bytes of the payload of the target Ciphertext.
+func (ciphertext *Ciphertext) GetDataLen(WithMetaData bool) (dataLen int) {
+	return ciphertext.Ciphertext.GetDataLen(WithMetaData)
+}
+
+// MarshalBinary encodes a Ciphertext on a byte slice bound to its fingerprint. The payload holds
+// every component prefixed by its ID.
+func (ciphertext *Ciphertext) MarshalBinary() (data []byte, err error) {
+	return mkrlwe.MarshalEnvelope(mkrlwe.KindBFVCiphertext, ciphertext.Fingerprint, ciphertext.GetDataLen(true), func(payload []byte) (err error) {
+		_, err = ciphertext.Ciphertext.Encode(payload)
+		return
+	})
+}
+
+// UnmarshalBinary decodes a previously marshaled Ciphertext on the target Ciphertext.
+// The fingerprint of the ciphertext is read from its envelope and can be checked with mkrlwe.EnvelopeHeader.CheckParams.
+func (ciphertext *Ciphertext) UnmarshalBinary(data []byte) (err error) {
+
+	var hdr mkrlwe.EnvelopeHeader
+
+	hdr, err = mkrlwe.UnmarshalEnvelope(mkrlwe.KindBFVCiphertext, data, func(payload []byte) error {
+		ciphertext.Ciphertext = new(mkrlwe.Ciphertext)
+		return ciphertext.Ciphertext.Decode(payload)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	ciphertext.Fingerprint = hdr.ParamHash
+
+	return nil
+}
@@ -0,0 +1,386 @@
+package mkbfv
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"mk-lr/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+	"github.com/ldsec/lattigo/v2/ring"
+	"github.com/ldsec/lattigo/v2/rlwe"
+	"github.com/ldsec/lattigo/v2/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+var maxUsers = flag.Int("n", 4, "maximum number of parties")
+
+func GetTestName(params Parameters, opname string) string {
+	return fmt.Sprintf("%slogN=%d/T=%d/logQP=%d/levels=%d/",
+		opname,
+		params.LogN(),
+		params.T(),
+		params.LogQP(),
+		params.MaxLevel()+1)
+}
+
+type testParams struct {
+	params Parameters
+	prng   utils.PRNG
+	kgen   *mkrlwe.KeyGenerator
+	skSet  *mkrlwe.SecretKeySet
+	pkSet  *mkrlwe.PublicKeySet
+	rlkSet *mkrlwe.RelinearizationKeySet
+	rtkSet *mkrlwe.RotationKeySet
+	cjkSet *mkrlwe.ConjugationKeySet
+
+	encryptor *Encryptor
+	decryptor *Decryptor
+	evaluator *Evaluator
+}
+
+var (
+	PN14QP439 = bfv.ParametersLiteral{
+		LogN: 14,
+		T:    65537,
+		Q: []uint64{
+			// 59 + 5x52
+			0x7ffffffffe70001,
+
+			0xffffffff00001, 0xfffffffe40001,
+			0xfffffffe20001, 0xfffffffbe0001,
+			0xfffffffa60001,
+		},
+		P: []uint64{
+			// 60 x 2
+			0xffffffffffc0001, 0xfffffffff840001,
+		},
+		Sigma: rlwe.DefaultSigma,
+	}
+)
+
+func TestBFV(t *testing.T) {
+
+	defaultParams := []bfv.ParametersLiteral{PN14QP439}
+
+	for _, defaultParam := range defaultParams {
+		bfvParams, err := bfv.NewParametersFromLiteral(defaultParam)
+
+		if err != nil {
+			panic(err)
+		}
+
+		params := NewParameters(bfvParams)
+		userList := make([]string, *maxUsers)
+		idset := mkrlwe.NewIDSet()
+
+		for i := range userList {
+			userList[i] = "user" + strconv.Itoa(i)
+			idset.Add(userList[i])
+		}
+
+		var testContext *testParams
+		if testContext, err = genTestParams(params, idset); err != nil {
+			panic(err)
+		}
+
+		testEncAndDec(testContext, userList, t)
+		testMarshaler(testContext, t)
+
+		for numUsers := 2; numUsers <= *maxUsers; numUsers *= 2 {
+			testEvaluatorAddSub(testContext, userList[:numUsers], t)
+			testEvaluatorMul(testContext, userList[:numUsers], t)
+			testEvaluatorRot(testContext, userList[:numUsers], t)
+			testEvaluatorConj(testContext, userList[:numUsers], t)
+			testDecryptionShares(testContext, userList[:numUsers], t)
+		}
+	}
+}
+
+func TestNewParameters(t *testing.T) {
+	literal := PN14QP439
+	literal.P = literal.P[:1]
+
+	bfvParams, err := bfv.NewParametersFromLiteral(literal)
+	require.NoError(t, err)
+
+	require.Panics(t, func() { NewParameters(bfvParams) })
+}
+
+func genTestParams(defaultParam Parameters, idset *mkrlwe.IDSet) (testContext *testParams, err error) {
+
+	testContext = new(testParams)
+
+	testContext.params = defaultParam
+
+	testContext.kgen = NewKeyGenerator(testContext.params)
+
+	testContext.skSet = mkrlwe.NewSecretKeySet()
+	testContext.pkSet = mkrlwe.NewPublicKeyKeySet()
+	testContext.rlkSet = mkrlwe.NewRelinearizationKeyKeySet(defaultParam.Parameters)
+	testContext.rtkSet = mkrlwe.NewRotationKeySet()
+	testContext.cjkSet = mkrlwe.NewConjugationKeySet()
+
+	// gen sk, pk, rlk, rk, cjk
+
+	for id := range idset.Value {
+		sk, pk := testContext.kgen.GenKeyPair(id)
+		r := testContext.kgen.GenSecretKey(id)
+		rlk := testContext.kgen.GenRelinearizationKey(sk, r)
+		cjk := testContext.kgen.GenConjugationKey(sk)
+
+		testContext.kgen.GenDefaultRotationKeys(sk, testContext.rtkSet)
+
+		testContext.skSet.AddSecretKey(sk)
+		testContext.pkSet.AddPublicKey(pk)
+		testContext.rlkSet.AddRelinearizationKey(rlk)
+		testContext.cjkSet.AddConjugationKey(cjk)
+	}
+
+	if testContext.prng, err = utils.NewPRNG(); err != nil {
+		return nil, err
+	}
+
+	testContext.encryptor = NewEncryptor(testContext.params)
+	testContext.decryptor = NewDecryptor(testContext.params)
+
+	testContext.evaluator = NewEvaluator(testContext.params)
+
+	return testContext, nil
+
+}
+
+func newTestVectors(testContext *testParams, id string) (msg *Message, ciphertext *Ciphertext) {
+
+	params := testContext.params
+
+	msg = NewMessage(params)
+
+	for i := range msg.Value {
+		msg.Value[i] = utils.RandUint64() % params.T()
+	}
+
+	if testContext.encryptor != nil {
+		ciphertext = testContext.encryptor.EncryptMsgNew(msg, testContext.pkSet.GetPublicKey(id))
+	} else {
+		panic("cannot newTestVectors: encryptor is not initialized!")
+	}
+
+	return msg, ciphertext
+}
+
+// newTestSum returns the sum of fresh ciphertexts of every user in userList with its message.
+func newTestSum(testContext *testParams, userList []string) (msg *Message, ct *Ciphertext) {
+	t := testContext.params.T()
+	eval := testContext.evaluator
+
+	msg = NewMessage(testContext.params)
+
+	for i := range userList {
+		msgi, cti := newTestVectors(testContext, userList[i])
+
+		if i == 0 {
+			ct = cti
+		} else {
+			ct = eval.AddNew(ct, cti)
+		}
+
+		for j := range msg.Value {
+			msg.Value[j] = (msg.Value[j] + msgi.Value[j]) % t
+		}
+	}
+
+	return
+}
+
+func testEncAndDec(testContext *testParams, userList []string, t *testing.T) {
+
+	t.Run(GetTestName(testContext.params, "MKEncAndDec: "), func(t *testing.T) {
+		for i := range userList {
+			msg, ct := newTestVectors(testContext, userList[i])
+			msgRes := testContext.decryptor.Decrypt(ct, testContext.skSet)
+
+			require.Equal(t, msg.Value, msgRes.Value)
+		}
+	})
+}
+
+func testEvaluatorAddSub(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	eval := testContext.evaluator
+
+	msg0, ct0 := newTestSum(testContext, userList[:numUsers/2])
+	msg1, ct1 := newTestSum(testContext, userList[numUsers/2:])
+
+	t.Run(GetTestName(params, "MKAdd: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		msgRes := testContext.decryptor.Decrypt(eval.AddNew(ct0, ct1), testContext.skSet)
+
+		for i := range msgRes.Value {
+			require.Equal(t, (msg0.Value[i]+msg1.Value[i])%params.T(), msgRes.Value[i])
+		}
+	})
+
+	t.Run(GetTestName(params, "MKSub: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		msgRes := testContext.decryptor.Decrypt(eval.SubNew(ct0, ct1), testContext.skSet)
+
+		for i := range msgRes.Value {
+			require.Equal(t, (msg0.Value[i]+params.T()-msg1.Value[i])%params.T(), msgRes.Value[i])
+		}
+	})
+}
+
+func testEvaluatorMul(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	eval := testContext.evaluator
+	ringT := params.RingT()
+
+	msg0, ct0 := newTestSum(testContext, userList)
+	msg1, ct1 := newTestVectors(testContext, userList[0])
+
+	t.Run(GetTestName(params, "MKMulAndRelin: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctRes := eval.MulRelinNew(ct0, ct1, testContext.rlkSet)
+		msgRes := testContext.decryptor.Decrypt(ctRes, testContext.skSet)
+
+		for i := range msgRes.Value {
+			require.Equal(t, ring.BRed(msg0.Value[i], msg1.Value[i], params.T(), ringT.BredParams[0]), msgRes.Value[i])
+		}
+	})
+
+	t.Run(GetTestName(params, "MKSquare: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctRes := eval.MulRelinNew(ct0, ct0, testContext.rlkSet)
+		ctRes = eval.MulRelinNew(ctRes, ct0, testContext.rlkSet)
+		msgRes := testContext.decryptor.Decrypt(ctRes, testContext.skSet)
+
+		for i := range msgRes.Value {
+			cube := ring.BRed(msg0.Value[i], msg0.Value[i], params.T(), ringT.BredParams[0])
+			cube = ring.BRed(cube, msg0.Value[i], params.T(), ringT.BredParams[0])
+			require.Equal(t, cube, msgRes.Value[i])
+		}
+	})
+
+	t.Run(GetTestName(params, "MKMulAndRelin: "+strconv.Itoa(numUsers)+"/ Buffers/ "), func(t *testing.T) {
+		// the tensoring buffers of the evaluator are reused across operands of shrinking and growing IDs
+		for _, ops := range [][2]*Ciphertext{{ct0, ct1}, {ct1, ct1}, {ct1, ct0}} {
+			msgA, msgB := msg0, msg0
+			if ops[0] == ct1 {
+				msgA = msg1
+			}
+			if ops[1] == ct1 {
+				msgB = msg1
+			}
+
+			ctRes := eval.MulRelinNew(ops[0], ops[1], testContext.rlkSet)
+			require.Equal(t, ops[0].IDSet().Union(ops[1].IDSet()).Sorted(), ctRes.IDSet().Sorted())
+
+			msgRes := testContext.decryptor.Decrypt(ctRes, testContext.skSet)
+			for i := range msgRes.Value {
+				require.Equal(t, ring.BRed(msgA.Value[i], msgB.Value[i], params.T(), ringT.BredParams[0]), msgRes.Value[i])
+			}
+		}
+	})
+}
+
+func testEvaluatorRot(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	eval := testContext.evaluator
+	rowSize := params.Slots() / 2
+
+	msg, ct := newTestSum(testContext, userList)
+
+	for _, rotidx := range []int{1, 5, -3} {
+		t.Run(GetTestName(params, "MKRotate: "+strconv.Itoa(numUsers)+"/ "+strconv.Itoa(rotidx)+"/ "), func(t *testing.T) {
+			msgRes := testContext.decryptor.Decrypt(eval.RotateNew(ct, rotidx, testContext.rtkSet), testContext.skSet)
+
+			for i := range msgRes.Value {
+				row, col := i/rowSize, i%rowSize
+				require.Equal(t, msg.Value[row*rowSize+((col+rotidx)%rowSize+rowSize)%rowSize], msgRes.Value[i])
+			}
+		})
+	}
+}
+
+func testEvaluatorConj(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	eval := testContext.evaluator
+	rowSize := params.Slots() / 2
+
+	msg, ct := newTestSum(testContext, userList)
+
+	t.Run(GetTestName(params, "MKConjugate: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		msgRes := testContext.decryptor.Decrypt(eval.ConjugateNew(ct, testContext.cjkSet), testContext.skSet)
+
+		for i := range msgRes.Value {
+			require.Equal(t, msg.Value[(i+rowSize)%params.Slots()], msgRes.Value[i])
+		}
+	})
+}
+
+func testDecryptionShares(testContext *testParams, userList []string, t *testing.T) {
+
+	numUsers := len(userList)
+	dec := testContext.decryptor
+
+	msg, ct := newTestSum(testContext, userList)
+
+	t.Run(GetTestName(testContext.params, "MKDecryptionShares: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		shares := make([]*mkrlwe.DecryptionShare, numUsers)
+		for i := range userList {
+			shares[i] = dec.GenDecryptionShare(ct, testContext.skSet.GetSecretKey(userList[i]))
+		}
+
+		_, err := dec.MergeDecryptionShares(ct, shares[1:])
+		require.Error(t, err)
+
+		msgRes, err := dec.MergeDecryptionShares(ct, shares)
+		require.NoError(t, err)
+		require.Equal(t, msg.Value, msgRes.Value)
+	})
+}
+
+func testMarshaler(testContext *testParams, t *testing.T) {
+
+	t.Run(GetTestName(testContext.params, "MKMarshalParameters: "), func(t *testing.T) {
+		data, err := testContext.params.MarshalBinary()
+		require.NoError(t, err)
+
+		var params Parameters
+		require.NoError(t, params.UnmarshalBinary(data))
+		require.Equal(t, testContext.params.T(), params.T())
+		require.Equal(t, testContext.params.Fingerprint(), params.Fingerprint())
+	})
+
+	t.Run(GetTestName(testContext.params, "MKMarshalCiphertext: "), func(t *testing.T) {
+		for id := range testContext.pkSet.Value {
+			msg, ct := newTestVectors(testContext, id)
+
+			data, err := ct.MarshalBinary()
+			require.NoError(t, err)
+
+			ctRes := new(Ciphertext)
+			require.NoError(t, ctRes.UnmarshalBinary(data))
+			require.Equal(t, msg.Value, testContext.decryptor.Decrypt(ctRes, testContext.skSet).Value)
+			require.Equal(t, testContext.params.Fingerprint(), ctRes.Fingerprint)
+
+			hdr, err := mkrlwe.ReadEnvelopeHeader(data)
+			require.NoError(t, err)
+			require.NoError(t, hdr.CheckParams(testContext.params.Parameters))
+
+			otherParams := NewParametersFromSeed(testContext.params.bfvParams, make([]byte, mkrlwe.CRSSeedSize))
+			require.ErrorIs(t, hdr.CheckParams(otherParams.Parameters), mkrlwe.ErrParamsMismatch)
+
+			require.ErrorIs(t, new(Ciphertext).UnmarshalBinary(data[:len(data)-1]), mkrlwe.ErrTruncated)
+		}
+	})
+}
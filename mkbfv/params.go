@@ -0,0 +1,148 @@
+package mkbfv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"mk-lr/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/bfv"
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+// Parameters represents a parameter set for the multi-key BFV cryptosystem. Its fields are private and
+// immutable.
+type Parameters struct {
+	mkrlwe.Parameters
+
+	bfvParams bfv.Parameters
+}
+
+// gamma is the gamma of the mkrlwe parameters of MKBFV
+const gamma = 2
+
+// NewParameters instantiate a set of MKBFV parameters from the generic BFV parameters.
+// The relinearization keys are the ones of mkrlwe, so that the CRSs reserved for BFV are not used.
+// The procedure will panic if bfvParams have less than 2 special moduli P, which the key-switchings need.
+func NewParameters(bfvParams bfv.Parameters) Parameters {
+
+	checkPCount("NewParameters", bfvParams)
+
+	ret := new(Parameters)
+	ret.Parameters = mkrlwe.NewParameters(bfvParams.Parameters, gamma)
+	ret.bfvParams = bfvParams
+
+	return *ret
+}
+
+// NewParametersFromSeed instantiate a set of MKBFV parameters whose CRS is expanded from the given public seed.
+// Parties sharing the BFV parameters and the seed obtain identical parameters.
+// The procedure will panic if bfvParams have less than 2 special moduli P, which the key-switchings need.
+func NewParametersFromSeed(bfvParams bfv.Parameters, seed []byte) Parameters {
+
+	checkPCount("NewParametersFromSeed", bfvParams)
+
+	ret := new(Parameters)
+	ret.Parameters = mkrlwe.NewParametersFromSeed(bfvParams.Parameters, gamma, seed)
+	ret.bfvParams = bfvParams
+
+	return *ret
+}
+
+// checkPCount panics if bfvParams have less special moduli than gamma
+func checkPCount(op string, bfvParams bfv.Parameters) {
+	if bfvParams.PCount() < gamma {
+		panic(fmt.Sprintf("Cannot %s: parameters have %d special moduli P instead of at least %d", op, bfvParams.PCount(), gamma))
+	}
+}
+
+// T returns the plaintext modulus
+func (p Parameters) T() uint64 {
+	return p.bfvParams.T()
+}
+
+// RingT returns the ring of the plaintexts
+func (p Parameters) RingT() *ring.Ring {
+	return p.bfvParams.RingT()
+}
+
+// RingQMul returns the auxiliary ring used for the tensor product of ciphertexts
+func (p Parameters) RingQMul() *ring.Ring {
+	return p.bfvParams.RingQMul()
+}
+
+// Slots returns number of available plaintext slots
+func (p Parameters) Slots() int {
+	return p.N()
+}
+
+// BFVParameters returns the single-key BFV parameters
+func (p Parameters) BFVParameters() bfv.Parameters {
+	return p.bfvParams
+}
+
+// GetDataLen returns the length in bytes of the payload of the marshaled parameters.
+// The mkrlwe parameters are stored in their own envelope.
+func (params Parameters) GetDataLen(WithMetaData bool) (dataLen int) {
+
+	if WithMetaData {
+		dataLen = 8
+	}
+
+	dataLen += params.Parameters.GetDataLen(true) + mkrlwe.EnvelopeOverhead
+
+	return
+}
+
+// MarshalBinary encodes the parameters in a byte slice bound to their fingerprint.
+func (params Parameters) MarshalBinary() ([]byte, error) {
+	return mkrlwe.MarshalEnvelope(mkrlwe.KindBFVParameters, params.Fingerprint(), params.GetDataLen(true), params.encode)
+}
+
+// UnmarshalBinary decodes previously marshaled parameters in the target parameters.
+func (p *Parameters) UnmarshalBinary(data []byte) (err error) {
+
+	var hdr mkrlwe.EnvelopeHeader
+
+	if hdr, err = mkrlwe.UnmarshalEnvelope(mkrlwe.KindBFVParameters, data, p.decode); err != nil {
+		return err
+	}
+
+	if hdr.ParamHash != p.Fingerprint() {
+		return &mkrlwe.DecodingError{Kind: mkrlwe.KindBFVParameters, Err: mkrlwe.ErrParamsMismatch}
+	}
+
+	return nil
+}
+
+func (params Parameters) encode(data []byte) (err error) {
+
+	var mkrlweParamsBuf []byte
+
+	binary.BigEndian.PutUint64(data[0:8], params.T())
+
+	if mkrlweParamsBuf, err = params.Parameters.MarshalBinary(); err != nil {
+		return err
+	}
+
+	copy(data[8:], mkrlweParamsBuf)
+
+	return nil
+}
+
+func (p *Parameters) decode(data []byte) (err error) {
+	if len(data) < 8 {
+		return &mkrlwe.DecodingError{Err: mkrlwe.ErrTruncated, Msg: "parameters"}
+	}
+
+	t := binary.BigEndian.Uint64(data)
+
+	if err = p.Parameters.UnmarshalBinary(data[8:]); err != nil {
+		return err
+	}
+
+	if p.bfvParams, err = bfv.NewParameters(p.Parameters.Parameters, t); err != nil {
+		return &mkrlwe.DecodingError{Err: mkrlwe.ErrMalformed, Msg: fmt.Sprintf("invalid plaintext modulus %d: %v", t, err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+
+	"mk-lr/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+// Bootstrapper refreshes multi-key ciphertexts at level 0 into ciphertexts at the level OutputLevel of its parameters.
+// The bootstrapping is evaluated with the relinearization, rotation and conjugation keys of the parties of the ciphertext,
+// whose secret keys should have the Hamming weight of the parameters.
+type Bootstrapper struct {
+	*Evaluator
+	BootstrappingParameters
+
+	ctsMatrices []*linearTransform
+	stcMatrices []*linearTransform
+	sinePoly    *Polynomial
+	sqrt2pi     float64
+}
+
+// NewBootstrapper creates a Bootstrapper from params, which should be the parameters of the modulus chain of btpParams,
+// and encodes the matrices of the homomorphic DFTs. The CRS of the rotations of the bootstrapping should have been
+// added to params, see BootstrappingParameters.AddCRS.
+// params can have more slots than btpParams, in which case the messages of the bootstrapped ciphertexts should repeat
+// every 2^LogSlots slots of btpParams: read with the slots of btpParams, such a message is their sparse packing.
+// It returns an error if btpParams are invalid or do not match params.
+func NewBootstrapper(params Parameters, btpParams BootstrappingParameters) (btp *Bootstrapper, err error) {
+
+	if err = btpParams.Validate(); err != nil {
+		return nil, fmt.Errorf("cannot NewBootstrapper: %w", err)
+	}
+
+	if params.LogN() != btpParams.LogN || params.LogSlots() < btpParams.LogSlots || params.MaxLevel() != len(btpParams.LogQ)+len(btpParams.Q)-1 {
+		return nil, fmt.Errorf("cannot NewBootstrapper: parameters do not match the bootstrapping parameters")
+	}
+
+	// the bootstrapping is evaluated on the slots of btpParams
+	params.logSlots = btpParams.LogSlots
+
+	btp = &Bootstrapper{Evaluator: NewEvaluator(params), BootstrappingParameters: btpParams}
+
+	btp.sinePoly = btpParams.sinePoly()
+	btp.sqrt2pi = math.Pow(1/(2*math.Pi), 1/math.Exp2(float64(btpParams.DoubleAngle)))
+
+	ckksParams, err := ckks.NewParameters(params.Parameters.Parameters, params.LogSlots(), params.Scale())
+	if err != nil {
+		return nil, fmt.Errorf("cannot NewBootstrapper: %w", err)
+	}
+
+	encoder := ckks.NewEncoder(ckksParams)
+	ringQ := params.RingQ()
+
+	logdSlots := btpParams.logdSlots()
+	q0 := float64(ringQ.Modulus[0])
+
+	// CoeffsToSlots maps the coefficients c of the trace, which holds N / (2 * slots) times the plaintext,
+	// to 2 * slots * c in the slots: it is scaled by 1 / (N * K * Q0 / scale) so that EvalMod receives
+	// the decryption divided by K * Q0.
+	ctsScaling := math.Pow(params.Scale()/(float64(params.N())*btpParams.K*q0), 1/float64(btpParams.CoeffsToSlotsDepth))
+
+	level := params.MaxLevel()
+	for _, diags := range dftMatrices(btpParams.LogSlots, logdSlots, btpParams.CoeffsToSlotsDepth, coeffsToSlots, complex(ctsScaling, 0)) {
+		btp.ctsMatrices = append(btp.ctsMatrices, newLinearTransform(encoder, ckksParams, diags, level, float64(ringQ.Modulus[level]), logdSlots))
+		level--
+	}
+
+	// SlotsToCoeffs maps back the plaintext divided by Q0 to the coefficients: it is scaled by Q0 / scale
+	stcScaling := math.Pow(q0/params.Scale(), 1/float64(btpParams.SlotsToCoeffsDepth))
+
+	level -= btpParams.EvalModDepth()
+	for _, diags := range dftMatrices(btpParams.LogSlots, logdSlots, btpParams.SlotsToCoeffsDepth, slotsToCoeffs, complex(stcScaling, 0)) {
+		btp.stcMatrices = append(btp.stcMatrices, newLinearTransform(encoder, ckksParams, diags, level, float64(ringQ.Modulus[level]), logdSlots))
+		level--
+	}
+
+	return btp, nil
+}
+
+// ShallowCopy creates a copy of the Bootstrapper sharing the encoded matrices and with its own evaluator.
+// The copy can be used concurrently with the receiver.
+func (btp *Bootstrapper) ShallowCopy() *Bootstrapper {
+	btpCopy := *btp
+	btpCopy.Evaluator = btp.Evaluator.ShallowCopy()
+	return &btpCopy
+}
+
+// Bootstrap refreshes ct into a ciphertext of the same parties at level OutputLevel, whose scale is close to the scale of ct.
+// The slots of ct are first brought to level 0 and should be small compared to Q0 / scale for the modular reduction
+// to be accurate; the error of the output grows with this ratio and with the square root of the number of slots. It runs ModRaise, CoeffsToSlots, EvalMod and SlotsToCoeffs with the keys of the
+// parties of ct, the rotation indexes being given by BootstrappingParameters.Rotations.
+// The scales of the intermediate ciphertexts are matched as in EvaluatePoly.
+// It returns an error if ct has more parties than MaxParties.
+func (btp *Bootstrapper) Bootstrap(ct *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet, rtkSet *mkrlwe.RotationKeySet, cjkSet *mkrlwe.ConjugationKeySet) (ctOut *Ciphertext, err error) {
+
+	if numParties := ct.IDSet().Size(); numParties > btp.MaxParties {
+		return nil, fmt.Errorf("cannot Bootstrap: ciphertext of %d parties exceeds the %d parties of the parameters", numParties, btp.MaxParties)
+	}
+
+	defer btp.raiseScaleTolerance()()
+
+	scale := ct.Scale
+
+	ctOut = btp.ModRaiseNew(ct)
+
+	// the plaintext is read at the default scale during the bootstrapping, the scale of ct being restored at the end
+	ctOut.Scale = btp.params.Scale()
+
+	btp.Trace(ctOut, rtkSet, ctOut)
+
+	ctReal, ctImag, err := btp.CoeffsToSlots(ctOut, rtkSet, cjkSet)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctReal, err = btp.EvalMod(ctReal, rlkSet); err != nil {
+		return nil, err
+	}
+
+	if ctImag != nil {
+		if ctImag, err = btp.EvalMod(ctImag, rlkSet); err != nil {
+			return nil, err
+		}
+	}
+
+	if ctOut, err = btp.SlotsToCoeffs(ctReal, ctImag, rtkSet); err != nil {
+		return nil, err
+	}
+
+	ctOut.Scale *= scale / btp.params.Scale()
+
+	return ctOut, nil
+}
+
+// ModRaiseNew brings ct to level 0 and lifts its components from Q0 to the whole modulus chain, returning the result
+// in a newly created element. The decryption of the output is the decryption of ct plus Q0 times a small integer polynomial.
+func (btp *Bootstrapper) ModRaiseNew(ct *Ciphertext) (ctOut *Ciphertext) {
+
+	ringQ := btp.params.RingQ()
+	q0 := ringQ.Modulus[0]
+
+	ctOut = NewCiphertext(btp.params, ct.IDSet(), btp.params.MaxLevel(), ct.Scale)
+
+	for id, p := range ct.Value {
+		pOut := ctOut.Value[id]
+		for j, c := range p.Coeffs[0] {
+			// centered lift of c mod Q0
+			neg := c >= q0>>1
+			if neg {
+				c = q0 - c
+			}
+
+			for i, qi := range ringQ.Modulus[:ctOut.Level()+1] {
+				if v := c % qi; neg && v != 0 {
+					pOut.Coeffs[i][j] = qi - v
+				} else {
+					pOut.Coeffs[i][j] = v
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// Trace sums the rotations of ct by the multiples of its number of slots, which multiplies the coefficients of the
+// sparse packing by N / (2 * slots) and cancels the other ones, and returns the result in ctOut.
+// It does nothing for a full packing. ctOut can be ct.
+func (btp *Bootstrapper) Trace(ct *Ciphertext, rtkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+
+	if ct != ctOut {
+		btp.resizeIDs(ctOut, ct.IDSet())
+		btp.copyLvl(ct.Level(), ct, ctOut)
+		ctOut.Scale = ct.Scale
+	}
+
+	for i := btp.params.LogSlots(); i < btp.params.LogN()-1; i++ {
+		if err := btp.Add(ctOut, btp.RotateNew(ctOut, 1<<i, rtkSet), ctOut); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// CoeffsToSlots evaluates the homomorphic encoding on ct, which consumes CoeffsToSlotsDepth levels, and returns
+// the real and imaginary parts of the coefficients in the slots of two newly created elements.
+// For a sparse packing, both parts are returned in ctReal and ctImag is nil.
+func (btp *Bootstrapper) CoeffsToSlots(ct *Ciphertext, rtkSet *mkrlwe.RotationKeySet, cjkSet *mkrlwe.ConjugationKeySet) (ctReal, ctImag *Ciphertext, err error) {
+
+	for _, lt := range btp.ctsMatrices {
+		if ct, err = btp.evaluateLinearTransform(ct, lt, rtkSet); err != nil {
+			return nil, nil, fmt.Errorf("cannot CoeffsToSlots: %w", err)
+		}
+	}
+
+	ctConj := btp.ConjugateNew(ct, cjkSet)
+
+	ctReal = btp.AddNew(ct, ctConj)
+
+	ctImag = btp.SubNew(ct, ctConj)
+	btp.multByi(ctImag, true, ctImag)
+
+	// the upper half of the slots of a sparse packing is zero
+	if btp.params.LogSlots() < btp.params.LogN()-1 {
+		if err = btp.Add(ctReal, btp.RotateNew(ctImag, btp.params.Slots(), rtkSet), ctReal); err != nil {
+			return nil, nil, err
+		}
+		ctImag = nil
+	}
+
+	return
+}
+
+// EvalMod reduces the slots of ct modulo 1 after CoeffsToSlots and returns the result in a newly created element.
+// It evaluates the interpolant of a scaled cosine followed by DoubleAngle squarings, which consumes EvalModDepth levels.
+func (btp *Bootstrapper) EvalMod(ct *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+
+	// cos(2 pi (x - 1/4)) = sin(2 pi x)
+	ctOut = ct.CopyNew()
+	btp.addConst(-0.25/btp.K, 0, ctOut)
+
+	if ctOut, err = btp.EvaluatePoly(ctOut, btp.sinePoly, rlkSet); err != nil {
+		return nil, fmt.Errorf("cannot EvalMod: %w", err)
+	}
+
+	// cos(2a) = 2 cos(a)^2 - 1, the scaling of the interpolant being squared at each step
+	sqrt2pi := btp.sqrt2pi
+	for i := 0; i < btp.DoubleAngle; i++ {
+		sqrt2pi *= sqrt2pi
+
+		btp.mulRelinAndRescale(ctOut, ctOut, rlkSet, ctOut)
+
+		if err = btp.Add(ctOut, ctOut, ctOut); err != nil {
+			return nil, fmt.Errorf("cannot EvalMod: %w", err)
+		}
+
+		btp.addConst(-sqrt2pi, 0, ctOut)
+	}
+
+	return ctOut, nil
+}
+
+// SlotsToCoeffs evaluates the homomorphic decoding on the real and imaginary parts returned by CoeffsToSlots,
+// which consumes SlotsToCoeffsDepth levels, and returns the result in a newly created element.
+// ctImag should be nil for a sparse packing.
+func (btp *Bootstrapper) SlotsToCoeffs(ctReal, ctImag *Ciphertext, rtkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext, err error) {
+
+	ctOut = ctReal
+
+	if ctImag != nil {
+		ctOut = NewCiphertext(btp.params, ctImag.IDSet(), ctImag.Level(), ctImag.Scale)
+		btp.multByi(ctImag, false, ctOut)
+		if err = btp.Add(ctOut, ctReal, ctOut); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, lt := range btp.stcMatrices {
+		if ctOut, err = btp.evaluateLinearTransform(ctOut, lt, rtkSet); err != nil {
+			return nil, fmt.Errorf("cannot SlotsToCoeffs: %w", err)
+		}
+	}
+
+	return ctOut, nil
+}
+
+// multByi multiplies the slots of ct by i, or by -i if neg, and returns the result in ctOut, which can be ct.
+// As ciphertexts are out of the NTT domain, this is the multiplication of each component by X^(N/2) or -X^(N/2).
+func (eval *Evaluator) multByi(ct *Ciphertext, neg bool, ctOut *Ciphertext) {
+
+	ringQ := eval.params.RingQ()
+	half := ringQ.N >> 1
+
+	eval.resizeIDs(ctOut, ct.IDSet())
+	ctOut.Scale = ct.Scale
+
+	for id, p := range ct.Value {
+		pOut := ctOut.Value[id]
+		for i, qi := range ringQ.Modulus[:ct.Level()+1] {
+			in, out := p.Coeffs[i], pOut.Coeffs[i]
+			for j := 0; j < half; j++ {
+				// X^(N/2) * (lo + X^(N/2) * hi) = -hi + X^(N/2) * lo
+				lo, hi := in[j], in[j+half]
+				if neg {
+					lo, hi = ring.CRed(qi-lo, qi), ring.CRed(qi-hi, qi)
+				}
+				out[j], out[j+half] = ring.CRed(qi-hi, qi), lo
+			}
+		}
+	}
+}
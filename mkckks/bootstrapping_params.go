@@ -0,0 +1,235 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// BootstrappingParameters are the CKKS parameters of a modulus chain supporting the bootstrapping,
+// together with the parameters of the bootstrapping circuit.
+//
+// The chain is made of the modulus Q0 of the bootstrapped ciphertexts, the moduli left to the computation
+// after the bootstrapping and then of the moduli consumed by SlotsToCoeffs, EvalMod and CoeffsToSlots, in this order.
+// The moduli other than Q0 should be close to the scale, and Q0 should be larger than the scale
+// by the ratio between Q0 and the largest message, see Bootstrapper.Bootstrap. A full packing spreads the message
+// over small coefficients and is most precise with a small ratio, such as 2^4 or 2^5.
+type BootstrappingParameters struct {
+	ckks.ParametersLiteral
+
+	// H is the Hamming weight of the secret keys, which should be generated with GenSecretKeySparse
+	H int
+
+	// MaxParties is the largest number of parties of a bootstrapped ciphertext
+	MaxParties int
+
+	// K bounds the integer part of the decryption of a bootstrapped ciphertext divided by Q0.
+	// It grows with the square root of H * MaxParties.
+	K float64
+
+	// SineDegree is the degree of the Chebyshev interpolant of the cosine evaluated by EvalMod
+	SineDegree int
+
+	// DoubleAngle is the number of double angle steps applied after the interpolant
+	DoubleAngle int
+
+	// CoeffsToSlotsDepth and SlotsToCoeffsDepth are the numbers of levels consumed by the homomorphic DFTs
+	CoeffsToSlotsDepth int
+	SlotsToCoeffsDepth int
+}
+
+var (
+	// BootstrappingPN15QP1080 bootstraps ciphertexts of up to 3 parties with a sparse packing of 2^3 slots and leaves 4 levels of 50 bits,
+	// which is the depth of an iteration of the logistic regression of lr. Its sparse packing also bootstraps the ciphertexts
+	// of parameters with more slots whose messages repeat every 2^3 slots, such as the weights of lr, see NewBootstrapper.
+	// The ratio between its 60-bit Q0 and the scale is 2^10. Its modulus exceeds the 881 bits of 128-bit security for N = 2^15,
+	// which cannot hold the bootstrapping and 4 levels at this scale: with moduli of 40 bits, which would fit, the error of the
+	// sparse toy parameters of the tests grows from 2^-11.8 to 2^-2.
+	// With 2 parties, the largest error measured over 5 bootstrappings of sums of messages in [-1, 1] is 2^-7.9, see TestBootstrapping,
+	// and the integer part of the decryption of fresh ciphertexts divided by Q0 was measured at most 27, below K.
+	BootstrappingPN15QP1080 = BootstrappingParameters{
+		ParametersLiteral: ckks.ParametersLiteral{
+			LogN:     15,
+			LogSlots: 3,
+			// 60 + 4x50 + 1x50 + 9x50 + 2x50
+			LogQ:  append([]int{60}, repeatLogQ(50, 16)...),
+			LogP:  []int{55, 55, 55, 55},
+			Scale: 1 << 50,
+			Sigma: rlwe.DefaultSigma,
+		},
+		H:                  192,
+		MaxParties:         3,
+		K:                  32,
+		SineDegree:         48,
+		DoubleAngle:        3,
+		CoeffsToSlotsDepth: 2,
+		SlotsToCoeffsDepth: 1,
+	}
+
+	// BootstrappingPN16QP1599 bootstraps ciphertexts of up to 4 parties with 2^15 slots and leaves 9 levels of 50 bits.
+	// The ratio between its 55-bit Q0 and the scale is 2^5: the error of a full packing grows with this ratio,
+	// and the full-packing toy parameters of the tests reach 2^-11.5 with a ratio of 2^4 against 2^-5.4 with 2^10.
+	// Its end-to-end precision has not been measured, the rotation keys of 4 parties taking about 20 GB, see TestBootstrappingPresets.
+	// The integer part of the decryption of fresh ciphertexts of 4 parties divided by Q0 was measured at most 39, below K.
+	BootstrappingPN16QP1599 = BootstrappingParameters{
+		ParametersLiteral: ckks.ParametersLiteral{
+			LogN:     16,
+			LogSlots: 15,
+			// 55 + 9x50 + 3x50 + 10x50 + 4x50
+			LogQ:  append([]int{55}, repeatLogQ(50, 26)...),
+			LogP:  []int{61, 61, 61, 61},
+			Scale: 1 << 50,
+			Sigma: rlwe.DefaultSigma,
+		},
+		H:                  192,
+		MaxParties:         4,
+		K:                  56,
+		SineDegree:         48,
+		DoubleAngle:        4,
+		CoeffsToSlotsDepth: 4,
+		SlotsToCoeffsDepth: 3,
+	}
+
+	// BootstrappingPN16QP1599N8 is BootstrappingPN16QP1599 with the EvalMod interval widened to 8 parties.
+	// Its end-to-end precision has not been measured either. The integer part of the decryption of fresh ciphertexts
+	// of 8 parties divided by Q0 was measured at most 56, below K.
+	BootstrappingPN16QP1599N8 = BootstrappingParameters{
+		ParametersLiteral: ckks.ParametersLiteral{
+			LogN:     16,
+			LogSlots: 15,
+			// 55 + 9x50 + 3x50 + 10x50 + 4x50
+			LogQ:  append([]int{55}, repeatLogQ(50, 26)...),
+			LogP:  []int{61, 61, 61, 61},
+			Scale: 1 << 50,
+			Sigma: rlwe.DefaultSigma,
+		},
+		H:                  192,
+		MaxParties:         8,
+		K:                  80,
+		SineDegree:         60,
+		DoubleAngle:        4,
+		CoeffsToSlotsDepth: 4,
+		SlotsToCoeffsDepth: 3,
+	}
+)
+
+// repeatLogQ returns n moduli sizes of logQ bits
+func repeatLogQ(logQ, n int) (logQs []int) {
+	logQs = make([]int, n)
+	for i := range logQs {
+		logQs[i] = logQ
+	}
+	return
+}
+
+// CKKSParameters returns the ckks.Parameters of the modulus chain
+func (p BootstrappingParameters) CKKSParameters() (ckks.Parameters, error) {
+	return ckks.NewParametersFromLiteral(p.ParametersLiteral)
+}
+
+// sinePoly returns the interpolant of the scaled cosine evaluated by EvalMod, on [-1, 1].
+// The double angle steps turn s * cos(2 pi K t / 2^r) with s = (1/(2 pi))^(1/2^r) into cos(2 pi K t) / (2 pi).
+func (p BootstrappingParameters) sinePoly() *Polynomial {
+	r := math.Exp2(float64(p.DoubleAngle))
+	s := math.Pow(1/(2*math.Pi), 1/r)
+
+	return Approximate(func(t float64) float64 {
+		return s * math.Cos(2*math.Pi*p.K*t/r)
+	}, -1, 1, p.SineDegree)
+}
+
+// EvalModDepth returns the number of levels consumed by EvalMod
+func (p BootstrappingParameters) EvalModDepth() int {
+	return p.sinePoly().Depth() + p.DoubleAngle
+}
+
+// Depth returns the number of levels consumed by the bootstrapping
+func (p BootstrappingParameters) Depth() int {
+	return p.CoeffsToSlotsDepth + p.EvalModDepth() + p.SlotsToCoeffsDepth
+}
+
+// OutputLevel returns the level of the bootstrapped ciphertexts
+func (p BootstrappingParameters) OutputLevel() int {
+	return len(p.LogQ) + len(p.Q) - 1 - p.Depth()
+}
+
+// Validate returns an error if the modulus chain cannot hold the bootstrapping circuit
+func (p BootstrappingParameters) Validate() error {
+	switch {
+	case p.H < 1:
+		return fmt.Errorf("invalid bootstrapping parameters: Hamming weight %d", p.H)
+	case p.MaxParties < 1:
+		return fmt.Errorf("invalid bootstrapping parameters: %d parties", p.MaxParties)
+	case p.K < 1:
+		return fmt.Errorf("invalid bootstrapping parameters: interval K = %v", p.K)
+	case p.SineDegree < 2 || p.DoubleAngle < 0:
+		return fmt.Errorf("invalid bootstrapping parameters: sine degree %d with %d double angles", p.SineDegree, p.DoubleAngle)
+	case p.LogSlots < 1 || p.LogSlots > p.LogN-1:
+		return fmt.Errorf("invalid bootstrapping parameters: logSlots %d", p.LogSlots)
+	case p.CoeffsToSlotsDepth < 1 || p.CoeffsToSlotsDepth > p.LogSlots || p.SlotsToCoeffsDepth < 1 || p.SlotsToCoeffsDepth > p.LogSlots:
+		return fmt.Errorf("invalid bootstrapping parameters: DFT depths %d and %d for logSlots %d", p.CoeffsToSlotsDepth, p.SlotsToCoeffsDepth, p.LogSlots)
+	case p.OutputLevel() < 0:
+		return fmt.Errorf("invalid bootstrapping parameters: depth %d exceeds the %d levels of the modulus chain", p.Depth(), len(p.LogQ)+len(p.Q)-1)
+	}
+	return nil
+}
+
+// logdSlots returns the log of the number of slots the DFTs act on, which is twice the number of slots for a sparse packing
+func (p BootstrappingParameters) logdSlots() int {
+	if p.LogSlots < p.LogN-1 {
+		return p.LogSlots + 1
+	}
+	return p.LogSlots
+}
+
+// Rotations returns the rotation indexes used by the bootstrapping, for which every party should generate a rotation key.
+// The indexes without a CRS in the parameters should first be added with AddCRS.
+func (p BootstrappingParameters) Rotations() []int {
+
+	rotidxs := []int{}
+
+	// trace of a sparse packing and merge of its real and imaginary parts
+	for i := p.LogSlots; i < p.LogN-1; i++ {
+		rotidxs = append(rotidxs, 1<<i)
+	}
+
+	for _, ltType := range []dftType{coeffsToSlots, slotsToCoeffs} {
+		depth := p.CoeffsToSlotsDepth
+		if ltType == slotsToCoeffs {
+			depth = p.SlotsToCoeffsDepth
+		}
+
+		for _, diags := range dftMatrices(p.LogSlots, p.logdSlots(), depth, ltType, 1) {
+			n1 := bsgsSplit(diagIndexes(diags), 1<<p.logdSlots())
+			for i := range diags {
+				rotidxs = append(rotidxs, i%n1, (i/n1)*n1)
+			}
+		}
+	}
+
+	slots := 1 << (p.LogN - 1)
+	set := make(map[int]bool)
+	rots := []int{}
+	for _, rotidx := range rotidxs {
+		if rotidx = ((rotidx % slots) + slots) % slots; rotidx != 0 && !set[rotidx] {
+			set[rotidx] = true
+			rots = append(rots, rotidx)
+		}
+	}
+
+	sort.Ints(rots)
+
+	return rots
+}
+
+// AddCRS adds to params the CRS of the rotations of the bootstrapping which are missing
+func (p BootstrappingParameters) AddCRS(params *Parameters) {
+	for _, rotidx := range p.Rotations() {
+		if _, in := params.CRS[rotidx]; !in {
+			params.AddCRS(rotidx)
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package mkckks
 
+import "fmt"
+
 import "github.com/ldsec/lattigo/v2/ckks"
 import "mk-lr/mkrlwe"
 
 type Decryptor struct {
 	*mkrlwe.Decryptor
-	encoder  ckks.Encoder
-	params   Parameters
-	ptxtPool *ckks.Plaintext
+	encoder      ckks.Encoder
+	params       Parameters
+	ptxtPool     *ckks.Plaintext
+	logPrecision float64
 }
 
 // NewDecryptor instantiates a Decryptor for the CKKS scheme.
@@ -28,6 +31,103 @@ func (dec *Decryptor) PartialDecrypt(ct *Ciphertext, sk *mkrlwe.SecretKey) {
 	dec.Decryptor.PartialDecrypt(ct.Ciphertext, sk)
 }
 
+// GenDecryptionShare computes the decryption share of ct for the owner of sk.
+// No secret key leaves its owner, only the share is sent to the combiner.
+func (dec *Decryptor) GenDecryptionShare(ct *Ciphertext, sk *mkrlwe.SecretKey) (share *mkrlwe.DecryptionShare) {
+	return dec.Decryptor.GenDecryptionShare(ct.Ciphertext, sk)
+}
+
+// CheckSmudging returns an error if the noise flooding the decryption shares of the parties engaged in ct
+// may bring the decryption error above 2^-logPrecision.
+func (dec *Decryptor) CheckSmudging(ct *Ciphertext, logPrecision float64) error {
+	numShares := ct.IDSet().Size()
+	logErr := dec.params.SmudgingLogError(dec.SmudgingSigma(), ct.Scale, numShares)
+
+	if logErr > -logPrecision {
+		return fmt.Errorf("cannot CheckSmudging: smudging noise gives 2^%.2f decryption error, more than tolerated 2^%.2f", logErr, -logPrecision)
+	}
+
+	return nil
+}
+
+// SetPrecision sets the precision in bits that MergeDecryptionShares enforces on its output.
+// A zero logPrecision, the default, disables the check.
+func (dec *Decryptor) SetPrecision(logPrecision float64) {
+	if logPrecision < 0 {
+		panic("Cannot SetPrecision: logPrecision should be non-negative")
+	}
+	dec.logPrecision = logPrecision
+}
+
+// Precision returns the precision in bits enforced by MergeDecryptionShares, or zero if it is not enforced.
+func (dec *Decryptor) Precision() float64 {
+	return dec.logPrecision
+}
+
+// MergeDecryptionShares combines the decryption shares of every party engaged in ciphertext and decodes the result.
+// It returns an error if the shares do not match the ciphertext, or if a precision was set with SetPrecision
+// and the smudging noise of the shares, assumed to be that of the decryptor, may exceed it as reported by CheckSmudging.
+func (dec *Decryptor) MergeDecryptionShares(ciphertext *Ciphertext, shares []*mkrlwe.DecryptionShare) (msg *Message, err error) {
+	if dec.logPrecision > 0 {
+		if err = dec.CheckSmudging(ciphertext, dec.logPrecision); err != nil {
+			return nil, fmt.Errorf("cannot MergeDecryptionShares: %w", err)
+		}
+	}
+
+	if err = dec.Decryptor.MergeDecryptionShares(ciphertext.Ciphertext, shares, dec.ptxtPool.Plaintext); err != nil {
+		return nil, err
+	}
+
+	dec.ptxtPool.Scale = ciphertext.Scale
+	msg = new(Message)
+	msg.Value = dec.encoder.Decode(dec.ptxtPool, dec.params.logSlots)
+
+	return
+}
+
+// GenReencryptionShare computes the share of the owner of sk re-encrypting ct under the public key pk of a recipient.
+// Neither the secret key nor the plaintext is revealed, only the share is sent to the combiner.
+func (dec *Decryptor) GenReencryptionShare(ct *Ciphertext, sk *mkrlwe.SecretKey, pk *mkrlwe.PublicKey) (share *mkrlwe.ReencryptionShare) {
+	return dec.Decryptor.GenReencryptionShare(ct.Ciphertext, sk, pk)
+}
+
+// MergeReencryptionShares combines the re-encryption shares of every party engaged in ciphertext into a ciphertext
+// of the same scale under the public key of the recipient only, who can then decrypt it alone.
+// It returns an error if the shares do not match the ciphertext.
+func (dec *Decryptor) MergeReencryptionShares(ciphertext *Ciphertext, shares []*mkrlwe.ReencryptionShare) (ctOut *Ciphertext, err error) {
+	ctOut = &Ciphertext{Scale: ciphertext.Scale}
+	if ctOut.Ciphertext, err = dec.Decryptor.MergeReencryptionShares(ciphertext.Ciphertext, shares); err != nil {
+		return nil, err
+	}
+
+	return ctOut, nil
+}
+
+// MergeExitShare removes in place the component of the party of share from ciphertext, which is re-encrypted
+// towards the recipient of the share. The scale of ciphertext is not modified.
+// It returns an error if the share does not match the ciphertext.
+func (dec *Decryptor) MergeExitShare(ciphertext *Ciphertext, share *mkrlwe.ReencryptionShare) error {
+	return dec.Decryptor.MergeExitShare(ciphertext.Ciphertext, share)
+}
+
+// ConvertToCollective combines the re-encryption shares towards cpk of the parties of the group engaged in ciphertext
+// into a ciphertext of the same scale in which their components are replaced by a single component of the group.
+// It returns an error if the shares do not match the ciphertext or the group.
+func (dec *Decryptor) ConvertToCollective(ciphertext *Ciphertext, cpk *mkrlwe.CollectivePublicKey, shares []*mkrlwe.ReencryptionShare) (ctOut *Ciphertext, err error) {
+	ctOut = &Ciphertext{Scale: ciphertext.Scale}
+	if ctOut.Ciphertext, err = dec.Decryptor.ConvertToCollective(ciphertext.Ciphertext, cpk, shares); err != nil {
+		return nil, err
+	}
+
+	return ctOut, nil
+}
+
+// GenCollectiveDecryptionShare computes the share of the owner of sk, a party of the group of cpk, for the decryption
+// of the component of the group in ct. The shares of the group are added with cpk.AggregateDecryptionShares.
+func (dec *Decryptor) GenCollectiveDecryptionShare(ct *Ciphertext, sk *mkrlwe.SecretKey, cpk *mkrlwe.CollectivePublicKey) (share *mkrlwe.DecryptionShare) {
+	return dec.Decryptor.GenCollectiveDecryptionShare(ct.Ciphertext, sk, cpk)
+}
+
 // Decrypt decrypts the ciphertext with given secretkey set and write the result in ptOut.
 // The level of the output plaintext is min(ciphertext.Level(), plaintext.Level())
 // Output domain will match plaintext.Value.IsNTT value.
@@ -51,3 +51,24 @@ func (msg *Message) Slots() int {
 func (el *Ciphertext) Degree() int {
 	return len(el.Value) - 1
 }
+
+// SeededCiphertext is a fresh ciphertext of a single party whose uniform component is replaced by a seed.
+// It is about half the size of a Ciphertext and is expanded by the receiver with Expand.
+type SeededCiphertext struct {
+	*mkrlwe.SeededCiphertext
+	Scale float64
+}
+
+// NewSeededCiphertext returns a new SeededCiphertext of given id with zero values
+func NewSeededCiphertext(params Parameters, id string, level int, scale float64) *SeededCiphertext {
+	sct := new(SeededCiphertext)
+	sct.SeededCiphertext = mkrlwe.NewSeededCiphertext(params.Parameters, id, level)
+	sct.Scale = scale
+
+	return sct
+}
+
+// Expand regenerates the uniform component of sct and returns the corresponding Ciphertext
+func (sct *SeededCiphertext) Expand(params Parameters) *Ciphertext {
+	return &Ciphertext{Ciphertext: sct.SeededCiphertext.Expand(params.Parameters), Scale: sct.Scale}
+}
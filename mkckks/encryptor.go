@@ -64,6 +64,17 @@ func (enc *Encryptor) EncryptMsgNewExpand(msg *Message, pk *mkrlwe.PublicKey, id
 	return
 }
 
+// EncryptMsgSeededNew encodes message and encrypts it with the secret key sk in a new SeededCiphertext,
+// whose uniform component is sampled from a fresh seed.
+func (enc *Encryptor) EncryptMsgSeededNew(msg *Message, sk *mkrlwe.SecretKey) (sctOut *SeededCiphertext) {
+	enc.encoder.Encode(enc.ptxtPool, msg.Value, enc.params.LogSlots())
+
+	sctOut = NewSeededCiphertext(enc.params, sk.ID, enc.params.MaxLevel(), enc.ptxtPool.Scale)
+	enc.Encryptor.EncryptSkSeeded(&rlwe.Plaintext{Value: enc.ptxtPool.Value}, sk, sctOut.SeededCiphertext)
+
+	return
+}
+
 func (enc *Encryptor) EncodeMsgNew(msg *Message) (ptxtOut *ckks.Plaintext) {
 	ptxtOut = ckks.NewPlaintext(enc.ckksParams, enc.params.MaxLevel(), enc.params.Scale())
 	enc.encoder.Encode(ptxtOut, msg.Value, enc.params.LogSlots())
@@ -6,6 +6,7 @@ import "github.com/ldsec/lattigo/v2/ring"
 import "github.com/ldsec/lattigo/v2/ckks"
 import "github.com/ldsec/lattigo/v2/utils"
 
+import "fmt"
 import "math"
 import "unsafe"
 import "errors"
@@ -15,8 +16,26 @@ type Evaluator struct {
 	ksw       *mkrlwe.KeySwitcher
 	ctxtPool  *mkrlwe.Ciphertext
 	polyQPool *ring.Poly
+	hoistPool [2]*mkrlwe.HoistedCiphertext
+
+	tensorPool [2]*mkrlwe.Ciphertext
+
+	rescalePolicy  RescalePolicy
+	scaleTolerance float64
 }
 
+// RescalePolicy tells whether the multiplications of an Evaluator rescale their output.
+type RescalePolicy int
+
+const (
+	// RescaleAuto rescales the output of every multiplication to the default scale. It is the default policy.
+	RescaleAuto RescalePolicy = iota
+
+	// RescaleManual leaves the output of the multiplications at the product of the scales of their operands,
+	// so that several products can be added before a single call to Rescale.
+	RescaleManual
+)
+
 // NewEvaluator creates a new Evaluator, that can be used to do homomorphic
 // operations on the Ciphertexts and/or Plaintexts. It stores a small pool of polynomials
 // and Ciphertexts that will be used for intermediate values.
@@ -28,13 +47,104 @@ func NewEvaluator(params Parameters) *Evaluator {
 		eval.ksw = mkrlwe.NewKeySwitcher(params.Parameters)
 	}
 
-	eval.ctxtPool = mkrlwe.NewCiphertext(params.Parameters, mkrlwe.NewIDSet(), params.MaxLevel())
+	eval.allocatePools()
+
+	return eval
+}
+
+// allocatePools allocates the memory pools of the Evaluator
+func (eval *Evaluator) allocatePools() {
+	eval.ctxtPool = mkrlwe.NewCiphertext(eval.params.Parameters, mkrlwe.NewIDSet(), eval.params.MaxLevel())
 
-	ringQ := params.RingQ()
+	ringQ := eval.params.RingQ()
 	eval.polyQPool = ringQ.NewPoly()
 	eval.polyQPool.IsNTT = true
 
-	return eval
+	eval.hoistPool = [2]*mkrlwe.HoistedCiphertext{mkrlwe.NewHoistedCiphertext(), mkrlwe.NewHoistedCiphertext()}
+
+	eval.tensorPool[0] = mkrlwe.NewCiphertext(eval.params.Parameters, mkrlwe.NewIDSet(), eval.params.MaxLevel())
+	eval.tensorPool[1] = mkrlwe.NewCiphertext(eval.params.Parameters, mkrlwe.NewIDSet(), eval.params.MaxLevel())
+}
+
+// ShallowCopy creates a shallow copy of this Evaluator in which all the read-only data-structures are
+// shared with the receiver and the temporary buffers are reallocated. The receiver and the returned
+// Evaluator can be used concurrently.
+func (eval *Evaluator) ShallowCopy() *Evaluator {
+	evalCopy := &Evaluator{params: eval.params, rescalePolicy: eval.rescalePolicy, scaleTolerance: eval.scaleTolerance}
+
+	if eval.ksw != nil {
+		evalCopy.ksw = eval.ksw.ShallowCopy()
+	}
+
+	evalCopy.allocatePools()
+
+	return evalCopy
+}
+
+// SetWorkers sets the number of goroutines on which the per-ID loops of MulRelin, Rotate and Conjugate are spread.
+// Each worker holds its own key-switching buffers, so that the memory used grows linearly with n.
+func (eval *Evaluator) SetWorkers(n int) {
+	eval.ksw.SetWorkers(n)
+}
+
+// SetRescalePolicy sets the rescale policy of MulRelin, MulRelinHoistedNew, MulPtxt and Relinearize.
+// EvaluatePoly, Bootstrap, InnerProduct, SumRows and SumColumns always rescale, as they manage the levels they consume.
+func (eval *Evaluator) SetRescalePolicy(policy RescalePolicy) {
+	eval.rescalePolicy = policy
+}
+
+// RescalePolicy returns the rescale policy of the evaluator
+func (eval *Evaluator) RescalePolicy() RescalePolicy {
+	return eval.rescalePolicy
+}
+
+// SetScaleTolerance sets the largest relative mismatch between the scales of the operands of the binary operations,
+// once the smallest scale has been multiplied by the integer closest to the ratio of the scales.
+// The output takes the largest scale, so that a mismatch adds a relative error of at most tolerance to the message.
+// The default tolerance is 0: the ratio of the scales must be an integer, otherwise the operations return an error.
+func (eval *Evaluator) SetScaleTolerance(tolerance float64) {
+	if tolerance < 0 || tolerance >= 0.5 {
+		panic("Cannot SetScaleTolerance: tolerance should be in [0, 0.5)")
+	}
+	eval.scaleTolerance = tolerance
+}
+
+// ScaleTolerance returns the relative mismatch between the scales of the operands accepted by the evaluator
+func (eval *Evaluator) ScaleTolerance() float64 {
+	return eval.scaleTolerance
+}
+
+// algorithmScaleTolerance is the relative mismatch between the scales of the operands accepted inside EvaluatePoly and Bootstrap,
+// which add intermediate values rescaled by different moduli close to the scale. It is well above the mismatch left by
+// such rescalings and well below any mismatch due to a wrong scale.
+const algorithmScaleTolerance = 1.0 / (1 << 12)
+
+// raiseScaleTolerance sets the scale tolerance of the evaluator to at least algorithmScaleTolerance
+// and returns a function restoring the previous tolerance.
+func (eval *Evaluator) raiseScaleTolerance() (restore func()) {
+	tolerance := eval.scaleTolerance
+	eval.scaleTolerance = math.Max(tolerance, algorithmScaleTolerance)
+	return func() { eval.scaleTolerance = tolerance }
+}
+
+// applyRescalePolicy rescales ctOut to the default scale if the rescale policy of the evaluator is RescaleAuto.
+// The procedure will panic if ctOut cannot be rescaled, for instance if it is at level 0.
+func (eval *Evaluator) applyRescalePolicy(ctOut *Ciphertext) {
+	if eval.rescalePolicy == RescaleAuto {
+		if err := eval.Rescale(ctOut, eval.params.Scale(), ctOut); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// hoistBuffer returns the i-th hoisting buffer of the evaluator, allocating the decompositions of the IDs of idset it misses.
+func (eval *Evaluator) hoistBuffer(i int, idset *mkrlwe.IDSet) *mkrlwe.HoistedCiphertext {
+	for id := range idset.Value {
+		if _, in := eval.hoistPool[i].Value[id]; !in {
+			eval.hoistPool[i].Value[id] = mkrlwe.NewSwitchingKey(eval.params.Parameters)
+		}
+	}
+	return eval.hoistPool[i]
 }
 
 func (eval *Evaluator) getConstAndScale(level int, constant interface{}) (cReal, cImag, scale float64) {
@@ -197,24 +307,233 @@ func (eval *Evaluator) MultByConst(ct0 *Ciphertext, constant interface{}, ctOut
 	ctOut.Scale = ct0.Scale * scale
 }
 
-func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(int, *ring.Poly, *ring.Poly, *ring.Poly)) {
+// multByConstAndAdd multiplies ct0 by the real constant scaled up by scale and adds the result to ctOut.
+// ctOut should contain the IDs of ct0, and its scale is assumed to be ct0.Scale * scale.
+func (eval *Evaluator) multByConstAndAdd(ct0 *Ciphertext, constant, scale float64, ctOut *Ciphertext) {
+
+	level := utils.MinInt(ct0.Level(), ctOut.Level())
+	ringQ := eval.params.RingQ()
+
+	for i := 0; i < level+1; i++ {
+		qi := ringQ.Modulus[i]
+		mredParams := ringQ.MredParams[i]
+
+		scaledConst := ring.CRed(scaleUpExact(constant, scale, qi), qi)
+		scaledConst = ring.MForm(scaledConst, qi, ringQ.BredParams[i])
+
+		for id := range ct0.Value {
+			p0tmp := ct0.Value[id].Coeffs[i]
+			p1tmp := ctOut.Value[id].Coeffs[i]
+
+			for j := range p0tmp {
+				p1tmp[j] = ring.CRed(p1tmp[j]+ring.MRed(p0tmp[j], scaledConst, qi, mredParams), qi)
+			}
+		}
+	}
+}
+
+// AddConstNew adds the input constant to every slot of ct0 and returns the result in a newly created element.
+// The constant can be a uint64, int64, int, float64 or complex128.
+func (eval *Evaluator) AddConstNew(ct0 *Ciphertext, constant interface{}) (ctOut *Ciphertext) {
+	ctOut = ct0.CopyNew()
+	eval.AddConst(ctOut, constant, ctOut)
+	return
+}
+
+// AddConst adds the input constant to every slot of ct0 and returns the result in ctOut.
+// The constant is scaled up by the scale of ct0, so that neither the scale nor the level is modified.
+// ctOut can be ct0, its IDs are set to the IDs of ct0 and it is dropped to the minimum level of ct0 and ctOut.
+// The constant can be a uint64, int64, int, float64 or complex128.
+func (eval *Evaluator) AddConst(ct0 *Ciphertext, constant interface{}, ctOut *Ciphertext) {
+
+	level := utils.MinInt(ct0.Level(), ctOut.Level())
+
+	eval.resizeIDs(ctOut, ct0.IDSet())
+	eval.DropLevel(ctOut, ctOut.Level()-level)
+
+	eval.copyLvl(level, ct0, ctOut)
+
+	cReal, cImag, _ := eval.getConstAndScale(level, constant)
+	eval.addConst(cReal, cImag, ctOut)
+}
+
+// addConst adds the constant cReal + i * cImag scaled up by ctOut.Scale to every slot of ctOut.
+// As ciphertexts are out of the NTT domain, only the "0" component is modified: the real part
+// is added to the constant coefficient and the imaginary part to the N/2-th coefficient, since X^(N/2) encodes i.
+func (eval *Evaluator) addConst(cReal, cImag float64, ctOut *Ciphertext) {
+
+	ringQ := eval.params.RingQ()
+	c0 := ctOut.Value["0"]
+
+	for i := 0; i < ctOut.Level()+1; i++ {
+		qi := ringQ.Modulus[i]
+
+		if cReal != 0 {
+			c0.Coeffs[i][0] = ring.CRed(c0.Coeffs[i][0]+ring.CRed(scaleUpExact(cReal, ctOut.Scale, qi), qi), qi)
+		}
+
+		if cImag != 0 {
+			c0.Coeffs[i][ringQ.N>>1] = ring.CRed(c0.Coeffs[i][ringQ.N>>1]+ring.CRed(scaleUpExact(cImag, ctOut.Scale, qi), qi), qi)
+		}
+	}
+}
+
+// AddPtxtNew adds pt to ct0 and returns the result in a newly created element.
+// The procedure will panic if the scales of ct0 and pt cannot be matched.
+func (eval *Evaluator) AddPtxtNew(ct0 *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct0.IDSet(), utils.MinInt(ct0.Level(), pt.Level()), utils.MaxFloat64(ct0.Scale, pt.Scale))
+	if err := eval.AddPtxt(ct0, pt, ctOut); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// AddPtxt adds pt to ct0 and returns the result in ctOut.
+// The plaintext can be in or out of the NTT domain. The output is at the minimum level of the operands
+// and the scales are matched as in Add. ctOut should contain the IDs of ct0.
+// Returns an error if the scales of ct0 and pt cannot be matched.
+func (eval *Evaluator) AddPtxt(ct0 *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) (err error) {
+	if err = eval.evaluatePtxt(ct0, pt, ctOut, eval.params.RingQ().AddLvl); err != nil {
+		return fmt.Errorf("cannot AddPtxt: %w", err)
+	}
+	return nil
+}
+
+// SubPtxtNew subtracts pt from ct0 and returns the result in a newly created element.
+// The procedure will panic if the scales of ct0 and pt cannot be matched.
+func (eval *Evaluator) SubPtxtNew(ct0 *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct0.IDSet(), utils.MinInt(ct0.Level(), pt.Level()), utils.MaxFloat64(ct0.Scale, pt.Scale))
+	if err := eval.SubPtxt(ct0, pt, ctOut); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// SubPtxt subtracts pt from ct0 and returns the result in ctOut.
+// The plaintext can be in or out of the NTT domain. The output is at the minimum level of the operands
+// and the scales are matched as in Sub. ctOut should contain the IDs of ct0.
+// Returns an error if the scales of ct0 and pt cannot be matched.
+func (eval *Evaluator) SubPtxt(ct0 *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) (err error) {
+	if err = eval.evaluatePtxt(ct0, pt, ctOut, eval.params.RingQ().SubLvl); err != nil {
+		return fmt.Errorf("cannot SubPtxt: %w", err)
+	}
+	return nil
+}
+
+// evaluatePtxt applies evaluate to the "0" component of ct0 and to pt brought out of the NTT domain,
+// and copies the other components of ct0 on ctOut.
+func (eval *Evaluator) evaluatePtxt(ct0 *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext, evaluate func(int, *ring.Poly, *ring.Poly, *ring.Poly)) (err error) {
+
+	ringQ := eval.params.RingQ()
+
+	ct0Scale, ptScale := ct0.Scale, pt.Scale
+
+	k0, k1, err := matchScales(ct0Scale, ptScale, eval.scaleTolerance)
+	if err != nil {
+		return err
+	}
+
+	level := utils.MinInt(utils.MinInt(ct0.Level(), pt.Level()), ctOut.Level())
+
+	if ctOut.Level() > level {
+		eval.DropLevel(ctOut, ctOut.Level()-level)
+	}
+
+	if pt.Value.IsNTT {
+		ringQ.InvNTTLvl(level, pt.Value, eval.polyQPool)
+	} else {
+		ring.CopyValuesLvl(level, pt.Value, eval.polyQPool)
+	}
+
+	if k1 > 1 {
+		ringQ.MulScalarLvl(level, eval.polyQPool, k1, eval.polyQPool)
+		eval.copyLvl(level, ct0, ctOut)
+	} else if k0 > 1 {
+		eval.multByInt(level, ct0.El(), k0, ctOut.El())
+	} else {
+		eval.copyLvl(level, ct0, ctOut)
+	}
+
+	ctOut.Scale = utils.MaxFloat64(ct0Scale, ptScale)
+
+	evaluate(level, ctOut.Value["0"], eval.polyQPool, ctOut.Value["0"])
+
+	return nil
+}
+
+// copyLvl copies the components of ct0 on ctOut up to the given level, as well as its scale.
+func (eval *Evaluator) copyLvl(level int, ct0, ctOut *Ciphertext) {
+	if ct0 != ctOut {
+		for id := range ct0.Value {
+			ring.CopyValuesLvl(level, ct0.Value[id], ctOut.Value[id])
+		}
+		ctOut.Scale = ct0.Scale
+	}
+}
+
+// matchScales returns the integer constants k0 and k1 by which operands of scales scale0 and scale1 must be
+// multiplied so that their scales match, one of them being always 1.
+// Returns an error if a scale is not positive or if the ratio of the scales differs from an integer
+// by more than the relative tolerance.
+func matchScales(scale0, scale1, tolerance float64) (k0, k1 uint64, err error) {
+
+	if scale0 <= 0 || scale1 <= 0 {
+		return 0, 0, fmt.Errorf("invalid scales %v and %v", scale0, scale1)
+	}
+
+	ratio := scale0 / scale1
+	if ratio < 1 {
+		ratio = 1 / ratio
+	}
+
+	k := math.Round(ratio)
+
+	if k >= 1<<63 || math.Abs(ratio-k) > ratio*tolerance {
+		return 0, 0, fmt.Errorf("scales %v and %v differ by a factor %v which is not an integer up to a relative tolerance of %v", scale0, scale1, ratio, tolerance)
+	}
+
+	if scale0 < scale1 {
+		return uint64(k), 1, nil
+	}
+
+	return 1, uint64(k), nil
+}
+
+// multByInt multiplies the components of ct0 by the integer k up to the given level and writes the result on ctOut.
+func (eval *Evaluator) multByInt(level int, ct0 *mkrlwe.Ciphertext, k uint64, ctOut *mkrlwe.Ciphertext) {
+	for id := range ct0.Value {
+		eval.params.RingQ().MulScalarLvl(level, ct0.Value[id], k, ctOut.Value[id])
+	}
+}
+
+// evaluateInPlace applies evaluate to the components of c0 and c1 at their minimum level, after multiplying the operand of
+// smallest scale by the integer constant matching the scales, and returns the result in ctOut.
+// The IDs of ctOut are set to the union of the IDs of c0 and c1.
+// Returns an error if the scales cannot be matched, in which case the operands are left unchanged.
+func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(int, *ring.Poly, *ring.Poly, *ring.Poly)) (err error) {
 
 	var tmp0, tmp1 *mkrlwe.Ciphertext
 
+	c0Scale := c0.ScalingFactor()
+	c1Scale := c1.ScalingFactor()
+	ctOutScale := ctOut.ScalingFactor()
+
+	k0, k1, err := matchScales(c0Scale, c1Scale, eval.scaleTolerance)
+	if err != nil {
+		return err
+	}
+
 	idset0 := c0.IDSet()
 	idset1 := c1.IDSet()
 	idset := idset0.Union(idset1)
 
+	eval.resizeIDs(ctOut, idset)
 	eval.ctxtPool.PadCiphertext(idset)
 
 	level := utils.MinInt(utils.MinInt(c0.Level(), c1.Level()), ctOut.Level())
 
-	c0Scale := c0.ScalingFactor()
-	c1Scale := c1.ScalingFactor()
-	ctOutScale := ctOut.ScalingFactor()
-
 	if ctOut.Level() > level {
-		eval.DropLevel(&Ciphertext{ctOut.El(), ctOutScale}, ctOut.Level()-utils.MinInt(c0.Level(), c1.Level()))
+		eval.DropLevel(&Ciphertext{ctOut.El(), ctOutScale}, ctOut.Level()-level)
 	}
 
 	// Checks whether or not the receiver element is the same as one of the input elements
@@ -222,17 +541,15 @@ func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(
 	// and scales properly the element before the evaluation.
 	if ctOut == c0 {
 
-		if c0Scale > c1Scale && math.Floor(c0Scale/c1Scale) > 1 {
+		if k1 > 1 {
 
 			tmp1 = eval.ctxtPool.El()
 
-			eval.MultByConst(&Ciphertext{c1.El(), c1Scale}, math.Floor(c0Scale/c1Scale), &Ciphertext{tmp1, ctOutScale})
+			eval.multByInt(level, c1.El(), k1, tmp1)
 
-		} else if c1Scale > c0Scale && math.Floor(c1Scale/c0Scale) > 1 {
+		} else if k0 > 1 {
 
-			eval.MultByConst(&Ciphertext{c0.El(), c0Scale}, math.Floor(c1Scale/c0Scale), &Ciphertext{c0.El(), c0Scale})
-
-			ctOut.SetScalingFactor(c1Scale)
+			eval.multByInt(level, c0.El(), k0, c0.El())
 
 			tmp1 = c1.El()
 
@@ -245,17 +562,15 @@ func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(
 
 	} else if ctOut == c1 {
 
-		if c1Scale > c0Scale && math.Floor(c1Scale/c0Scale) > 1 {
+		if k0 > 1 {
 
 			tmp0 = eval.ctxtPool.El()
 
-			eval.MultByConst(&Ciphertext{c0.El(), c0Scale}, math.Floor(c1Scale/c0Scale), &Ciphertext{tmp0, ctOutScale})
-
-		} else if c0Scale > c1Scale && math.Floor(c0Scale/c1Scale) > 1 {
+			eval.multByInt(level, c0.El(), k0, tmp0)
 
-			eval.MultByConst(&Ciphertext{c1.El(), c1Scale}, math.Floor(c0Scale/c1Scale), &Ciphertext{ctOut.El(), ctOutScale})
+		} else if k1 > 1 {
 
-			ctOut.SetScalingFactor(c0Scale)
+			eval.multByInt(level, c1.El(), k1, ctOut.El())
 
 			tmp0 = c0.El()
 
@@ -268,19 +583,19 @@ func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(
 
 	} else {
 
-		if c1Scale > c0Scale && math.Floor(c1Scale/c0Scale) > 1 {
+		if k0 > 1 {
 
 			tmp0 = eval.ctxtPool.El()
 
-			eval.MultByConst(&Ciphertext{c0.El(), c0Scale}, math.Floor(c1Scale/c0Scale), &Ciphertext{tmp0, ctOutScale})
+			eval.multByInt(level, c0.El(), k0, tmp0)
 
 			tmp1 = c1.El()
 
-		} else if c0Scale > c1Scale && math.Floor(c0Scale/c1Scale) > 1 {
+		} else if k1 > 1 {
 
 			tmp1 = eval.ctxtPool.El()
 
-			eval.MultByConst(&Ciphertext{c1.El(), c1Scale}, math.Floor(c0Scale/c1Scale), &Ciphertext{tmp1, ctOutScale})
+			eval.multByInt(level, c1.El(), k1, tmp1)
 
 			tmp0 = c0.El()
 
@@ -290,6 +605,8 @@ func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(
 		}
 	}
 
+	ctOut.SetScalingFactor(utils.MaxFloat64(c0Scale, c1Scale))
+
 	evaluate(level, tmp0.Value["0"], tmp1.Value["0"], ctOut.Value["0"])
 	for id := range ctOut.IDSet().Value {
 		if !idset0.Has(id) {
@@ -301,6 +618,7 @@ func (eval *Evaluator) evaluateInPlace(c0, c1, ctOut *Ciphertext, evaluate func(
 		}
 	}
 
+	return nil
 }
 
 func (eval *Evaluator) newCiphertextBinary(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
@@ -313,39 +631,111 @@ func (eval *Evaluator) newCiphertextBinary(op0, op1 *Ciphertext) (ctOut *Ciphert
 }
 
 // Add adds op0 to op1 and returns the result in ctOut.
-func (eval *Evaluator) add(op0, op1 *Ciphertext, ctOut *Ciphertext) {
-	eval.evaluateInPlace(op0, op1, ctOut, eval.params.RingQ().AddLvl)
-
+// ctOut can be op0 or op1, and its IDs are set to the union of the IDs of op0 and op1.
+// The operands are brought to their minimum level, and the operand of smallest scale is multiplied by
+// the integer closest to the ratio of the scales.
+// Returns an error if this ratio is not an integer up to the scale tolerance of the evaluator.
+func (eval *Evaluator) Add(op0, op1 *Ciphertext, ctOut *Ciphertext) (err error) {
+	if err = eval.evaluateInPlace(op0, op1, ctOut, eval.params.RingQ().AddLvl); err != nil {
+		return fmt.Errorf("cannot Add: %w", err)
+	}
+	return nil
 }
 
 // AddNew adds op0 to op1 and returns the result in a newly created element.
+// The procedure will panic if the scales of op0 and op1 cannot be matched.
 func (eval *Evaluator) AddNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
 	ctOut = eval.newCiphertextBinary(op0, op1)
-	eval.add(op0, op1, ctOut)
+	if err := eval.Add(op0, op1, ctOut); err != nil {
+		panic(err)
+	}
 	return
 }
 
 // Sub subtracts op1 from op0 and returns the result in ctOut.
-func (eval *Evaluator) sub(op0, op1 *Ciphertext, ctOut *Ciphertext) {
+// ctOut can be op0 or op1, and its IDs are set to the union of the IDs of op0 and op1.
+// The levels and scales of the operands are matched as in Add.
+// Returns an error if the ratio of the scales is not an integer up to the scale tolerance of the evaluator.
+func (eval *Evaluator) Sub(op0, op1 *Ciphertext, ctOut *Ciphertext) (err error) {
 
-	eval.evaluateInPlace(op0, op1, ctOut, eval.params.RingQ().SubLvl)
+	// the IDs of op0 are read before ctOut is resized, as ctOut can be op0
+	idset0 := op0.IDSet()
+
+	if err = eval.evaluateInPlace(op0, op1, ctOut, eval.params.RingQ().SubLvl); err != nil {
+		return fmt.Errorf("cannot Sub: %w", err)
+	}
 
 	level := utils.MinInt(utils.MinInt(op0.Level(), op1.Level()), ctOut.Level())
 
 	//negate polys which is not contained in op0
-	idset0 := op0.IDSet()
 	for id := range ctOut.IDSet().Value {
 		if !idset0.Has(id) {
 			eval.params.RingQ().NegLvl(level, ctOut.Value[id], ctOut.Value[id])
 		}
 	}
 
+	return nil
 }
 
 // SubNew subtracts op1 from op0 and returns the result in a newly created element.
+// The procedure will panic if the scales of op0 and op1 cannot be matched.
 func (eval *Evaluator) SubNew(op0, op1 *Ciphertext) (ctOut *Ciphertext) {
 	ctOut = eval.newCiphertextBinary(op0, op1)
-	eval.sub(op0, op1, ctOut)
+	if err := eval.Sub(op0, op1, ctOut); err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+// Neg negates ct0 and returns the result in ctOut. ctOut can be ct0.
+func (eval *Evaluator) Neg(ct0 *Ciphertext, ctOut *Ciphertext) {
+
+	eval.resizeIDs(ctOut, ct0.IDSet())
+
+	level := utils.MinInt(ct0.Level(), ctOut.Level())
+
+	if ctOut.Level() > level {
+		eval.DropLevel(ctOut, ctOut.Level()-level)
+	}
+
+	for id := range ct0.Value {
+		eval.params.RingQ().NegLvl(level, ct0.Value[id], ctOut.Value[id])
+	}
+
+	ctOut.Scale = ct0.Scale
+}
+
+// NegNew negates ct0 and returns the result in a newly created element.
+func (eval *Evaluator) NegNew(ct0 *Ciphertext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct0.IDSet(), ct0.Level(), ct0.Scale)
+	eval.Neg(ct0, ctOut)
+	return
+}
+
+// resizeIDs sets the IDs of ctOut to idset, adding zero components for the missing IDs
+// and removing the components of the IDs not in idset.
+func (eval *Evaluator) resizeIDs(ctOut *Ciphertext, idset *mkrlwe.IDSet) {
+	for id := range ctOut.Value {
+		if id != "0" && !idset.Has(id) {
+			delete(ctOut.Value, id)
+		}
+	}
+
+	ctOut.PadCiphertext(idset)
+}
+
+// poolCiphertext returns a ciphertext of given IDs and level backed by the ciphertext pool of the evaluator.
+// It is used as a temporary receiver when the output of an operation is one of its inputs.
+func (eval *Evaluator) poolCiphertext(idset *mkrlwe.IDSet, level int) (ct *Ciphertext) {
+
+	eval.ctxtPool.PadCiphertext(idset)
+
+	ct = &Ciphertext{Ciphertext: &mkrlwe.Ciphertext{Value: make(map[string]*ring.Poly)}}
+	ct.Value["0"] = &ring.Poly{Coeffs: eval.ctxtPool.Value["0"].Coeffs[:level+1]}
+	for id := range idset.Value {
+		ct.Value[id] = &ring.Poly{Coeffs: eval.ctxtPool.Value[id].Coeffs[:level+1]}
+	}
 
 	return
 }
@@ -372,16 +762,20 @@ func (eval *Evaluator) Rescale(ctIn *Ciphertext, minScale float64, ctOut *Cipher
 		return errors.New("cannot Rescale: input Ciphertext already at level 0")
 	}
 
-	ctOut.Scale = ctIn.Scale
+	scale := ctIn.Scale
 
 	var nbRescales int
 	// Divides the scale by each moduli of the modulus chain as long as the scale isn't smaller than minScale/2
 	// or until the output Level() would be zero
-	for ctOut.Scale/float64(ringQ.Modulus[ctIn.Level()-nbRescales]) >= minScale/2 && ctIn.Level()-nbRescales >= 0 {
-		ctOut.Scale /= (float64(ringQ.Modulus[ctIn.Level()-nbRescales]))
+	for scale/float64(ringQ.Modulus[ctIn.Level()-nbRescales]) >= minScale/2 && ctIn.Level()-nbRescales > 0 {
+		scale /= (float64(ringQ.Modulus[ctIn.Level()-nbRescales]))
 		nbRescales++
 	}
 
+	if ctIn != ctOut {
+		eval.resizeIDs(ctOut, ctIn.IDSet())
+	}
+
 	if nbRescales > 0 {
 		level := ctIn.Level()
 		for i := range ctOut.Value {
@@ -389,11 +783,13 @@ func (eval *Evaluator) Rescale(ctIn *Ciphertext, minScale float64, ctOut *Cipher
 			ctOut.Value[i].Coeffs = ctOut.Value[i].Coeffs[:level+1-nbRescales]
 		}
 	} else {
-		if ctIn != ctOut {
-			ctOut = ctIn.CopyNew()
-		}
+		level := utils.MinInt(ctIn.Level(), ctOut.Level())
+		eval.DropLevel(ctOut, ctOut.Level()-level)
+		eval.copyLvl(level, ctIn, ctOut)
 	}
 
+	ctOut.Scale = scale
+
 	return nil
 }
 
@@ -414,95 +810,160 @@ func (eval *Evaluator) RescaleNew(ct0 *Ciphertext, threshold float64) (ctOut *Ci
 // The procedure will panic if either op0.Degree or op1.Degree > 1.
 // The procedure will panic if the evaluator was not created with an relinearization key.
 func (eval *Evaluator) MulRelinNew(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(op0, op1)
+	eval.MulRelin(op0, op1, rlkSet, ctOut)
+	return
+}
 
-	//case of square
-	if op0 == op1 {
-		idset := op0.IDSet()
-		// Save decomposed ciphertext at rlkSet's pool
-		for id := range idset.Value {
-			eval.ksw.Decompose(op0.Level(), op0.Value[id], rlkSet.HoistPool[0].Value[id])
-		}
+// MulRelin multiplies op0 with op1 with relinearization, rescales the result according to the rescale policy
+// of the evaluator and returns it in ctOut.
+// ctOut can be op0 or op1, and its IDs are set to the union of the IDs of op0 and op1.
+// The procedure will panic if the evaluator was not created with an relinearization key,
+// or if the result cannot be rescaled, for instance if the operands are at level 0.
+func (eval *Evaluator) MulRelin(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet, ctOut *Ciphertext) {
+	eval.MulRelinNoRescale(op0, op1, rlkSet, ctOut)
+	eval.applyRescalePolicy(ctOut)
+}
 
-		return eval.MulRelinHoistedNew(op0, op1, rlkSet.HoistPool[0], rlkSet.HoistPool[0], rlkSet)
+// mulRelinAndRescale multiplies op0 with op1 with relinearization and rescales the result whatever the rescale policy.
+// The procedure will panic if the result cannot be rescaled.
+func (eval *Evaluator) mulRelinAndRescale(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet, ctOut *Ciphertext) {
+	eval.MulRelinNoRescale(op0, op1, rlkSet, ctOut)
+	if err := eval.Rescale(ctOut, eval.params.Scale(), ctOut); err != nil {
+		panic(err)
+	}
+}
 
-	} else {
-		idset0 := op0.IDSet()
-		idset1 := op1.IDSet()
+// MulRelinNoRescaleNew multiplies op0 with op1 with relinearization and returns the result in a newly created element,
+// at the product of the scales of op0 and op1.
+func (eval *Evaluator) MulRelinNoRescaleNew(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(op0, op1)
+	eval.MulRelinNoRescale(op0, op1, rlkSet, ctOut)
+	return
+}
 
-		for id := range idset0.Value {
-			eval.ksw.Decompose(op0.Level(), op0.Value[id], rlkSet.HoistPool[0].Value[id])
-		}
+// MulRelinNoRescale multiplies op0 with op1 with relinearization and returns the result in ctOut,
+// at the product of the scales of op0 and op1 and at their minimum level.
+// ctOut can be op0 or op1, and its IDs are set to the union of the IDs of op0 and op1.
+// The procedure will panic if the evaluator was not created with an relinearization key.
+func (eval *Evaluator) MulRelinNoRescale(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet, ctOut *Ciphertext) {
 
-		for id := range idset1.Value {
-			eval.ksw.Decompose(op1.Level(), op1.Value[id], rlkSet.HoistPool[1].Value[id])
-		}
+	idset := op0.IDSet().Union(op1.IDSet())
+	level := utils.MinInt(utils.MinInt(op0.Level(), op1.Level()), ctOut.Level())
+
+	// Save decomposed ciphertexts at the evaluator's pool
+	op0Hoisted, op1Hoisted := eval.hoistBuffer(0, op0.IDSet()), eval.hoistBuffer(1, op1.IDSet())
 
-		return eval.MulRelinHoistedNew(op0, op1, rlkSet.HoistPool[0], rlkSet.HoistPool[1], rlkSet)
+	eval.ksw.DecomposeCiphertext(level, op0.Ciphertext, op0Hoisted)
+
+	//case of square
+	if op0 == op1 {
+		op1Hoisted = op0Hoisted
+	} else {
+		eval.ksw.DecomposeCiphertext(level, op1.Ciphertext, op1Hoisted)
 	}
 
+	if ctOut != op0 && ctOut != op1 {
+		eval.resizeIDs(ctOut, idset)
+		eval.mulRelinHoisted(op0, op1, op0Hoisted, op1Hoisted, rlkSet, ctOut)
+		return
+	}
+
+	ctTmp := eval.poolCiphertext(idset, level)
+	eval.mulRelinHoisted(op0, op1, op0Hoisted, op1Hoisted, rlkSet, ctTmp)
+
+	eval.resizeIDs(ctOut, idset)
+	eval.DropLevel(ctOut, ctOut.Level()-ctTmp.Level())
+	eval.copyLvl(ctTmp.Level(), ctTmp, ctOut)
 }
 
-// MulRelin multiplies op0 with op1 with relinearization and returns the result in ctOut.
-// The procedure will panic if either op0.Degree or op1.Degree > 1.
-// The procedure will panic if ctOut.Degree != op0.Degree + op1.Degree.
-// The procedure will panic if the evaluator was not created with an relinearization key.
-func (eval *Evaluator) mulRelin(op0, op1 *Ciphertext, rlkSet *mkrlwe.RelinearizationKeySet, ctOut *Ciphertext) {
+// MulPtxtNew multiplies ct by pt, rescales the result according to the rescale policy of the evaluator
+// and returns it in a newly created element.
+func (eval *Evaluator) MulPtxtNew(ct *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), utils.MinInt(ct.Level(), pt.Level()), ct.Scale*pt.Scale)
+	eval.MulPtxt(ct, pt, ctOut)
+	return
+}
 
-	level := utils.MinInt(utils.MinInt(op0.Level(), op1.Level()), ctOut.Level())
+// MulPtxt multiplies ct by pt, rescales the result according to the rescale policy of the evaluator and returns it in ctOut.
+// The plaintext can be in or out of the NTT domain. ctOut can be ct.
+// The procedure will panic if the result cannot be rescaled, for instance if the operands are at level 0.
+func (eval *Evaluator) MulPtxt(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
+	eval.MulPtxtNoRescale(ct, pt, ctOut)
+	eval.applyRescalePolicy(ctOut)
+}
 
-	if ctOut.Level() > level {
-		eval.DropLevel(ctOut, ctOut.Level()-level)
+// mulPtxtAndRescale multiplies ct by pt and rescales the result whatever the rescale policy.
+// The procedure will panic if the result cannot be rescaled.
+func (eval *Evaluator) mulPtxtAndRescale(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
+	eval.MulPtxtNoRescale(ct, pt, ctOut)
+	if err := eval.Rescale(ctOut, eval.params.Scale(), ctOut); err != nil {
+		panic(err)
 	}
+}
 
-	ctOut.Scale = op0.ScalingFactor() * op1.ScalingFactor()
-	eval.ksw.MulAndRelin(op0.Ciphertext, op1.Ciphertext, rlkSet, ctOut.Ciphertext)
-	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
+// MulPtxtNoRescaleNew multiplies ct by pt and returns the result in a newly created element, at the product of their scales.
+func (eval *Evaluator) MulPtxtNoRescaleNew(ct *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), utils.MinInt(ct.Level(), pt.Level()), ct.Scale*pt.Scale)
+	eval.MulPtxtNoRescale(ct, pt, ctOut)
+	return
 }
 
-// MulRelinNew multiplies ct0 by ct1 with relinearization and returns the result in a newly created element.
-// The procedure will panic if either op0.Degree or op1.Degree > 1.
-// The procedure will panic if the evaluator was not created with an relinearization key.
-func (eval *Evaluator) MulPtxtNew(ct *Ciphertext, pt *ckks.Plaintext) (ctOut *Ciphertext) {
-	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale*pt.Scale)
+// MulPtxtNoRescale multiplies ct by pt and returns the result in ctOut, at the product of their scales.
+// The plaintext can be in or out of the NTT domain. ctOut can be ct.
+func (eval *Evaluator) MulPtxtNoRescale(ct *Ciphertext, pt *ckks.Plaintext, ctOut *Ciphertext) {
 
-	level := ct.Level()
+	ringQ := eval.params.RingQ()
+
+	eval.resizeIDs(ctOut, ct.IDSet())
+
+	level := utils.MinInt(utils.MinInt(ct.Level(), pt.Level()), ctOut.Level())
 
-	eval.params.RingQ().NTTLvl(level, pt.Value, eval.polyQPool)
-	eval.params.RingQ().MFormLvl(level, eval.polyQPool, eval.polyQPool)
+	if ctOut.Level() > level {
+		eval.DropLevel(ctOut, ctOut.Level()-level)
+	}
+
+	if pt.Value.IsNTT {
+		ring.CopyValuesLvl(level, pt.Value, eval.polyQPool)
+	} else {
+		ringQ.NTTLvl(level, pt.Value, eval.polyQPool)
+	}
+	ringQ.MFormLvl(level, eval.polyQPool, eval.polyQPool)
 
 	for id := range ct.Value {
-		eval.params.RingQ().NTTLvl(level, ct.Value[id], ctOut.Value[id])
-		eval.params.RingQ().MulCoeffsMontgomeryLvl(level, ctOut.Value[id], eval.polyQPool, ctOut.Value[id])
-		eval.params.RingQ().InvNTTLvl(level, ctOut.Value[id], ctOut.Value[id])
+		ringQ.NTTLvl(level, ct.Value[id], ctOut.Value[id])
+		ringQ.MulCoeffsMontgomeryLvl(level, ctOut.Value[id], eval.polyQPool, ctOut.Value[id])
+		ringQ.InvNTTLvl(level, ctOut.Value[id], ctOut.Value[id])
 	}
 
-	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
-	return
+	ctOut.Scale = ct.Scale * pt.Scale
 }
 
 // RotateNew rotates the columns of ct0 by k positions to the left, and returns the result in a newly created element.
 // If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key for the specific rotation needs to be provided.
 func (eval *Evaluator) RotateNew(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
 	ctOut = NewCiphertext(eval.params, ct0.IDSet(), ct0.Level(), ct0.Scale)
-	eval.rotate(ct0, rotidx, rkSet, ctOut)
+	eval.Rotate(ct0, rotidx, rkSet, ctOut)
 	return
 }
 
 // Rotate rotates the columns of ct0 by k positions to the left and returns the result in ctOut.
 // If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key for the specific rotation needs to be provided.
-func (eval *Evaluator) rotate(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+// ctOut can be ct0. A rotation without a common reference string is decomposed as given by mkrlwe.Parameters.RotationDecomposition.
+func (eval *Evaluator) Rotate(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
 
-	// normalize rotidx
-	for rotidx >= eval.params.N()/2 {
-		rotidx -= eval.params.N() / 2
-	}
+	eval.resizeIDs(ctOut, ct0.IDSet())
 
-	for rotidx < 0 {
-		rotidx += eval.params.N() / 2
+	if ctOut.Level() > ct0.Level() {
+		eval.DropLevel(ctOut, ctOut.Level()-ct0.Level())
 	}
 
+	ctOut.Scale = ct0.Scale
+
+	rotidx = eval.params.NormalizeRotation(rotidx)
+
 	if rotidx == 0 {
-		ctOut.Ciphertext.Copy(ct0.Ciphertext)
+		eval.copyLvl(ctOut.Level(), ct0, ctOut)
 		return
 	}
 
@@ -513,13 +974,10 @@ func (eval *Evaluator) rotate(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.Rotatio
 		return
 	}
 
-	ctTmp := ct0.CopyNew()
-	for k := 1; rotidx > 0; k *= 2 {
-		if rotidx%2 != 0 {
-			eval.ksw.Rotate(ctTmp.Ciphertext, k, rkSet, ctOut.Ciphertext)
-			ctTmp.Ciphertext.Copy(ctOut.Ciphertext)
-		}
-		rotidx /= 2
+	// the key-switcher can rotate in place
+	eval.copyLvl(ctOut.Level(), ct0, ctOut)
+	for _, k := range eval.params.RotationDecomposition(rotidx) {
+		eval.ksw.Rotate(ctOut.Ciphertext, k, rkSet, ctOut.Ciphertext)
 	}
 
 }
@@ -529,16 +987,45 @@ func (eval *Evaluator) rotate(ct0 *Ciphertext, rotidx int, rkSet *mkrlwe.Rotatio
 // for the row rotation needs to be provided.
 func (eval *Evaluator) ConjugateNew(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKeySet) (ctOut *Ciphertext) {
 	ctOut = NewCiphertext(eval.params, ct0.IDSet(), ct0.Level(), ct0.Scale)
-	eval.conjugate(ct0, ckSet, ctOut)
+	eval.Conjugate(ct0, ckSet, ctOut)
 	return
 }
 
 // Conjugate conjugates ct0 (which is equivalent to a row rotation) and returns the result in ctOut.
 // If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key for the row rotation needs to be provided.
-func (eval *Evaluator) conjugate(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKeySet, ctOut *Ciphertext) {
+// ctOut can be ct0.
+func (eval *Evaluator) Conjugate(ct0 *Ciphertext, ckSet *mkrlwe.ConjugationKeySet, ctOut *Ciphertext) {
+
+	eval.resizeIDs(ctOut, ct0.IDSet())
+
+	if ctOut.Level() > ct0.Level() {
+		eval.DropLevel(ctOut, ctOut.Level()-ct0.Level())
+	}
+
+	ctOut.Scale = ct0.Scale
+
 	eval.ksw.Conjugate(ct0.Ciphertext, ckSet, ctOut.Ciphertext)
 }
 
+// SwitchPartyKey rewrites in place the component of party id in ct, encrypted under the old secret key of the party,
+// into a component under its new secret key, using the switching key swk generated by the party with GenPartySwitchingKey.
+// The other components, the level and the scale of ct are unchanged.
+// It returns an error if swk does not belong to id or if ct has no component for id.
+func (eval *Evaluator) SwitchPartyKey(ct *Ciphertext, id string, swk *mkrlwe.PartySwitchingKey) (err error) {
+
+	if swk.ID != id {
+		return fmt.Errorf("cannot SwitchPartyKey: switching key of %s cannot switch the component of %s", swk.ID, id)
+	}
+
+	if !ct.IDSet().Has(id) {
+		return fmt.Errorf("cannot SwitchPartyKey: ciphertext has no component for %s", id)
+	}
+
+	eval.ksw.SwitchPartyKey(ct.Ciphertext, swk, ct.Ciphertext)
+
+	return nil
+}
+
 // HoistedForm computes hoisted form of input ciphertext
 func (eval *Evaluator) HoistedForm(ct *Ciphertext) (ctHoisted *mkrlwe.HoistedCiphertext) {
 	idset := ct.IDSet()
@@ -546,9 +1033,10 @@ func (eval *Evaluator) HoistedForm(ct *Ciphertext) (ctHoisted *mkrlwe.HoistedCip
 
 	for id := range idset.Value {
 		ctHoisted.Value[id] = mkrlwe.NewSwitchingKey(eval.params.Parameters)
-		eval.ksw.Decompose(ct.Level(), ct.Value[id], ctHoisted.Value[id])
 	}
 
+	eval.ksw.DecomposeCiphertext(ct.Level(), ct.Ciphertext, ctHoisted)
+
 	return
 }
 
@@ -560,10 +1048,11 @@ func (eval *Evaluator) MulRelinHoistedNew(op0, op1 *Ciphertext, op0Hoisted, op1H
 	ctOut = eval.newCiphertextBinary(op0, op1)
 	ctOut.Scale = 0
 	eval.mulRelinHoisted(op0, op1, op0Hoisted, op1Hoisted, rlkSet, ctOut)
+	eval.applyRescalePolicy(ctOut)
 	return
 }
 
-// MulRelin multiplies op0 with op1 with relinearization and returns the result in ctOut.
+// mulRelinHoisted multiplies op0 with op1 with relinearization and returns the result in ctOut, without rescaling.
 // The procedure will panic if either op0.Degree or op1.Degree > 1.
 // The procedure will panic if ctOut.Degree != op0.Degree + op1.Degree.
 // The procedure will panic if the evaluator was not created with an relinearization key.
@@ -577,7 +1066,6 @@ func (eval *Evaluator) mulRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1Hois
 
 	ctOut.Scale = op0.ScalingFactor() * op1.ScalingFactor()
 	eval.ksw.MulAndRelinHoisted(op0.Ciphertext, op1.Ciphertext, op0Hoisted, op1Hoisted, rlkSet, ctOut.Ciphertext)
-	eval.Rescale(ctOut, eval.params.Scale(), ctOut)
 }
 
 // RotateNew rotates the columns of ct0 by k positions to the left, and returns the result in a newly created element.
@@ -592,14 +1080,7 @@ func (eval *Evaluator) RotateHoistedNew(ct0 *Ciphertext, rotidx int, ct0Hoisted
 // If the provided element is a Ciphertext, a key-switching operation is necessary and a rotation key for the specific rotation needs to be provided.
 func (eval *Evaluator) rotateHoisted(ct0 *Ciphertext, rotidx int, ct0Hoisted *mkrlwe.HoistedCiphertext, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
 
-	// normalize rotidx
-	for rotidx >= eval.params.N()/2 {
-		rotidx -= eval.params.N() / 2
-	}
-
-	for rotidx < 0 {
-		rotidx += eval.params.N() / 2
-	}
+	rotidx = eval.params.NormalizeRotation(rotidx)
 
 	if rotidx == 0 {
 		ctOut.Ciphertext.Copy(ct0.Ciphertext)
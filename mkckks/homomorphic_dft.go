@@ -0,0 +1,448 @@
+package mkckks
+
+import (
+	"math"
+	"sort"
+
+	"mk-lr/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+// dftType distinguishes the two homomorphic DFTs of the bootstrapping.
+type dftType int
+
+const (
+	// coeffsToSlots is the homomorphic encoding, which moves the coefficients of the plaintext to the slots
+	coeffsToSlots = dftType(0)
+	// slotsToCoeffs is the homomorphic decoding, which moves the slots back to the coefficients
+	slotsToCoeffs = dftType(1)
+)
+
+// linearTransform is a plaintext matrix given by its non-zero diagonals, encoded for the baby-step giant-step
+// evaluation: the diagonal of index n1 * j + k is rotated by -n1 * j and stored in the NTT and Montgomery domains.
+type linearTransform struct {
+	level int
+	scale float64
+	n1    int
+	diags map[int]*ring.Poly
+}
+
+// newLinearTransform encodes the diagonals of a matrix acting on 2^logSlots slots at given level and scale.
+func newLinearTransform(encoder ckks.Encoder, params ckks.Parameters, diags map[int][]complex128, level int, scale float64, logSlots int) (lt *linearTransform) {
+
+	slots := 1 << logSlots
+	ringQ := params.RingQ()
+
+	lt = &linearTransform{level: level, scale: scale, n1: bsgsSplit(diagIndexes(diags), slots), diags: make(map[int]*ring.Poly)}
+
+	for i, diag := range diags {
+		pt := ckks.NewPlaintext(params, level, scale)
+		encoder.EncodeNTT(pt, rotateVec(diag, -(i/lt.n1)*lt.n1), logSlots)
+		ringQ.MFormLvl(level, pt.Value, pt.Value)
+		lt.diags[i] = pt.Value
+	}
+
+	return
+}
+
+// diagIndexes returns the indexes of the diagonals of a matrix in increasing order.
+func diagIndexes(diags map[int][]complex128) (idxs []int) {
+	for i := range diags {
+		idxs = append(idxs, i)
+	}
+	sort.Ints(idxs)
+	return
+}
+
+// bsgsSplit returns the number of baby-steps, a power of two, minimizing the number of distinct rotations
+// of the baby-step giant-step evaluation of a matrix of given diagonals.
+func bsgsSplit(idxs []int, slots int) (n1 int) {
+
+	best := -1
+	for m := 1; m <= slots; m <<= 1 {
+		baby, giant := make(map[int]bool), make(map[int]bool)
+		for _, i := range idxs {
+			baby[i%m] = true
+			giant[(i/m)*m] = true
+		}
+
+		if cost := len(baby) + len(giant); best < 0 || cost < best {
+			best, n1 = cost, m
+		}
+	}
+
+	return
+}
+
+// evaluateLinearTransform multiplies the slots of ct by the matrix lt with the baby-step giant-step algorithm and
+// returns the result in a newly created element. The baby-step rotations share the decomposition of ct, the products
+// are accumulated in the NTT domain and the result is rescaled once, which consumes one level.
+func (eval *Evaluator) evaluateLinearTransform(ct *Ciphertext, lt *linearTransform, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext, err error) {
+
+	ringQ := eval.params.RingQ()
+
+	level := min(ct.Level(), lt.level)
+	if ct.Level() > level {
+		ct = eval.DropLevelNew(ct, ct.Level()-level)
+	}
+
+	giants := make(map[int][]int)
+	babies := []int{}
+	seen := make(map[int]bool)
+
+	for i := range lt.diags {
+		j, k := (i/lt.n1)*lt.n1, i%lt.n1
+		giants[j] = append(giants[j], k)
+		if !seen[k] {
+			seen[k] = true
+			babies = append(babies, k)
+		}
+	}
+	sort.Ints(babies)
+
+	rots := eval.rotateMany(ct, babies, rkSet)
+
+	ctRot := make(map[int]*Ciphertext)
+	for i, k := range babies {
+		for _, p := range rots[i].Value {
+			ringQ.NTTLvl(level, p, p)
+		}
+		ctRot[k] = rots[i]
+	}
+
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), level, ct.Scale*lt.scale)
+	acc := NewCiphertext(eval.params, ct.IDSet(), level, ctOut.Scale)
+
+	giantIdxs := make([]int, 0, len(giants))
+	for j := range giants {
+		giantIdxs = append(giantIdxs, j)
+	}
+	sort.Ints(giantIdxs)
+
+	for _, j := range giantIdxs {
+
+		for _, p := range acc.Value {
+			p.Zero()
+		}
+
+		for _, k := range giants[j] {
+			for id, p := range ctRot[k].Value {
+				ringQ.MulCoeffsMontgomeryAndAddLvl(level, p, lt.diags[j+k], acc.Value[id])
+			}
+		}
+
+		for _, p := range acc.Value {
+			ringQ.InvNTTLvl(level, p, p)
+		}
+
+		if j != 0 {
+			eval.Rotate(acc, j, rkSet, acc)
+		}
+
+		for id, p := range acc.Value {
+			ringQ.AddLvl(level, ctOut.Value[id], p, ctOut.Value[id])
+		}
+	}
+
+	if err = eval.Rescale(ctOut, ctOut.Scale/float64(ringQ.Modulus[level]), ctOut); err != nil {
+		return nil, err
+	}
+
+	return ctOut, nil
+}
+
+// dftMatrices returns the diagonals of the factors of the homomorphic DFT on 2^logSlots slots, the layers of the
+// butterfly being merged in depth factors, each multiplied by scaling. The matrices act on 2^logdSlots slots,
+// which is twice the number of slots for a sparse packing.
+func dftMatrices(logSlots, logdSlots, depth int, ltType dftType, scaling complex128) (matrices []map[int][]complex128) {
+
+	slots := 1 << logSlots
+
+	roots := computeRoots(slots << 1)
+	pow5 := make([]int, (slots<<1)+1)
+	pow5[0] = 1
+	for i := 1; i < (slots<<1)+1; i++ {
+		pow5[i] = pow5[i-1] * 5
+		pow5[i] &= (slots << 2) - 1
+	}
+
+	var a, b, c [][]complex128
+	if ltType == coeffsToSlots {
+		a, b, c = fftInvPlainVec(logSlots, 1<<logdSlots, roots, pow5)
+	} else {
+		a, b, c = fftPlainVec(logSlots, 1<<logdSlots, roots, pow5)
+	}
+
+	// The layers are merged in increasing order for the encoding and in decreasing order for the decoding,
+	// which lowers the number of diagonals of the factors holding the most layers.
+	merge := make([]int, depth)
+	fftLevel := logSlots
+	for i := 0; i < depth; i++ {
+		d := int(math.Ceil(float64(fftLevel) / float64(depth-i)))
+
+		if ltType == coeffsToSlots {
+			merge[i] = d
+		} else {
+			merge[depth-i-1] = d
+		}
+
+		fftLevel -= d
+	}
+
+	matrices = make([]map[int][]complex128, depth)
+
+	fftLevel = logSlots
+	for i := 0; i < depth; i++ {
+
+		n := 1 << logSlots
+		if logSlots != logdSlots && ltType == slotsToCoeffs && i == 0 {
+			// the repacking of a sparse packing is merged with the first layer of the decoding
+			n = 2 << logSlots
+			matrices[i] = genRepackMatrix(logSlots)
+			matrices[i] = multiplyFFTMatrixWithNextFFTLevel(matrices[i], logSlots, n, fftLevel, a[logSlots-fftLevel], b[logSlots-fftLevel], c[logSlots-fftLevel], ltType)
+		} else {
+			matrices[i] = genFFTDiagMatrix(logSlots, fftLevel, a[logSlots-fftLevel], b[logSlots-fftLevel], c[logSlots-fftLevel], ltType)
+		}
+
+		for next, j := fftLevel-1, 0; j < merge[i]-1; next, j = next-1, j+1 {
+			matrices[i] = multiplyFFTMatrixWithNextFFTLevel(matrices[i], logSlots, n, next, a[logSlots-next], b[logSlots-next], c[logSlots-next], ltType)
+		}
+
+		fftLevel -= merge[i]
+	}
+
+	// the encoding of a sparse packing zeroes the upper half of the slots
+	if logSlots != logdSlots && ltType == coeffsToSlots {
+		for _, diag := range matrices[depth-1] {
+			for x := 0; x < slots; x++ {
+				diag[x+slots] = 0
+			}
+		}
+	}
+
+	for _, matrix := range matrices {
+		for _, diag := range matrix {
+			for x := range diag {
+				diag[x] *= scaling
+			}
+		}
+	}
+
+	return
+}
+
+// computeRoots returns the 2N-th roots of unity
+func computeRoots(N int) (roots []complex128) {
+
+	m := N << 1
+
+	roots = make([]complex128, m)
+	roots[0] = 1
+
+	for i := 1; i < m; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(m)
+		roots[i] = complex(math.Cos(angle), math.Sin(angle))
+	}
+
+	return
+}
+
+// fftPlainVec returns the diagonals of the layers of the butterfly of the DFT on 2^logN slots
+func fftPlainVec(logN, dslots int, roots []complex128, pow5 []int) (a, b, c [][]complex128) {
+
+	N := 1 << logN
+
+	a = make([][]complex128, logN)
+	b = make([][]complex128, logN)
+	c = make([][]complex128, logN)
+
+	size := 1
+	if 2*N == dslots {
+		size = 2
+	}
+
+	index := 0
+	for m := 2; m <= N; m <<= 1 {
+
+		a[index] = make([]complex128, dslots)
+		b[index] = make([]complex128, dslots)
+		c[index] = make([]complex128, dslots)
+
+		tt := m >> 1
+
+		for i := 0; i < N; i += m {
+
+			gap := N / m
+			mask := (m << 2) - 1
+
+			for j := 0; j < m>>1; j++ {
+
+				k := (pow5[j] & mask) * gap
+
+				idx1 := i + j
+				idx2 := i + j + tt
+
+				for u := 0; u < size; u++ {
+					a[index][idx1+u*N] = 1
+					a[index][idx2+u*N] = -roots[k]
+					b[index][idx1+u*N] = roots[k]
+					c[index][idx2+u*N] = 1
+				}
+			}
+		}
+
+		index++
+	}
+
+	return
+}
+
+// fftInvPlainVec returns the diagonals of the layers of the butterfly of the inverse DFT on 2^logN slots
+func fftInvPlainVec(logN, dslots int, roots []complex128, pow5 []int) (a, b, c [][]complex128) {
+
+	N := 1 << logN
+
+	a = make([][]complex128, logN)
+	b = make([][]complex128, logN)
+	c = make([][]complex128, logN)
+
+	size := 1
+	if 2*N == dslots {
+		size = 2
+	}
+
+	index := 0
+	for m := N; m >= 2; m >>= 1 {
+
+		a[index] = make([]complex128, dslots)
+		b[index] = make([]complex128, dslots)
+		c[index] = make([]complex128, dslots)
+
+		tt := m >> 1
+
+		for i := 0; i < N; i += m {
+
+			gap := N / m
+			mask := (m << 2) - 1
+
+			for j := 0; j < m>>1; j++ {
+
+				k := ((m << 2) - (pow5[j] & mask)) * gap
+
+				idx1 := i + j
+				idx2 := i + j + tt
+
+				for u := 0; u < size; u++ {
+					a[index][idx1+u*N] = 1
+					a[index][idx2+u*N] = -roots[k]
+					b[index][idx1+u*N] = 1
+					c[index][idx2+u*N] = roots[k]
+				}
+			}
+		}
+
+		index++
+	}
+
+	return
+}
+
+// fftRotation returns the rotation of the butterfly of the given layer
+func fftRotation(logL, fftLevel int, ltType dftType) int {
+	if ltType == coeffsToSlots {
+		return 1 << (fftLevel - 1)
+	}
+	return 1 << (logL - fftLevel)
+}
+
+// genFFTDiagMatrix returns the diagonals of one layer of the butterfly
+func genFFTDiagMatrix(logL, fftLevel int, a, b, c []complex128, ltType dftType) (vectors map[int][]complex128) {
+
+	rot := fftRotation(logL, fftLevel, ltType)
+
+	vectors = make(map[int][]complex128)
+
+	addToDiagMatrix(vectors, 0, a)
+	addToDiagMatrix(vectors, rot, b)
+	addToDiagMatrix(vectors, (1<<logL)-rot, c)
+
+	return
+}
+
+// genRepackMatrix returns the diagonals of the matrix merging the real and imaginary parts of a sparse packing
+func genRepackMatrix(logL int) (vectors map[int][]complex128) {
+
+	vectors = make(map[int][]complex128)
+
+	a := make([]complex128, 2<<logL)
+	b := make([]complex128, 2<<logL)
+
+	for i := 0; i < 1<<logL; i++ {
+		a[i] = complex(1, 0)
+		a[i+(1<<logL)] = complex(0, 1)
+
+		b[i] = complex(0, 1)
+		b[i+(1<<logL)] = complex(1, 0)
+	}
+
+	addToDiagMatrix(vectors, 0, a)
+	addToDiagMatrix(vectors, 1<<logL, b)
+
+	return
+}
+
+// multiplyFFTMatrixWithNextFFTLevel returns the product of the matrix of diagonals vec with the given layer of the butterfly
+func multiplyFFTMatrixWithNextFFTLevel(vec map[int][]complex128, logL, N, nextLevel int, a, b, c []complex128, ltType dftType) (newVec map[int][]complex128) {
+
+	rot := fftRotation(logL, nextLevel, ltType) & (N - 1)
+
+	newVec = make(map[int][]complex128)
+
+	for i := range vec {
+		addToDiagMatrix(newVec, i, mulVec(vec[i], a))
+		addToDiagMatrix(newVec, (i+rot)&(N-1), mulVec(rotateVec(vec[i], rot), b))
+		addToDiagMatrix(newVec, (i-rot)&(N-1), mulVec(rotateVec(vec[i], -rot), c))
+	}
+
+	return
+}
+
+func addToDiagMatrix(diagMat map[int][]complex128, index int, vec []complex128) {
+	if diagMat[index] == nil {
+		diagMat[index] = vec
+	} else {
+		diagMat[index] = addVec(diagMat[index], vec)
+	}
+}
+
+// rotateVec returns x rotated by n positions to the left
+func rotateVec(x []complex128, n int) (y []complex128) {
+
+	y = make([]complex128, len(x))
+
+	mask := len(x) - 1
+
+	for i := range x {
+		y[i] = x[(i+n)&mask]
+	}
+
+	return
+}
+
+func mulVec(a, b []complex128) (res []complex128) {
+	res = make([]complex128, len(a))
+	for i := range a {
+		res[i] = a[i] * b[i]
+	}
+	return
+}
+
+func addVec(a, b []complex128) (res []complex128) {
+	res = make([]complex128, len(a))
+	for i := range a {
+		res[i] = a[i] + b[i]
+	}
+	return
+}
@@ -0,0 +1,246 @@
+package mkckks
+
+import (
+	"fmt"
+	"sort"
+
+	"mk-lr/mkrlwe"
+
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+// innerSumStep is one step of the inner sum of n terms: the partial sum of 2^i terms is rotated by accRot
+// and added to the accumulator if the i-th bit of n is set, and is doubled with a rotation by stepRot
+// if n has higher bits.
+type innerSumStep struct {
+	accumulate, double bool
+	accRot, stepRot    int
+}
+
+// innerSumSteps returns the steps of the inner sum of n terms spaced by batch slots.
+func innerSumSteps(batch, n int) (steps []innerSumStep) {
+	covered := 0
+	for i := 0; n>>i > 0; i++ {
+		step := innerSumStep{accumulate: (n>>i)&1 == 1, double: n>>(i+1) > 0}
+		if step.accumulate {
+			step.accRot = covered * batch
+			covered += 1 << i
+		}
+		if step.double {
+			step.stepRot = (1 << i) * batch
+		}
+		steps = append(steps, step)
+	}
+	return
+}
+
+// rotationSet returns the non-zero rotation indexes of rotidxs normalized in [0, N/2), without duplicates and in increasing order.
+func (p Parameters) rotationSet(rotidxs []int) (rots []int) {
+	seen := make(map[int]bool)
+	rots = []int{}
+	for _, rotidx := range rotidxs {
+		if rotidx = p.NormalizeRotation(rotidx); rotidx != 0 && !seen[rotidx] {
+			seen[rotidx] = true
+			rots = append(rots, rotidx)
+		}
+	}
+	sort.Ints(rots)
+	return
+}
+
+// RotationsForInnerSum returns the rotation indexes used by InnerSum with given batch and n.
+// The rotations are hoisted only if their indexes have a CRS in the parameters, the other ones
+// are decomposed in rotations by powers of two.
+func (p Parameters) RotationsForInnerSum(batch, n int) []int {
+	rotidxs := []int{}
+	for _, step := range innerSumSteps(batch, n) {
+		if step.accumulate {
+			rotidxs = append(rotidxs, step.accRot)
+		}
+		if step.double {
+			rotidxs = append(rotidxs, step.stepRot)
+		}
+	}
+	return p.rotationSet(rotidxs)
+}
+
+// RotationsForReplicate returns the rotation indexes used by Replicate with given batch and n.
+func (p Parameters) RotationsForReplicate(batch, n int) []int {
+	return p.RotationsForInnerSum(-batch, n)
+}
+
+// RotationsForInnerProduct returns the rotation indexes used by InnerProduct of n slots.
+func (p Parameters) RotationsForInnerProduct(n int) []int {
+	return p.RotationsForInnerSum(1, n)
+}
+
+// RotationsForSumRows returns the rotation indexes used by SumRows on a numRow x numCol matrix with a mask.
+// Without a mask, only the indexes of RotationsForInnerSum(numCol, numRow) are used.
+func (p Parameters) RotationsForSumRows(numRow, numCol int) []int {
+	return p.rotationSet(append(p.RotationsForInnerSum(numCol, numRow), p.RotationsForReplicate(numCol, numRow)...))
+}
+
+// RotationsForSumColumns returns the rotation indexes used by SumColumns on a matrix of numCol columns with a mask.
+// Without a mask, only the indexes of RotationsForInnerSum(1, numCol) are used.
+func (p Parameters) RotationsForSumColumns(numCol int) []int {
+	return p.rotationSet(append(p.RotationsForInnerSum(1, numCol), p.RotationsForReplicate(1, numCol)...))
+}
+
+// rotateMany returns the rotations of ct by each of rotidxs in newly created elements.
+// The decomposition of ct is computed once and shared by the rotations having a CRS when there are at least two of them.
+func (eval *Evaluator) rotateMany(ct *Ciphertext, rotidxs []int, rkSet *mkrlwe.RotationKeySet) (ctOut []*Ciphertext) {
+
+	numHoisted := 0
+	for _, rotidx := range rotidxs {
+		if rotidx = eval.params.NormalizeRotation(rotidx); rotidx != 0 {
+			if _, in := eval.params.CRS[rotidx]; in {
+				numHoisted++
+			}
+		}
+	}
+
+	var ctHoisted *mkrlwe.HoistedCiphertext
+	if numHoisted > 1 {
+		ctHoisted = eval.HoistedForm(ct)
+	}
+
+	ctOut = make([]*Ciphertext, len(rotidxs))
+	for i, rotidx := range rotidxs {
+		rotidx = eval.params.NormalizeRotation(rotidx)
+		_, in := eval.params.CRS[rotidx]
+		switch {
+		case rotidx == 0:
+			ctOut[i] = ct.CopyNew()
+		case in && ctHoisted != nil:
+			ctOut[i] = eval.RotateHoistedNew(ct, rotidx, ctHoisted, rkSet)
+		default:
+			ctOut[i] = eval.RotateNew(ct, rotidx, rkSet)
+		}
+	}
+
+	return
+}
+
+// InnerSumNew returns in a newly created element the inner sum of ct by batches, see InnerSum.
+func (eval *Evaluator) InnerSumNew(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.InnerSum(ct, batch, n, rkSet, ctOut)
+	return
+}
+
+// InnerSum sets the j-th slot of ctOut to the sum of the slots j + i * batch of ct for 0 <= i < n, the indexes being taken cyclically.
+// It uses 2 * log2(n) rotations at most, the two rotations of each step sharing the decomposition of their input
+// when their indexes have a CRS in the parameters. The indexes are given by Parameters.RotationsForInnerSum.
+// ctOut can be ct. The procedure will panic if n < 1.
+func (eval *Evaluator) InnerSum(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+
+	if n < 1 {
+		panic(fmt.Sprintf("Cannot InnerSum: invalid number of terms %d", n))
+	}
+
+	var acc *Ciphertext
+	cur := ct
+
+	for _, step := range innerSumSteps(batch, n) {
+		rotidxs := []int{}
+		if step.accumulate {
+			rotidxs = append(rotidxs, step.accRot)
+		}
+		if step.double {
+			rotidxs = append(rotidxs, step.stepRot)
+		}
+
+		rots := eval.rotateMany(cur, rotidxs, rkSet)
+
+		if step.accumulate {
+			if acc == nil {
+				acc = rots[0]
+			} else if err := eval.Add(acc, rots[0], acc); err != nil {
+				panic(err)
+			}
+		}
+
+		if step.double {
+			cur = eval.AddNew(cur, rots[len(rots)-1])
+		}
+	}
+
+	eval.resizeIDs(ctOut, acc.IDSet())
+
+	if ctOut.Level() > acc.Level() {
+		eval.DropLevel(ctOut, ctOut.Level()-acc.Level())
+	}
+
+	eval.copyLvl(ctOut.Level(), acc, ctOut)
+}
+
+// ReplicateNew returns in a newly created element the replication of ct by batches, see Replicate.
+func (eval *Evaluator) ReplicateNew(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.Replicate(ct, batch, n, rkSet, ctOut)
+	return
+}
+
+// Replicate sets the j-th slot of ctOut to the sum of the slots j - i * batch of ct for 0 <= i < n, the indexes being taken cyclically.
+// If only the first batch slots of ct are non-zero, they are copied n times in ctOut.
+// The rotation indexes are given by Parameters.RotationsForReplicate. ctOut can be ct.
+func (eval *Evaluator) Replicate(ct *Ciphertext, batch, n int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+	eval.InnerSum(ct, -batch, n, rkSet, ctOut)
+}
+
+// InnerProductNew returns in a newly created element the inner product of the first n slots of ct0 and ct1, see InnerProduct.
+func (eval *Evaluator) InnerProductNew(ct0, ct1 *Ciphertext, n int, rlkSet *mkrlwe.RelinearizationKeySet, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	ctOut = eval.newCiphertextBinary(ct0, ct1)
+	eval.InnerProduct(ct0, ct1, n, rlkSet, rkSet, ctOut)
+	return
+}
+
+// InnerProduct multiplies ct0 by ct1 and sets the first slot of ctOut to the inner product of their first n slots.
+// The j-th slot of ctOut holds the inner product of the slots j to j + n - 1. It consumes one level.
+// The rotation indexes are given by Parameters.RotationsForInnerProduct. ctOut can be ct0 or ct1.
+func (eval *Evaluator) InnerProduct(ct0, ct1 *Ciphertext, n int, rlkSet *mkrlwe.RelinearizationKeySet, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+	eval.mulRelinAndRescale(ct0, ct1, rlkSet, ctOut)
+	eval.InnerSum(ctOut, 1, n, rkSet, ctOut)
+}
+
+// SumRowsNew returns in a newly created element the sum of the rows of the matrix encrypted in ct, see SumRows.
+func (eval *Evaluator) SumRowsNew(ct *Ciphertext, mask *ckks.Plaintext, numRow, numCol int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.SumRows(ct, mask, numRow, numCol, rkSet, ctOut)
+	return
+}
+
+// SumRows adds up the rows of the numRow x numCol matrix encrypted row by row in the first slots of ct and returns the result in ctOut.
+// If mask is not nil, the sum is multiplied by mask, which should select the first row, and replicated on the numRow rows,
+// which consumes one level. Without a mask, every row holds the sum only if the matrix fills all the slots.
+// The procedure will panic if the masked sum cannot be rescaled, for instance if ct is at level 0.
+// The rotation indexes are given by Parameters.RotationsForSumRows. ctOut can be ct.
+func (eval *Evaluator) SumRows(ct *Ciphertext, mask *ckks.Plaintext, numRow, numCol int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+	eval.InnerSum(ct, numCol, numRow, rkSet, ctOut)
+
+	if mask != nil {
+		eval.mulPtxtAndRescale(ctOut, mask, ctOut)
+		eval.Replicate(ctOut, numCol, numRow, rkSet, ctOut)
+	}
+}
+
+// SumColumnsNew returns in a newly created element the sum of the columns of the matrix encrypted in ct, see SumColumns.
+func (eval *Evaluator) SumColumnsNew(ct *Ciphertext, mask *ckks.Plaintext, numCol int, rkSet *mkrlwe.RotationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.SumColumns(ct, mask, numCol, rkSet, ctOut)
+	return
+}
+
+// SumColumns adds up the columns of the matrix of numCol columns encrypted row by row in ct and returns the result in ctOut.
+// If mask is not nil, the sum is multiplied by mask, which should select the first column, and replicated on the numCol columns,
+// which consumes one level. Without a mask, only the first column holds the sum.
+// The procedure will panic if the masked sum cannot be rescaled, for instance if ct is at level 0.
+// The rotation indexes are given by Parameters.RotationsForSumColumns. ctOut can be ct.
+func (eval *Evaluator) SumColumns(ct *Ciphertext, mask *ckks.Plaintext, numCol int, rkSet *mkrlwe.RotationKeySet, ctOut *Ciphertext) {
+	eval.InnerSum(ct, 1, numCol, rkSet, ctOut)
+
+	if mask != nil {
+		eval.mulPtxtAndRescale(ctOut, mask, ctOut)
+		eval.Replicate(ctOut, 1, numCol, rkSet, ctOut)
+	}
+}
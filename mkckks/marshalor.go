@@ -2,7 +2,8 @@ package mkckks
 
 import (
 	"encoding/binary"
-	"errors"
+	"fmt"
+	"io"
 	"math"
 
 	"mk-lr/mkrlwe"
@@ -10,94 +11,180 @@ import (
 	"github.com/ldsec/lattigo/v2/ring"
 )
 
-// GetDataLen returns the length in bytes of the target Ciphertext.
+// GetDataLen returns the length in bytes of the payload of the target Ciphertext.
 func (ciphertext *Ciphertext) GetDataLen(WithMetaData bool) (dataLen int) {
-	// MetaData is :
-	// 1 byte : Degree
-	// 9 byte : Scale
-	// 1 byte : isNTT
+	// 8 byte : Scale
 	if WithMetaData {
-		dataLen += 10
+		dataLen += 8
 	}
 
-	for ID, el := range ciphertext.Value {
-		if WithMetaData {
-			//用于存放字符串ID
-			dataLen += 1
-		}
-		dataLen += len(ID)
-
-		dataLen += el.GetDataLen(WithMetaData)
-	}
+	dataLen += ciphertext.Ciphertext.GetDataLen(WithMetaData)
 
 	return dataLen
 }
 
-// MarshalBinary encodes a Ciphertext on a byte slice. The total size
-// in byte is 4 + 8* N * numberModuliQ * (degree + 1).
+// MarshalBinary encodes a Ciphertext on a byte slice bound to its fingerprint. The payload holds the scale
+// followed by every component prefixed by its ID.
 func (ciphertext *Ciphertext) MarshalBinary() (data []byte, err error) {
+	return mkrlwe.MarshalEnvelope(mkrlwe.KindCiphertext, ciphertext.Fingerprint, ciphertext.GetDataLen(true), ciphertext.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled Ciphertext on the target Ciphertext.
+// The fingerprint of the ciphertext is read from its envelope and can be checked with mkrlwe.EnvelopeHeader.CheckParams.
+func (ciphertext *Ciphertext) UnmarshalBinary(data []byte) (err error) {
 
-	data = make([]byte, ciphertext.GetDataLen(true))
+	var hdr mkrlwe.EnvelopeHeader
 
-	data[0] = uint8(ciphertext.Degree() + 1)
+	if hdr, err = mkrlwe.UnmarshalEnvelope(mkrlwe.KindCiphertext, data, ciphertext.decode); err != nil {
+		return err
+	}
 
-	binary.LittleEndian.PutUint64(data[1:9], math.Float64bits(ciphertext.Scale))
+	ciphertext.Fingerprint = hdr.ParamHash
 
-	var pointer, inc int
+	return nil
+}
 
-	pointer = 10
+func (ciphertext *Ciphertext) encode(data []byte) (err error) {
 
-	for ID, el := range ciphertext.Value {
-		data[pointer] = uint8(len(ID))
-		pointer += 1
+	binary.BigEndian.PutUint64(data[0:8], math.Float64bits(ciphertext.Scale))
 
-		copy(data[pointer:], []byte(ID))
-		pointer += len(ID)
+	_, err = ciphertext.Ciphertext.Encode(data[8:])
 
-		if inc, err = el.WriteTo(data[pointer:]); err != nil {
-			return nil, err
-		}
+	return
+}
 
-		pointer += inc
+func (ciphertext *Ciphertext) decode(data []byte) (err error) {
+	if len(data) < 8 { // cf. ciphertext.GetDataLen()
+		return &mkrlwe.DecodingError{Err: mkrlwe.ErrTruncated, Msg: "ciphertext metadata"}
 	}
 
-	return data, nil
+	ciphertext.Ciphertext = new(mkrlwe.Ciphertext)
+
+	ciphertext.Scale = math.Float64frombits(binary.BigEndian.Uint64(data[0:8]))
+
+	return ciphertext.Ciphertext.Decode(data[8:])
 }
 
-// UnmarshalBinary decodes a previously marshaled Ciphertext on the target Ciphertext.
-func (ciphertext *Ciphertext) UnmarshalBinary(data []byte) (err error) {
-	if len(data) < 10 { // cf. ciphertext.GetDataLen()
-		return errors.New("too small bytearray")
+// MarshalBinaryAtLevel encodes a Ciphertext on a byte slice, dropping its moduli above level.
+// The receiver decodes a Ciphertext at the given level.
+func (ciphertext *Ciphertext) MarshalBinaryAtLevel(level int) (data []byte, err error) {
+
+	if level < 0 || level > ciphertext.Level() {
+		return nil, fmt.Errorf("cannot MarshalBinaryAtLevel: level %d is not in [0, %d]", level, ciphertext.Level())
 	}
 
-	ciphertext.Ciphertext = new(mkrlwe.Ciphertext)
+	ctLvl := &Ciphertext{Ciphertext: new(mkrlwe.Ciphertext), Scale: ciphertext.Scale}
+	ctLvl.Value = make(map[string]*ring.Poly)
+	ctLvl.Fingerprint = ciphertext.Fingerprint
+
+	for id, pol := range ciphertext.Value {
+		ctLvl.Value[id] = &ring.Poly{Coeffs: pol.Coeffs[:level+1], IsNTT: pol.IsNTT, IsMForm: pol.IsMForm}
+	}
 
-	ciphertext.Value = make(map[string]*ring.Poly)
+	return ctLvl.MarshalBinary()
+}
 
-	ciphertext.Scale = math.Float64frombits(binary.LittleEndian.Uint64(data[1:9]))
+// GetDataLen returns the length in bytes of the payload of the target SeededCiphertext.
+func (sct *SeededCiphertext) GetDataLen(WithMetaData bool) (dataLen int) {
+	// 8 byte : Scale
+	if WithMetaData {
+		dataLen += 8
+	}
 
-	var pointer, inc int
-	pointer = 10
+	dataLen += sct.SeededCiphertext.GetDataLen(WithMetaData)
 
-	for pointer < len(data) {
-		idLen := int(data[pointer])
-		pointer += 1
+	return dataLen
+}
+
+// MarshalBinary encodes a SeededCiphertext on a byte slice bound to its fingerprint.
+func (sct *SeededCiphertext) MarshalBinary() (data []byte, err error) {
+	return mkrlwe.MarshalEnvelope(mkrlwe.KindSeededCiphertext, sct.Fingerprint, sct.GetDataLen(true), func(payload []byte) (err error) {
+		binary.BigEndian.PutUint64(payload[0:8], math.Float64bits(sct.Scale))
+		_, err = sct.SeededCiphertext.Encode(payload[8:])
+		return
+	})
+}
 
-		ID := string(data[pointer : pointer+idLen])
-		pointer += idLen
+// UnmarshalBinary decodes a previously marshaled SeededCiphertext on the target SeededCiphertext.
+func (sct *SeededCiphertext) UnmarshalBinary(data []byte) (err error) {
 
-		ciphertext.Value[ID] = new(ring.Poly)
+	var hdr mkrlwe.EnvelopeHeader
 
-		if inc, err = ciphertext.Value[ID].DecodePolyNew(data[pointer:]); err != nil {
+	if hdr, err = mkrlwe.UnmarshalEnvelope(mkrlwe.KindSeededCiphertext, data, sct.decode); err != nil {
+		return err
+	}
+
+	sct.Fingerprint = hdr.ParamHash
+
+	return nil
+}
+
+func (sct *SeededCiphertext) decode(data []byte) (err error) {
+	if len(data) < 8 {
+		return &mkrlwe.DecodingError{Err: mkrlwe.ErrTruncated, Msg: "seeded ciphertext metadata"}
+	}
+
+	sct.Scale = math.Float64frombits(binary.BigEndian.Uint64(data[0:8]))
+	sct.SeededCiphertext = new(mkrlwe.SeededCiphertext)
+
+	return sct.SeededCiphertext.Decode(data[8:])
+}
+
+// WriteTo writes the target Ciphertext to w.
+func (ciphertext *Ciphertext) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := ciphertext.GetDataLen(true)
+	return mkrlwe.WriteEnvelope(w, mkrlwe.KindCiphertext, ciphertext.Fingerprint, payloadLen, func(w io.Writer) (err error) {
+		data := make([]byte, payloadLen)
+		if err = ciphertext.encode(data); err != nil {
 			return err
 		}
+		_, err = w.Write(data)
+		return err
+	})
+}
 
-		pointer += inc
-	}
+// ReadFrom reads a Ciphertext written by WriteTo or MarshalBinary from r in the target Ciphertext.
+func (ciphertext *Ciphertext) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = mkrlwe.ReadEnvelope(r, mkrlwe.KindCiphertext, func(hdr mkrlwe.EnvelopeHeader, payload io.Reader) error {
+		data, err := io.ReadAll(payload)
+		if err != nil {
+			return err
+		}
+		if err = ciphertext.decode(data); err != nil {
+			return err
+		}
+		ciphertext.Fingerprint = hdr.ParamHash
+		return nil
+	})
+	return
+}
 
-	if pointer != len(data) {
-		return errors.New("remaining unparsed data")
+// WriteTo writes the target SeededCiphertext to w.
+func (sct *SeededCiphertext) WriteTo(w io.Writer) (n int64, err error) {
+
+	var data []byte
+	if data, err = sct.MarshalBinary(); err != nil {
+		return 0, err
 	}
 
-	return nil
+	var m int
+	m, err = w.Write(data)
+
+	return int64(m), err
+}
+
+// ReadFrom reads a SeededCiphertext written by WriteTo or MarshalBinary from r in the target SeededCiphertext.
+func (sct *SeededCiphertext) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = mkrlwe.ReadEnvelope(r, mkrlwe.KindSeededCiphertext, func(hdr mkrlwe.EnvelopeHeader, payload io.Reader) error {
+		data, err := io.ReadAll(payload)
+		if err != nil {
+			return err
+		}
+		if err = sct.decode(data); err != nil {
+			return err
+		}
+		sct.Fingerprint = hdr.ParamHash
+		return nil
+	})
+	return
 }
@@ -39,6 +39,7 @@ func BenchmarkMKCKKS(b *testing.B) {
 
 		for numUsers := 2; numUsers <= *maxUsers; numUsers *= 2 {
 			benchMulAndRelin(testContext, userList[:numUsers], b)
+			benchLazyRelin(testContext, userList[:numUsers], b)
 			//benchMulAndRelinHoisted(testContext, userList[:numUsers], b)
 			//benchSquareHoisted(testContext, userList[:numUsers], b)
 		}
@@ -83,6 +84,54 @@ func benchMulAndRelin(testContext *testParams, userList []string, b *testing.B)
 	})
 }
 
+func benchLazyRelin(testContext *testParams, userList []string, b *testing.B) {
+
+	numUsers := len(userList)
+
+	rlkSet := testContext.rlkSet
+	eval := testContext.evaluator
+
+	ct0 := newTestCiphertext(testContext, userList)
+	ct1 := newTestCiphertext(testContext, userList)
+
+	// sums of numTerms products relinearized one by one or once
+	for _, numTerms := range []int{1, 2, 4, 8} {
+		terms := "/" + strconv.Itoa(numTerms) + " terms"
+
+		b.Run(GetTestName(testContext.params, "MKSumMulRelin: "+strconv.Itoa(numUsers)+terms+"/ "), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				acc := eval.MulRelinNew(ct0, ct1, rlkSet)
+				for j := 1; j < numTerms; j++ {
+					eval.Add(acc, eval.MulRelinNew(ct0, ct1, rlkSet), acc)
+				}
+			}
+		})
+
+		b.Run(GetTestName(testContext.params, "MKSumMulNoRelin: "+strconv.Itoa(numUsers)+terms+"/ "), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				acc := eval.MulNoRelinNew(ct0, ct1)
+				for j := 1; j < numTerms; j++ {
+					eval.AddTensored(acc, eval.MulNoRelinNew(ct0, ct1), acc)
+				}
+				eval.RelinearizeNew(acc, rlkSet)
+			}
+		})
+	}
+}
+
+// newTestCiphertext returns the sum of fresh ciphertexts of the parties of userList
+func newTestCiphertext(testContext *testParams, userList []string) (ct *Ciphertext) {
+	for _, id := range userList {
+		_, cti := newTestVectors(testContext, id, complex(-1, 1), complex(-1, 1))
+		if ct == nil {
+			ct = cti
+		} else {
+			ct = testContext.evaluator.AddNew(ct, cti)
+		}
+	}
+	return
+}
+
 func benchRotate(testContext *testParams, userList []string, b *testing.B) {
 
 	numUsers := len(userList)
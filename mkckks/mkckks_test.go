@@ -1,9 +1,11 @@
 package mkckks
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"strconv"
+	"sync"
 	"testing"
 
 	"mk-lr/mkrlwe"
@@ -124,6 +126,22 @@ func TestCKKS(t *testing.T) {
 
 		for numUsers := 2; numUsers <= *maxUsers; numUsers *= 2 {
 			testEvaluatorMul(testContext, userList[:numUsers], t)
+			testDecryptionShares(testContext, userList[:numUsers], t)
+			testSmudgingPrecision(testContext, userList[:numUsers], t)
+			testMarshaler(testContext, userList[:numUsers], t)
+			testCompression(testContext, userList[:numUsers], t)
+			testEvaluatePoly(testContext, userList[:numUsers], t)
+			testEvaluatorAddConstPtxt(testContext, userList[:numUsers], t)
+			testEvaluatorInPlace(testContext, userList[:numUsers], t)
+			testEvaluatorAlign(testContext, userList[:numUsers], t)
+			testEvaluatorInnerSum(testContext, userList[:numUsers], t)
+			testEvaluatorRotationPlan(testContext, userList[:numUsers], t)
+			testEvaluatorConcurrent(testContext, userList[:numUsers], t)
+			testEvaluatorSwitchPartyKey(testContext, userList[:numUsers], t)
+			testEvaluatorTensored(testContext, userList[:numUsers], t)
+			testEvaluatorRescalePolicy(testContext, userList[:numUsers], t)
+			testCollective(testContext, userList[:numUsers], t)
+			testSession(testContext, userList[:numUsers], t)
 			//testEvaluatorMulHoisted(testContext, userList[:numUsers], t)
 			//testEvaluatorMulPtxt(testContext, userList[:numUsers], t)
 			//testEvaluatorRot(testContext, userList[:numUsers], t)
@@ -199,6 +217,33 @@ func newTestVectors(testContext *testParams, id string, a, b complex128) (msg *M
 	return msg, ciphertext
 }
 
+// testLogPrecision is the number of bits, above the precision of the scale and the slots, lost by the evaluations of the tests
+const testLogPrecision = 12
+
+// requireTestMessage requires msgRes to match want up to testLogPrecision bits in the real and imaginary parts of every slot
+func requireTestMessage(t *testing.T, params Parameters, msgRes, want *Message) {
+	bound := -math.Log2(params.Scale()) + float64(params.LogSlots()) + testLogPrecision
+	for i := range msgRes.Value {
+		delta := msgRes.Value[i] - want.Value[i]
+		require.GreaterOrEqual(t, bound, math.Log2(math.Abs(real(delta))))
+		require.GreaterOrEqual(t, bound, math.Log2(math.Abs(imag(delta))))
+	}
+}
+
+// testSmudgingLogBound returns the bound on the smudging noise of the shares of numShares parties for which requireTestMessage holds,
+// with a margin of 4 bits for evaluating the re-encrypted ciphertexts.
+func testSmudgingLogBound(params Parameters, numShares int) int {
+	logPrecision := math.Log2(params.Scale()) - float64(params.LogSlots()) - testLogPrecision + 4
+	return params.SmudgingLogBound(params.MaxLevel(), params.Scale(), numShares, logPrecision)
+}
+
+// newTestSmudgingDecryptor returns a decryptor whose decryption and re-encryption shares are smudged within testSmudgingLogBound
+func newTestSmudgingDecryptor(params Parameters, numShares int) (dec *Decryptor) {
+	dec = NewDecryptor(params)
+	dec.SetSmudgingLogBound(testSmudgingLogBound(params, numShares))
+	return
+}
+
 func testEncAndDec(testContext *testParams, userList []string, t *testing.T) {
 
 	params := testContext.params
@@ -362,6 +407,510 @@ func testEvaluatorMul(testContext *testParams, userList []string, t *testing.T)
 
 }
 
+func testEvaluatorSwitchPartyKey(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+
+	kgen := testContext.kgen
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	msg := NewMessage(params)
+	var ct *Ciphertext
+	for i := range userList {
+		msgi, cti := newTestVectors(testContext, userList[i],
+			complex(-1.0/float64(numUsers), -1.0/float64(numUsers)),
+			complex(1.0/float64(numUsers), 1.0/float64(numUsers)))
+
+		if i == 0 {
+			ct = cti
+		} else {
+			ct = eval.AddNew(ct, cti)
+		}
+
+		for j := range msg.Value {
+			msg.Value[j] += msgi.Value[j]
+		}
+	}
+
+	t.Run(GetTestName(params, "MKSwitchPartyKey: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		// the first party rotates its secret key and sends a switching key to the evaluator
+		id := userList[0]
+		skOld := testContext.skSet.GetSecretKey(id)
+		skNew := kgen.GenSecretKey(id)
+		swk := kgen.GenPartySwitchingKey(skOld, skNew)
+
+		ctOut := ct.CopyNew()
+		require.Error(t, eval.SwitchPartyKey(ctOut, userList[1], swk))
+		require.Error(t, eval.SwitchPartyKey(NewCiphertext(params, mkrlwe.NewIDSet(), ct.Level(), ct.Scale), id, swk))
+
+		require.NoError(t, eval.SwitchPartyKey(ctOut, id, swk))
+		require.Equal(t, ct.Level(), ctOut.Level())
+		require.Equal(t, ct.Scale, ctOut.Scale)
+		for _, other := range userList[1:] {
+			require.True(t, ct.Value[other].Equals(ctOut.Value[other]))
+		}
+
+		skSet := mkrlwe.NewSecretKeySet()
+		rlkSet := mkrlwe.NewRelinearizationKeyKeySet(params.Parameters)
+		for _, other := range userList[1:] {
+			skSet.AddSecretKey(testContext.skSet.GetSecretKey(other))
+			rlkSet.AddRelinearizationKey(testContext.rlkSet.GetRelinearizationKey(other))
+		}
+		skSet.AddSecretKey(skNew)
+		rlkSet.AddRelinearizationKey(kgen.GenRelinearizationKey(skNew, kgen.GenSecretKey(id)))
+
+		requireTestMessage(t, params, dec.Decrypt(ctOut, skSet), msg)
+
+		// the refreshed ciphertext keeps being evaluated with the new keys of the party
+		msgSq := NewMessage(params)
+		for j := range msgSq.Value {
+			msgSq.Value[j] = msg.Value[j] * msg.Value[j]
+		}
+		requireTestMessage(t, params, dec.Decrypt(eval.MulRelinNew(ctOut, ctOut, rlkSet), skSet), msgSq)
+	})
+}
+
+func testEvaluatorTensored(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+
+	rlkSet := testContext.rlkSet
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	// inner product of the vectors Z and V, where Z_i is encrypted by party i and V_i by party i+1
+	msgZ := make([]*Message, numUsers)
+	msgV := make([]*Message, numUsers)
+	ctZ := make([]*Ciphertext, numUsers)
+	ctV := make([]*Ciphertext, numUsers)
+	for i := range userList {
+		msgZ[i], ctZ[i] = newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+		msgV[i], ctV[i] = newTestVectors(testContext, userList[(i+1)%numUsers], complex(-1, -1), complex(1, 1))
+	}
+
+	msg := NewMessage(params)
+	for i := range userList {
+		for j := range msg.Value {
+			msg.Value[j] += msgZ[i].Value[j] * msgV[i].Value[j]
+		}
+	}
+
+	requireMsg := func(t *testing.T, ctRes *Ciphertext, want *Message) {
+		requireTestMessage(t, params, dec.Decrypt(ctRes, testContext.skSet), want)
+	}
+
+	t.Run(GetTestName(params, "MKTensored: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		acc := eval.MulNoRelinNew(ctZ[0], ctV[0])
+		require.Equal(t, ctZ[0].Scale*ctV[0].Scale, acc.Scale)
+
+		for i := 1; i < numUsers; i++ {
+			require.NoError(t, eval.AddTensored(acc, eval.MulNoRelinNew(ctZ[i], ctV[i]), acc))
+		}
+
+		idset := mkrlwe.NewIDSet()
+		for _, id := range userList {
+			idset.Add(id)
+		}
+		require.Equal(t, idset.Sorted(), acc.IDSet().Sorted())
+
+		ctRes := eval.RelinearizeNew(acc, rlkSet)
+		require.Equal(t, ctZ[0].Level()-1, ctRes.Level())
+		requireMsg(t, ctRes, msg)
+
+		// the lazy relinearization gives the same result as adding the outputs of MulRelin
+		ctEager := eval.MulRelinNew(ctZ[0], ctV[0], rlkSet)
+		for i := 1; i < numUsers; i++ {
+			eval.Add(ctEager, eval.MulRelinNew(ctZ[i], ctV[i], rlkSet), ctEager)
+		}
+		requireMsg(t, eval.SubNew(ctRes, ctEager), NewMessage(params))
+	})
+
+	t.Run(GetTestName(params, "MKTensoredAlign: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		// a product taken one level lower and with an integer multiple of the scale is matched by AddTensored
+		ctZLow := eval.DropLevelNew(ctZ[1], 1)
+		ctZLow.Scale *= 2
+		eval.params.RingQ().MulScalarLvl(ctZLow.Level(), ctZLow.Value["0"], 2, ctZLow.Value["0"])
+		eval.params.RingQ().MulScalarLvl(ctZLow.Level(), ctZLow.Value[userList[1]], 2, ctZLow.Value[userList[1]])
+
+		op0 := eval.MulNoRelinNew(ctZ[0], ctV[0])
+		op1 := eval.MulNoRelinNew(ctZLow, ctV[1])
+
+		ctOut := eval.AddTensoredNew(op0, op1)
+		require.Equal(t, op1.Level(), ctOut.Level())
+		require.Equal(t, op1.Scale, ctOut.Scale)
+
+		// the output can be the second operand
+		require.NoError(t, eval.AddTensored(op0, op1, op1))
+
+		want := NewMessage(params)
+		for j := range want.Value {
+			want.Value[j] = msgZ[0].Value[j]*msgV[0].Value[j] + msgZ[1].Value[j]*msgV[1].Value[j]
+		}
+		requireMsg(t, eval.RelinearizeNew(ctOut, rlkSet), want)
+		requireMsg(t, eval.RelinearizeNew(op1, rlkSet), want)
+
+		op0.Scale *= 1.5
+		require.Error(t, eval.AddTensored(op0, op1, op1))
+	})
+}
+
+func testEvaluatorRescalePolicy(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+
+	rlkSet := testContext.rlkSet
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	msgZ := make([]*Message, numUsers)
+	msgV := make([]*Message, numUsers)
+	ctZ := make([]*Ciphertext, numUsers)
+	ctV := make([]*Ciphertext, numUsers)
+	for i := range userList {
+		msgZ[i], ctZ[i] = newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+		msgV[i], ctV[i] = newTestVectors(testContext, userList[(i+1)%numUsers], complex(-1, -1), complex(1, 1))
+	}
+
+	// sum of the products Z_i * V_i, each computed once with V_i encrypted and once with V_i encoded
+	msg := NewMessage(params)
+	for i := range userList {
+		for j := range msg.Value {
+			msg.Value[j] += msgZ[i].Value[j]*msgV[i].Value[j] + msgZ[i].Value[j]*msgV[i].Value[j]
+		}
+	}
+
+	requireMsg := func(t *testing.T, ctRes *Ciphertext, want *Message) {
+		requireTestMessage(t, params, dec.Decrypt(ctRes, testContext.skSet), want)
+	}
+
+	t.Run(GetTestName(params, "MKMulNoRescale: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		level := ctZ[0].Level()
+
+		var acc *Ciphertext
+		for i := range userList {
+			prod := eval.MulRelinNoRescaleNew(ctZ[i], ctV[i], rlkSet)
+			require.Equal(t, level, prod.Level())
+			require.Equal(t, ctZ[i].Scale*ctV[i].Scale, prod.Scale)
+
+			pt := testContext.encryptor.EncodeMsgNew(msgV[i])
+			prodPtxt := eval.MulPtxtNoRescaleNew(ctZ[i], pt)
+			require.Equal(t, level, prodPtxt.Level())
+			require.Equal(t, ctZ[i].Scale*pt.Scale, prodPtxt.Scale)
+
+			if acc == nil {
+				acc = eval.AddNew(prod, prodPtxt)
+			} else {
+				require.NoError(t, eval.Add(acc, prod, acc))
+				require.NoError(t, eval.Add(acc, prodPtxt, acc))
+			}
+		}
+
+		ctRes, err := eval.RescaleNew(acc, params.Scale())
+		require.NoError(t, err)
+		require.Equal(t, level-1, ctRes.Level())
+		requireMsg(t, ctRes, msg)
+	})
+
+	t.Run(GetTestName(params, "MKRescalePolicy: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		evalManual := eval.ShallowCopy()
+		evalManual.SetRescalePolicy(RescaleManual)
+		require.Equal(t, RescaleAuto, eval.RescalePolicy())
+		require.Equal(t, RescaleManual, evalManual.RescalePolicy())
+		require.Equal(t, RescaleManual, evalManual.ShallowCopy().RescalePolicy())
+
+		ct := evalManual.MulRelinNew(ctZ[0], ctV[0], rlkSet)
+		require.Equal(t, ctZ[0].Level(), ct.Level())
+		require.Equal(t, ctZ[0].Scale*ctV[0].Scale, ct.Scale)
+
+		// the output of Rescale is a copy of its input if no rescaling is needed
+		ctCopy := NewCiphertext(params, mkrlwe.NewIDSet(), ct.Level(), 0)
+		require.NoError(t, evalManual.Rescale(ct, ct.Scale, ctCopy))
+		require.Equal(t, ct.Level(), ctCopy.Level())
+		require.Equal(t, ct.Scale, ctCopy.Scale)
+		require.Equal(t, ct.IDSet().Sorted(), ctCopy.IDSet().Sorted())
+
+		require.NoError(t, evalManual.Rescale(ct, params.Scale(), ct))
+		require.Equal(t, ctZ[0].Level()-1, ct.Level())
+
+		want := NewMessage(params)
+		for j := range want.Value {
+			want.Value[j] = msgZ[0].Value[j] * msgV[0].Value[j]
+		}
+		requireMsg(t, ct, want)
+		requireMsg(t, eval.MulRelinNew(ctZ[0], ctV[0], rlkSet), want)
+
+		// a product at level 0 cannot be rescaled
+		ctZ0 := eval.DropLevelNew(ctZ[0], ctZ[0].Level())
+		ctV0 := eval.DropLevelNew(ctV[0], ctV[0].Level())
+		require.Panics(t, func() { eval.MulRelinNew(ctZ0, ctV0, rlkSet) })
+		require.NotPanics(t, func() { evalManual.MulRelinNew(ctZ0, ctV0, rlkSet) })
+	})
+}
+
+func testCollective(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+
+	kgen := testContext.kgen
+	eval := testContext.evaluator
+	dec := newTestSmudgingDecryptor(params, numUsers+1)
+
+	msg := NewMessage(params)
+	var ct *Ciphertext
+	for i := range userList {
+		msgi, cti := newTestVectors(testContext, userList[i],
+			complex(-1.0/float64(numUsers), -1.0/float64(numUsers)),
+			complex(1.0/float64(numUsers), 1.0/float64(numUsers)))
+
+		if i == 0 {
+			ct = cti
+		} else {
+			ct = eval.AddNew(ct, cti)
+		}
+
+		for j := range msg.Value {
+			msg.Value[j] += msgi.Value[j]
+		}
+	}
+
+	t.Run(GetTestName(params, "MKCollective: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		pks := make([]*mkrlwe.PublicKey, numUsers)
+		rlks := make([]*mkrlwe.RelinearizationKey, numUsers)
+		rks := make([]*mkrlwe.RotationKey, numUsers)
+		for i, id := range userList {
+			pks[i] = testContext.pkSet.GetPublicKey(id)
+			rlks[i] = testContext.rlkSet.GetRelinearizationKey(id)
+			rks[i] = testContext.rtkSet.GetRotationKey(id, 1)
+		}
+
+		_, err := mkrlwe.GenCollectivePublicKey(params.Parameters, userList[0], pks)
+		require.Error(t, err)
+		_, err = mkrlwe.GenCollectivePublicKey(params.Parameters, "group", append(pks, pks[0]))
+		require.Error(t, err)
+
+		cpk, err := mkrlwe.GenCollectivePublicKey(params.Parameters, "group", pks)
+		require.NoError(t, err)
+		require.Equal(t, numUsers, cpk.Parties.Size())
+
+		_, err = cpk.GenRelinearizationKey(rlks[1:])
+		require.Error(t, err)
+		crlk, err := cpk.GenRelinearizationKey(rlks)
+		require.NoError(t, err)
+		crk, err := cpk.GenRotationKey(rks)
+		require.NoError(t, err)
+
+		// the parties of ct re-encrypt their components towards the collective public key
+		shares := make([]*mkrlwe.ReencryptionShare, numUsers)
+		for i, id := range userList {
+			shares[i] = dec.GenReencryptionShare(ct, testContext.skSet.GetSecretKey(id), cpk.PublicKey)
+		}
+
+		_, err = dec.ConvertToCollective(ct, cpk, shares[1:])
+		require.Error(t, err)
+
+		ctCol, err := dec.ConvertToCollective(ct, cpk, shares)
+		require.NoError(t, err)
+		require.Equal(t, []string{"group"}, ctCol.IDSet().Sorted())
+		require.Equal(t, 2, len(ctCol.Value))
+		require.Equal(t, ct.Level(), ctCol.Level())
+		require.Equal(t, ct.Scale, ctCol.Scale)
+
+		// a new party joins with its own keys and the collective ciphertext is evaluated with the keys of the group
+		skJoin, pkJoin := kgen.GenKeyPair("joiner")
+		msgJoin, _ := newTestVectors(testContext, userList[0], complex(-1, -1), complex(1, 1))
+		ctJoin := testContext.encryptor.EncryptMsgNew(msgJoin, pkJoin)
+
+		rlkSet := mkrlwe.NewRelinearizationKeyKeySet(params.Parameters)
+		rlkSet.AddRelinearizationKey(crlk)
+		rlkSet.AddRelinearizationKey(kgen.GenRelinearizationKey(skJoin, kgen.GenSecretKey("joiner")))
+
+		ctMix := eval.AddNew(ctCol, ctJoin)
+		ctRes := eval.MulRelinNew(ctMix, ctMix, rlkSet)
+		require.Equal(t, []string{"group", "joiner"}, ctRes.IDSet().Sorted())
+
+		want := NewMessage(params)
+		for j := range want.Value {
+			want.Value[j] = (msg.Value[j] + msgJoin.Value[j]) * (msg.Value[j] + msgJoin.Value[j])
+		}
+
+		// the parties of the group decrypt the component of the group together
+		decShares := make([]*mkrlwe.DecryptionShare, numUsers)
+		for i, id := range userList {
+			decShares[i] = dec.GenCollectiveDecryptionShare(ctRes, testContext.skSet.GetSecretKey(id), cpk)
+		}
+
+		_, err = cpk.AggregateDecryptionShares(decShares[1:])
+		require.Error(t, err)
+		groupShare, err := cpk.AggregateDecryptionShares(decShares)
+		require.NoError(t, err)
+
+		msgRes, err := dec.MergeDecryptionShares(ctRes, []*mkrlwe.DecryptionShare{groupShare, dec.GenDecryptionShare(ctRes, skJoin)})
+		require.NoError(t, err)
+		requireTestMessage(t, params, msgRes, want)
+
+		// rotations of the collective ciphertext use the rotation key of the group
+		rtkSet := mkrlwe.NewRotationKeySet()
+		rtkSet.AddRotationKey(crk)
+		ctRot := eval.RotateNew(ctCol, 1, rtkSet)
+
+		for i := range decShares {
+			decShares[i] = dec.GenCollectiveDecryptionShare(ctRot, testContext.skSet.GetSecretKey(userList[i]), cpk)
+		}
+		groupShare, err = cpk.AggregateDecryptionShares(decShares)
+		require.NoError(t, err)
+
+		msgRes, err = dec.MergeDecryptionShares(ctRot, []*mkrlwe.DecryptionShare{groupShare})
+		require.NoError(t, err)
+
+		wantRot := NewMessage(params)
+		for j := range wantRot.Value {
+			wantRot.Value[j] = msg.Value[(j+1)%len(msg.Value)]
+		}
+		requireTestMessage(t, params, msgRes, wantRot)
+	})
+}
+
+func testSession(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+
+	kgen := testContext.kgen
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	t.Run(GetTestName(params, "MKSession: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		session := NewSession(params)
+		require.Equal(t, 0, session.Epoch())
+		require.Equal(t, mkrlwe.DefaultSmudgingSigma, session.SmudgingSigma())
+
+		// the exit shares are smudged within the precision of the test
+		session.SetSmudgingLogBound(testSmudgingLogBound(params, numUsers+1))
+
+		for _, id := range userList {
+			bundle := mkrlwe.NewEvaluationKeyBundle(params.Parameters, id)
+			bundle.PublicKey = testContext.pkSet.GetPublicKey(id)
+			bundle.RelinearizationKey = testContext.rlkSet.GetRelinearizationKey(id)
+			require.NoError(t, session.Join(bundle))
+		}
+		require.Equal(t, numUsers, session.Epoch())
+		require.Equal(t, userList, session.IDSet().Sorted())
+		require.Error(t, session.Join(kgen.GenEvaluationKeyBundle(testContext.skSet.GetSecretKey(userList[0]), nil)))
+
+		msg := NewMessage(params)
+		var model *Ciphertext
+		for i := range userList {
+			msgi, cti := newTestVectors(testContext, userList[i],
+				complex(-0.5/float64(numUsers), -0.5/float64(numUsers)),
+				complex(0.5/float64(numUsers), 0.5/float64(numUsers)))
+
+			if i == 0 {
+				model = cti
+			} else {
+				model = eval.AddNew(model, cti)
+			}
+
+			for j := range msg.Value {
+				msg.Value[j] += msgi.Value[j]
+			}
+		}
+		require.NoError(t, session.Store("model", model))
+
+		// a new party cannot contribute before joining
+		skJoin, pkJoin := kgen.GenKeyPair("joiner")
+		msgJoin, _ := newTestVectors(testContext, userList[0], complex(-0.5, -0.5), complex(0.5, 0.5))
+		ctJoin := testContext.encryptor.EncryptMsgNew(msgJoin, pkJoin)
+		require.Error(t, session.Store("update", ctJoin))
+		require.Equal(t, []string{"model"}, session.Names())
+
+		// a deleted ciphertext is neither listed nor handed over by a leaving party
+		require.NoError(t, session.Store("scratch", model.CopyNew()))
+		require.Equal(t, []string{"model", "scratch"}, session.Names())
+		session.Delete("scratch")
+		require.Equal(t, []string{"model"}, session.Names())
+		require.Nil(t, session.Ciphertext("scratch"))
+
+		// the joiner registers its keys mid-session and the model is padded with its component
+		require.NoError(t, session.Join(kgen.GenEvaluationKeyBundle(skJoin, nil)))
+		require.Equal(t, numUsers+1, session.Epoch())
+		require.True(t, session.Ciphertext("model").IDSet().Has("joiner"))
+		require.Equal(t, numUsers+2, len(session.Ciphertext("model").Value))
+
+		rlkSet := session.EvaluationKeys().RelinearizationKeySet
+		ctMix := eval.AddNew(session.Ciphertext("model"), ctJoin)
+		require.NoError(t, session.Store("model", eval.MulRelinNew(ctMix, ctMix, rlkSet)))
+
+		want := NewMessage(params)
+		for j := range want.Value {
+			want.Value[j] = (msg.Value[j] + msgJoin.Value[j]) * (msg.Value[j] + msgJoin.Value[j])
+		}
+
+		// the first party hands its component over to the second one and leaves
+		leaving, recipient := userList[0], userList[1]
+		skLeaving := testContext.skSet.GetSecretKey(leaving)
+
+		_, err := session.GenExitShares(skLeaving, leaving)
+		require.Error(t, err)
+		_, err = session.GenExitShares(skLeaving, "auditor")
+		require.Error(t, err)
+
+		shares, err := session.GenExitShares(skLeaving, recipient)
+		require.NoError(t, err)
+		require.Len(t, shares, 1)
+
+		require.Error(t, session.Leave(leaving, recipient, nil))
+		require.Error(t, session.Leave(leaving, "joiner", shares))
+		require.Equal(t, numUsers+1, session.Epoch())
+		require.True(t, session.Ciphertext("model").IDSet().Has(leaving))
+
+		modelScale := session.Ciphertext("model").Scale
+		require.NoError(t, session.Leave(leaving, recipient, shares))
+		require.Equal(t, numUsers+2, session.Epoch())
+		require.False(t, session.Ciphertext("model").IDSet().Has(leaving))
+		require.False(t, session.IDSet().Has(leaving))
+		require.Equal(t, modelScale, session.Ciphertext("model").Scale)
+		require.NotContains(t, rlkSet.Value, leaving)
+
+		// the remaining parties keep training without the leaving party
+		model = session.Ciphertext("model")
+		require.NoError(t, session.Store("model", eval.MulRelinNew(model, model, rlkSet)))
+		for j := range want.Value {
+			want.Value[j] *= want.Value[j]
+		}
+
+		skSet := mkrlwe.NewSecretKeySet()
+		skSet.AddSecretKey(skJoin)
+		for _, id := range userList[1:] {
+			skSet.AddSecretKey(testContext.skSet.GetSecretKey(id))
+		}
+		requireTestMessage(t, params, dec.Decrypt(session.Ciphertext("model"), skSet), want)
+
+		// every transition is recorded
+		events := session.Events()
+		require.Len(t, events, numUsers+2)
+		require.Equal(t, mkrlwe.MembershipEvent{Epoch: numUsers + 1, Kind: mkrlwe.PartyJoined, ID: "joiner"}, events[numUsers])
+		require.Equal(t, mkrlwe.MembershipEvent{Epoch: numUsers + 2, Kind: mkrlwe.PartyLeft, ID: leaving, Recipient: recipient}, events[numUsers+1])
+
+		idset, err := session.IDSetAt(numUsers + 1)
+		require.NoError(t, err)
+		require.True(t, idset.Has(leaving))
+		_, err = session.IDSetAt(numUsers + 3)
+		require.Error(t, err)
+	})
+}
+
 func testEvaluatorRescale(testContext *testParams, t *testing.T) {
 
 	t.Run(GetTestName(testContext.params, "Evaluator/Rescale/Single/"), func(t *testing.T) {
@@ -643,3 +1192,1239 @@ func testEvaluatorMulPtxt(testContext *testParams, userList []string, t *testing
 	})
 
 }
+
+func testDecryptionShares(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	msgList := make([]*Message, numUsers)
+	ctList := make([]*Ciphertext, numUsers)
+
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	for i := range userList {
+		msgList[i], ctList[i] = newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+	}
+
+	ct := ctList[0]
+	msg := NewMessage(params)
+
+	for i := range userList {
+		if i > 0 {
+			ct = eval.AddNew(ct, ctList[i])
+		}
+
+		for j := range msg.Value {
+			msg.Value[j] += msgList[i].Value[j]
+		}
+	}
+
+	t.Run(GetTestName(testContext.params, "MKDecryptionShares: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		shares := make([]*mkrlwe.DecryptionShare, numUsers)
+		for i := range userList {
+			share := dec.GenDecryptionShare(ct, testContext.skSet.GetSecretKey(userList[i]))
+
+			data, err := share.MarshalBinary()
+			require.NoError(t, err)
+
+			shares[i] = new(mkrlwe.DecryptionShare)
+			require.NoError(t, shares[i].UnmarshalBinary(data))
+		}
+
+		_, err := dec.MergeDecryptionShares(ct, shares[1:])
+		require.Error(t, err)
+
+		msgRes, err := dec.MergeDecryptionShares(ct, shares)
+		require.NoError(t, err)
+
+		for i := range msgRes.Value {
+			delta := msgRes.Value[i] - msg.Value[i]
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+24, math.Log2(math.Abs(real(delta))))
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+24, math.Log2(math.Abs(imag(delta))))
+		}
+	})
+}
+
+func testSmudgingPrecision(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	msgList := make([]*Message, numUsers)
+	ctList := make([]*Ciphertext, numUsers)
+
+	eval := testContext.evaluator
+	dec := NewDecryptor(params)
+	defer dec.SetSmudgingSigma(mkrlwe.DefaultSmudgingSigma)
+
+	for i := range userList {
+		msgList[i], ctList[i] = newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+	}
+
+	ct := ctList[0]
+	msg := NewMessage(params)
+
+	for i := range userList {
+		if i > 0 {
+			ct = eval.AddNew(ct, ctList[i])
+		}
+
+		for j := range msg.Value {
+			msg.Value[j] += msgList[i].Value[j]
+		}
+	}
+
+	maxLogErr := func(msgRes *Message) (logErr float64) {
+		logErr = math.Inf(-1)
+		for i := range msgRes.Value {
+			delta := msgRes.Value[i] - msg.Value[i]
+			logErr = math.Max(logErr, math.Log2(math.Abs(real(delta))))
+			logErr = math.Max(logErr, math.Log2(math.Abs(imag(delta))))
+		}
+		return
+	}
+
+	for _, logPrecision := range []float64{10, 20} {
+
+		t.Run(GetTestName(testContext.params, "MKSmudging/Precision="+strconv.Itoa(int(logPrecision))+": "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+			logBound := params.SmudgingLogBound(ct.Level(), ct.Scale, numUsers, logPrecision)
+			dec.SetSmudgingLogBound(logBound)
+			require.NoError(t, dec.CheckSmudging(ct, logPrecision))
+
+			shares := make([]*mkrlwe.DecryptionShare, numUsers)
+			for i := range userList {
+				shares[i] = dec.GenDecryptionShare(ct, testContext.skSet.GetSecretKey(userList[i]))
+			}
+
+			dec.SetPrecision(logPrecision)
+			defer dec.SetPrecision(0)
+
+			msgRes, err := dec.MergeDecryptionShares(ct, shares)
+			require.NoError(t, err)
+
+			logErrShares := maxLogErr(msgRes)
+			logErrDirect := maxLogErr(dec.Decrypt(ct, testContext.skSet))
+
+			t.Logf("smudging bound 2^%d: decryption error 2^%.2f with shares, 2^%.2f without", logBound, logErrShares, logErrDirect)
+			require.GreaterOrEqual(t, -logPrecision, logErrShares)
+
+			// doubling the noise breaks the tolerance
+			dec.SetSmudgingLogBound(logBound + 1)
+			require.Error(t, dec.CheckSmudging(ct, logPrecision))
+
+			// and the merge of shares flooded with this noise is rejected
+			for i := range userList {
+				shares[i] = dec.GenDecryptionShare(ct, testContext.skSet.GetSecretKey(userList[i]))
+			}
+			_, err = dec.MergeDecryptionShares(ct, shares)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestReencryption(t *testing.T) {
+
+	ckksParams, err := ckks.NewParametersFromLiteral(PN14QP439)
+	require.NoError(t, err)
+
+	params := NewParameters(ckksParams)
+	testContext := &testParams{
+		params:    params,
+		kgen:      NewKeyGenerator(params),
+		skSet:     mkrlwe.NewSecretKeySet(),
+		pkSet:     mkrlwe.NewPublicKeyKeySet(),
+		encryptor: NewEncryptor(params),
+		decryptor: NewDecryptor(params),
+		evaluator: NewEvaluator(params),
+	}
+
+	userList := make([]string, 8)
+	for i := range userList {
+		userList[i] = "user" + strconv.Itoa(i)
+		sk, pk := testContext.kgen.GenKeyPair(userList[i])
+		testContext.skSet.AddSecretKey(sk)
+		testContext.pkSet.AddPublicKey(pk)
+	}
+
+	for numUsers := 2; numUsers <= len(userList); numUsers++ {
+		testReencryption(testContext, userList[:numUsers], t)
+	}
+}
+
+func testReencryption(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	msg := NewMessage(params)
+	var ct *Ciphertext
+	for i := range userList {
+		msgi, cti := newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+
+		if i == 0 {
+			ct = cti
+		} else {
+			ct = eval.AddNew(ct, cti)
+		}
+
+		for j := range msg.Value {
+			msg.Value[j] += msgi.Value[j]
+		}
+	}
+
+	skRecipient, pkRecipient := testContext.kgen.GenKeyPair("recipient")
+
+	t.Run(GetTestName(params, "MKReencryption: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		shares := make([]*mkrlwe.ReencryptionShare, numUsers)
+		for i := range userList {
+			share := dec.GenReencryptionShare(ct, testContext.skSet.GetSecretKey(userList[i]), pkRecipient)
+
+			data, err := share.MarshalBinary()
+			require.NoError(t, err)
+
+			shares[i] = new(mkrlwe.ReencryptionShare)
+			require.NoError(t, shares[i].UnmarshalBinary(data))
+		}
+
+		_, err := dec.MergeReencryptionShares(ct, shares[1:])
+		require.Error(t, err)
+
+		ctOut, err := dec.MergeReencryptionShares(ct, shares)
+		require.NoError(t, err)
+		require.Equal(t, 1, ctOut.IDSet().Size())
+		require.Equal(t, ct.Level(), ctOut.Level())
+		require.Equal(t, ct.Scale, ctOut.Scale)
+
+		// the parties cannot decrypt the result, the recipient decrypts it alone
+		require.Panics(t, func() { dec.Decrypt(ctOut, testContext.skSet) })
+
+		skSet := mkrlwe.NewSecretKeySet()
+		skSet.AddSecretKey(skRecipient)
+		msgRes := dec.Decrypt(ctOut, skSet)
+
+		for i := range msgRes.Value {
+			delta := msgRes.Value[i] - msg.Value[i]
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+24, math.Log2(math.Abs(real(delta))))
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+24, math.Log2(math.Abs(imag(delta))))
+		}
+	})
+}
+
+func testMarshaler(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+
+	t.Run(GetTestName(testContext.params, "MKMarshalCiphertext: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		_, ct := newTestVectors(testContext, userList[0], complex(-1, -1), complex(1, 1))
+		for i := 1; i < numUsers; i++ {
+			_, ct2 := newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+			ct = testContext.evaluator.AddNew(ct, ct2)
+		}
+
+		data, err := ct.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, ct.GetDataLen(true)+mkrlwe.EnvelopeOverhead, len(data))
+
+		hdr, err := mkrlwe.ReadEnvelopeHeader(data)
+		require.NoError(t, err)
+		require.Equal(t, params.Fingerprint(), hdr.ParamHash)
+		require.NoError(t, hdr.CheckParams(params.Parameters))
+
+		ctRecv := new(Ciphertext)
+		require.NoError(t, ctRecv.UnmarshalBinary(data))
+		require.Equal(t, ct.Scale, ctRecv.Scale)
+		require.Equal(t, params.Fingerprint(), ctRecv.Fingerprint)
+		require.Equal(t, len(ct.Value), len(ctRecv.Value))
+		for id := range ct.Value {
+			require.True(t, ct.Value[id].Equals(ctRecv.Value[id]))
+		}
+
+		require.ErrorIs(t, new(Ciphertext).UnmarshalBinary(data[:len(data)-1]), mkrlwe.ErrTruncated)
+		require.ErrorIs(t, new(Ciphertext).UnmarshalBinary(nil), mkrlwe.ErrTruncated)
+
+		buf := new(bytes.Buffer)
+		n, err := ct.WriteTo(buf)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), n)
+
+		ctRecv = new(Ciphertext)
+		n, err = ctRecv.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), n)
+		for id := range ct.Value {
+			require.True(t, ct.Value[id].Equals(ctRecv.Value[id]))
+		}
+
+		_, err = new(Ciphertext).ReadFrom(bytes.NewReader(data[:len(data)-1]))
+		require.ErrorIs(t, err, mkrlwe.ErrTruncated)
+	})
+
+	t.Run(GetTestName(testContext.params, "MKMarshalCiphertext/ManyParties: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		// the number of components is not bounded by a byte
+		idset := mkrlwe.NewIDSet()
+		for i := 0; i < 300; i++ {
+			idset.Add("party" + strconv.Itoa(i))
+		}
+
+		ct := NewCiphertext(params, idset, 0, params.Scale())
+		for id, c := range ct.Value {
+			c.Coeffs[0][0] = uint64(len(id))
+		}
+
+		data, err := ct.MarshalBinary()
+		require.NoError(t, err)
+
+		ctRecv := new(Ciphertext)
+		require.NoError(t, ctRecv.UnmarshalBinary(data))
+		require.Equal(t, 300, ctRecv.Degree())
+		for id := range ct.Value {
+			require.True(t, ct.Value[id].Equals(ctRecv.Value[id]))
+		}
+	})
+
+	t.Run(GetTestName(testContext.params, "MKMarshalParameters: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		data, err := params.MarshalBinary()
+		require.NoError(t, err)
+
+		var paramsRecv Parameters
+		require.NoError(t, paramsRecv.UnmarshalBinary(data))
+		require.Equal(t, params.LogSlots(), paramsRecv.LogSlots())
+		require.Equal(t, params.Scale(), paramsRecv.Scale())
+		require.Equal(t, params.Fingerprint(), paramsRecv.Fingerprint())
+
+		require.ErrorIs(t, new(Ciphertext).UnmarshalBinary(data), mkrlwe.ErrKindMismatch)
+	})
+}
+
+func testCompression(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	skSet := testContext.skSet
+	dec := testContext.decryptor
+
+	checkMsg := func(t *testing.T, msg, msgOut *Message) {
+		for j := range msg.Value {
+			delta := msg.Value[j] - msgOut.Value[j]
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+8, math.Log2(math.Abs(real(delta))))
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+8, math.Log2(math.Abs(imag(delta))))
+		}
+	}
+
+	t.Run(GetTestName(testContext.params, "MKSeededCiphertext: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		msg, ct := newTestVectors(testContext, userList[0], complex(-1, -1), complex(1, 1))
+		sct := testContext.encryptor.EncryptMsgSeededNew(msg, skSet.GetSecretKey(userList[0]))
+
+		ctData, err := ct.MarshalBinary()
+		require.NoError(t, err)
+
+		data, err := sct.MarshalBinary()
+		require.NoError(t, err)
+		require.Less(t, len(data), len(ctData)/2+4096)
+
+		sctRecv := new(SeededCiphertext)
+		require.NoError(t, sctRecv.UnmarshalBinary(data))
+
+		ctOut := sctRecv.Expand(params)
+		require.Equal(t, params.MaxLevel(), ctOut.Level())
+		checkMsg(t, msg, dec.Decrypt(ctOut, skSet))
+
+		// the expanded ciphertext can be evaluated with the ciphertexts of other parties
+		if numUsers > 1 {
+			msg2, ct2 := newTestVectors(testContext, userList[1], complex(-1, -1), complex(1, 1))
+			for j := range msg.Value {
+				msg.Value[j] += msg2.Value[j]
+			}
+			checkMsg(t, msg, dec.Decrypt(testContext.evaluator.AddNew(ctOut, ct2), skSet))
+		}
+	})
+
+	t.Run(GetTestName(testContext.params, "MKMarshalCiphertextAtLevel: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		msg, ct := newTestVectors(testContext, userList[0], complex(-1, -1), complex(1, 1))
+
+		_, err := ct.MarshalBinaryAtLevel(ct.Level() + 1)
+		require.Error(t, err)
+
+		data, err := ct.MarshalBinaryAtLevel(1)
+		require.NoError(t, err)
+
+		ctRecv := new(Ciphertext)
+		require.NoError(t, ctRecv.UnmarshalBinary(data))
+		require.Equal(t, 1, ctRecv.Level())
+		require.Equal(t, params.MaxLevel(), ct.Level())
+		checkMsg(t, msg, dec.Decrypt(ctRecv, skSet))
+	})
+}
+
+func testEvaluatePoly(testContext *testParams, userList []string, t *testing.T) {
+
+	numUsers := len(userList)
+	eval := testContext.evaluator
+
+	// sum of fresh ciphertexts of every user with real messages in [-4, 4]
+	var ct *Ciphertext
+	msg := NewMessage(testContext.params)
+
+	for i := range userList {
+		msgi, cti := newTestVectors(testContext, userList[i], complex(-4/float64(numUsers), 0), complex(4/float64(numUsers), 0))
+
+		if i == 0 {
+			ct = cti
+		} else {
+			ct = eval.AddNew(ct, cti)
+		}
+
+		for j := range msg.Value {
+			msg.Value[j] += msgi.Value[j]
+		}
+	}
+
+	sigmoid := func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+	testCases := []struct {
+		name string
+		f    func(float64) float64
+		pol  *Polynomial
+		err  float64
+	}{
+		// sigmoid approximation of the lr programs
+		{"Sigmoid3", nil, NewPolynomial([]float64{0.5, 0.15012, 0, -0.001593}), 0},
+		{"Sigmoid", sigmoid, Approximate(sigmoid, -4, 4, 7), 1e-2},
+		{"Exp", math.Exp, Approximate(math.Exp, -4, 4, 15), 1e-3},
+		{"Log", math.Log, Approximate(math.Log, 1, 9, 15), 1e-2},
+		{"Tanh", math.Tanh, Approximate(math.Tanh, -4, 4, 15), 1e-2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(GetTestName(testContext.params, "MKEvaluatePoly: "+strconv.Itoa(numUsers)+"/ "+tc.name+"/ "), func(t *testing.T) {
+
+			if ct.Level() < tc.pol.Depth() {
+				t.Skip("not enough levels")
+			}
+
+			ctIn := ct
+			input := msg.Value
+			if tc.name == "Log" {
+				// log is approximated on [1, 9]
+				ctIn = eval.AddNew(ct, testContext.encryptor.EncryptMsgNew(constMessage(testContext.params, 5), testContext.pkSet.GetPublicKey(userList[0])))
+				input = make([]complex128, len(msg.Value))
+				for j := range input {
+					input[j] = msg.Value[j] + 5
+				}
+			}
+
+			ctRes, err := eval.EvaluatePoly(ctIn, tc.pol, testContext.rlkSet)
+			require.NoError(t, err)
+			require.Equal(t, ctIn.Level()-tc.pol.Depth(), ctRes.Level())
+
+			msgRes := testContext.decryptor.Decrypt(ctRes, testContext.skSet)
+
+			for j := range msgRes.Value {
+				x := real(input[j])
+				require.Less(t, math.Abs(real(msgRes.Value[j])-tc.pol.Evaluate(x)), 1e-6)
+
+				if tc.f != nil {
+					require.Less(t, math.Abs(real(msgRes.Value[j])-tc.f(x)), tc.err)
+				}
+			}
+		})
+	}
+
+	t.Run(GetTestName(testContext.params, "MKEvaluatePoly: "+strconv.Itoa(numUsers)+"/ NotEnoughLevels/ "), func(t *testing.T) {
+		pol := NewPolynomial(make([]float64, 1<<(ct.Level()+1)))
+		pol.Coeffs[len(pol.Coeffs)-1] = 1
+
+		_, err := eval.EvaluatePoly(ct, pol, testContext.rlkSet)
+		require.Error(t, err)
+	})
+}
+
+func testEvaluatorAddConstPtxt(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	msgList := make([]*Message, numUsers)
+	ctList := make([]*Ciphertext, numUsers)
+
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	for i := range userList {
+		msgList[i], ctList[i] = newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+	}
+
+	ct := ctList[0]
+	msg := msgList[0]
+
+	for i := range userList {
+		if i > 0 {
+			ct = eval.AddNew(ct, ctList[i])
+
+			for j := range msg.Value {
+				msg.Value[j] += msgList[i].Value[j]
+			}
+		}
+	}
+
+	msgPt, _ := newTestVectors(testContext, userList[0], complex(-1, -1), complex(1, 1))
+	pt := testContext.encryptor.EncodeMsgNew(msgPt)
+
+	// checks that only the "0" component of ct is modified
+	requireSameMask := func(t *testing.T, ctRes *Ciphertext) {
+		require.Equal(t, ct.IDSet().Size(), ctRes.IDSet().Size())
+		for id := range ct.Value {
+			if id != "0" {
+				for i := 0; i < ctRes.Level()+1; i++ {
+					require.Equal(t, ct.Value[id].Coeffs[i], ctRes.Value[id].Coeffs[i])
+				}
+			}
+		}
+	}
+
+	requireClose := func(t *testing.T, ctRes *Ciphertext, op func(complex128, complex128) complex128, want []complex128) {
+		msgRes := dec.Decrypt(ctRes, testContext.skSet)
+		for i := range msgRes.Value {
+			delta := msgRes.Value[i] - op(msg.Value[i], want[i])
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+8, math.Log2(math.Abs(real(delta))))
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+8, math.Log2(math.Abs(imag(delta))))
+		}
+	}
+
+	add := func(a, b complex128) complex128 { return a + b }
+	sub := func(a, b complex128) complex128 { return a - b }
+
+	t.Run(GetTestName(params, "MKAddConst: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		for _, c := range []interface{}{complex(0.25, -1.5), 3.14159, int64(-3), uint64(7)} {
+			ctRes := eval.AddConstNew(ct, c)
+
+			var cmplx complex128
+			switch c := c.(type) {
+			case complex128:
+				cmplx = c
+			case float64:
+				cmplx = complex(c, 0)
+			case int64:
+				cmplx = complex(float64(c), 0)
+			case uint64:
+				cmplx = complex(float64(c), 0)
+			}
+
+			require.Equal(t, ct.Level(), ctRes.Level())
+			require.Equal(t, ct.Scale, ctRes.Scale)
+			requireSameMask(t, ctRes)
+			requireClose(t, ctRes, add, constMessage(params, cmplx).Value)
+		}
+	})
+
+	t.Run(GetTestName(params, "MKAddConstInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctRes := ct.CopyNew()
+		eval.AddConst(ctRes, -0.5, ctRes)
+		requireSameMask(t, ctRes)
+		requireClose(t, ctRes, add, constMessage(params, -0.5).Value)
+	})
+
+	t.Run(GetTestName(params, "MKAddConstForeignOutput: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctLow := eval.DropLevelNew(ct, 1)
+
+		foreign := mkrlwe.NewIDSet()
+		foreign.Add("foreign")
+		ctRes := NewCiphertext(params, foreign, params.MaxLevel(), params.Scale())
+
+		eval.AddConst(ctLow, 0.75, ctRes)
+		require.Equal(t, ctLow.Level(), ctRes.Level())
+		require.Equal(t, ct.IDSet().Sorted(), ctRes.IDSet().Sorted())
+		requireSameMask(t, ctRes)
+		requireClose(t, ctRes, add, constMessage(params, 0.75).Value)
+	})
+
+	t.Run(GetTestName(params, "MKAddPtxt: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctRes := eval.AddPtxtNew(ct, pt)
+		require.Equal(t, ct.Level(), ctRes.Level())
+		requireSameMask(t, ctRes)
+		requireClose(t, ctRes, add, msgPt.Value)
+	})
+
+	t.Run(GetTestName(params, "MKSubPtxt: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctRes := eval.SubPtxtNew(ct, pt)
+		requireSameMask(t, ctRes)
+		requireClose(t, ctRes, sub, msgPt.Value)
+	})
+
+	t.Run(GetTestName(params, "MKAddPtxtNTT: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ptNTT := ckks.NewPlaintext(testContext.encryptor.ckksParams, pt.Level(), pt.Scale)
+		params.RingQ().NTTLvl(pt.Level(), pt.Value, ptNTT.Value)
+
+		ctRes := eval.AddPtxtNew(ct, ptNTT)
+		requireSameMask(t, ctRes)
+		requireClose(t, ctRes, add, msgPt.Value)
+	})
+
+	t.Run(GetTestName(params, "MKSubPtxtLevel: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ptLvl := testContext.encryptor.EncodeMsgNew(msgPt)
+		ptLvl.Value.Coeffs = ptLvl.Value.Coeffs[:ct.Level()]
+
+		ctRes := eval.SubPtxtNew(ct, ptLvl)
+		require.Equal(t, ct.Level()-1, ctRes.Level())
+		requireSameMask(t, ctRes)
+		requireClose(t, ctRes, sub, msgPt.Value)
+	})
+}
+
+func testEvaluatorInPlace(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	msgList := make([]*Message, numUsers)
+	ctList := make([]*Ciphertext, numUsers)
+
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	for i := range userList {
+		msgList[i], ctList[i] = newTestVectors(testContext, userList[i],
+			complex(-1.0/float64(numUsers), -1.0/float64(numUsers)),
+			complex(1.0/float64(numUsers), 1.0/float64(numUsers)))
+	}
+
+	// ctA is encrypted under the first party only and ctB under all the others
+	ctA, msgA := ctList[0], msgList[0]
+	ctB, msgB := ctList[1], NewMessage(params)
+	copy(msgB.Value, msgList[1].Value)
+
+	for i := 2; i < numUsers; i++ {
+		ctB = eval.AddNew(ctB, ctList[i])
+
+		for j := range msgB.Value {
+			msgB.Value[j] += msgList[i].Value[j]
+		}
+	}
+
+	apply := func(f func(a, b complex128) complex128) (msg *Message) {
+		msg = NewMessage(params)
+		for j := range msg.Value {
+			msg.Value[j] = f(msgA.Value[j], msgB.Value[j])
+		}
+		return
+	}
+
+	requireMsg := func(t *testing.T, ctRes *Ciphertext, want *Message, numIDs int) {
+		require.Equal(t, numIDs, ctRes.IDSet().Size())
+
+		requireTestMessage(t, params, dec.Decrypt(ctRes, testContext.skSet), want)
+	}
+
+	t.Run(GetTestName(params, "MKAddInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctOut := ctA.CopyNew()
+		require.NoError(t, eval.Add(ctOut, ctB, ctOut))
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return a + b }), numUsers)
+
+		// the receiver is reused and is resized to the IDs of the operands
+		require.NoError(t, eval.Add(ctA, ctA, ctOut))
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return 2 * a }), 1)
+	})
+
+	t.Run(GetTestName(params, "MKSubInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctOut := ctB.CopyNew()
+		require.NoError(t, eval.Sub(ctA, ctOut, ctOut))
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return a - b }), numUsers)
+	})
+
+	t.Run(GetTestName(params, "MKNegInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctOut := ctA.CopyNew()
+		eval.Neg(ctOut, ctOut)
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return -a }), 1)
+	})
+
+	t.Run(GetTestName(params, "MKMulRelinInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctOut := ctA.CopyNew()
+		eval.MulRelin(ctOut, ctB, testContext.rlkSet, ctOut)
+		require.Equal(t, ctA.Level()-1, ctOut.Level())
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return a * b }), numUsers)
+
+		ctOut = ctB.CopyNew()
+		eval.MulRelin(ctOut, ctOut, testContext.rlkSet, ctOut)
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return b * b }), numUsers-1)
+	})
+
+	t.Run(GetTestName(params, "MKMulPtxtInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		pt := testContext.encryptor.EncodeMsgNew(msgA)
+		ctOut := ctB.CopyNew()
+		eval.MulPtxt(ctOut, pt, ctOut)
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return a * b }), numUsers-1)
+	})
+
+	t.Run(GetTestName(params, "MKRotateInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		for _, rot := range []int{4, 5} {
+			ctOut := ctA.CopyNew()
+			require.NoError(t, eval.Add(ctOut, ctB, ctOut))
+			eval.Rotate(ctOut, rot, testContext.rtkSet, ctOut)
+
+			want := apply(func(a, b complex128) complex128 { return a + b })
+			rotated := NewMessage(params)
+			for j := range rotated.Value {
+				rotated.Value[j] = want.Value[(j+rot+len(want.Value))%len(want.Value)]
+			}
+
+			requireMsg(t, ctOut, rotated, numUsers)
+		}
+	})
+
+	t.Run(GetTestName(params, "MKConjugateInPlace: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		cjkSet := mkrlwe.NewConjugationKeySet()
+		for _, id := range userList {
+			cjkSet.AddConjugationKey(testContext.kgen.GenConjugationKey(testContext.skSet.GetSecretKey(id)))
+		}
+
+		ctOut := eval.AddNew(ctA, ctB)
+		eval.DropLevel(ctOut, 1)
+		eval.Conjugate(ctOut, cjkSet, ctOut)
+		requireMsg(t, ctOut, apply(func(a, b complex128) complex128 { return cmplx.Conj(a + b) }), numUsers)
+	})
+}
+
+func testEvaluatorAlign(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	msgList := make([]*Message, numUsers)
+	ctList := make([]*Ciphertext, numUsers)
+
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+
+	for i := range userList {
+		msgList[i], ctList[i] = newTestVectors(testContext, userList[i],
+			complex(-1.0/float64(numUsers), -1.0/float64(numUsers)),
+			complex(1.0/float64(numUsers), 1.0/float64(numUsers)))
+	}
+
+	ctA, msgA := ctList[0], msgList[0]
+	ctB, msgB := ctList[1], msgList[1]
+
+	requireMsg := func(t *testing.T, ctRes *Ciphertext, f func(a, b complex128) complex128) {
+		want := NewMessage(params)
+		for i := range want.Value {
+			want.Value[i] = f(msgA.Value[i], msgB.Value[i])
+		}
+		requireTestMessage(t, params, dec.Decrypt(ctRes, testContext.skSet), want)
+	}
+
+	t.Run(GetTestName(params, "MKAlignLevels: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctLow := eval.DropLevelNew(ctB, 2)
+
+		ctOut := eval.AddNew(ctA, ctLow)
+		require.Equal(t, ctLow.Level(), ctOut.Level())
+		requireMsg(t, ctOut, func(a, b complex128) complex128 { return a + b })
+
+		ctOut = eval.MulRelinNew(ctA, ctLow, testContext.rlkSet)
+		require.Equal(t, ctLow.Level()-1, ctOut.Level())
+		requireMsg(t, ctOut, func(a, b complex128) complex128 { return a * b })
+
+		// the key-switcher drops the receiver to the minimum level of the operands
+		ctOut = NewCiphertext(params, ctA.IDSet().Union(ctB.IDSet()), params.MaxLevel(), ctA.Scale*ctLow.Scale)
+		eval.ksw.MulAndRelin(ctA.Ciphertext, ctLow.Ciphertext, testContext.rlkSet, ctOut.Ciphertext)
+		require.Equal(t, ctLow.Level(), ctOut.Level())
+		require.NoError(t, eval.Rescale(ctOut, params.Scale(), ctOut))
+		requireMsg(t, ctOut, func(a, b complex128) complex128 { return a * b })
+	})
+
+	t.Run(GetTestName(params, "MKAlignScales: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		// the scale of ctHalf is the scale of ctA times the last modulus
+		ctHalf := ctA.CopyNew()
+		eval.MultByConst(ctA, 0.5, ctHalf)
+		require.NotEqual(t, ctA.Scale, ctHalf.Scale)
+
+		ctOut := eval.AddNew(ctB, ctHalf)
+		require.Equal(t, ctHalf.Scale, ctOut.Scale)
+		requireMsg(t, ctOut, func(a, b complex128) complex128 { return 0.5*a + b })
+
+		ctOut = eval.SubNew(ctHalf, ctB)
+		requireMsg(t, ctOut, func(a, b complex128) complex128 { return 0.5*a - b })
+
+		// products rescaled by different moduli have close but distinct scales
+		pt := testContext.encryptor.EncodeMsgNew(constMessage(params, 1))
+		ctMul := eval.MulRelinNew(ctA, ctB, testContext.rlkSet)
+		ctPtxt := eval.MulPtxtNew(eval.DropLevelNew(ctA, 1), pt)
+		require.NotEqual(t, ctMul.Scale, ctPtxt.Scale)
+
+		// they are only added once the evaluator tolerates the mismatch
+		require.Error(t, eval.Add(ctMul, ctPtxt, ctMul.CopyNew()))
+
+		eval.SetScaleTolerance(1.0 / (1 << 12))
+		defer eval.SetScaleTolerance(0)
+
+		ctOut = eval.AddNew(ctMul, ctPtxt)
+		requireMsg(t, ctOut, func(a, b complex128) complex128 { return a*b + a })
+		require.Panics(t, func() { eval.SetScaleTolerance(0.5) })
+	})
+
+	t.Run(GetTestName(params, "MKAlignScalesError: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		ctBad := ctA.CopyNew()
+		ctBad.Scale *= 1.5
+
+		ctOut := ctB.CopyNew()
+		require.Error(t, eval.Add(ctOut, ctBad, ctOut))
+		require.Error(t, eval.Sub(ctBad, ctOut, ctOut))
+		require.Equal(t, ctB.IDSet().Size(), ctOut.IDSet().Size())
+		require.Equal(t, ctB.Scale, ctOut.Scale)
+		require.Panics(t, func() { eval.AddNew(ctBad, ctB) })
+
+		pt := testContext.encryptor.EncodeMsgNew(msgB)
+		pt.Scale *= 1.5
+		require.Error(t, eval.AddPtxt(ctA, pt, ctA.CopyNew()))
+		require.Panics(t, func() { eval.SubPtxtNew(ctA, pt) })
+	})
+}
+
+func testEvaluatorInnerSum(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	slots := params.Slots()
+
+	eval := testContext.evaluator
+	dec := testContext.decryptor
+	rtkSet := testContext.rtkSet
+
+	a, b := complex(-1.0/float64(numUsers), -1.0/float64(numUsers)), complex(1.0/float64(numUsers), 1.0/float64(numUsers))
+	msg, ct := newTestVectors(testContext, userList[0], a, b)
+	for i := 1; i < numUsers; i++ {
+		msgi, cti := newTestVectors(testContext, userList[i], a, b)
+		ct = eval.AddNew(ct, cti)
+
+		for j := range msg.Value {
+			msg.Value[j] += msgi.Value[j]
+		}
+	}
+
+	// genRotationKeys adds the CRS of the rotations missing from the parameters and generates their keys
+	genRotationKeys := func(rots []int) {
+		for _, rot := range rots {
+			if _, in := params.CRS[rot]; !in {
+				params.AddCRS(rot)
+			}
+			for _, id := range userList {
+				if _, in := rtkSet.Value[id][uint(rot)]; !in {
+					rtkSet.AddRotationKey(testContext.kgen.GenRotationKey(rot, testContext.skSet.GetSecretKey(id)))
+				}
+			}
+		}
+	}
+
+	innerSum := func(values []complex128, batch, n int) (res []complex128) {
+		res = make([]complex128, slots)
+		for j := range res {
+			for i := 0; i < n; i++ {
+				res[j] += values[(((j+i*batch)%slots)+slots)%slots]
+			}
+		}
+		return
+	}
+
+	requireValues := func(t *testing.T, ctRes *Ciphertext, want []complex128) {
+		msgRes := dec.Decrypt(ctRes, testContext.skSet)
+		for i := range msgRes.Value {
+			delta := msgRes.Value[i] - want[i]
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+12, math.Log2(math.Abs(real(delta))))
+			require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+12, math.Log2(math.Abs(imag(delta))))
+		}
+	}
+
+	t.Run(GetTestName(params, "MKRotationsForInnerSum: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		half := params.N() / 2
+		require.Equal(t, []int{2, 4, 6}, params.RotationsForInnerSum(2, 7))
+		require.Equal(t, []int{8, 16, 32}, params.RotationsForInnerSum(8, 8))
+		require.Equal(t, []int{}, params.RotationsForInnerSum(3, 1))
+		require.Equal(t, []int{half - 4}, params.RotationsForReplicate(4, 3))
+		require.Equal(t, []int{1, 2}, params.RotationsForInnerProduct(5))
+		require.Equal(t, []int{4, half - 4}, params.RotationsForSumRows(2, 4))
+		require.Equal(t, []int{1, 2, half - 2, half - 1}, params.RotationsForSumColumns(4))
+		require.Panics(t, func() { eval.InnerSumNew(ct, 1, 0, rtkSet) })
+	})
+
+	t.Run(GetTestName(params, "MKInnerSum: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		// the rotations by 2 and 4 are hoisted and the rotation by 6, which has no CRS, is decomposed
+		ctOut := ct.CopyNew()
+		eval.InnerSum(ctOut, 2, 7, rtkSet, ctOut)
+		require.Equal(t, ct.Level(), ctOut.Level())
+		require.Equal(t, ct.Scale, ctOut.Scale)
+		requireValues(t, ctOut, innerSum(msg.Value, 2, 7))
+	})
+
+	t.Run(GetTestName(params, "MKReplicate: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		genRotationKeys(params.RotationsForReplicate(4, 3))
+		requireValues(t, eval.ReplicateNew(ct, 4, 3, rtkSet), innerSum(msg.Value, -4, 3))
+	})
+
+	t.Run(GetTestName(params, "MKInnerProduct: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		prod := make([]complex128, slots)
+		for j := range prod {
+			prod[j] = msg.Value[j] * msg.Value[j]
+		}
+
+		ctOut := eval.InnerProductNew(ct, ct, 5, testContext.rlkSet, rtkSet)
+		require.Equal(t, ct.Level()-1, ctOut.Level())
+		requireValues(t, ctOut, innerSum(prod, 1, 5))
+	})
+
+	numRow, numCol := 2, 4
+
+	// masked returns the values at the indexes selected by the predicate and zero elsewhere
+	masked := func(values []complex128, selected func(j int) bool) (res []complex128) {
+		res = make([]complex128, slots)
+		for j := range res {
+			if selected(j) {
+				res[j] = values[j]
+			}
+		}
+		return
+	}
+
+	maskPtxt := func(selected func(j int) bool) *ckks.Plaintext {
+		return testContext.encryptor.EncodeMsgNew(&Message{Value: masked(constMessage(params, 1).Value, selected)})
+	}
+
+	t.Run(GetTestName(params, "MKSumRows: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		genRotationKeys(params.RotationsForSumRows(numRow, numCol))
+
+		firstRow := func(j int) bool { return j < numCol }
+		want := innerSum(masked(innerSum(msg.Value, numCol, numRow), firstRow), -numCol, numRow)
+
+		ctOut := eval.SumRowsNew(ct, maskPtxt(firstRow), numRow, numCol, rtkSet)
+		require.Equal(t, ct.Level()-1, ctOut.Level())
+		requireValues(t, ctOut, want)
+
+		for j := 0; j < numRow*numCol; j++ {
+			require.Equal(t, want[j%numCol], want[j])
+		}
+
+		requireValues(t, eval.SumRowsNew(ct, nil, numRow, numCol, rtkSet), innerSum(msg.Value, numCol, numRow))
+
+		// the masked sum of a ciphertext at level 0 cannot be rescaled
+		require.Panics(t, func() { eval.SumRowsNew(eval.DropLevelNew(ct, ct.Level()), maskPtxt(firstRow), numRow, numCol, rtkSet) })
+	})
+
+	t.Run(GetTestName(params, "MKSumColumns: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		genRotationKeys(params.RotationsForSumColumns(numCol))
+
+		firstColumn := func(j int) bool { return j < numRow*numCol && j%numCol == 0 }
+		want := innerSum(masked(innerSum(msg.Value, 1, numCol), firstColumn), -1, numCol)
+
+		ctOut := ct.CopyNew()
+		eval.SumColumns(ctOut, maskPtxt(firstColumn), numCol, rtkSet, ctOut)
+		require.Equal(t, ct.Level()-1, ctOut.Level())
+		requireValues(t, ctOut, want)
+
+		require.Panics(t, func() { eval.SumColumnsNew(eval.DropLevelNew(ct, ct.Level()), maskPtxt(firstColumn), numCol, rtkSet) })
+	})
+}
+
+func testEvaluatorRotationPlan(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	eval := testContext.evaluator
+
+	msg, ct := newTestVectors(testContext, userList[0], complex(-1, -1), complex(1, 1))
+	for i := 1; i < numUsers; i++ {
+		msgi, cti := newTestVectors(testContext, userList[i], complex(-1, -1), complex(1, 1))
+		ct = eval.AddNew(ct, cti)
+
+		for j := range msg.Value {
+			msg.Value[j] += msgi.Value[j]
+		}
+	}
+
+	t.Run(GetTestName(params, "MKRotationPlan: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		planner := mkrlwe.NewRotationPlanner(params.Parameters)
+		planner.AddRotations(-3, 7)
+
+		// a single key is not enough, so both rotations are evaluated in their non-adjacent form
+		plan := planner.Plan(1)
+		require.Equal(t, 2, plan.KeySwitches(-3))
+		require.Equal(t, 2, plan.KeySwitches(7))
+
+		plan.AddCRS(&testContext.params.Parameters)
+		for _, id := range userList {
+			testContext.kgen.GenRotationKeysFromPlan(plan, testContext.skSet.GetSecretKey(id), testContext.rtkSet)
+		}
+
+		half := params.N() / 2
+		for _, rot := range []int{-3, 7} {
+			require.Equal(t, plan.Decompositions[(rot+half)%half], params.RotationDecomposition(rot))
+
+			msgRes := testContext.decryptor.Decrypt(eval.RotateNew(ct, rot, testContext.rtkSet), testContext.skSet)
+			for i := range msgRes.Value {
+				delta := msgRes.Value[i] - msg.Value[(((i+rot)%len(msg.Value))+len(msg.Value))%len(msg.Value)]
+				require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+12, math.Log2(math.Abs(real(delta))))
+				require.GreaterOrEqual(t, -math.Log2(params.Scale())+float64(params.LogSlots())+12, math.Log2(math.Abs(imag(delta))))
+			}
+		}
+	})
+}
+
+func testEvaluatorConcurrent(testContext *testParams, userList []string, t *testing.T) {
+
+	params := testContext.params
+	numUsers := len(userList)
+	eval := testContext.evaluator
+
+	var ct0, ct1 *Ciphertext
+	for i, id := range userList {
+		_, cti := newTestVectors(testContext, id, complex(-1, -1), complex(1, 1))
+		if i == 0 {
+			ct0 = cti
+		} else {
+			ct0 = eval.AddNew(ct0, cti)
+		}
+	}
+	for i, id := range userList {
+		_, cti := newTestVectors(testContext, id, complex(-1, -1), complex(1, 1))
+		if i == 0 {
+			ct1 = cti
+		} else {
+			ct1 = eval.AddNew(ct1, cti)
+		}
+	}
+
+	cjkSet := mkrlwe.NewConjugationKeySet()
+	for _, id := range userList {
+		cjkSet.AddConjugationKey(testContext.kgen.GenConjugationKey(testContext.skSet.GetSecretKey(id)))
+	}
+
+	// evaluate returns the product of ct0 and ct1, the rotation of ct0 by 1 and the conjugate of ct1
+	evaluate := func(eval *Evaluator, ct0, ct1 *Ciphertext) []*Ciphertext {
+		return []*Ciphertext{
+			eval.MulRelinNew(ct0, ct1, testContext.rlkSet),
+			eval.RotateNew(ct0, 1, testContext.rtkSet),
+			eval.ConjugateNew(ct1, cjkSet),
+		}
+	}
+
+	requireEqual := func(t *testing.T, want, have []*Ciphertext) {
+		for i := range want {
+			require.Equal(t, want[i].Scale, have[i].Scale)
+			require.Equal(t, len(want[i].Value), len(have[i].Value))
+			for id := range want[i].Value {
+				require.True(t, want[i].Value[id].Equals(have[i].Value[id]))
+			}
+		}
+	}
+
+	want := evaluate(eval, ct0, ct1)
+
+	t.Run(GetTestName(params, "MKWorkers: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		eval.SetWorkers(2)
+		defer eval.SetWorkers(1)
+
+		requireEqual(t, want, evaluate(eval, ct0, ct1))
+	})
+
+	t.Run(GetTestName(params, "MKShallowCopy: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+		evals := []*Evaluator{eval, eval.ShallowCopy()}
+		have := make([][]*Ciphertext, len(evals))
+
+		var wg sync.WaitGroup
+		for i := range evals {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				have[i] = evaluate(evals[i], ct0, ct1)
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range evals {
+			requireEqual(t, want, have[i])
+		}
+	})
+}
+
+func constMessage(params Parameters, c complex128) (msg *Message) {
+	msg = NewMessage(params)
+	for i := range msg.Value {
+		msg.Value[i] = c
+	}
+	return
+}
+
+// BootstrappingPN12Toy and BootstrappingPN12ToyFull are insecure parameter sets exercising the bootstrapping of 2 parties
+// with a sparse and a full packing. Their largest measured errors are 2^-11.8 and 2^-11.3, with a ratio between Q0
+// and the scale of 2^10 and 2^4: a ratio of 2^10 leaves an error of 2^-5.4 to the full packing, and one of 2^4 an error
+// of 2^-5.7 to the sparse packing, whose coefficients are larger.
+var (
+	BootstrappingPN12Toy = BootstrappingParameters{
+		ParametersLiteral: ckks.ParametersLiteral{
+			LogN:     12,
+			LogSlots: 4,
+			// 60 + 50 + 2x50 + 9x50 + 2x50
+			LogQ:  append([]int{60}, repeatLogQ(50, 14)...),
+			LogP:  []int{61, 61, 61, 61},
+			Scale: 1 << 50,
+			Sigma: rlwe.DefaultSigma,
+		},
+		H:                  32,
+		MaxParties:         2,
+		K:                  16,
+		SineDegree:         31,
+		DoubleAngle:        3,
+		CoeffsToSlotsDepth: 2,
+		SlotsToCoeffsDepth: 2,
+	}
+
+	BootstrappingPN12ToyFull = BootstrappingParameters{
+		ParametersLiteral: ckks.ParametersLiteral{
+			LogN:     12,
+			LogSlots: 11,
+			// 54 + 50 + 3x50 + 9x50 + 3x50
+			LogQ:  append([]int{54}, repeatLogQ(50, 16)...),
+			LogP:  []int{61, 61, 61, 61},
+			Scale: 1 << 50,
+			Sigma: rlwe.DefaultSigma,
+		},
+		H:                  32,
+		MaxParties:         2,
+		K:                  16,
+		SineDegree:         31,
+		DoubleAngle:        3,
+		CoeffsToSlotsDepth: 3,
+		SlotsToCoeffsDepth: 3,
+	}
+)
+
+func TestBootstrapping(t *testing.T) {
+	for _, tc := range []struct {
+		btpParams BootstrappingParameters
+		logSlots  int
+		numUsers  int
+		delta     float64
+	}{
+		{BootstrappingPN12Toy, 4, 2, 1e-3},
+		{BootstrappingPN12Toy, 11, 2, 1e-3},
+		{BootstrappingPN12ToyFull, 11, 2, 2e-3},
+		// the parameters of lr, whose weights repeat every 2^3 slots, with 2 of its 3 parties
+		{BootstrappingPN15QP1080, 14, 2, 1e-2},
+	} {
+		testBootstrapping(tc.btpParams, tc.logSlots, tc.numUsers, tc.delta, t)
+	}
+}
+
+func TestBootstrappingPresets(t *testing.T) {
+	// the rotation keys and CRS of the presets take tens of gigabytes
+	if testing.Short() {
+		t.Skip("skipping the bootstrapping presets in short mode")
+	}
+
+	testBootstrapping(BootstrappingPN16QP1599, BootstrappingPN16QP1599.LogSlots, BootstrappingPN16QP1599.MaxParties, 1e-2, t)
+}
+
+// testBootstrapping bootstraps the sum of the ciphertexts of numUsers parties under parameters with 2^logSlots slots,
+// whose messages repeat every 2^LogSlots slots of btpParams.
+func testBootstrapping(btpParams BootstrappingParameters, logSlots, numUsers int, delta float64, t *testing.T) {
+
+	literal := btpParams.ParametersLiteral
+	literal.LogSlots = logSlots
+
+	ckksParams, err := ckks.NewParametersFromLiteral(literal)
+	require.NoError(t, err)
+
+	params := NewParameters(ckksParams)
+	btpParams.AddCRS(&params)
+
+	userList := make([]string, numUsers)
+	for i := range userList {
+		userList[i] = "user" + strconv.Itoa(i)
+	}
+
+	kgen := NewKeyGenerator(params)
+	skSet := mkrlwe.NewSecretKeySet()
+	pkSet := mkrlwe.NewPublicKeyKeySet()
+	rlkSet := mkrlwe.NewRelinearizationKeyKeySet(params.Parameters)
+	rtkSet := mkrlwe.NewRotationKeySet()
+	cjkSet := mkrlwe.NewConjugationKeySet()
+
+	// every party generates a sparse secret key and its own bootstrapping keys
+	for _, id := range userList {
+		sk, pk := kgen.GenKeyPairSparse(btpParams.H, id)
+		skSet.AddSecretKey(sk)
+		pkSet.AddPublicKey(pk)
+		rlkSet.AddRelinearizationKey(kgen.GenRelinearizationKey(sk, kgen.GenSecretKey(id)))
+		cjkSet.AddConjugationKey(kgen.GenConjugationKey(sk))
+		for _, rotidx := range btpParams.Rotations() {
+			rtkSet.AddRotationKey(kgen.GenRotationKey(rotidx, sk))
+		}
+	}
+
+	btp, err := NewBootstrapper(params, btpParams)
+	require.NoError(t, err)
+
+	encryptor := NewEncryptor(params)
+	decryptor := NewDecryptor(params)
+
+	msg := NewMessage(params)
+	var ct *Ciphertext
+	for i, id := range userList {
+		msgi := NewMessage(params)
+		for j := range msgi.Value {
+			if j < 1<<btpParams.LogSlots {
+				msgi.Value[j] = complex(utils.RandFloat64(-1, 1), utils.RandFloat64(-1, 1))
+			} else {
+				msgi.Value[j] = msgi.Value[j%(1<<btpParams.LogSlots)]
+			}
+			msg.Value[j] += msgi.Value[j]
+		}
+
+		if cti := encryptor.EncryptMsgNew(msgi, pkSet.GetPublicKey(id)); i == 0 {
+			ct = cti
+		} else {
+			ct = btp.AddNew(ct, cti)
+		}
+	}
+
+	btp.DropLevel(ct, ct.Level())
+
+	t.Run(GetTestName(params, "MKBootstrapping: "+strconv.Itoa(numUsers)+"/ "), func(t *testing.T) {
+
+		ctOut, err := btp.Bootstrap(ct, rlkSet, rtkSet, cjkSet)
+		require.NoError(t, err)
+		require.Equal(t, btpParams.OutputLevel(), ctOut.Level())
+		require.InDelta(t, ct.Scale, ctOut.Scale, ct.Scale*1e-3)
+
+		msgOut := decryptor.Decrypt(ctOut, skSet)
+		for j := range msg.Value {
+			require.InDelta(t, real(msg.Value[j]), real(msgOut.Value[j]), delta)
+			require.InDelta(t, imag(msg.Value[j]), imag(msgOut.Value[j]), delta)
+		}
+
+		// the bootstrapped ciphertext can be multiplied again
+		ctSq := btp.MulRelinNew(ctOut, ctOut, rlkSet)
+		msgSq := decryptor.Decrypt(ctSq, skSet)
+		for j := range msg.Value {
+			want := msg.Value[j] * msg.Value[j]
+			require.InDelta(t, real(want), real(msgSq.Value[j]), 10*delta)
+			require.InDelta(t, imag(want), imag(msgSq.Value[j]), 10*delta)
+		}
+	})
+
+	t.Run(GetTestName(params, "MKBootstrapping: "+strconv.Itoa(numUsers)+"/ TooManyParties/ "), func(t *testing.T) {
+		idset := mkrlwe.NewIDSet()
+		for i := 0; i <= btpParams.MaxParties; i++ {
+			idset.Add("user" + strconv.Itoa(i))
+		}
+
+		_, err := btp.Bootstrap(NewCiphertext(params, idset, 0, params.Scale()), rlkSet, rtkSet, cjkSet)
+		require.Error(t, err)
+	})
+}
@@ -30,6 +30,18 @@ func NewParameters(ckksParams ckks.Parameters) Parameters {
 	return *ret
 }
 
+// NewParametersFromSeed instantiate a set of MKCKKS parameters whose CRS is expanded from the given public seed.
+// Parties sharing the CKKS parameters and the seed obtain identical parameters.
+func NewParametersFromSeed(ckksParams ckks.Parameters, seed []byte) Parameters {
+
+	ret := new(Parameters)
+	ret.Parameters = mkrlwe.NewParametersFromSeed(ckksParams.Parameters, 2, seed)
+	ret.logSlots = ckksParams.LogSlots()
+	ret.scale = ckksParams.Scale()
+
+	return *ret
+}
+
 // Scale returns the default plaintext/ciphertext scale
 func (p Parameters) Scale() float64 {
 	return p.scale
@@ -45,56 +57,101 @@ func (p Parameters) LogSlots() int {
 	return p.logSlots
 }
 
+// SmudgingLogBound returns the largest log2 bound on the noise flooding each of numShares decryption shares
+// that keeps the decryption error of a ciphertext at given level and scale below 2^-logPrecision.
+// The bound is also kept small enough for the sum of the shares not to wrap around the modulus at given level.
+func (p Parameters) SmudgingLogBound(level int, scale float64, numShares int, logPrecision float64) (logBound int) {
+
+	// the error of a slot is heuristically bounded by B * sqrt(numShares * N) / scale
+	logBound = int(math.Floor(math.Log2(scale) - logPrecision - 0.5*math.Log2(float64(numShares*p.N()))))
+
+	logQ := math.Log2(float64(p.RingQ().Modulus[0]))
+	for i := 1; i < level+1; i++ {
+		logQ = math.Min(logQ, math.Log2(float64(p.RingQ().Modulus[i])))
+	}
+
+	if maxLogBound := int(math.Floor(logQ)) - 2; logBound > maxLogBound {
+		logBound = maxLogBound
+	}
+
+	return
+}
+
+// SmudgingLogError returns the log2 of the heuristic decryption error on the slots of a ciphertext at given scale,
+// when it is decrypted from numShares decryption shares flooded with a noise of standard deviation sigma.
+func (p Parameters) SmudgingLogError(sigma, scale float64, numShares int) float64 {
+	return math.Log2(6*sigma) + 0.5*math.Log2(float64(numShares*p.N())) - math.Log2(scale)
+}
+
+// GetDataLen returns the length in bytes of the payload of the marshaled parameters.
+// The mkrlwe parameters are stored in their own envelope.
 func (params Parameters) GetDataLen(WithMetaData bool) (dataLen int) {
 
 	if WithMetaData {
 		dataLen = 12
 	}
 
-	dataLen += params.Parameters.GetDataLen(true)
+	dataLen += params.Parameters.GetDataLen(true) + mkrlwe.EnvelopeOverhead
 
 	return
 }
 
+// MarshalBinary encodes the parameters in a byte slice bound to their fingerprint.
 func (params Parameters) MarshalBinary() ([]byte, error) {
+	return mkrlwe.MarshalEnvelope(mkrlwe.KindCKKSParameters, params.Fingerprint(), params.GetDataLen(true), params.encode)
+}
 
-	var pointer = 0
-	var mkrlweParamsBuf []byte
-	var err error
+// UnmarshalBinary decodes previously marshaled parameters in the target parameters.
+func (p *Parameters) UnmarshalBinary(data []byte) (err error) {
+
+	var hdr mkrlwe.EnvelopeHeader
+
+	if hdr, err = mkrlwe.UnmarshalEnvelope(mkrlwe.KindCKKSParameters, data, p.decode); err != nil {
+		return err
+	}
+
+	if hdr.ParamHash != p.Fingerprint() {
+		return &mkrlwe.DecodingError{Kind: mkrlwe.KindCKKSParameters, Err: mkrlwe.ErrParamsMismatch}
+	}
 
-	data := make([]byte, params.GetDataLen(true))
+	return nil
+}
+
+func (params Parameters) encode(data []byte) (err error) {
 
-	binary.BigEndian.PutUint32(data[pointer:pointer+4], uint32(params.logSlots))
+	var mkrlweParamsBuf []byte
 
-	binary.BigEndian.PutUint64(data[pointer+4:pointer+12], math.Float64bits(params.scale))
+	binary.BigEndian.PutUint32(data[0:4], uint32(params.logSlots))
 
-	pointer += 12
+	binary.BigEndian.PutUint64(data[4:12], math.Float64bits(params.scale))
 
 	if mkrlweParamsBuf, err = params.Parameters.MarshalBinary(); err != nil {
-		return []byte{}, err
+		return err
 	}
 
-	copy(data[pointer:], mkrlweParamsBuf)
+	copy(data[12:], mkrlweParamsBuf)
 
-	return data, nil
+	return nil
 }
 
-func (p *Parameters) UnmarshalBinary(data []byte) error {
+func (p *Parameters) decode(data []byte) (err error) {
 	if len(data) < 12 {
-		return fmt.Errorf("invalid rlwe.Parameter serialization")
+		return &mkrlwe.DecodingError{Err: mkrlwe.ErrTruncated, Msg: "parameters"}
 	}
 
-	var pointer = 0
-	var err error
-
-	p.logSlots = int(binary.BigEndian.Uint32(data))
+	logSlots := int(binary.BigEndian.Uint32(data))
+	scale := math.Float64frombits(binary.BigEndian.Uint64(data[4:]))
 
-	pointer += 4
-	p.scale = math.Float64frombits(binary.BigEndian.Uint64(data[pointer:]))
-
-	if err = p.Parameters.UnmarshalBinary(data[pointer+8:]); err != nil {
+	if err = p.Parameters.UnmarshalBinary(data[12:]); err != nil {
 		return err
 	}
 
-	return err
+	if logSlots < 0 || logSlots > p.LogN()-1 {
+		return &mkrlwe.DecodingError{Err: mkrlwe.ErrMalformed, Msg: fmt.Sprintf("invalid logSlots %d", logSlots)}
+	}
+
+	p.logSlots = logSlots
+	p.scale = scale
+
+	return nil
 }
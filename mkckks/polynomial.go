@@ -0,0 +1,189 @@
+package mkckks
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// PolynomialBasis is the basis in which the coefficients of a Polynomial are given.
+type PolynomialBasis int
+
+const (
+	// Monomial is the basis 1, x, x^2, ...
+	Monomial PolynomialBasis = iota
+	// Chebyshev is the basis T_0(y), T_1(y), T_2(y), ... of the Chebyshev polynomials of the first kind,
+	// where y = (2x - a - b) / (b - a) maps the interval [a, b] to [-1, 1].
+	Chebyshev
+)
+
+// Polynomial is a polynomial with real coefficients, in monomial or Chebyshev basis.
+type Polynomial struct {
+	Basis  PolynomialBasis
+	Coeffs []float64
+
+	// A and B are the bounds of the interval of a polynomial in Chebyshev basis
+	A, B float64
+}
+
+// NewPolynomial returns the polynomial coeffs[0] + coeffs[1] * x + ... in monomial basis.
+func NewPolynomial(coeffs []float64) *Polynomial {
+	pol := &Polynomial{Basis: Monomial, Coeffs: make([]float64, len(coeffs))}
+	copy(pol.Coeffs, coeffs)
+	return pol
+}
+
+// NewChebyshevPolynomial returns the polynomial coeffs[0] * T_0(y) + coeffs[1] * T_1(y) + ... in Chebyshev basis,
+// where y = (2x - a - b) / (b - a).
+func NewChebyshevPolynomial(coeffs []float64, a, b float64) *Polynomial {
+	if a >= b {
+		panic(fmt.Sprintf("Cannot NewChebyshevPolynomial: invalid interval [%v, %v]", a, b))
+	}
+
+	pol := &Polynomial{Basis: Chebyshev, Coeffs: make([]float64, len(coeffs)), A: a, B: b}
+	copy(pol.Coeffs, coeffs)
+	return pol
+}
+
+// Approximate returns the Chebyshev interpolant of given degree of f on the interval [a, b].
+// The interpolant is evaluated on the degree+1 Chebyshev nodes of the interval.
+func Approximate(f func(float64) float64, a, b float64, degree int) *Polynomial {
+	if degree < 0 {
+		panic("Cannot Approximate: degree is negative")
+	}
+
+	n := degree + 1
+
+	nodes := make([]float64, n)
+	values := make([]float64, n)
+	for k := range nodes {
+		nodes[k] = math.Cos(math.Pi * (float64(k) + 0.5) / float64(n))
+		values[k] = f(0.5*(b-a)*nodes[k] + 0.5*(a+b))
+	}
+
+	coeffs := make([]float64, n)
+	for j := range coeffs {
+		for k := range nodes {
+			coeffs[j] += values[k] * math.Cos(float64(j)*math.Acos(nodes[k]))
+		}
+		coeffs[j] *= 2 / float64(n)
+	}
+	coeffs[0] /= 2
+
+	return NewChebyshevPolynomial(coeffs, a, b)
+}
+
+// Degree returns the degree of the polynomial
+func (pol *Polynomial) Degree() int {
+	return len(pol.Coeffs) - 1
+}
+
+// Evaluate evaluates the polynomial on x in the clear.
+func (pol *Polynomial) Evaluate(x float64) (y float64) {
+	switch pol.Basis {
+	case Chebyshev:
+		x = (2*x - pol.A - pol.B) / (pol.B - pol.A)
+
+		var t0, t1 float64 = 1, x
+		for i, c := range pol.Coeffs {
+			if i == 0 {
+				y += c
+				continue
+			}
+			if i > 1 {
+				t0, t1 = t1, 2*x*t1-t0
+			}
+			y += c * t1
+		}
+	default:
+		for i := len(pol.Coeffs) - 1; i >= 0; i-- {
+			y = y*x + pol.Coeffs[i]
+		}
+	}
+
+	return
+}
+
+// changeOfVariable returns the affine map y = alpha * x + beta sending the interval of a Chebyshev
+// polynomial on [-1, 1]. The map is the identity for a polynomial in monomial basis.
+func (pol *Polynomial) changeOfVariable() (alpha, beta float64) {
+	if pol.Basis != Chebyshev {
+		return 1, 0
+	}
+	return 2 / (pol.B - pol.A), -(pol.A + pol.B) / (pol.B - pol.A)
+}
+
+// Depth returns the number of levels consumed by the evaluation of the polynomial on a ciphertext.
+func (pol *Polynomial) Depth() (depth int) {
+	if pol.Degree() < 1 {
+		return 0
+	}
+
+	if alpha, beta := pol.changeOfVariable(); alpha != 1 || beta != 0 {
+		depth++
+	}
+
+	return depth + pol.depth(pol.Coeffs, optimalSplit(bits.Len(uint(pol.Degree()))))
+}
+
+func (pol *Polynomial) depth(coeffs []float64, logSplit int) int {
+	degree := len(coeffs) - 1
+
+	if degree < 1<<logSplit {
+		// baby-step T_i is at depth ceil(log2(i)), and the linear combination consumes one level
+		depth := 1
+		for i := 2; i <= degree; i++ {
+			if coeffs[i] != 0 {
+				depth = bits.Len(uint(i-1)) + 1
+			}
+		}
+		return depth
+	}
+
+	nextPower := splitPower(degree, logSplit)
+	coeffsq, coeffsr := splitCoeffs(coeffs, nextPower, pol.Basis)
+
+	return max(max(pol.depth(coeffsq, logSplit), bits.Len(uint(nextPower-1)))+1, pol.depth(coeffsr, logSplit))
+}
+
+// optimalSplit returns the log2 of the number of baby-steps for a polynomial of degree below 2^logDegree.
+func optimalSplit(logDegree int) (logSplit int) {
+	logSplit = logDegree >> 1
+	if logSplit < 1 {
+		logSplit = 1
+	}
+	return
+}
+
+// splitPower returns the smallest power of two larger than 2^(logSplit-1) and than half the degree.
+func splitPower(degree, logSplit int) (nextPower int) {
+	nextPower = 1 << logSplit
+	for nextPower < (degree>>1)+1 {
+		nextPower <<= 1
+	}
+	return
+}
+
+// splitCoeffs splits p in q and r such that p = q * X_nextPower + r, where X_i is the i-th polynomial of basis.
+func splitCoeffs(coeffs []float64, nextPower int, basis PolynomialBasis) (coeffsq, coeffsr []float64) {
+	degree := len(coeffs) - 1
+
+	coeffsr = make([]float64, nextPower)
+	copy(coeffsr, coeffs[:nextPower])
+
+	coeffsq = make([]float64, degree-nextPower+1)
+	coeffsq[0] = coeffs[nextPower]
+
+	for i := nextPower + 1; i < degree+1; i++ {
+		switch basis {
+		case Chebyshev:
+			// T_i = 2 * T_(i-nextPower) * T_nextPower - T_(2 * nextPower - i)
+			coeffsq[i-nextPower] = 2 * coeffs[i]
+			coeffsr[2*nextPower-i] -= coeffs[i]
+		default:
+			coeffsq[i-nextPower] = coeffs[i]
+		}
+	}
+
+	return
+}
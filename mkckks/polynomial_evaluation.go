@@ -0,0 +1,176 @@
+package mkckks
+
+import (
+	"fmt"
+	"math/bits"
+
+	"mk-lr/mkrlwe"
+)
+
+// polynomialEvaluator holds the powers of the input ciphertext computed during the evaluation of a polynomial.
+type polynomialEvaluator struct {
+	*Evaluator
+	rlkSet *mkrlwe.RelinearizationKeySet
+	basis  PolynomialBasis
+	powers map[int]*Ciphertext
+}
+
+// EvaluatePoly evaluates the polynomial pol on the slots of ct and returns the result in a newly created element.
+// The polynomial is evaluated with the baby-step giant-step algorithm in the basis of pol, consuming pol.Depth() levels.
+// The levels and scales of the intermediate ciphertexts are aligned automatically, their scales being matched up to
+// a relative tolerance of 2^-12 whatever the scale tolerance of the evaluator, and the output is close to the default scale.
+// It returns an error if ct has not enough levels left.
+func (eval *Evaluator) EvaluatePoly(ct *Ciphertext, pol *Polynomial, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext, err error) {
+
+	if pol.Degree() < 0 {
+		return nil, fmt.Errorf("cannot EvaluatePoly: polynomial has no coefficient")
+	}
+
+	if depth := pol.Depth(); ct.Level() < depth {
+		return nil, fmt.Errorf("cannot EvaluatePoly: polynomial of depth %d cannot be evaluated on a ciphertext at level %d", depth, ct.Level())
+	}
+
+	if pol.Degree() < 1 {
+		ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), eval.params.Scale())
+		eval.addConst(pol.Coeffs[0], 0, ctOut)
+		return ctOut, nil
+	}
+
+	defer eval.raiseScaleTolerance()()
+
+	polyEval := &polynomialEvaluator{Evaluator: eval, rlkSet: rlkSet, basis: pol.Basis, powers: make(map[int]*Ciphertext)}
+
+	// T_1 is the input mapped on [-1, 1] for a polynomial in Chebyshev basis
+	if alpha, beta := pol.changeOfVariable(); alpha != 1 || beta != 0 {
+		if polyEval.powers[1], err = polyEval.linearCombination([]*Ciphertext{ct}, []float64{alpha}, beta); err != nil {
+			return nil, err
+		}
+	} else {
+		polyEval.powers[1] = ct.CopyNew()
+	}
+
+	return polyEval.recurse(pol.Coeffs, optimalSplit(bits.Len(uint(pol.Degree()))))
+}
+
+// recurse evaluates the polynomial of given coefficients by splitting it around the giant-step powers
+// until its degree is smaller than the number of baby-steps.
+func (polyEval *polynomialEvaluator) recurse(coeffs []float64, logSplit int) (ctOut *Ciphertext, err error) {
+
+	degree := len(coeffs) - 1
+
+	if degree < 1<<logSplit {
+		return polyEval.evaluateBabyStep(coeffs)
+	}
+
+	nextPower := splitPower(degree, logSplit)
+	coeffsq, coeffsr := splitCoeffs(coeffs, nextPower, polyEval.basis)
+
+	var ctq, ctr *Ciphertext
+
+	if ctq, err = polyEval.recurse(coeffsq, logSplit); err != nil {
+		return nil, err
+	}
+
+	if ctr, err = polyEval.recurse(coeffsr, logSplit); err != nil {
+		return nil, err
+	}
+
+	return polyEval.AddNew(polyEval.mul(ctq, polyEval.power(nextPower)), ctr), nil
+}
+
+// evaluateBabyStep evaluates the linear combination of the baby-step powers with given coefficients.
+// The term of degree one is always included so that the result is a ciphertext.
+func (polyEval *polynomialEvaluator) evaluateBabyStep(coeffs []float64) (ctOut *Ciphertext, err error) {
+
+	cts := []*Ciphertext{polyEval.power(1)}
+	constants := []float64{0}
+
+	if len(coeffs) > 1 {
+		constants[0] = coeffs[1]
+	}
+
+	for i := 2; i < len(coeffs); i++ {
+		if coeffs[i] != 0 {
+			cts = append(cts, polyEval.power(i))
+			constants = append(constants, coeffs[i])
+		}
+	}
+
+	return polyEval.linearCombination(cts, constants, coeffs[0])
+}
+
+// linearCombination returns constant + sum_i constants[i] * cts[i] at the default scale.
+// Each term is scaled up so that the sum has scale exactly the default scale times the last modulus,
+// and the sum is then rescaled, which consumes one level.
+func (polyEval *polynomialEvaluator) linearCombination(cts []*Ciphertext, constants []float64, constant float64) (ctOut *Ciphertext, err error) {
+
+	params := polyEval.params
+
+	level := cts[0].Level()
+	for _, ct := range cts[1:] {
+		level = min(level, ct.Level())
+	}
+
+	if level == 0 {
+		return nil, fmt.Errorf("cannot EvaluatePoly: ciphertext already at level 0")
+	}
+
+	qi := float64(params.RingQ().Modulus[level])
+
+	ctOut = NewCiphertext(params, cts[0].IDSet(), level, params.Scale()*qi)
+
+	for i, ct := range cts {
+		polyEval.multByConstAndAdd(ct, constants[i], ctOut.Scale/ct.Scale, ctOut)
+	}
+
+	polyEval.addConst(constant, 0, ctOut)
+
+	if err = polyEval.Rescale(ctOut, params.Scale(), ctOut); err != nil {
+		return nil, err
+	}
+
+	return ctOut, nil
+}
+
+// power returns the i-th polynomial of the basis evaluated on the input, computing and storing it if needed.
+// X_2n is computed from X_n and X_(a+b) from X_a and X_b, where a is the largest power of two below a+b,
+// which puts X_n at depth ceil(log2(n)).
+func (polyEval *polynomialEvaluator) power(n int) (ct *Ciphertext) {
+
+	if ct, in := polyEval.powers[n]; in {
+		return ct
+	}
+
+	a := 1 << (bits.Len(uint(n-1)) - 1)
+	b := n - a
+
+	ct = polyEval.mul(polyEval.power(a), polyEval.power(b))
+
+	if polyEval.basis == Chebyshev {
+		// T_(a+b) = 2 * T_a * T_b - T_(a-b)
+		ct = polyEval.AddNew(ct, ct)
+
+		if a == b {
+			polyEval.addConst(-1, 0, ct)
+		} else {
+			ct = polyEval.SubNew(ct, polyEval.power(a-b))
+		}
+	}
+
+	polyEval.powers[n] = ct
+
+	return
+}
+
+// mul multiplies op0 by op1 after bringing them to the same level.
+func (polyEval *polynomialEvaluator) mul(op0, op1 *Ciphertext) *Ciphertext {
+	if op0.Level() > op1.Level() {
+		op0 = polyEval.DropLevelNew(op0, op0.Level()-op1.Level())
+	} else if op1.Level() > op0.Level() {
+		op1 = polyEval.DropLevelNew(op1, op1.Level()-op0.Level())
+	}
+
+	ctOut := polyEval.newCiphertextBinary(op0, op1)
+	polyEval.mulRelinAndRescale(op0, op1, polyEval.rlkSet, ctOut)
+	return ctOut
+}
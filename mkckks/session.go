@@ -0,0 +1,109 @@
+package mkckks
+
+import (
+	"maps"
+	"slices"
+
+	"mk-lr/mkrlwe"
+)
+
+// Session tracks the parties of a multi-key CKKS computation across joins and leaves, as mkrlwe.Session does,
+// and stores CKKS ciphertexts by name. The stored ciphertexts are updated in place by the transitions
+// of the session and keep their scale.
+type Session struct {
+	session     *mkrlwe.Session
+	ciphertexts map[string]*Ciphertext
+}
+
+// NewSession returns a new session at epoch 0 without any party
+func NewSession(params Parameters) *Session {
+	return &Session{session: mkrlwe.NewSession(params.Parameters), ciphertexts: make(map[string]*Ciphertext)}
+}
+
+// Epoch returns the current epoch of the session
+func (s *Session) Epoch() int {
+	return s.session.Epoch()
+}
+
+// IDSet returns the IDs of the active parties of the session
+func (s *Session) IDSet() *mkrlwe.IDSet {
+	return s.session.IDSet()
+}
+
+// IDSetAt returns the IDs of the active parties of the session at given epoch.
+// Returns an error if the session has not reached the epoch.
+func (s *Session) IDSetAt(epoch int) (*mkrlwe.IDSet, error) {
+	return s.session.IDSetAt(epoch)
+}
+
+// Events returns the log of the transitions of the session in order
+func (s *Session) Events() []mkrlwe.MembershipEvent {
+	return s.session.Events()
+}
+
+// EvaluationKeys returns the evaluation keys of the active parties.
+// The keys of a party are added by Join and removed by Leave.
+func (s *Session) EvaluationKeys() *mkrlwe.EvaluationKeySet {
+	return s.session.EvaluationKeys()
+}
+
+// SetSmudgingSigma sets the standard deviation of the noise flooding the exit shares computed by GenExitShares,
+// see mkrlwe.Session.SetSmudgingSigma.
+func (s *Session) SetSmudgingSigma(sigma float64) {
+	s.session.SetSmudgingSigma(sigma)
+}
+
+// SetSmudgingLogBound sets the noise flooding the exit shares so that it is bounded by 2^logBound in absolute value
+func (s *Session) SetSmudgingLogBound(logBound int) {
+	s.session.SetSmudgingLogBound(logBound)
+}
+
+// SmudgingSigma returns the standard deviation of the noise flooding the exit shares
+func (s *Session) SmudgingSigma() float64 {
+	return s.session.SmudgingSigma()
+}
+
+// Store stores ct under name, replacing the previous ciphertext of that name, and pads it with the active parties.
+// Returns an error if ct has a component for a party that is not active.
+func (s *Session) Store(name string, ct *Ciphertext) error {
+	if err := s.session.Store(name, ct.Ciphertext); err != nil {
+		return err
+	}
+
+	s.ciphertexts[name] = ct
+	return nil
+}
+
+// Ciphertext returns the ciphertext stored under name, or nil if there is none
+func (s *Session) Ciphertext(name string) *Ciphertext {
+	return s.ciphertexts[name]
+}
+
+// Names returns the names of the stored ciphertexts in increasing order
+func (s *Session) Names() []string {
+	return slices.Sorted(maps.Keys(s.ciphertexts))
+}
+
+// Delete removes the ciphertext stored under name from the session
+func (s *Session) Delete(name string) {
+	s.session.Delete(name)
+	delete(s.ciphertexts, name)
+}
+
+// Join registers the evaluation keys of bundle mid-session, pads the stored ciphertexts with a component
+// for its party and starts a new epoch, see mkrlwe.Session.Join.
+func (s *Session) Join(bundle *mkrlwe.EvaluationKeyBundle) error {
+	return s.session.Join(bundle)
+}
+
+// GenExitShares computes the re-encryption shares of the stored ciphertexts of the owner of sk towards
+// the active party recipient, which are merged by Leave, see mkrlwe.Session.GenExitShares.
+func (s *Session) GenExitShares(sk *mkrlwe.SecretKey, recipient string) (map[string]*mkrlwe.ReencryptionShare, error) {
+	return s.session.GenExitShares(sk, recipient)
+}
+
+// Leave removes the party id from the session and re-encrypts its component in every stored ciphertext
+// towards the active party recipient, see mkrlwe.Session.Leave.
+func (s *Session) Leave(id, recipient string, shares map[string]*mkrlwe.ReencryptionShare) error {
+	return s.session.Leave(id, recipient, shares)
+}
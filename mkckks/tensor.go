@@ -0,0 +1,243 @@
+package mkckks
+
+import (
+	"fmt"
+
+	"github.com/ldsec/lattigo/v2/ring"
+	"github.com/ldsec/lattigo/v2/utils"
+	"mk-lr/mkrlwe"
+)
+
+// TensoredCiphertext is the product of two ciphertexts before relinearization.
+// It holds a component for 1, for each s_i and for each pair s_i * s_j of the IDs engaged in the operands.
+//
+// Relinearize decomposes the k^2 pair components of a TensoredCiphertext of k parties, whereas MulRelin only decomposes
+// the components of its operands, so that summing products with MulNoRelin and AddTensored before a single Relinearize
+// pays off past a number of products growing linearly with k. With PN14QP439 on one core (benchLazyRelin), the lazy sum
+// of a single product costs 0.85 MulRelin for 2 parties and 1.25 MulRelin for 4 parties, and it is faster from 2 products on,
+// by 3.7 and 3.1 times for 8 products. Extrapolating, it pays off from about k/3 products.
+type TensoredCiphertext struct {
+	*mkrlwe.TensoredCiphertext
+	Scale float64
+}
+
+// NewTensoredCiphertext returns a new TensoredCiphertext with zero values
+func NewTensoredCiphertext(params Parameters, idset *mkrlwe.IDSet, level int, scale float64) *TensoredCiphertext {
+	el := new(TensoredCiphertext)
+	el.TensoredCiphertext = mkrlwe.NewTensoredCiphertext(params.Parameters, idset, level)
+	el.Scale = scale
+
+	return el
+}
+
+// CopyNew makes a deep copy of the receiver tensored ciphertext and returns it.
+func (ct *TensoredCiphertext) CopyNew() (ctc *TensoredCiphertext) {
+	ctc = &TensoredCiphertext{TensoredCiphertext: ct.TensoredCiphertext.CopyNew(), Scale: ct.Scale}
+	return
+}
+
+// forEachComponent calls f on every component of ct with the pair of IDs (i, j) of its secret s_i * s_j,
+// where the ID "0" stands for 1.
+func forEachComponent(ct *TensoredCiphertext, f func(i, j string, c *ring.Poly)) {
+	for id, c := range ct.Value {
+		f("0", id, c)
+	}
+
+	for i, row := range ct.Quadratic {
+		for j, c := range row {
+			f(i, j, c)
+		}
+	}
+}
+
+// resizeTensoredIDs sets the IDs of ctOut to idset and drops it to given level, adding zero components
+// for the missing IDs and removing the components of the IDs not in idset.
+func (eval *Evaluator) resizeTensoredIDs(ctOut *TensoredCiphertext, idset *mkrlwe.IDSet, level int) {
+	for i, row := range ctOut.Quadratic {
+		if !idset.Has(i) {
+			delete(ctOut.Quadratic, i)
+			continue
+		}
+
+		for j := range row {
+			if !idset.Has(j) {
+				delete(row, j)
+			}
+		}
+	}
+
+	for id := range ctOut.Value {
+		if id != "0" && !idset.Has(id) {
+			delete(ctOut.Value, id)
+		}
+	}
+
+	ctOut.PadTensoredCiphertext(idset)
+
+	forEachComponent(ctOut, func(i, j string, c *ring.Poly) {
+		c.Coeffs = c.Coeffs[:level+1]
+	})
+}
+
+// tensorOperand returns the components of ct at given level in the NTT domain, and in Montgomery form if mForm is true.
+// They are backed by the i-th tensoring buffer of the evaluator.
+func (eval *Evaluator) tensorOperand(i int, ct *Ciphertext, level int, mForm bool) (op map[string]*ring.Poly) {
+	ringQ := eval.params.RingQ()
+
+	eval.tensorPool[i].PadCiphertext(ct.IDSet())
+
+	op = make(map[string]*ring.Poly)
+	for id := range ct.Value {
+		op[id] = eval.tensorPool[i].Value[id]
+		ringQ.NTTLvl(level, ct.Value[id], op[id])
+		if mForm {
+			ringQ.MFormLvl(level, op[id], op[id])
+		}
+	}
+
+	return
+}
+
+// MulNoRelinNew multiplies op0 by op1 without relinearization nor rescaling and returns the result in a newly created element.
+func (eval *Evaluator) MulNoRelinNew(op0, op1 *Ciphertext) (ctOut *TensoredCiphertext) {
+	idset := op0.IDSet().Union(op1.IDSet())
+	level := utils.MinInt(op0.Level(), op1.Level())
+
+	ctOut = NewTensoredCiphertext(eval.params, idset, level, op0.Scale*op1.Scale)
+	eval.MulNoRelin(op0, op1, ctOut)
+	return
+}
+
+// MulNoRelin multiplies op0 by op1 without relinearization nor rescaling and returns the result in ctOut.
+// The IDs of ctOut are set to the union of the IDs of op0 and op1, and its scale to the product of their scales.
+// The tensored products of several multiplications can be added with AddTensored before a single Relinearize,
+// which saves a key-switching per multiplication compared to adding the outputs of MulRelin.
+func (eval *Evaluator) MulNoRelin(op0, op1 *Ciphertext, ctOut *TensoredCiphertext) {
+
+	ringQ := eval.params.RingQ()
+
+	idset := op0.IDSet().Union(op1.IDSet())
+	level := utils.MinInt(utils.MinInt(op0.Level(), op1.Level()), ctOut.Level())
+
+	eval.resizeTensoredIDs(ctOut, idset, level)
+
+	a := eval.tensorOperand(0, op0, level, true)
+	b := eval.tensorOperand(1, op1, level, false)
+
+	forEachComponent(ctOut, func(i, j string, c *ring.Poly) {
+		c.Zero()
+	})
+
+	// the component of s_i * s_j accumulates a_i * b_j + a_j * b_i
+	for i, ai := range a {
+		for j, bj := range b {
+			ringQ.MulCoeffsMontgomeryAndAddLvl(level, ai, bj, ctOut.Component(i, j))
+		}
+	}
+
+	forEachComponent(ctOut, func(i, j string, c *ring.Poly) {
+		ringQ.InvNTTLvl(level, c, c)
+	})
+
+	ctOut.Scale = op0.Scale * op1.Scale
+}
+
+// AddTensoredNew adds op0 to op1 and returns the result in a newly created element.
+// The procedure will panic if the scales of op0 and op1 cannot be matched.
+func (eval *Evaluator) AddTensoredNew(op0, op1 *TensoredCiphertext) (ctOut *TensoredCiphertext) {
+	idset := op0.IDSet().Union(op1.IDSet())
+	level := utils.MinInt(op0.Level(), op1.Level())
+
+	ctOut = NewTensoredCiphertext(eval.params, idset, level, utils.MaxFloat64(op0.Scale, op1.Scale))
+	if err := eval.AddTensored(op0, op1, ctOut); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// AddTensored adds op0 to op1 and returns the result in ctOut.
+// ctOut can be op0 or op1, and its IDs are set to the union of the IDs of op0 and op1.
+// The levels and scales of the operands are matched as in Add.
+// Returns an error if the ratio of the scales is not an integer up to the scale tolerance of the evaluator.
+func (eval *Evaluator) AddTensored(op0, op1, ctOut *TensoredCiphertext) (err error) {
+
+	ringQ := eval.params.RingQ()
+
+	k0, k1, err := matchScales(op0.Scale, op1.Scale, eval.scaleTolerance)
+	if err != nil {
+		return fmt.Errorf("cannot AddTensored: %w", err)
+	}
+
+	idset := op0.IDSet().Union(op1.IDSet())
+	level := utils.MinInt(utils.MinInt(op0.Level(), op1.Level()), ctOut.Level())
+	scale := utils.MaxFloat64(op0.Scale, op1.Scale)
+
+	// ctOut can be op0 or op1, in which case its missing components are padded with zeros
+	eval.resizeTensoredIDs(ctOut, idset, level)
+
+	forEachComponent(ctOut, func(i, j string, c *ring.Poly) {
+		p0, p1 := op0.Component(i, j), op1.Component(i, j)
+		q0, q1 := k0, k1
+
+		// the operand aliased by the output is read first
+		if c == p1 {
+			p0, p1 = p1, p0
+			q0, q1 = q1, q0
+		}
+
+		switch {
+		case p0 == nil && p1 == nil:
+			c.Zero()
+		case p1 == nil:
+			eval.mulByIntLvl(level, p0, q0, c)
+		case p0 == nil:
+			eval.mulByIntLvl(level, p1, q1, c)
+		default:
+			eval.mulByIntLvl(level, p0, q0, c)
+			if q1 > 1 {
+				ringQ.MulScalarLvl(level, p1, q1, eval.polyQPool)
+				ringQ.AddLvl(level, c, eval.polyQPool, c)
+			} else {
+				ringQ.AddLvl(level, c, p1, c)
+			}
+		}
+	})
+
+	ctOut.Scale = scale
+
+	return nil
+}
+
+// mulByIntLvl multiplies p by the integer k up to the given level and writes the result on pOut.
+func (eval *Evaluator) mulByIntLvl(level int, p *ring.Poly, k uint64, pOut *ring.Poly) {
+	if k > 1 {
+		eval.params.RingQ().MulScalarLvl(level, p, k, pOut)
+	} else if p != pOut {
+		ring.CopyValuesLvl(level, p, pOut)
+	}
+}
+
+// RelinearizeNew relinearizes ct, rescales the result according to the rescale policy of the evaluator
+// and returns it in a newly created element.
+func (eval *Evaluator) RelinearizeNew(ct *TensoredCiphertext, rlkSet *mkrlwe.RelinearizationKeySet) (ctOut *Ciphertext) {
+	ctOut = NewCiphertext(eval.params, ct.IDSet(), ct.Level(), ct.Scale)
+	eval.Relinearize(ct, rlkSet, ctOut)
+	return
+}
+
+// Relinearize relinearizes ct with the relinearization keys of its IDs, rescales the result as MulRelin does
+// and returns it in ctOut, whose IDs are set to the IDs of ct.
+// The procedure will panic if the evaluator was not created with an relinearization key,
+// or if the result cannot be rescaled.
+func (eval *Evaluator) Relinearize(ct *TensoredCiphertext, rlkSet *mkrlwe.RelinearizationKeySet, ctOut *Ciphertext) {
+
+	level := utils.MinInt(ct.Level(), ctOut.Level())
+
+	eval.resizeIDs(ctOut, ct.IDSet())
+	eval.DropLevel(ctOut, ctOut.Level()-level)
+
+	eval.ksw.Relinearize(ct.TensoredCiphertext, rlkSet, ctOut.Ciphertext)
+
+	ctOut.Scale = ct.Scale
+	eval.applyRescalePolicy(ctOut)
+}
@@ -0,0 +1,92 @@
+package mkrlwe
+
+import "fmt"
+
+// EvaluationKeyBundle is a type for all the public evaluation keys of a single party.
+// It is sent to the server as a single object together with the fingerprint of the parameters it was generated with.
+type EvaluationKeyBundle struct {
+	ID                 string
+	Fingerprint        [32]byte
+	PublicKey          *PublicKey
+	RelinearizationKey *RelinearizationKey
+	RotationKeys       map[uint]*RotationKey
+	ConjugationKey     *ConjugationKey
+}
+
+// EvaluationKeySet is a type for the public evaluation keys of several parties held by the server.
+type EvaluationKeySet struct {
+	params                Parameters
+	PublicKeySet          *PublicKeySet
+	RelinearizationKeySet *RelinearizationKeySet
+	RotationKeySet        *RotationKeySet
+	ConjugationKeySet     *ConjugationKeySet
+}
+
+// NewEvaluationKeyBundle returns a new empty EvaluationKeyBundle of given id
+func NewEvaluationKeyBundle(params Parameters, id string) *EvaluationKeyBundle {
+	bundle := new(EvaluationKeyBundle)
+	bundle.ID = id
+	bundle.Fingerprint = params.Fingerprint()
+	bundle.RotationKeys = make(map[uint]*RotationKey)
+	return bundle
+}
+
+// AddRotationKey insert new rotation key into EvaluationKeyBundle
+func (bundle *EvaluationKeyBundle) AddRotationKey(rtk *RotationKey) {
+	bundle.RotationKeys[rtk.RotIdx] = rtk
+}
+
+// NewEvaluationKeySet returns a new empty EvaluationKeySet
+func NewEvaluationKeySet(params Parameters) *EvaluationKeySet {
+	evkSet := new(EvaluationKeySet)
+	evkSet.params = params
+	evkSet.PublicKeySet = NewPublicKeyKeySet()
+	evkSet.RelinearizationKeySet = NewRelinearizationKeyKeySet(params)
+	evkSet.RotationKeySet = NewRotationKeySet()
+	evkSet.ConjugationKeySet = NewConjugationKeySet()
+	return evkSet
+}
+
+// AddBundle checks that bundle was generated with the parameters of the set and inserts its keys into the corresponding key sets
+func (evkSet *EvaluationKeySet) AddBundle(bundle *EvaluationKeyBundle) error {
+
+	if bundle.Fingerprint != evkSet.params.Fingerprint() {
+		return fmt.Errorf("cannot AddBundle: keys of %s were generated with different parameters", bundle.ID)
+	}
+
+	if bundle.PublicKey != nil && bundle.PublicKey.ID != bundle.ID {
+		return fmt.Errorf("cannot AddBundle: public key of %s has id %s", bundle.ID, bundle.PublicKey.ID)
+	}
+
+	if bundle.RelinearizationKey != nil && bundle.RelinearizationKey.ID != bundle.ID {
+		return fmt.Errorf("cannot AddBundle: relinearization key of %s has id %s", bundle.ID, bundle.RelinearizationKey.ID)
+	}
+
+	for _, rtk := range bundle.RotationKeys {
+		if rtk.ID != bundle.ID {
+			return fmt.Errorf("cannot AddBundle: rotation key of %s has id %s", bundle.ID, rtk.ID)
+		}
+	}
+
+	if bundle.ConjugationKey != nil && bundle.ConjugationKey.ID != bundle.ID {
+		return fmt.Errorf("cannot AddBundle: conjugation key of %s has id %s", bundle.ID, bundle.ConjugationKey.ID)
+	}
+
+	if bundle.PublicKey != nil {
+		evkSet.PublicKeySet.AddPublicKey(bundle.PublicKey)
+	}
+
+	if bundle.RelinearizationKey != nil {
+		evkSet.RelinearizationKeySet.AddRelinearizationKey(bundle.RelinearizationKey)
+	}
+
+	for _, rtk := range bundle.RotationKeys {
+		evkSet.RotationKeySet.AddRotationKey(rtk)
+	}
+
+	if bundle.ConjugationKey != nil {
+		evkSet.ConjugationKeySet.AddConjugationKey(bundle.ConjugationKey)
+	}
+
+	return nil
+}
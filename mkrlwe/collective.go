@@ -0,0 +1,269 @@
+package mkrlwe
+
+import (
+	"fmt"
+
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+// CollectivePublicKey is the public key of a group of parties under the sum of their secret keys.
+// As the keys of the parties share the CRS, it is the sum of their public keys, and the evaluation keys of the group
+// are the sums of their evaluation keys. Its ID identifies the group in the ciphertexts and in the key sets,
+// so that a ciphertext converted with ConvertToCollective holds a single component for the whole group
+// and can still be combined with the ciphertexts of parties outside the group.
+type CollectivePublicKey struct {
+	*PublicKey
+	Parties *IDSet
+
+	params Parameters
+}
+
+// GenCollectivePublicKey returns the collective public key with given ID of the parties of pks.
+// Returns an error if id is not a valid party ID or is the ID of one of the parties, if there is no public key
+// or if a party has several public keys.
+func GenCollectivePublicKey(params Parameters, id string, pks []*PublicKey) (cpk *CollectivePublicKey, err error) {
+
+	if err = ValidateID(id); err != nil {
+		return nil, fmt.Errorf("cannot GenCollectivePublicKey: %w", err)
+	}
+
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("cannot GenCollectivePublicKey: there is no public key")
+	}
+
+	ringQP := params.RingQP()
+	levelQ, levelP := params.QCount()-1, params.PCount()-1
+
+	cpk = &CollectivePublicKey{PublicKey: NewPublicKey(params, id), Parties: NewIDSet(), params: params}
+
+	for _, pk := range pks {
+		if pk.ID == id {
+			return nil, fmt.Errorf("cannot GenCollectivePublicKey: %s is the ID of a party", id)
+		}
+
+		if cpk.Parties.Has(pk.ID) {
+			return nil, fmt.Errorf("cannot GenCollectivePublicKey: duplicated public key for %s", pk.ID)
+		}
+
+		ringQP.AddLvl(levelQ, levelP, cpk.Value[0], pk.Value[0], cpk.Value[0])
+		cpk.Parties.Add(pk.ID)
+	}
+
+	// pk[1] is the CRS shared by the parties
+	cpk.Value[1].Q.Copy(params.CRS[0].Value[0].Q)
+	cpk.Value[1].P.Copy(params.CRS[0].Value[0].P)
+
+	return cpk, nil
+}
+
+// checkParties returns an error if ids do not hold every party of the group exactly once.
+func (cpk *CollectivePublicKey) checkParties(ids []string) error {
+	summed := NewIDSet()
+
+	for _, id := range ids {
+		if !cpk.Parties.Has(id) {
+			return fmt.Errorf("%s is not a party of group %s", id, cpk.ID)
+		}
+
+		if summed.Has(id) {
+			return fmt.Errorf("duplicated key for %s", id)
+		}
+
+		summed.Add(id)
+	}
+
+	if summed.Size() != cpk.Parties.Size() {
+		return fmt.Errorf("there is a missing key for group %s", cpk.ID)
+	}
+
+	return nil
+}
+
+// addSwitchingKey adds swk to acc
+func (cpk *CollectivePublicKey) addSwitchingKey(acc, swk *SwitchingKey) {
+	ringQP := cpk.params.RingQP()
+	levelQ, levelP := cpk.params.QCount()-1, cpk.params.PCount()-1
+
+	for i := range acc.Value {
+		ringQP.AddLvl(levelQ, levelP, acc.Value[i], swk.Value[i], acc.Value[i])
+	}
+}
+
+// GenRelinearizationKey returns the relinearization key of the group, which is the sum of the relinearization keys of its parties.
+// Returns an error if rlks do not hold the key of every party of the group exactly once.
+func (cpk *CollectivePublicKey) GenRelinearizationKey(rlks []*RelinearizationKey) (rlk *RelinearizationKey, err error) {
+
+	ids := make([]string, len(rlks))
+	for i := range rlks {
+		ids[i] = rlks[i].ID
+	}
+
+	if err = cpk.checkParties(ids); err != nil {
+		return nil, fmt.Errorf("cannot GenRelinearizationKey: %w", err)
+	}
+
+	rlk = NewRelinearizationKey(cpk.params, cpk.ID)
+	for _, rlki := range rlks {
+		for k := range rlk.Value {
+			cpk.addSwitchingKey(rlk.Value[k], rlki.Value[k])
+		}
+	}
+
+	return rlk, nil
+}
+
+// GenRotationKey returns the rotation key of the group, which is the sum of the rotation keys of its parties.
+// Returns an error if rks do not hold the key of every party of the group exactly once or if their rotations differ.
+func (cpk *CollectivePublicKey) GenRotationKey(rks []*RotationKey) (rk *RotationKey, err error) {
+
+	ids := make([]string, len(rks))
+	for i := range rks {
+		ids[i] = rks[i].ID
+
+		if rks[i].RotIdx != rks[0].RotIdx {
+			return nil, fmt.Errorf("cannot GenRotationKey: rotation keys for %d and %d", rks[0].RotIdx, rks[i].RotIdx)
+		}
+	}
+
+	if err = cpk.checkParties(ids); err != nil {
+		return nil, fmt.Errorf("cannot GenRotationKey: %w", err)
+	}
+
+	rk = NewRotationKey(cpk.params, rks[0].RotIdx, cpk.ID)
+	for _, rki := range rks {
+		cpk.addSwitchingKey(rk.Value, rki.Value)
+	}
+
+	return rk, nil
+}
+
+// GenConjugationKey returns the conjugation key of the group, which is the sum of the conjugation keys of its parties.
+// Returns an error if cjks do not hold the key of every party of the group exactly once.
+func (cpk *CollectivePublicKey) GenConjugationKey(cjks []*ConjugationKey) (cjk *ConjugationKey, err error) {
+
+	ids := make([]string, len(cjks))
+	for i := range cjks {
+		ids[i] = cjks[i].ID
+	}
+
+	if err = cpk.checkParties(ids); err != nil {
+		return nil, fmt.Errorf("cannot GenConjugationKey: %w", err)
+	}
+
+	cjk = NewConjugationKey(cpk.params, cpk.ID)
+	for _, cjki := range cjks {
+		cpk.addSwitchingKey(cjk.Value, cjki.Value)
+	}
+
+	return cjk, nil
+}
+
+// AggregateDecryptionShares adds the decryption shares of the group component of a ciphertext computed by every party
+// of the group with GenCollectiveDecryptionShare. The result is the decryption share of the group, which is merged
+// with the shares of the other parties of the ciphertext by MergeDecryptionShares.
+// Returns an error if shares do not hold the share of every party of the group exactly once or if they do not match.
+func (cpk *CollectivePublicKey) AggregateDecryptionShares(shares []*DecryptionShare) (share *DecryptionShare, err error) {
+
+	ids := make([]string, len(shares))
+	for i := range shares {
+		ids[i] = shares[i].ID
+
+		if shares[i].Value.Level() != shares[0].Value.Level() || shares[i].Value.IsNTT != shares[0].Value.IsNTT {
+			return nil, fmt.Errorf("cannot AggregateDecryptionShares: shares of %s and %s do not match", shares[0].ID, shares[i].ID)
+		}
+	}
+
+	if err = cpk.checkParties(ids); err != nil {
+		return nil, fmt.Errorf("cannot AggregateDecryptionShares: %w", err)
+	}
+
+	ringQ := cpk.params.RingQ()
+	level := shares[0].Value.Level()
+
+	share = &DecryptionShare{Value: ringQ.NewPolyLvl(level), ID: cpk.ID}
+	share.Value.IsNTT = shares[0].Value.IsNTT
+	for _, sharei := range shares {
+		ringQ.AddLvl(level, share.Value, sharei.Value, share.Value)
+	}
+
+	return share, nil
+}
+
+// GenCollectiveDecryptionShare computes the share c * s_i + e_smudge of the owner of sk, a party of the group of cpk,
+// for the decryption of the component c of the group in ct. The shares of the parties of the group are added by
+// AggregateDecryptionShares. The input ciphertext is not modified and the share has the same level and domain as ct.
+func (decryptor *Decryptor) GenCollectiveDecryptionShare(ct *Ciphertext, sk *SecretKey, cpk *CollectivePublicKey) (share *DecryptionShare) {
+
+	if !cpk.Parties.Has(sk.ID) {
+		panic("Cannot GenCollectiveDecryptionShare: secretkey is not of a party of the group")
+	}
+
+	c, in := ct.Value[cpk.ID]
+	if !in {
+		panic("Cannot GenCollectiveDecryptionShare: ciphertext does not contain the component of the group")
+	}
+
+	return decryptor.genDecryptionShare(ct.Level(), c, sk)
+}
+
+// ConvertToCollective merges the re-encryption shares towards cpk of the parties of the group engaged in ct, computed with
+// GenReencryptionShare, and returns a copy of ct in which their components are replaced by a single component of the group.
+// The components of the parties outside the group are kept, so that the output has 2 components if every party of ct
+// is in the group, and it is decrypted by the group as a single party with AggregateDecryptionShares.
+// Returns an error if a share is missing, duplicated, foreign to ct or to the group, for another recipient,
+// at a lower level than ct or not in its domain.
+func (decryptor *Decryptor) ConvertToCollective(ct *Ciphertext, cpk *CollectivePublicKey, shares []*ReencryptionShare) (ctOut *Ciphertext, err error) {
+
+	ringQ := decryptor.ringQ
+	level := ct.Level()
+	isNTT := ct.Value["0"].IsNTT
+	idset := ct.IDSet()
+
+	converted := NewIDSet()
+	for _, share := range shares {
+		switch {
+		case share.Recipient != cpk.ID:
+			return nil, fmt.Errorf("cannot ConvertToCollective: share of %s for recipient %s instead of %s", share.ID, share.Recipient, cpk.ID)
+		case !cpk.Parties.Has(share.ID):
+			return nil, fmt.Errorf("cannot ConvertToCollective: %s is not a party of group %s", share.ID, cpk.ID)
+		case !idset.Has(share.ID):
+			return nil, fmt.Errorf("cannot ConvertToCollective: ciphertext has no component for %s", share.ID)
+		case converted.Has(share.ID):
+			return nil, fmt.Errorf("cannot ConvertToCollective: duplicated share for %s", share.ID)
+		case share.Value[0].Level() < level || share.Value[1].Level() < level:
+			return nil, fmt.Errorf("cannot ConvertToCollective: share of %s has a lower level than the ciphertext", share.ID)
+		case share.Value[0].IsNTT != isNTT || share.Value[1].IsNTT != isNTT:
+			return nil, fmt.Errorf("cannot ConvertToCollective: share of %s is not in the ciphertext domain", share.ID)
+		}
+
+		converted.Add(share.ID)
+	}
+
+	if converted.Size() == 0 {
+		return nil, fmt.Errorf("cannot ConvertToCollective: ciphertext has no component of group %s", cpk.ID)
+	}
+
+	if converted.Size() != idset.Intersection(cpk.Parties).Size() {
+		return nil, fmt.Errorf("cannot ConvertToCollective: there is a missing share")
+	}
+
+	ctOut = &Ciphertext{Value: make(map[string]*ring.Poly), Fingerprint: ct.Fingerprint}
+	for id, c := range ct.Value {
+		if !converted.Has(id) {
+			ctOut.Value[id] = ringQ.NewPolyLvl(level)
+			ring.CopyValuesLvl(level, c, ctOut.Value[id])
+			ctOut.Value[id].IsNTT = isNTT
+		}
+	}
+
+	group := NewIDSet()
+	group.Add(cpk.ID)
+	ctOut.PadCiphertext(group)
+
+	for _, share := range shares {
+		ringQ.AddLvl(level, ctOut.Value["0"], share.Value[0], ctOut.Value["0"])
+		ringQ.AddLvl(level, ctOut.Value[cpk.ID], share.Value[1], ctOut.Value[cpk.ID])
+	}
+
+	return ctOut, nil
+}
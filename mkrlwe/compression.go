@@ -0,0 +1,249 @@
+package mkrlwe
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/ldsec/lattigo/v2/ring"
+	"github.com/ldsec/lattigo/v2/rlwe"
+	"github.com/ldsec/lattigo/v2/utils"
+)
+
+// The uniform parts of the public objects are either given by the CRS or sampled from a seed,
+// and can thus be dropped when marshaling:
+//   - the a part of a PublicKey is CRS[0] and is expanded again from the parameters by MarshalBinaryCompressed,
+//   - the a part of a SeededCiphertext is sampled from a seed which is sent instead, which about halves its size.
+//
+// The other objects are not compressed:
+//   - relinearization, rotation and conjugation keys only hold their b parts, their a parts being CRSs,
+//     so that their marshaling is already minimal and they make up most of an EvaluationKeyBundle,
+//   - the public key of an EvaluationKeyBundle is marshaled in full,
+//   - both components of a ciphertext encrypted with a public key carry noise, so that it cannot be seeded:
+//     a party uploading its own data should encrypt it with its secret key in a SeededCiphertext,
+//   - PartySwitchingKeys hold their own a part, as there is no CRS for the new key of the party.
+
+// CiphertextSeedSize is the size in bytes of the seed of a SeededCiphertext
+const CiphertextSeedSize = 32
+
+// SeededCiphertext is a fresh ciphertext encrypted with the secret key of a single party,
+// whose uniform component is replaced by the seed it was sampled from.
+// Fingerprint is the fingerprint of the parameters it was created with, as for a Ciphertext.
+type SeededCiphertext struct {
+	Value       *ring.Poly
+	ID          string
+	Seed        []byte
+	Fingerprint [32]byte
+}
+
+// NewSeededCiphertext returns a new SeededCiphertext of given id at given level
+func NewSeededCiphertext(params Parameters, id string, level int) *SeededCiphertext {
+	sct := new(SeededCiphertext)
+	sct.Value = ring.NewPoly(params.N(), level+1)
+	sct.ID = id
+	sct.Fingerprint = params.Fingerprint()
+	return sct
+}
+
+// Level returns the level of the target SeededCiphertext
+func (sct *SeededCiphertext) Level() int {
+	return len(sct.Value.Coeffs) - 1
+}
+
+// sampleSeededUniform samples the uniform component of a SeededCiphertext of given seed at given level.
+// The moduli are sampled one after the other, so that the component at a lower level is a prefix of
+// the component at a higher level.
+func sampleSeededUniform(params Parameters, seed []byte, level int, pol *ring.Poly) {
+	prng, err := utils.NewKeyedPRNG(seed)
+	if err != nil {
+		panic(err)
+	}
+	ring.NewUniformSampler(prng, params.RingQ()).ReadLvl(level, pol)
+}
+
+// Expand regenerates the uniform component of sct and returns the corresponding Ciphertext.
+func (sct *SeededCiphertext) Expand(params Parameters) (ctOut *Ciphertext) {
+
+	level := sct.Level()
+
+	ctOut = new(Ciphertext)
+	ctOut.Value = make(map[string]*ring.Poly)
+	ctOut.Fingerprint = params.Fingerprint()
+	ctOut.Value["0"] = sct.Value.CopyNew()
+	ctOut.Value[sct.ID] = ring.NewPoly(params.N(), level+1)
+
+	sampleSeededUniform(params, sct.Seed, level, ctOut.Value[sct.ID])
+	ctOut.Value[sct.ID].IsNTT = sct.Value.IsNTT
+
+	return ctOut
+}
+
+// EncryptSkSeeded encrypts the input Plaintext with sk and write the result in sctOut.
+// The uniform component is sampled from a fresh seed stored in sctOut.
+// The level of the output is min(plaintext.Level(), sctOut.Level()).
+func (encryptor *Encryptor) EncryptSkSeeded(plaintext *rlwe.Plaintext, sk *SecretKey, sctOut *SeededCiphertext) {
+
+	levelQ := utils.MinInt(plaintext.Level(), sctOut.Level())
+	ringQ := encryptor.ringQ
+	poolQ0 := encryptor.poolQ[0]
+
+	sctOut.ID = sk.ID
+	sctOut.Seed = make([]byte, CiphertextSeedSize)
+	if _, err := rand.Read(sctOut.Seed); err != nil {
+		panic(err)
+	}
+
+	ciphertextNTT := sctOut.Value.IsNTT
+	c0 := sctOut.Value
+
+	// a is sampled in the domain of the ciphertext
+	sampleSeededUniform(encryptor.params, sctOut.Seed, levelQ, poolQ0)
+	if !ciphertextNTT {
+		ringQ.NTTLvl(levelQ, poolQ0, poolQ0)
+	}
+
+	// c0 = -a*s
+	ringQ.MulCoeffsMontgomeryLvl(levelQ, poolQ0, sk.Value.Q, c0)
+	ringQ.NegLvl(levelQ, c0, c0)
+
+	if ciphertextNTT {
+		// c0 = -a*s + e
+		encryptor.gaussianSampler.ReadLvl(levelQ, poolQ0)
+		ringQ.NTTLvl(levelQ, poolQ0, poolQ0)
+		ringQ.AddLvl(levelQ, c0, poolQ0, c0)
+
+		// c0 = -a*s + e + m
+		if !plaintext.Value.IsNTT {
+			ringQ.NTTLvl(levelQ, plaintext.Value, poolQ0)
+			ringQ.AddLvl(levelQ, c0, poolQ0, c0)
+		} else {
+			ringQ.AddLvl(levelQ, c0, plaintext.Value, c0)
+		}
+	} else {
+		ringQ.InvNTTLvl(levelQ, c0, c0)
+
+		// c0 = -a*s + e
+		encryptor.gaussianSampler.ReadAndAddLvl(levelQ, c0)
+
+		// c0 = -a*s + e + m
+		if !plaintext.Value.IsNTT {
+			ringQ.AddLvl(levelQ, c0, plaintext.Value, c0)
+		} else {
+			ringQ.InvNTTLvl(levelQ, plaintext.Value, poolQ0)
+			ringQ.AddLvl(levelQ, c0, poolQ0, c0)
+		}
+	}
+
+	c0.Coeffs = c0.Coeffs[:levelQ+1]
+}
+
+// GetDataLen returns the length in bytes of the target SeededCiphertext.
+func (sct *SeededCiphertext) GetDataLen(WithMetadata bool) (dataLen int) {
+	return idDataLen(sct.ID, WithMetadata) + CiphertextSeedSize + sct.Value.GetDataLen(WithMetadata)
+}
+
+// Encode writes the ID, the seed and the first component of the target SeededCiphertext in data.
+// It returns the number of bytes written.
+func (sct *SeededCiphertext) Encode(data []byte) (pointer int, err error) {
+
+	if len(sct.Seed) != CiphertextSeedSize {
+		return 0, fmt.Errorf("cannot Encode: seed should be %d bytes", CiphertextSeedSize)
+	}
+
+	var inc int
+
+	if pointer, err = encodeID(data, sct.ID); err != nil {
+		return 0, err
+	}
+
+	copy(data[pointer:], sct.Seed)
+	pointer += CiphertextSeedSize
+
+	if inc, err = sct.Value.WriteTo(data[pointer:]); err != nil {
+		return pointer, err
+	}
+
+	return pointer + inc, nil
+}
+
+// Decode reads a SeededCiphertext written by Encode from data.
+func (sct *SeededCiphertext) Decode(data []byte) (err error) {
+
+	var pointer, inc int
+
+	if sct.ID, pointer, err = decodeID(data); err != nil {
+		return err
+	}
+
+	if len(data)-pointer < CiphertextSeedSize {
+		return errTruncated("seed")
+	}
+
+	sct.Seed = make([]byte, CiphertextSeedSize)
+	copy(sct.Seed, data[pointer:pointer+CiphertextSeedSize])
+	pointer += CiphertextSeedSize
+
+	if sct.Value, inc, err = decodePoly(data[pointer:]); err != nil {
+		return err
+	}
+
+	if pointer+inc != len(data) {
+		return errMalformed("remaining unparsed data")
+	}
+
+	return nil
+}
+
+// MarshalBinaryCompressed encodes a PublicKey in a byte slice without its a part, which is CRS[0] of params.
+// The output is bound to params and should be decoded with UnmarshalBinaryCompressed.
+func (pk *PublicKey) MarshalBinaryCompressed(params Parameters) (data []byte, err error) {
+
+	crs := params.CRS[0].Value[0]
+	if !pk.Value[1].Q.Equals(crs.Q) || !pk.Value[1].P.Equals(crs.P) {
+		return nil, fmt.Errorf("cannot MarshalBinaryCompressed: public key of %s is not generated from the CRS of params", pk.ID)
+	}
+
+	if err = ValidateID(pk.ID); err != nil {
+		return nil, err
+	}
+
+	return MarshalEnvelope(KindCompressedPublicKey, params.Fingerprint(), pk.Value[0].GetDataLen(true)+len(pk.ID), func(payload []byte) (err error) {
+		var pt int
+		if pt, err = pk.Value[0].WriteTo(payload); err != nil {
+			return err
+		}
+		copy(payload[pt:], []byte(pk.ID))
+		return nil
+	})
+}
+
+// UnmarshalBinaryCompressed decodes a PublicKey marshaled with MarshalBinaryCompressed
+// and expands its a part from the CRS of params.
+func (pk *PublicKey) UnmarshalBinaryCompressed(params Parameters, data []byte) (err error) {
+
+	var hdr EnvelopeHeader
+
+	if hdr, err = ReadEnvelopeHeader(data); err != nil {
+		return err
+	}
+
+	if hdr.ParamHash != params.Fingerprint() {
+		return &DecodingError{Kind: KindCompressedPublicKey, Err: ErrParamsMismatch}
+	}
+
+	_, err = UnmarshalEnvelope(KindCompressedPublicKey, data, func(payload []byte) (err error) {
+		var pt int
+		if pk.Value[0], pt, err = decodePolyQP(payload); err != nil {
+			return err
+		}
+		pk.ID = string(payload[pt:])
+		return checkDecodedID(pk.ID)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	pk.Value[1] = params.CRS[0].Value[0].CopyNew()
+
+	return nil
+}
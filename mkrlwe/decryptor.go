@@ -1,24 +1,101 @@
 package mkrlwe
 
+import "fmt"
+import "math"
+
 import "github.com/ldsec/lattigo/v2/ring"
 import "github.com/ldsec/lattigo/v2/rlwe"
 import "github.com/ldsec/lattigo/v2/utils"
 
+// DefaultSmudgingSigma is the standard deviation of the noise added to decryption shares
+const DefaultSmudgingSigma = float64(1 << 20)
+
 // decryptor is a structure used to decrypt ciphertext. It stores the secret-key.
 type Decryptor struct {
-	params Parameters
-	ringQ  *ring.Ring
-	pool   *ring.Poly
-	sk     *SecretKey
+	params          Parameters
+	ringQ           *ring.Ring
+	pool            *ring.Poly
+	sk              *SecretKey
+	smudgingSigma   float64
+	smudgingSampler *ring.GaussianSampler
+
+	// samplers of the encryption randomness of the re-encryption shares
+	ternarySampler  *ring.TernarySampler
+	gaussianSampler *ring.GaussianSampler
+}
+
+// DecryptionShare is a type for a partial decryption c_i * s_i + e_smudge of the ID component of a ciphertext.
+// It is computed by the owner of the secret key s_i and can be sent to a combiner without revealing s_i.
+type DecryptionShare struct {
+	Value *ring.Poly
+	ID    string
 }
 
 // NewDecryptor instantiates a new generic RLWE Decryptor.
 func NewDecryptor(params Parameters) *Decryptor {
 
-	return &Decryptor{
-		params: params,
-		ringQ:  params.RingQ(),
-		pool:   params.RingQ().NewPoly(),
+	prng, err := utils.NewPRNG()
+	if err != nil {
+		panic(err)
+	}
+
+	decryptor := &Decryptor{
+		params:          params,
+		ringQ:           params.RingQ(),
+		pool:            params.RingQ().NewPoly(),
+		ternarySampler:  ring.NewTernarySampler(prng, params.RingQ(), 0.5, false),
+		gaussianSampler: ring.NewGaussianSampler(prng, params.RingQ(), params.Sigma(), int(6*params.Sigma())),
+	}
+
+	decryptor.SetSmudgingSigma(DefaultSmudgingSigma)
+
+	return decryptor
+}
+
+// SetSmudgingSigma sets the standard deviation of the noise flooding the decryption shares.
+// The noise is truncated at 6 sigma, which should be smaller than every modulus of the ring.
+func (decryptor *Decryptor) SetSmudgingSigma(sigma float64) {
+	if sigma <= 0 {
+		panic("Cannot SetSmudgingSigma: sigma should be positive")
+	}
+
+	bound := 6 * sigma
+	for _, qi := range decryptor.ringQ.Modulus {
+		if bound >= float64(qi>>1) {
+			panic("Cannot SetSmudgingSigma: smudging bound exceeds the ciphertext modulus")
+		}
+	}
+
+	prng, err := utils.NewPRNG()
+	if err != nil {
+		panic(err)
+	}
+
+	decryptor.smudgingSigma = sigma
+	decryptor.smudgingSampler = ring.NewGaussianSampler(prng, decryptor.ringQ, sigma, int(bound))
+}
+
+// SetSmudgingLogBound sets the noise flooding the decryption shares so that it is bounded by 2^logBound in absolute value.
+func (decryptor *Decryptor) SetSmudgingLogBound(logBound int) {
+	decryptor.SetSmudgingSigma(math.Exp2(float64(logBound)) / 6)
+}
+
+// SmudgingSigma returns the standard deviation of the noise flooding the decryption shares
+func (decryptor *Decryptor) SmudgingSigma() float64 {
+	return decryptor.smudgingSigma
+}
+
+// mulSecret computes c * s at given level and write the result in cOut.
+// The output has the same domain as c.
+func (decryptor *Decryptor) mulSecret(level int, c *ring.Poly, sk *SecretKey, cOut *ring.Poly) {
+	ringQ := decryptor.ringQ
+
+	if !c.IsNTT {
+		ringQ.NTTLvl(level, c, cOut)
+		ringQ.MulCoeffsMontgomeryLvl(level, cOut, sk.Value.Q, cOut)
+		ringQ.InvNTTLvl(level, cOut, cOut)
+	} else {
+		ringQ.MulCoeffsMontgomeryLvl(level, c, sk.Value.Q, cOut)
 	}
 }
 
@@ -28,18 +105,88 @@ func (decryptor *Decryptor) PartialDecrypt(ct *Ciphertext, sk *SecretKey) {
 	id := sk.ID
 	level := ct.Level()
 
-	if !ct.Value[id].IsNTT {
-		ringQ.NTTLvl(level, ct.Value[id], ct.Value[id])
+	decryptor.mulSecret(level, ct.Value[id], sk, ct.Value[id])
+
+	ringQ.AddLvl(level, ct.Value["0"], ct.Value[id], ct.Value["0"])
+	delete(ct.Value, id)
+}
+
+// GenDecryptionShare computes the decryption share c_i * s_i + e_smudge of ct for the owner of sk.
+// The input ciphertext is not modified and the share has the same level and domain as ct.
+func (decryptor *Decryptor) GenDecryptionShare(ct *Ciphertext, sk *SecretKey) (share *DecryptionShare) {
+	c, in := ct.Value[sk.ID]
+	if !in {
+		panic("Cannot GenDecryptionShare: ciphertext does not contain the component of given secretkey")
 	}
 
-	ringQ.MulCoeffsMontgomeryLvl(level, ct.Value[id], sk.Value.Q, ct.Value[id])
+	return decryptor.genDecryptionShare(ct.Level(), c, sk)
+}
+
+// genDecryptionShare computes the decryption share c * s + e_smudge of the component c for the owner of sk at given level.
+func (decryptor *Decryptor) genDecryptionShare(level int, c *ring.Poly, sk *SecretKey) (share *DecryptionShare) {
+	ringQ := decryptor.ringQ
+
+	share = new(DecryptionShare)
+	share.ID = sk.ID
+	share.Value = ringQ.NewPolyLvl(level)
+	share.Value.IsNTT = c.IsNTT
+
+	decryptor.mulSecret(level, c, sk, share.Value)
 
-	if !ct.Value[id].IsNTT {
-		ringQ.InvNTTLvl(level, ct.Value[id], ct.Value[id])
+	// flood the share with smudging noise
+	decryptor.smudgingSampler.ReadLvl(level, decryptor.pool)
+	if share.Value.IsNTT {
+		ringQ.NTTLvl(level, decryptor.pool, decryptor.pool)
 	}
+	ringQ.AddLvl(level, share.Value, decryptor.pool, share.Value)
 
-	ringQ.AddLvl(level, ct.Value["0"], ct.Value[id], ct.Value["0"])
-	delete(ct.Value, id)
+	return share
+}
+
+// MergeDecryptionShares adds the decryption shares of every party engaged in ct to ct_0 and write the result in plaintext.
+// The level of the output plaintext is min(ciphertext.Level(), plaintext.Level())
+// It returns an error if a share is missing, duplicated, foreign to ct or not in the same domain as ct.
+func (decryptor *Decryptor) MergeDecryptionShares(ct *Ciphertext, shares []*DecryptionShare, plaintext *rlwe.Plaintext) error {
+	ringQ := decryptor.ringQ
+	level := utils.MinInt(ct.Level(), plaintext.Level())
+
+	idset := ct.IDSet()
+	merged := NewIDSet()
+
+	for _, share := range shares {
+		if !idset.Has(share.ID) {
+			return fmt.Errorf("cannot MergeDecryptionShares: ciphertext has no component for %s", share.ID)
+		}
+
+		if merged.Has(share.ID) {
+			return fmt.Errorf("cannot MergeDecryptionShares: duplicated share for %s", share.ID)
+		}
+
+		if share.Value.Level() < level {
+			return fmt.Errorf("cannot MergeDecryptionShares: share of %s has a lower level than the ciphertext", share.ID)
+		}
+
+		if share.Value.IsNTT != ct.Value["0"].IsNTT {
+			return fmt.Errorf("cannot MergeDecryptionShares: share of %s is not in the ciphertext domain", share.ID)
+		}
+
+		merged.Add(share.ID)
+	}
+
+	if merged.Size() != idset.Size() {
+		return fmt.Errorf("cannot MergeDecryptionShares: there is a missing share")
+	}
+
+	plaintext.Value.Coeffs = plaintext.Value.Coeffs[:level+1]
+
+	ring.CopyValuesLvl(level, ct.Value["0"], decryptor.pool)
+	for _, share := range shares {
+		ringQ.AddLvl(level, decryptor.pool, share.Value, decryptor.pool)
+	}
+
+	ringQ.ReduceLvl(level, decryptor.pool, plaintext.Value)
+
+	return nil
 }
 
 // Decrypt decrypts the ciphertext with given secretkey set and write the result in ptOut.
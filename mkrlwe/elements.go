@@ -1,6 +1,7 @@
 package mkrlwe
 
 import "github.com/ldsec/lattigo/v2/ring"
+import "github.com/ldsec/lattigo/v2/utils"
 
 type HoistedCiphertext struct {
 	Value map[string]*SwitchingKey
@@ -16,12 +17,17 @@ func NewHoistedCiphertext() *HoistedCiphertext {
 
 type Ciphertext struct {
 	Value map[string]*ring.Poly
+
+	// Fingerprint is the fingerprint of the parameters the ciphertext was created with, or all zeros if it is unknown.
+	// It is written as the parameter hash of the envelope of the ciphertext.
+	Fingerprint [32]byte
 }
 
 // NewCiphertext returns a new Element with zero values
 func NewCiphertext(params Parameters, idset *IDSet, level int) *Ciphertext {
 	el := new(Ciphertext)
 	el.Value = make(map[string]*ring.Poly)
+	el.Fingerprint = params.Fingerprint()
 
 	el.Value["0"] = ring.NewPoly(params.N(), level+1)
 
@@ -71,6 +77,7 @@ func (el *Ciphertext) CopyNew() *Ciphertext {
 
 	ctxCopy := new(Ciphertext)
 	ctxCopy.Value = make(map[string]*ring.Poly)
+	ctxCopy.Fingerprint = el.Fingerprint
 
 	ctxCopy.Value["0"] = el.Value["0"].CopyNew()
 	for id := range el.Value {
@@ -103,3 +110,18 @@ func (el *Ciphertext) PadCiphertext(idset *IDSet) {
 		}
 	}
 }
+
+// AlignLevels returns the minimum level of ctOut and of the input ciphertexts, and drops ctOut to this level.
+func AlignLevels(ctOut *Ciphertext, cts ...*Ciphertext) (level int) {
+
+	level = ctOut.Level()
+	for _, ct := range cts {
+		level = utils.MinInt(level, ct.Level())
+	}
+
+	for id := range ctOut.Value {
+		ctOut.Value[id].Coeffs = ctOut.Value[id].Coeffs[:level+1]
+	}
+
+	return
+}
@@ -0,0 +1,296 @@
+package mkrlwe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ldsec/lattigo/v2/ring"
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
+
+// Every serializable object is marshaled inside an envelope of the following layout.
+// All the integers are written in big endian.
+//
+//	[4 magic "MKHE"][1 version][1 kind][32 parameter hash][8 payload length][payload][32 SHA-256]
+//
+// The checksum is computed over the header and the payload.
+// The parameter hash is the Fingerprint of the parameters the object is bound to,
+// or all zeros if the object does not carry its parameters.
+const (
+	// EnvelopeVersion is the version of the envelope format
+	EnvelopeVersion = 1
+
+	// EnvelopeHeaderSize is the size in bytes of the envelope header
+	EnvelopeHeaderSize = 4 + 1 + 1 + 32 + 8
+
+	// EnvelopeOverhead is the number of bytes added by the envelope to the payload of an object
+	EnvelopeOverhead = EnvelopeHeaderSize + sha256.Size
+)
+
+var envelopeMagic = [4]byte{'M', 'K', 'H', 'E'}
+
+// ObjectKind identifies the type of a marshaled object.
+type ObjectKind uint8
+
+// Kinds of the serializable objects of mkrlwe and of the schemes built on top of it.
+const (
+	KindParameters ObjectKind = iota + 1
+	KindSecretKey
+	KindPublicKey
+	KindSwitchingKey
+	KindRelinearizationKey
+	KindRotationKeySet
+	KindConjugationKey
+	KindConjugationKeySet
+	KindDecryptionShare
+	KindRelinearizationKeySet
+	KindEvaluationKeyBundle
+	KindCiphertext
+	KindCKKSParameters
+	KindCompressedPublicKey
+	KindSeededCiphertext
+	KindBFVParameters
+	KindBFVCiphertext
+	KindReencryptionShare
+	KindPartySwitchingKey
+)
+
+var kindNames = map[ObjectKind]string{
+	KindParameters:            "Parameters",
+	KindSecretKey:             "SecretKey",
+	KindPublicKey:             "PublicKey",
+	KindSwitchingKey:          "SwitchingKey",
+	KindRelinearizationKey:    "RelinearizationKey",
+	KindRotationKeySet:        "RotationKeySet",
+	KindConjugationKey:        "ConjugationKey",
+	KindConjugationKeySet:     "ConjugationKeySet",
+	KindDecryptionShare:       "DecryptionShare",
+	KindRelinearizationKeySet: "RelinearizationKeySet",
+	KindEvaluationKeyBundle:   "EvaluationKeyBundle",
+	KindCiphertext:            "Ciphertext",
+	KindCKKSParameters:        "CKKSParameters",
+	KindCompressedPublicKey:   "CompressedPublicKey",
+	KindSeededCiphertext:      "SeededCiphertext",
+	KindBFVParameters:         "BFVParameters",
+	KindBFVCiphertext:         "BFVCiphertext",
+	KindReencryptionShare:     "ReencryptionShare",
+	KindPartySwitchingKey:     "PartySwitchingKey",
+}
+
+func (kind ObjectKind) String() string {
+	if name, in := kindNames[kind]; in {
+		return name
+	}
+	return fmt.Sprintf("ObjectKind(%d)", uint8(kind))
+}
+
+// Errors returned when decoding a marshaled object. They are wrapped in a DecodingError.
+var (
+	ErrTruncated          = errors.New("truncated data")
+	ErrBadMagic           = errors.New("bad magic number")
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	ErrKindMismatch       = errors.New("unexpected object kind")
+	ErrChecksum           = errors.New("checksum mismatch")
+	ErrParamsMismatch     = errors.New("parameter hash mismatch")
+	ErrMalformed          = errors.New("malformed payload")
+)
+
+// DecodingError is the error returned by UnmarshalBinary.
+// Err is one of the ErrXxx errors of this package and can be tested with errors.Is.
+type DecodingError struct {
+	Kind ObjectKind
+	Err  error
+	Msg  string
+}
+
+func (e *DecodingError) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("cannot decode %s: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("cannot decode %s: %v: %s", e.Kind, e.Err, e.Msg)
+}
+
+func (e *DecodingError) Unwrap() error {
+	return e.Err
+}
+
+func errMalformed(format string, a ...interface{}) error {
+	return &DecodingError{Err: ErrMalformed, Msg: fmt.Sprintf(format, a...)}
+}
+
+func errTruncated(what string) error {
+	return &DecodingError{Err: ErrTruncated, Msg: what}
+}
+
+// asDecodingError returns err as a *DecodingError of given kind, wrapping ErrMalformed if it is not one.
+func asDecodingError(kind ObjectKind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var decErr *DecodingError
+	if !errors.As(err, &decErr) {
+		return &DecodingError{Kind: kind, Err: ErrMalformed, Msg: err.Error()}
+	}
+
+	if decErr.Kind == 0 {
+		decErr.Kind = kind
+	}
+
+	return err
+}
+
+// EnvelopeHeader is the header of a marshaled object.
+type EnvelopeHeader struct {
+	Version    uint8
+	Kind       ObjectKind
+	ParamHash  [32]byte
+	PayloadLen uint64
+}
+
+// CheckParams returns an error wrapping ErrParamsMismatch if the object was marshaled for other parameters than params.
+// Objects which do not carry a parameter hash are always accepted.
+func (hdr EnvelopeHeader) CheckParams(params Parameters) error {
+	if hdr.ParamHash == [32]byte{} || hdr.ParamHash == params.Fingerprint() {
+		return nil
+	}
+	return &DecodingError{Kind: hdr.Kind, Err: ErrParamsMismatch}
+}
+
+// ReadEnvelopeHeader decodes and checks the header of a marshaled object without checking its payload.
+func ReadEnvelopeHeader(data []byte) (hdr EnvelopeHeader, err error) {
+
+	if len(data) < EnvelopeHeaderSize {
+		return hdr, &DecodingError{Err: ErrTruncated, Msg: "missing envelope header"}
+	}
+
+	if !bytes.Equal(data[:4], envelopeMagic[:]) {
+		return hdr, &DecodingError{Err: ErrBadMagic}
+	}
+
+	hdr.Version = data[4]
+	hdr.Kind = ObjectKind(data[5])
+	copy(hdr.ParamHash[:], data[6:38])
+	hdr.PayloadLen = binary.BigEndian.Uint64(data[38:46])
+
+	if hdr.Version != EnvelopeVersion {
+		return hdr, &DecodingError{Kind: hdr.Kind, Err: ErrUnsupportedVersion, Msg: fmt.Sprintf("version %d", hdr.Version)}
+	}
+
+	return hdr, nil
+}
+
+// MarshalEnvelope allocates an envelope of given kind and parameter hash for a payload of payloadLen bytes,
+// calls encode on the payload and seals the envelope with its checksum.
+func MarshalEnvelope(kind ObjectKind, paramHash [32]byte, payloadLen int, encode func(payload []byte) error) (data []byte, err error) {
+
+	data = make([]byte, EnvelopeHeaderSize+payloadLen+sha256.Size)
+
+	copy(data[:4], envelopeMagic[:])
+	data[4] = EnvelopeVersion
+	data[5] = uint8(kind)
+	copy(data[6:38], paramHash[:])
+	binary.BigEndian.PutUint64(data[38:46], uint64(payloadLen))
+
+	if err = encode(data[EnvelopeHeaderSize : EnvelopeHeaderSize+payloadLen]); err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(data[:EnvelopeHeaderSize+payloadLen])
+	copy(data[EnvelopeHeaderSize+payloadLen:], checksum[:])
+
+	return data, nil
+}
+
+// UnmarshalEnvelope checks the envelope of a marshaled object of given kind and calls decode on its payload.
+// It returns the header of the envelope. Any error is returned as a *DecodingError.
+// decode should check the lengths of the payload before reading it.
+func UnmarshalEnvelope(kind ObjectKind, data []byte, decode func(payload []byte) error) (hdr EnvelopeHeader, err error) {
+
+	defer func() {
+		err = asDecodingError(kind, err)
+	}()
+
+	if hdr, err = ReadEnvelopeHeader(data); err != nil {
+		return
+	}
+
+	if hdr.Kind != kind {
+		return hdr, &DecodingError{Kind: kind, Err: ErrKindMismatch, Msg: fmt.Sprintf("got %s", hdr.Kind)}
+	}
+
+	if hdr.PayloadLen > uint64(len(data)-EnvelopeHeaderSize) || uint64(len(data)-EnvelopeHeaderSize)-hdr.PayloadLen < sha256.Size {
+		return hdr, &DecodingError{Kind: kind, Err: ErrTruncated}
+	}
+
+	end := EnvelopeHeaderSize + int(hdr.PayloadLen)
+
+	if end+sha256.Size != len(data) {
+		return hdr, &DecodingError{Kind: kind, Err: ErrMalformed, Msg: "remaining unparsed data"}
+	}
+
+	if checksum := sha256.Sum256(data[:end]); !bytes.Equal(checksum[:], data[end:]) {
+		return hdr, &DecodingError{Kind: kind, Err: ErrChecksum}
+	}
+
+	err = decode(data[EnvelopeHeaderSize:end])
+
+	return
+}
+
+// maxPolyLogN bounds the ring degree accepted when decoding a polynomial
+const maxPolyLogN = 20
+
+// decodePoly checks that data holds a full polynomial before decoding it in a new polynomial.
+func decodePoly(data []byte) (pol *ring.Poly, pointer int, err error) {
+
+	if len(data) < 4 {
+		return nil, 0, errTruncated("polynomial header")
+	}
+
+	logN, numModuli := int(data[0]), int(data[1])
+
+	if logN > maxPolyLogN || numModuli == 0 {
+		return nil, 0, errMalformed("invalid polynomial header")
+	}
+
+	if len(data)-4 < numModuli<<(logN+3) {
+		return nil, 0, errTruncated("polynomial coefficients")
+	}
+
+	pol = new(ring.Poly)
+	if pointer, err = pol.DecodePolyNew(data); err != nil {
+		return nil, 0, err
+	}
+
+	return pol, pointer, nil
+}
+
+// decodePolyQP decodes a PolyQP written by rlwe.PolyQP.WriteTo.
+func decodePolyQP(data []byte) (polQP rlwe.PolyQP, pointer int, err error) {
+
+	var inc int
+
+	if polQP.Q, inc, err = decodePoly(data); err != nil {
+		return
+	}
+	pointer += inc
+
+	if polQP.P, inc, err = decodePoly(data[pointer:]); err != nil {
+		return
+	}
+	pointer += inc
+
+	return
+}
+
+// decodeUint64 decodes a big endian uint64.
+func decodeUint64(data []byte) (uint64, error) {
+	if len(data) < 8 {
+		return 0, errTruncated("uint64")
+	}
+	return binary.BigEndian.Uint64(data[:8]), nil
+}
@@ -0,0 +1,92 @@
+package mkrlwe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// MaxIDLength is the maximum length in bytes of a party ID
+const MaxIDLength = 1 << 16
+
+// ErrInvalidID is wrapped by the errors returned for an invalid party ID.
+var ErrInvalidID = errors.New("invalid party id")
+
+// ValidateID returns an error wrapping ErrInvalidID if id is not a valid party ID.
+// A valid party ID is a non-empty UTF-8 string of at most MaxIDLength bytes, other than "0"
+// which is the key of the first component of a Ciphertext. IDs are marshaled prefixed by their length encoded as a varint.
+func ValidateID(id string) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("%w: empty id", ErrInvalidID)
+	case id == "0":
+		return fmt.Errorf("%w: id 0 is reserved", ErrInvalidID)
+	case len(id) > MaxIDLength:
+		return fmt.Errorf("%w: id of %d bytes is longer than %d bytes", ErrInvalidID, len(id), MaxIDLength)
+	case !utf8.ValidString(id):
+		return fmt.Errorf("%w: id is not valid UTF-8", ErrInvalidID)
+	}
+	return nil
+}
+
+// uvarintLen returns the length in bytes of x encoded as a varint.
+func uvarintLen(x uint64) int {
+	return len(binary.AppendUvarint(nil, x))
+}
+
+// idDataLen returns the length in bytes of id, with its length prefix if WithMetadata is true.
+func idDataLen(id string, WithMetadata bool) int {
+	if WithMetadata {
+		return uvarintLen(uint64(len(id))) + len(id)
+	}
+	return len(id)
+}
+
+// encodeID checks id and writes it in data prefixed by its length.
+// It returns the number of bytes written.
+func encodeID(data []byte, id string) (pointer int, err error) {
+
+	if err = ValidateID(id); err != nil {
+		return 0, err
+	}
+
+	pointer = binary.PutUvarint(data, uint64(len(id)))
+	pointer += copy(data[pointer:], []byte(id))
+
+	return pointer, nil
+}
+
+// decodeID decodes and checks an ID written by encodeID.
+func decodeID(data []byte) (id string, pointer int, err error) {
+
+	idLen, n := binary.Uvarint(data)
+
+	if n == 0 {
+		return "", 0, errTruncated("id")
+	}
+
+	if n < 0 || idLen > MaxIDLength {
+		return "", 0, errMalformed("invalid id length")
+	}
+
+	if uint64(len(data)-n) < idLen {
+		return "", 0, errTruncated("id")
+	}
+
+	id = string(data[n : n+int(idLen)])
+
+	if err = checkDecodedID(id); err != nil {
+		return "", 0, err
+	}
+
+	return id, n + int(idLen), nil
+}
+
+// checkDecodedID returns an error wrapping ErrMalformed if a decoded id is not valid.
+func checkDecodedID(id string) error {
+	if err := ValidateID(id); err != nil {
+		return errMalformed("%v", err)
+	}
+	return nil
+}
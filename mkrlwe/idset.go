@@ -1,5 +1,11 @@
 package mkrlwe
 
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
 type IDSet struct {
 	Value map[string]struct{} //empty structs occupy 0 memory
 }
@@ -10,8 +16,8 @@ func (s *IDSet) Has(v string) bool {
 }
 
 func (s *IDSet) Add(v string) {
-	if v == "0" {
-		panic("Cannot IDSet Add : 0 cannot be used")
+	if err := ValidateID(v); err != nil {
+		panic(fmt.Sprintf("Cannot IDSet Add : %v", err))
 	}
 	s.Value[v] = struct{}{}
 }
@@ -20,6 +26,11 @@ func (s *IDSet) Remove(v string) {
 	delete(s.Value, v)
 }
 
+// Sorted returns the IDs of the set in increasing order
+func (s *IDSet) Sorted() []string {
+	return slices.Sorted(maps.Keys(s.Value))
+}
+
 func (s *IDSet) Size() int {
 	return len(s.Value)
 }
@@ -4,6 +4,7 @@ import "github.com/ldsec/lattigo/v2/rlwe"
 import "github.com/ldsec/lattigo/v2/ring"
 import "github.com/ldsec/lattigo/v2/utils"
 import "math/big"
+import "fmt"
 
 // KeyGenerator is a structure that stores the elements required to create new keys,
 // as well as a small memory pool for intermediate values.
@@ -42,6 +43,9 @@ func NewKeyGenerator(params Parameters) *KeyGenerator {
 // genSecretKeyFromSampler generates a new SecretKey sampled from the provided Sampler.
 // output SecretKey is in MForm
 func (keygen *KeyGenerator) genSecretKeyFromSampler(sampler ring.Sampler, id string) *SecretKey {
+	if err := ValidateID(id); err != nil {
+		panic(fmt.Sprintf("Cannot GenSecretKey: %v", err))
+	}
 	ringQP := keygen.params.RingQP()
 	sk := new(SecretKey)
 	sk.Value = ringQP.NewPoly()
@@ -114,9 +118,9 @@ func (keygen *KeyGenerator) GenKeyPair(id string) (sk *SecretKey, pk *PublicKey)
 	return sk, keygen.GenPublicKey(sk)
 }
 
-// GenKeyPairSparse generates a new SecretKey with exactly hw non zero coefficients [1/2, 0, 1/2].
-func (keygen *KeyGenerator) GenKeyPairSparse(hw int) (sk *SecretKey, pk *PublicKey) {
-	sk = keygen.GenSecretKeySparse(hw, sk.ID)
+// GenKeyPairSparse generates a new SecretKey of given id with exactly hw non zero coefficients [1/2, 0, 1/2].
+func (keygen *KeyGenerator) GenKeyPairSparse(hw int, id string) (sk *SecretKey, pk *PublicKey) {
+	sk = keygen.GenSecretKeySparse(hw, id)
 	return sk, keygen.GenPublicKey(sk)
 }
 
@@ -266,6 +270,56 @@ func (keygen *KeyGenerator) GenConjugationKey(sk *SecretKey) (cjk *ConjugationKe
 	return cjk
 }
 
+// GenPartySwitchingKey generates the key switching the component of the owner of skOld and skNew
+// from skOld to skNew, which lets the evaluator refresh the ciphertexts of a party after a key rotation.
+func (keygen *KeyGenerator) GenPartySwitchingKey(skOld, skNew *SecretKey) (swk *PartySwitchingKey) {
+	if skOld.ID != skNew.ID {
+		panic("Cannot GenPartySwitchingKey: secret keys should belong to the same party")
+	}
+
+	params := keygen.params
+	levelQ := params.QCount() - 1
+	levelP := params.PCount() - 1
+	beta := params.Beta(levelQ)
+	ringQP := params.RingQP()
+
+	swk = NewPartySwitchingKey(params, skOld.ID)
+
+	// a is sampled by the party as there is no CRS for its new key
+	a := swk.Value[1]
+	for i := 0; i < beta; i++ {
+		keygen.uniformSamplerQ.Read(a.Value[i].Q)
+		keygen.uniformSamplerP.Read(a.Value[i].P)
+		ringQP.MFormLvl(levelQ, levelP, a.Value[i], a.Value[i])
+	}
+
+	// swk = -s'a + Ps + e
+	keygen.GenSwitchingKey(skOld, swk.Value[0])
+	for i := 0; i < beta; i++ {
+		ringQP.MulCoeffsMontgomeryAndSubLvl(levelQ, levelP, a.Value[i], skNew.Value, swk.Value[0].Value[i])
+	}
+
+	return swk
+}
+
+// GenEvaluationKeyBundle generates the public, relinearization, conjugation and rotation keys of given rot idxs
+// of the owner of sk and returns them in a single EvaluationKeyBundle.
+func (keygen *KeyGenerator) GenEvaluationKeyBundle(sk *SecretKey, rotidxs []int) (bundle *EvaluationKeyBundle) {
+	bundle = NewEvaluationKeyBundle(keygen.params, sk.ID)
+
+	r := keygen.GenSecretKey(sk.ID)
+
+	bundle.PublicKey = keygen.GenPublicKey(sk)
+	bundle.RelinearizationKey = keygen.GenRelinearizationKey(sk, r)
+	bundle.ConjugationKey = keygen.GenConjugationKey(sk)
+
+	for _, rotidx := range rotidxs {
+		bundle.AddRotationKey(keygen.GenRotationKey(rotidx, sk))
+	}
+
+	return bundle
+}
+
 //For an input secretkey s, gen gs + e in MForm
 func (keygen *KeyGenerator) GenSwitchingKey(skIn *SecretKey, swk *SwitchingKey) {
 	params := keygen.params
@@ -1,6 +1,11 @@
 package mkrlwe
 
-import "github.com/ldsec/lattigo/v2/rlwe"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ldsec/lattigo/v2/rlwe"
+)
 
 // SecretKeySet is a type for generic Multikey RLWE secret keys.
 type SecretKey struct {
@@ -49,16 +54,24 @@ type ConjugationKey struct {
 	ID    string
 }
 
+// PartySwitchingKey is a type for the key switching the component of a party from its old to its new secret key.
+// It consists of two polynomial vectors, the second one being uniformly random.
+type PartySwitchingKey struct {
+	Value [2]*SwitchingKey
+	ID    string
+}
+
 // RelinearizationKeySet is a type for a set of multikey RLWE relinearization keys.
 type RelinearizationKeySet struct {
-	params    Parameters
-	Value     map[string]*RelinearizationKey
-	HoistPool [2]*HoistedCiphertext
+	params Parameters
+	Value  map[string]*RelinearizationKey
 }
 
 //RotationKeysSet is a type for a set of multikey RLWE rotation keys.
 type RotationKeySet struct {
 	Value map[string]map[uint]*RotationKey
+	store *RotationKeyStore
+	mu    sync.Mutex // guards the keys loaded from the store
 }
 
 // ConjugationKeySet is a type for a set of multikey RLWE relinearization keys.
@@ -131,6 +144,13 @@ func NewRotationKeySet() *RotationKeySet {
 
 // AddRotationKeys insert new rotation keys into RotationKeysSet with its id
 func (rkSet *RotationKeySet) AddRotationKey(rk *RotationKey) {
+	rkSet.mu.Lock()
+	defer rkSet.mu.Unlock()
+	rkSet.addRotationKey(rk)
+}
+
+// addRotationKey inserts rk into the set, whose mutex should be held by the caller
+func (rkSet *RotationKeySet) addRotationKey(rk *RotationKey) {
 
 	_, ok := rkSet.Value[rk.ID]
 
@@ -144,31 +164,61 @@ func (rkSet *RotationKeySet) AddRotationKey(rk *RotationKey) {
 
 // DelRotationKeys delete rotation keys of given id from RotationKeysSet
 func (rkSet *RotationKeySet) DelRotationKey(id string, rotidx uint) {
+	rkSet.mu.Lock()
+	defer rkSet.mu.Unlock()
 	delete(rkSet.Value[id], rotidx)
 }
 
-// GetRotationKeys returns a rotation keys of given id from RotationKeysSet
-func (rkSet *RotationKeySet) GetRotationKey(id string, rotidx uint) *RotationKey {
-	_, in := rkSet.Value[id]
-	if !in {
-		panic("cannot GetRotationKeys: there is no rotation key with given id")
+// DelRotationKeys delete all the rotation keys of given id from RotationKeysSet
+// The keys of a set backed by a RotationKeyStore are loaded again from the store if it still holds them.
+func (rkSet *RotationKeySet) DelRotationKeys(id string) {
+	rkSet.mu.Lock()
+	defer rkSet.mu.Unlock()
+	delete(rkSet.Value, id)
+}
+
+// LoadRotationKey returns the rotation key of given id and index from RotationKeysSet.
+// If the set is backed by a RotationKeyStore, a missing rotation key is loaded from the store and kept in the set,
+// so that evaluators can load the keys they need before a computation.
+// Returns an error if there is no such key or if it cannot be loaded from the store.
+// It can be called concurrently.
+func (rkSet *RotationKeySet) LoadRotationKey(id string, rotidx uint) (rtk *RotationKey, err error) {
+	rkSet.mu.Lock()
+	defer rkSet.mu.Unlock()
+
+	if rtk, in := rkSet.Value[id][rotidx]; in {
+		return rtk, nil
 	}
 
-	_, in = rkSet.Value[id][rotidx]
-	if !in {
-		panic("cannot GetRotationKeys: there is no rotation key with given id")
+	if rkSet.store == nil || !rkSet.store.Has(id, rotidx) {
+		return nil, fmt.Errorf("cannot LoadRotationKey: there is no rotation key %d of %s", rotidx, id)
+	}
+
+	if rtk, err = rkSet.store.Load(id, rotidx); err != nil {
+		return nil, fmt.Errorf("cannot LoadRotationKey: %w", err)
+	}
+
+	rkSet.addRotationKey(rtk)
+
+	return rtk, nil
+}
+
+// GetRotationKeys returns a rotation keys of given id from RotationKeysSet
+// If the set is backed by a RotationKeyStore, a missing rotation key is loaded from the store.
+// The procedure will panic if the key is missing or cannot be loaded, see LoadRotationKey.
+// It can be called concurrently.
+func (rkSet *RotationKeySet) GetRotationKey(id string, rotidx uint) *RotationKey {
+	rtk, err := rkSet.LoadRotationKey(id, rotidx)
+	if err != nil {
+		panic(err)
 	}
-	return rkSet.Value[id][rotidx]
+	return rtk
 }
 
 // NewRelinearizationKeySet returns a new empty RelinearizationKeySet
 func NewRelinearizationKeyKeySet(params Parameters) *RelinearizationKeySet {
 	rlkSet := new(RelinearizationKeySet)
 	rlkSet.Value = make(map[string]*RelinearizationKey)
-
-	rlkSet.HoistPool[0] = NewHoistedCiphertext()
-	rlkSet.HoistPool[1] = NewHoistedCiphertext()
-
 	rlkSet.params = params
 
 	return rlkSet
@@ -177,8 +227,6 @@ func NewRelinearizationKeyKeySet(params Parameters) *RelinearizationKeySet {
 // AddRelinearizationKey insert new publickey into RelinearizationKeySet with its id
 func (rlkSet *RelinearizationKeySet) AddRelinearizationKey(rlk *RelinearizationKey) {
 	rlkSet.Value[rlk.ID] = rlk
-	rlkSet.HoistPool[0].Value[rlk.ID] = NewSwitchingKey(rlkSet.params)
-	rlkSet.HoistPool[1].Value[rlk.ID] = NewSwitchingKey(rlkSet.params)
 }
 
 // DelRelinearizationKey delete publickey of given id from SecretKeySet
@@ -283,6 +331,16 @@ func NewConjugationKey(params Parameters, id string) *ConjugationKey {
 	return cjk
 }
 
+// NewPartySwitchingKey returns a new PartySwitchingKey with zero values.
+func NewPartySwitchingKey(params Parameters, id string) *PartySwitchingKey {
+	swk := new(PartySwitchingKey)
+	swk.Value[0] = NewSwitchingKey(params)
+	swk.Value[1] = NewSwitchingKey(params)
+	swk.ID = id
+
+	return swk
+}
+
 // CopyNew creates a deep copy of the receiver secret key and returns it.
 func (sk *SecretKey) CopyNew() *SecretKey {
 	if sk == nil {
@@ -0,0 +1,131 @@
+package mkrlwe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// RotationKeyStore is an index of a RotationKeySet written by WriteTo or MarshalBinary,
+// for instance in a file, which loads its rotation keys one at a time when they are requested.
+// The checksum of the whole set is verified when the store is opened and every rotation key
+// is checked against the digest recorded at that time when it is loaded.
+type RotationKeyStore struct {
+	src   io.ReaderAt
+	index map[string]map[uint]rotationKeyLocation
+}
+
+// rotationKeyLocation is the position and the digest of the encoding of a rotation key in the source of a store.
+type rotationKeyLocation struct {
+	offset int64
+	length int
+	digest [sha256.Size]byte
+}
+
+// NewRotationKeyStore reads the size bytes of src holding a RotationKeySet and returns a RotationKeyStore
+// indexing its rotation keys. src must not be modified while the store is in use.
+func NewRotationKeyStore(src io.ReaderAt, size int64) (store *RotationKeyStore, err error) {
+
+	store = new(RotationKeyStore)
+	store.src = src
+	store.index = make(map[string]map[uint]rotationKeyLocation)
+
+	var hdr EnvelopeHeader
+	var n int64
+
+	// the checksum is verified in a first pass over src, so that the set is indexed without buffering it
+	if hdr, n, err = readEnvelope(io.NewSectionReader(src, 0, size), KindRotationKeySet, func(payload io.Reader) (err error) {
+		_, err = io.Copy(io.Discard, payload)
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	if n != size {
+		return nil, &DecodingError{Kind: KindRotationKeySet, Err: ErrMalformed, Msg: "remaining unparsed data"}
+	}
+
+	payload := &io.LimitedReader{R: io.NewSectionReader(src, EnvelopeHeaderSize, int64(hdr.PayloadLen)), N: int64(hdr.PayloadLen)}
+
+	err = scanRotationKeySet(payload, func(ID string, idx uint64, offset int64, data []byte) error {
+
+		rtkID, pointer, err := decodeID(data)
+		if err != nil {
+			return err
+		}
+
+		if rtkID != ID || binary.BigEndian.Uint64(data[pointer:]) != idx {
+			return errMalformed("rotation key stored under %s/%d does not match its index", ID, idx)
+		}
+
+		if _, in := store.index[ID]; !in {
+			store.index[ID] = make(map[uint]rotationKeyLocation)
+		}
+
+		store.index[ID][uint(idx)] = rotationKeyLocation{
+			offset: EnvelopeHeaderSize + offset,
+			length: len(data),
+			digest: sha256.Sum256(data),
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, asDecodingError(KindRotationKeySet, err)
+	}
+
+	return store, nil
+}
+
+// Has returns true if the store holds the rotation key of given id and index.
+func (store *RotationKeyStore) Has(id string, rotidx uint) bool {
+	_, in := store.index[id][rotidx]
+	return in
+}
+
+// RotIdxs returns the sorted rotation indexes of the rotation keys of given id held by the store.
+func (store *RotationKeyStore) RotIdxs(id string) (rotidxs []uint) {
+	for rotidx := range store.index[id] {
+		rotidxs = append(rotidxs, rotidx)
+	}
+	sort.Slice(rotidxs, func(i, j int) bool { return rotidxs[i] < rotidxs[j] })
+	return
+}
+
+// Load reads the rotation key of given id and index from the source of the store.
+func (store *RotationKeyStore) Load(id string, rotidx uint) (rtk *RotationKey, err error) {
+
+	loc, in := store.index[id][rotidx]
+	if !in {
+		return nil, fmt.Errorf("cannot Load: there is no rotation key %d of %s in the store", rotidx, id)
+	}
+
+	data := make([]byte, loc.length)
+	if _, err = store.src.ReadAt(data, loc.offset); err != nil {
+		return nil, fmt.Errorf("cannot Load: %w", err)
+	}
+
+	if digest := sha256.Sum256(data); !bytes.Equal(digest[:], loc.digest[:]) {
+		return nil, &DecodingError{Kind: KindRotationKeySet, Err: ErrChecksum, Msg: fmt.Sprintf("rotation key %d of %s", rotidx, id)}
+	}
+
+	rtk = new(RotationKey)
+	if _, err = rtk.decode(data); err != nil {
+		return nil, err
+	}
+
+	return rtk, nil
+}
+
+// RotationKeySet returns an empty RotationKeySet backed by the store: the rotation keys are loaded
+// from the store the first time they are requested with GetRotationKey and then kept in the set.
+// They can be released with DelRotationKey to bound the memory used, and are loaded again if needed.
+func (store *RotationKeyStore) RotationKeySet() *RotationKeySet {
+	rtkSet := NewRotationKeySet()
+	rtkSet.store = store
+	return rtkSet
+}
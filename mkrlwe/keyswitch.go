@@ -5,14 +5,17 @@ import "github.com/ldsec/lattigo/v2/ring"
 import "math/bits"
 
 // KeySwitcher is a struct for RLWE key-switching.
+// The per-ID loops of the key-switchings can be spread over several goroutines with SetWorkers.
 type KeySwitcher struct {
 	rlwe.KeySwitcher
 	Parameters
 	Decomposer *Decomposer
 	polyQPool  [3]*ring.Poly
+	accPool    *ring.Poly
 	swkPool1   *SwitchingKey
 	swkPool2   *SwitchingKey
 	swkPool3   *SwitchingKey
+	workers    []*KeySwitcher
 }
 
 // DecomposeSingleNTT takes the input polynomial c2 (c2NTT and c2InvNTT, respectively in the NTT and out of the NTT domain)
@@ -35,13 +38,7 @@ func NewKeySwitcher(params Parameters) *KeySwitcher {
 	ks.KeySwitcher = *rlwe.NewKeySwitcher(params.Parameters)
 	ks.Parameters = params
 	ks.Decomposer = NewDecomposer(params.RingQ(), params.RingP(), params.Gamma())
-
-	ringQ := params.RingQ()
-	ks.polyQPool = [3]*ring.Poly{ringQ.NewPoly(), ringQ.NewPoly(), ringQ.NewPoly()}
-
-	ks.swkPool1 = NewSwitchingKey(params)
-	ks.swkPool2 = NewSwitchingKey(params)
-	ks.swkPool3 = NewSwitchingKey(params)
+	ks.allocatePools()
 
 	return ks
 }
@@ -118,215 +115,102 @@ func (ks *KeySwitcher) ExternalProduct(levelQ int, a *ring.Poly, bg *SwitchingKe
 }
 
 // MulRelin multiplies op0 with op1 with relinearization and returns the result in ctOut.
+// The operation is done at the minimum level of op0, op1 and ctOut, to which ctOut is dropped.
 // Input ciphertext should be in NTT form
 func (ks *KeySwitcher) MulAndRelin(op0, op1 *Ciphertext, rlkSet *RelinearizationKeySet, ctOut *Ciphertext) {
-
-	level := ctOut.Level()
-
-	if op0.Level() < level {
-		panic("Cannot MulAndRelin: op0 and op1 have different levels")
-	}
-
-	if ctOut.Level() < level {
-		panic("Cannot MulAndRelin: op0 and ctOut have different levels")
-	}
-
-	idset0 := op0.IDSet()
-	idset1 := op1.IDSet()
-
-	params := ks.Parameters
-	ringQP := params.RingQP()
-	ringQ := params.RingQ()
-
-	levelP := params.PCount() - 1
-	beta := params.Beta(level)
-
-	x := ks.swkPool1
-	y := ks.swkPool2
-
-	//initialize x1, x2, y1, y2
-	for i := 0; i < beta; i++ {
-		x.Value[i].Q.Zero()
-		x.Value[i].P.Zero()
-
-		y.Value[i].Q.Zero()
-		y.Value[i].P.Zero()
-	}
-
-	//gen x vector
-	for id := range idset0.Value {
-		ks.Decompose(level, op0.Value[id], ks.swkPool3)
-		d := rlkSet.Value[id].Value[1]
-		for i := 0; i < beta; i++ {
-			ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, d.Value[i], ks.swkPool3.Value[i], x.Value[i])
-		}
-	}
-
-	for i := 0; i < beta; i++ {
-		ringQP.MFormLvl(level, levelP, x.Value[i], x.Value[i])
-	}
-
-	//gen y vector
-	for id := range idset1.Value {
-		ks.Decompose(level, op1.Value[id], ks.swkPool3)
-		b := rlkSet.Value[id].Value[0]
-		for i := 0; i < beta; i++ {
-			ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, b.Value[i], ks.swkPool3.Value[i], y.Value[i])
-		}
-	}
-
-	for i := 0; i < beta; i++ {
-		ringQP.MFormLvl(level, levelP, y.Value[i], y.Value[i])
-	}
-
-	//ctOut_0 <- op0_0 * op1_0
-	ringQ.NTTLvl(level, op0.Value["0"], ks.polyQPool[0])
-	ringQ.NTTLvl(level, op1.Value["0"], ks.polyQPool[1])
-
-	ringQ.MFormLvl(level, ks.polyQPool[0], ks.polyQPool[0])
-	ringQ.MulCoeffsMontgomeryLvl(level, ks.polyQPool[0], ks.polyQPool[1], ctOut.Value["0"])
-
-	//ctOut_j <- op0_0 * op1_j + op0_j * op1_0
-	ringQ.MFormLvl(level, ks.polyQPool[1], ks.polyQPool[1])
-	for id := range idset0.Value {
-		ringQ.NTTLvl(level, op0.Value[id], ks.polyQPool[2])
-		ringQ.MulCoeffsMontgomeryLvl(level, ks.polyQPool[1], ks.polyQPool[2], ctOut.Value[id])
-	}
-
-	for id := range idset1.Value {
-		ringQ.NTTLvl(level, op1.Value[id], ks.polyQPool[2])
-		if idset0.Has(id) {
-			ringQ.MulCoeffsMontgomeryAndAddLvl(level, ks.polyQPool[0], ks.polyQPool[2], ctOut.Value[id])
-		} else {
-			ringQ.MulCoeffsMontgomeryLvl(level, ks.polyQPool[0], ks.polyQPool[2], ctOut.Value[id])
-		}
-	}
-
-	for id := range ctOut.Value {
-		ringQ.InvNTTLvl(level, ctOut.Value[id], ctOut.Value[id])
-	}
-
-	//ctOut_j <- ctOut_j +  Inter(op1_j, x)
-	for id := range idset1.Value {
-		ks.ExternalProduct(level, op1.Value[id], x, ks.polyQPool[0])
-		ringQ.AddLvl(level, ctOut.Value[id], ks.polyQPool[0], ctOut.Value[id])
-	}
-
-	//ctOut_0 <- ctOut_0 + Inter(Inter(op0_i, y), v_i)
-	//ctOut_i <- ctOut_i + Inter(Inter(op0_i, y), u)
-
-	u := params.CRS[-1]
-
-	for id := range idset0.Value {
-		v := rlkSet.Value[id].Value[2]
-		ks.ExternalProduct(level, op0.Value[id], y, ks.polyQPool[0])
-
-		ks.ExternalProduct(level, ks.polyQPool[0], v, ks.polyQPool[1])
-		ringQ.AddLvl(level, ctOut.Value["0"], ks.polyQPool[1], ctOut.Value["0"])
-
-		ks.ExternalProduct(level, ks.polyQPool[0], u, ks.polyQPool[2])
-		ringQ.AddLvl(level, ctOut.Value[id], ks.polyQPool[2], ctOut.Value[id])
-	}
+	ks.MulAndRelinHoisted(op0, op1, nil, nil, rlkSet, ctOut)
 }
 
 // Rotate rotates ctIn with ctOut with RotationKeySet and returns the result in ctOut.
+// The operation is done at the minimum level of ctIn and ctOut, to which ctOut is dropped.
 // Input ciphertext should be in InvNTT form
 func (ks *KeySwitcher) Rotate(ctIn *Ciphertext, rotidx int, rkSet *RotationKeySet, ctOut *Ciphertext) {
+	ks.RotateHoisted(ctIn, rotidx, nil, rkSet, ctOut)
+}
 
-	level := ctOut.Level()
-	idset := ctIn.IDSet()
+// Conjugate conjugate ctIn with ctOut with ConjugationKeySet and returns the result in ctOut.
+// The operation is done at the minimum level of ctIn and ctOut, to which ctOut is dropped.
+// Input ciphertext should be in NTT form
+func (ks *KeySwitcher) Conjugate(ctIn *Ciphertext, ckSet *ConjugationKeySet, ctOut *Ciphertext) {
+	level := AlignLevels(ctOut, ctIn)
+	ids := sortedIDs(ctIn.IDSet())
 	params := ks.Parameters
 	ringQ := params.RingQ()
+	galEl := params.GaloisElementForRowRotation()
 
-	// check ctIn level
-	if ctIn.Level() < level {
-		panic("Cannot Rotate: ctIn and ctOut have different levels")
-	}
-
-	// adjust rotidx
-	for rotidx < 0 {
-		rotidx += (params.N() / 2)
-	}
+	// permute ctIn and put it to ctOut
+	ks.forEach(append([]string{"0"}, ids...), func(w *KeySwitcher, id string) {
+		w.permuteLvl(level, ctIn.Value[id], galEl, w.polyQPool[0])
+		ctOut.Value[id].Copy(w.polyQPool[0])
+	})
 
 	// c0 <- c0 + IP(c_i, rk_i)
-
 	// c_i <- IP(c_i, a)
-	a := params.CRS[rotidx]
-
-	ctOut.Value["0"].Copy(ctIn.Value["0"])
-
-	for id := range idset.Value {
-		rk := rkSet.GetRotationKey(id, uint(rotidx))
-		ks.ExternalProduct(level, ctIn.Value[id], rk.Value, ks.polyQPool[0])
-		ringQ.AddLvl(level, ctOut.Value["0"], ks.polyQPool[0], ctOut.Value["0"])
-
-		ks.ExternalProduct(level, ctIn.Value[id], a, ctOut.Value[id])
-	}
-
-	// permute ctOut
-	galEl := params.GaloisElementForColumnRotationBy(rotidx)
-	for id := range ctIn.Value {
-
-		var mask, index, indexRaw, logN, tmp uint64
+	a := params.CRS[-2]
+	ks.accumulatePoly(level, ids, ctOut.Value["0"], func(w *KeySwitcher, id string, acc *ring.Poly) {
+		ck := ckSet.GetConjugationKey(id)
+		w.ExternalProduct(level, ctOut.Value[id], ck.Value, w.polyQPool[0])
+		ringQ.AddLvl(level, acc, w.polyQPool[0], acc)
 
-		mask = uint64(ringQ.N - 1)
+		w.ExternalProduct(level, ctOut.Value[id], a, w.polyQPool[0])
+		ctOut.Value[id].Copy(w.polyQPool[0])
+	})
+}
 
-		logN = uint64(bits.Len64(mask))
+// SwitchPartyKey switches the component of the party of swk in ctIn from its old to its new secret key
+// and returns the result in ctOut, the other components being copied.
+// The operation is done at the minimum level of ctIn and ctOut, to which ctOut is dropped.
+func (ks *KeySwitcher) SwitchPartyKey(ctIn *Ciphertext, swk *PartySwitchingKey, ctOut *Ciphertext) {
+	level := AlignLevels(ctOut, ctIn)
+	ringQ := ks.Parameters.RingQ()
+	id := swk.ID
 
-		for i := uint64(0); i < uint64(ringQ.N); i++ {
+	c := ctIn.Value[id]
 
-			indexRaw = i * galEl
+	// c0 <- c0 + IP(c_i, swk_0)
+	// c_i <- IP(c_i, swk_1)
+	ks.Decompose(level, c, ks.swkPool1)
+	ks.ExternalProductHoisted(level, ks.swkPool1, swk.Value[0], ks.polyQPool[0])
+	ks.ExternalProductHoisted(level, ks.swkPool1, swk.Value[1], ks.polyQPool[1])
 
-			index = indexRaw & mask
+	if c.IsNTT {
+		ringQ.NTTLvl(level, ks.polyQPool[0], ks.polyQPool[0])
+		ringQ.NTTLvl(level, ks.polyQPool[1], ks.polyQPool[1])
+	}
 
-			tmp = (indexRaw >> logN) & 1
+	for cid := range ctIn.Value {
+		if cid != id && cid != "0" {
+			ring.CopyValuesLvl(level, ctIn.Value[cid], ctOut.Value[cid])
+		}
+	}
 
-			for j, qi := range ringQ.Modulus {
+	ringQ.AddLvl(level, ctIn.Value["0"], ks.polyQPool[0], ctOut.Value["0"])
+	ring.CopyValuesLvl(level, ks.polyQPool[1], ctOut.Value[id])
+}
 
-				if j > level {
-					break
-				}
+// permuteLvl applies the automorphism X -> X^galEl on the first level+1 moduli of polIn and writes the result on polOut.
+// polIn and polOut must be distinct.
+func (ks *KeySwitcher) permuteLvl(level int, polIn *ring.Poly, galEl uint64, polOut *ring.Poly) {
 
-				ks.polyQPool[0].Coeffs[j][index] = ctOut.Value[id].Coeffs[j][i]*(tmp^1) | (qi-ctOut.Value[id].Coeffs[j][i])*tmp
-			}
-		}
+	ringQ := ks.Parameters.RingQ()
 
-		ctOut.Value[id].Copy(ks.polyQPool[0])
+	var mask, index, indexRaw, logN, tmp uint64
 
-	}
+	mask = uint64(ringQ.N - 1)
 
-}
+	logN = uint64(bits.Len64(mask))
 
-// Conjugate conjugate ctIn with ctOut with ConjugationKeySet and returns the result in ctOut.
-// Input ciphertext should be in NTT form
-func (ks *KeySwitcher) Conjugate(ctIn *Ciphertext, ckSet *ConjugationKeySet, ctOut *Ciphertext) {
-	level := ctOut.Level()
-	idset := ctIn.IDSet()
-	params := ks.Parameters
-	ringQ := params.RingQ()
-	galEl := params.GaloisElementForRowRotation()
+	for i := uint64(0); i < uint64(ringQ.N); i++ {
 
-	// check ctIn level
-	if ctIn.Level() < level {
-		panic("Cannot Conjugate: ctIn and ctOut have different levels")
-	}
+		indexRaw = i * galEl
 
-	// permute ctIn and put it to ctOut
-	for id := range ctIn.Value {
-		ringQ.Permute(ctIn.Value[id], galEl, ctOut.Value[id])
-	}
+		index = indexRaw & mask
 
-	// c0 <- c0 + IP(c_i, rk_i)
-	for id := range idset.Value {
-		ck := ckSet.GetConjugationKey(id)
-		ks.ExternalProduct(level, ctOut.Value[id], ck.Value, ks.polyQPool[0])
-		ringQ.AddLvl(level, ctOut.Value["0"], ks.polyQPool[0], ctOut.Value["0"])
-	}
+		tmp = (indexRaw >> logN) & 1
 
-	// c_i <- IP(c_i, a)
-	a := params.CRS[-2]
-	for id := range idset.Value {
-		ks.ExternalProduct(level, ctOut.Value[id], a, ks.polyQPool[0])
-		ctOut.Value[id].Copy(ks.polyQPool[0])
+		for j := 0; j < level+1; j++ {
+			qi := ringQ.Modulus[j]
+			polOut.Coeffs[j][index] = polIn.Coeffs[j][i]*(tmp^1) | (qi-polIn.Coeffs[j][i])*tmp
+		}
 	}
 }
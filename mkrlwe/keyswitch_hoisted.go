@@ -1,7 +1,6 @@
 package mkrlwe
 
 import "github.com/ldsec/lattigo/v2/ring"
-import "math/bits"
 
 // ExternalProduct applies internal product of input poly a & bg
 // the expected result is ab
@@ -40,21 +39,18 @@ func (ks *KeySwitcher) ExternalProductHoisted(levelQ int, aHoisted, bg *Switchin
 }
 
 // MulRelin multiplies op0 with op1 with relinearization and returns the result in ctOut.
+// The operation is done at the minimum level of op0, op1 and ctOut, to which ctOut is dropped,
+// and the hoisted ciphertexts should have been decomposed at this level.
+// A nil hoisted ciphertext is decomposed on the fly.
 // Input ciphertext should be in NTT form
 func (ks *KeySwitcher) MulAndRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1Hoisted *HoistedCiphertext, rlkSet *RelinearizationKeySet, ctOut *Ciphertext) {
 
-	level := ctOut.Level()
-
-	if op0.Level() < level {
-		panic("Cannot MulAndRelin: op0 and op1 have different levels")
-	}
-
-	if ctOut.Level() < level {
-		panic("Cannot MulAndRelin: op0 and ctOut have different levels")
-	}
+	level := AlignLevels(ctOut, op0, op1)
 
 	idset0 := op0.IDSet()
 	idset1 := op1.IDSet()
+	ids0 := sortedIDs(idset0)
+	ids1 := sortedIDs(idset1)
 
 	params := ks.Parameters
 	ringQP := params.RingQP()
@@ -66,51 +62,36 @@ func (ks *KeySwitcher) MulAndRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1H
 	x := ks.swkPool1
 	y := ks.swkPool2
 
-	//initialize x1, x2, y1, y2
-	for i := 0; i < beta; i++ {
-		x.Value[i].Q.Zero()
-		x.Value[i].P.Zero()
-
-		y.Value[i].Q.Zero()
-		y.Value[i].P.Zero()
+	// decomposed returns the decomposition of op.Value[id], computing it in the pool of w if opHoisted is nil
+	decomposed := func(w *KeySwitcher, op *Ciphertext, opHoisted *HoistedCiphertext, id string) *SwitchingKey {
+		if opHoisted == nil {
+			w.Decompose(level, op.Value[id], w.swkPool3)
+			return w.swkPool3
+		}
+		return opHoisted.Value[id]
 	}
 
 	//gen x vector
-	for id := range idset0.Value {
-		if op0Hoisted == nil {
-			ks.Decompose(level, op0.Value[id], ks.swkPool3)
-			d := rlkSet.Value[id].Value[1]
-			for i := 0; i < beta; i++ {
-				ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, d.Value[i], ks.swkPool3.Value[i], x.Value[i])
-			}
-		} else {
-			d := rlkSet.Value[id].Value[1]
-			for i := 0; i < beta; i++ {
-				ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, d.Value[i], op0Hoisted.Value[id].Value[i], x.Value[i])
-			}
+	ks.accumulateSwk(level, ids0, x, func(w *KeySwitcher, id string, acc *SwitchingKey) {
+		ad := decomposed(w, op0, op0Hoisted, id)
+		d := rlkSet.Value[id].Value[1]
+		for i := 0; i < beta; i++ {
+			ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, d.Value[i], ad.Value[i], acc.Value[i])
 		}
-	}
+	})
 
 	for i := 0; i < beta; i++ {
 		ringQP.MFormLvl(level, levelP, x.Value[i], x.Value[i])
 	}
 
 	//gen y vector
-	for id := range idset1.Value {
-		if op1Hoisted == nil {
-			ks.Decompose(level, op1.Value[id], ks.swkPool3)
-			b := rlkSet.Value[id].Value[0]
-			for i := 0; i < beta; i++ {
-				ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, b.Value[i], ks.swkPool3.Value[i], y.Value[i])
-			}
-		} else {
-			b := rlkSet.Value[id].Value[0]
-			for i := 0; i < beta; i++ {
-				ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, b.Value[i], op1Hoisted.Value[id].Value[i], y.Value[i])
-			}
+	ks.accumulateSwk(level, ids1, y, func(w *KeySwitcher, id string, acc *SwitchingKey) {
+		ad := decomposed(w, op1, op1Hoisted, id)
+		b := rlkSet.Value[id].Value[0]
+		for i := 0; i < beta; i++ {
+			ringQP.MulCoeffsMontgomeryAndAddLvl(level, levelP, b.Value[i], ad.Value[i], acc.Value[i])
 		}
-
-	}
+	})
 
 	for i := 0; i < beta; i++ {
 		ringQP.MFormLvl(level, levelP, y.Value[i], y.Value[i])
@@ -144,54 +125,52 @@ func (ks *KeySwitcher) MulAndRelinHoisted(op0, op1 *Ciphertext, op0Hoisted, op1H
 	}
 
 	//ctOut_j <- ctOut_j +  Ext(op1_j, x)
-	for id := range idset1.Value {
+	ks.forEach(ids1, func(w *KeySwitcher, id string) {
 		if op1Hoisted == nil {
-			ks.ExternalProduct(level, op1.Value[id], x, ks.polyQPool[0])
+			w.ExternalProduct(level, op1.Value[id], x, w.polyQPool[0])
 		} else {
-			ks.ExternalProductHoisted(level, op1Hoisted.Value[id], x, ks.polyQPool[0])
+			w.ExternalProductHoisted(level, op1Hoisted.Value[id], x, w.polyQPool[0])
 		}
-		ringQ.AddLvl(level, ctOut.Value[id], ks.polyQPool[0], ctOut.Value[id])
-	}
+		ringQ.AddLvl(level, ctOut.Value[id], w.polyQPool[0], ctOut.Value[id])
+	})
 
 	//ctOut_0 <- ctOut_0 + Ext(Ext(op0_i, y), v_i)
 	//ctOut_i <- ctOut_i + Ext(Ext(op0_i, y), u)
 
 	u := params.CRS[-1]
 
-	for id := range idset0.Value {
+	ks.accumulatePoly(level, ids0, ctOut.Value["0"], func(w *KeySwitcher, id string, acc *ring.Poly) {
 
 		v := rlkSet.Value[id].Value[2]
 
 		if op0Hoisted == nil {
-			ks.ExternalProduct(level, op0.Value[id], y, ks.polyQPool[0])
+			w.ExternalProduct(level, op0.Value[id], y, w.polyQPool[0])
 		} else {
-			ks.ExternalProductHoisted(level, op0Hoisted.Value[id], y, ks.polyQPool[0])
+			w.ExternalProductHoisted(level, op0Hoisted.Value[id], y, w.polyQPool[0])
 		}
 
-		ks.Decompose(level, ks.polyQPool[0], ks.swkPool3)
+		w.Decompose(level, w.polyQPool[0], w.swkPool3)
 
-		ks.ExternalProductHoisted(level, ks.swkPool3, v, ks.polyQPool[1])
-		ringQ.AddLvl(level, ctOut.Value["0"], ks.polyQPool[1], ctOut.Value["0"])
+		w.ExternalProductHoisted(level, w.swkPool3, v, w.polyQPool[1])
+		ringQ.AddLvl(level, acc, w.polyQPool[1], acc)
 
-		ks.ExternalProductHoisted(level, ks.swkPool3, u, ks.polyQPool[2])
-		ringQ.AddLvl(level, ctOut.Value[id], ks.polyQPool[2], ctOut.Value[id])
-	}
+		w.ExternalProductHoisted(level, w.swkPool3, u, w.polyQPool[2])
+		ringQ.AddLvl(level, ctOut.Value[id], w.polyQPool[2], ctOut.Value[id])
+	})
 }
 
 // Rotate rotates ctIn with ctOut with RotationKeySet and returns the result in ctOut.
+// The operation is done at the minimum level of ctIn and ctOut, to which ctOut is dropped,
+// and the hoisted ciphertext should have been decomposed at this level.
+// A nil hoisted ciphertext is decomposed on the fly.
 // Input ciphertext should be in InvNTT form
 func (ks *KeySwitcher) RotateHoisted(ctIn *Ciphertext, rotidx int, ctInHoisted *HoistedCiphertext, rkSet *RotationKeySet, ctOut *Ciphertext) {
 
-	level := ctOut.Level()
-	idset := ctIn.IDSet()
+	level := AlignLevels(ctOut, ctIn)
+	ids := sortedIDs(ctIn.IDSet())
 	params := ks.Parameters
 	ringQ := params.RingQ()
 
-	// check ctIn level
-	if ctIn.Level() < level {
-		panic("Cannot Rotate: ctIn and ctOut have different levels")
-	}
-
 	// adjust rotidx
 	for rotidx < 0 {
 		rotidx += (params.N() / 2)
@@ -204,44 +183,24 @@ func (ks *KeySwitcher) RotateHoisted(ctIn *Ciphertext, rotidx int, ctInHoisted *
 
 	ctOut.Value["0"].Copy(ctIn.Value["0"])
 
-	for id := range idset.Value {
+	ks.accumulatePoly(level, ids, ctOut.Value["0"], func(w *KeySwitcher, id string, acc *ring.Poly) {
 		rk := rkSet.GetRotationKey(id, uint(rotidx))
-		ks.ExternalProductHoisted(level, ctInHoisted.Value[id], rk.Value, ks.polyQPool[0])
-		ringQ.AddLvl(level, ctOut.Value["0"], ks.polyQPool[0], ctOut.Value["0"])
-
-		ks.ExternalProductHoisted(level, ctInHoisted.Value[id], a, ctOut.Value[id])
-	}
+		if ctInHoisted == nil {
+			w.ExternalProduct(level, ctIn.Value[id], rk.Value, w.polyQPool[0])
+			ringQ.AddLvl(level, acc, w.polyQPool[0], acc)
+			w.ExternalProduct(level, ctIn.Value[id], a, w.polyQPool[0])
+		} else {
+			w.ExternalProductHoisted(level, ctInHoisted.Value[id], rk.Value, w.polyQPool[0])
+			ringQ.AddLvl(level, acc, w.polyQPool[0], acc)
+			w.ExternalProductHoisted(level, ctInHoisted.Value[id], a, w.polyQPool[0])
+		}
+		ctOut.Value[id].Copy(w.polyQPool[0])
+	})
 
 	// permute ctOut
 	galEl := params.GaloisElementForColumnRotationBy(rotidx)
-	for id := range ctIn.Value {
-
-		var mask, index, indexRaw, logN, tmp uint64
-
-		mask = uint64(ringQ.N - 1)
-
-		logN = uint64(bits.Len64(mask))
-
-		for i := uint64(0); i < uint64(ringQ.N); i++ {
-
-			indexRaw = i * galEl
-
-			index = indexRaw & mask
-
-			tmp = (indexRaw >> logN) & 1
-
-			for j, qi := range ringQ.Modulus {
-
-				if j > level {
-					break
-				}
-
-				ks.polyQPool[0].Coeffs[j][index] = ctOut.Value[id].Coeffs[j][i]*(tmp^1) | (qi-ctOut.Value[id].Coeffs[j][i])*tmp
-			}
-		}
-
-		ctOut.Value[id].Copy(ks.polyQPool[0])
-
-	}
-
+	ks.forEach(append([]string{"0"}, ids...), func(w *KeySwitcher, id string) {
+		w.permuteLvl(level, ctOut.Value[id], galEl, w.polyQPool[0])
+		ctOut.Value[id].Copy(w.polyQPool[0])
+	})
 }
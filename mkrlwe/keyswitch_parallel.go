@@ -0,0 +1,167 @@
+package mkrlwe
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+// ShallowCopy creates a copy of a KeySwitcher, only reallocating the memory pools and the workers.
+// The copy can be used concurrently with the receiver.
+func (ks *KeySwitcher) ShallowCopy() *KeySwitcher {
+	ksc := &KeySwitcher{
+		KeySwitcher: *ks.KeySwitcher.ShallowCopy(),
+		Parameters:  ks.Parameters,
+		Decomposer:  ks.Decomposer,
+	}
+
+	ksc.allocatePools()
+	ksc.SetWorkers(ks.Workers())
+
+	return ksc
+}
+
+// allocatePools allocates the memory pools of the KeySwitcher
+func (ks *KeySwitcher) allocatePools() {
+	ringQ := ks.Parameters.RingQ()
+	ks.polyQPool = [3]*ring.Poly{ringQ.NewPoly(), ringQ.NewPoly(), ringQ.NewPoly()}
+	ks.accPool = ringQ.NewPoly()
+
+	ks.swkPool1 = NewSwitchingKey(ks.Parameters)
+	ks.swkPool2 = NewSwitchingKey(ks.Parameters)
+	ks.swkPool3 = NewSwitchingKey(ks.Parameters)
+}
+
+// SetWorkers sets the number of goroutines on which the per-ID loops of MulAndRelin, Rotate and Conjugate
+// and of their hoisted versions are spread. Each worker holds its own memory pools.
+// With a single worker, which is the default, the loops run on the calling goroutine.
+func (ks *KeySwitcher) SetWorkers(n int) {
+	ks.workers = nil
+	for i := 0; i < n && n > 1; i++ {
+		w := &KeySwitcher{
+			KeySwitcher: *ks.KeySwitcher.ShallowCopy(),
+			Parameters:  ks.Parameters,
+			Decomposer:  ks.Decomposer,
+		}
+		w.allocatePools()
+		ks.workers = append(ks.workers, w)
+	}
+}
+
+// Workers returns the number of goroutines on which the per-ID loops are spread
+func (ks *KeySwitcher) Workers() int {
+	return max(len(ks.workers), 1)
+}
+
+// run splits ids in contiguous chunks, one per worker, and calls f on each chunk with the worker it is assigned to.
+// f may use the memory pools of its worker. It returns the workers that were used, which is only ks itself
+// when there is a single worker or a single ID, in which case f runs on the calling goroutine.
+func (ks *KeySwitcher) run(ids []string, f func(w *KeySwitcher, ids []string)) (workers []*KeySwitcher) {
+
+	n := min(len(ks.workers), len(ids))
+
+	if n < 2 {
+		f(ks, ids)
+		return []*KeySwitcher{ks}
+	}
+
+	workers = ks.workers[:n]
+
+	var wg sync.WaitGroup
+	for k, w := range workers {
+		chunk := ids[k*len(ids)/n : (k+1)*len(ids)/n]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(w, chunk)
+		}()
+	}
+	wg.Wait()
+
+	return
+}
+
+// forEach calls f on each of ids, spreading them over the workers.
+func (ks *KeySwitcher) forEach(ids []string, f func(w *KeySwitcher, id string)) {
+	ks.run(ids, func(w *KeySwitcher, ids []string) {
+		for _, id := range ids {
+			f(w, id)
+		}
+	})
+}
+
+// accumulatePoly calls f on each of ids, spreading them over the workers, and adds to acc the sum of what f accumulates.
+// Each worker accumulates in its own pool, the pools being added to acc once all the IDs are processed.
+func (ks *KeySwitcher) accumulatePoly(level int, ids []string, acc *ring.Poly, f func(w *KeySwitcher, id string, acc *ring.Poly)) {
+
+	workers := ks.run(ids, func(w *KeySwitcher, ids []string) {
+		wacc := acc
+		if w != ks {
+			wacc = w.accPool
+			wacc.Zero()
+		}
+
+		for _, id := range ids {
+			f(w, id, wacc)
+		}
+	})
+
+	for _, w := range workers {
+		if w != ks {
+			ks.Parameters.RingQ().AddLvl(level, acc, w.accPool, acc)
+		}
+	}
+}
+
+// accumulateSwk calls f on each of ids, spreading them over the workers, and sets acc to the sum of what f accumulates.
+// Each worker accumulates in its own pool, the pools being added to acc once all the IDs are processed.
+func (ks *KeySwitcher) accumulateSwk(level int, ids []string, acc *SwitchingKey, f func(w *KeySwitcher, id string, acc *SwitchingKey)) {
+
+	levelP := ks.Parameters.PCount() - 1
+	beta := ks.Parameters.Beta(level)
+	ringQP := ks.Parameters.RingQP()
+
+	zero := func(swk *SwitchingKey) {
+		for i := 0; i < beta; i++ {
+			swk.Value[i].Q.Zero()
+			swk.Value[i].P.Zero()
+		}
+	}
+
+	zero(acc)
+
+	workers := ks.run(ids, func(w *KeySwitcher, ids []string) {
+		wacc := acc
+		if w != ks {
+			wacc = w.swkPool1
+			zero(wacc)
+		}
+
+		for _, id := range ids {
+			f(w, id, wacc)
+		}
+	})
+
+	for _, w := range workers {
+		if w != ks {
+			for i := 0; i < beta; i++ {
+				ringQP.AddLvl(level, levelP, acc.Value[i], w.swkPool1.Value[i], acc.Value[i])
+			}
+		}
+	}
+}
+
+// DecomposeCiphertext decomposes the components of ct at given level into ctHoisted, spreading the IDs over the workers.
+// ctHoisted should hold a SwitchingKey for each ID of ct.
+func (ks *KeySwitcher) DecomposeCiphertext(level int, ct *Ciphertext, ctHoisted *HoistedCiphertext) {
+	ks.forEach(sortedIDs(ct.IDSet()), func(w *KeySwitcher, id string) {
+		w.Decompose(level, ct.Value[id], ctHoisted.Value[id])
+	})
+}
+
+// sortedIDs returns the IDs of idset in increasing order
+func sortedIDs(idset *IDSet) []string {
+	return slices.Sorted(maps.Keys(idset.Value))
+}
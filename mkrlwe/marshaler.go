@@ -2,85 +2,113 @@ package mkrlwe
 
 import (
 	"encoding/binary"
+	"errors"
+	"maps"
+	"slices"
 
 	"github.com/ldsec/lattigo/v2/ring"
 	"github.com/ldsec/lattigo/v2/rlwe"
 )
 
-// GetDataLen returns the length in bytes of the target SecretKey.
+// Objects which do not carry their parameters are marshaled with an all-zero parameter hash.
+var noParamHash [32]byte
+
+// GetDataLen returns the length in bytes of the payload of the target SecretKey, without its ID.
 func (sk *SecretKey) GetDataLen(WithMetadata bool) (dataLen int) {
 	return sk.Value.GetDataLen(WithMetadata)
 }
 
 // MarshalBinary encodes a secret key in a byte slice.
 func (sk *SecretKey) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindSecretKey, noParamHash, sk.GetDataLen(true)+len(sk.ID), sk.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled SecretKey in the target SecretKey.
+func (sk *SecretKey) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindSecretKey, data, sk.decode)
+	return
+}
+
+func (sk *SecretKey) encode(data []byte) (err error) {
+	if err = ValidateID(sk.ID); err != nil {
+		return err
+	}
 
-	var pt = 0
-	data = make([]byte, sk.GetDataLen(true)+len(sk.ID))
+	var pt int
 	if pt, err = sk.Value.WriteTo(data); err != nil {
-		return nil, err
+		return err
 	}
 
 	copy(data[pt:], []byte(sk.ID))
-	return
+	return nil
 }
 
-// UnmarshalBinary decodes a previously marshaled SecretKey in the target SecretKey.
-func (sk *SecretKey) UnmarshalBinary(data []byte) (err error) {
-	var pt = 0
-	if pt, err = sk.Value.DecodePolyNew(data); err != nil {
+func (sk *SecretKey) decode(data []byte) (err error) {
+	var pt int
+	if sk.Value, pt, err = decodePolyQP(data); err != nil {
 		return err
 	}
 
 	sk.ID = string(data[pt:])
-	return
+	return checkDecodedID(sk.ID)
 }
 
-// GetDataLen returns the length in bytes of the target PublicKey.
+// GetDataLen returns the length in bytes of the payload of the target PublicKey, without its ID.
 func (pk *PublicKey) GetDataLen(WithMetadata bool) (dataLen int) {
 	return pk.Value[0].GetDataLen(WithMetadata) + pk.Value[1].GetDataLen(WithMetadata)
 }
 
 // MarshalBinary encodes a PublicKey in a byte slice.
 func (pk *PublicKey) MarshalBinary() (data []byte, err error) {
-	data = make([]byte, pk.GetDataLen(true)+len(pk.ID))
+	return MarshalEnvelope(KindPublicKey, noParamHash, pk.GetDataLen(true)+len(pk.ID), pk.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled PublicKey in the target PublicKey.
+func (pk *PublicKey) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindPublicKey, data, pk.decode)
+	return
+}
+
+func (pk *PublicKey) encode(data []byte) (err error) {
+	if err = ValidateID(pk.ID); err != nil {
+		return err
+	}
+
 	var inc, pt int
 	if inc, err = pk.Value[0].WriteTo(data[pt:]); err != nil {
-		return nil, err
+		return err
 	}
 	pt += inc
 
 	if inc, err = pk.Value[1].WriteTo(data[pt:]); err != nil {
-		return nil, err
+		return err
 	}
-
 	pt += inc
 
 	copy(data[pt:], []byte(pk.ID))
 
-	return
+	return nil
 }
 
-// UnmarshalBinary decodes a previously marshaled PublicKey in the target PublicKey.
-func (pk *PublicKey) UnmarshalBinary(data []byte) (err error) {
+func (pk *PublicKey) decode(data []byte) (err error) {
 
 	var pt, inc int
-	if inc, err = pk.Value[0].DecodePolyNew(data[pt:]); err != nil {
+	if pk.Value[0], inc, err = decodePolyQP(data[pt:]); err != nil {
 		return
 	}
 	pt += inc
 
-	if inc, err = pk.Value[1].DecodePolyNew(data[pt:]); err != nil {
+	if pk.Value[1], inc, err = decodePolyQP(data[pt:]); err != nil {
 		return
 	}
 	pt += inc
 
 	pk.ID = string(data[pt:])
 
-	return
+	return checkDecodedID(pk.ID)
 }
 
-// GetDataLen returns the length in bytes of the target EvaluationKey.
+// GetDataLen returns the length in bytes of the payload of the target RelinearizationKey, without its ID.
 func (rlk *RelinearizationKey) GetDataLen(WithMetadata bool) (dataLen int) {
 
 	if WithMetadata {
@@ -96,39 +124,50 @@ func (rlk *RelinearizationKey) GetDataLen(WithMetadata bool) (dataLen int) {
 
 // MarshalBinary encodes an EvaluationKey key in a byte slice.
 func (rlk *RelinearizationKey) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindRelinearizationKey, noParamHash, rlk.GetDataLen(true)+len(rlk.ID), rlk.encode)
+}
 
-	var pointer int
+// UnmarshalBinary decodes a previously marshaled EvaluationKey in the target EvaluationKey.
+func (rlk *RelinearizationKey) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindRelinearizationKey, data, rlk.decode)
+	return
+}
 
-	dataLen := rlk.GetDataLen(true)
+func (rlk *RelinearizationKey) encode(data []byte) (err error) {
 
-	data = make([]byte, dataLen+len(rlk.ID))
+	if err = ValidateID(rlk.ID); err != nil {
+		return err
+	}
 
 	data[0] = uint8(len(rlk.Value))
 
-	pointer++
+	pointer := 1
 
 	for _, evakey := range rlk.Value {
 
 		if pointer, err = (*SwitchingKey)(evakey).encode(pointer, data); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
 	copy(data[pointer:], []byte(rlk.ID))
 
-	return data, nil
+	return nil
 }
 
-// UnmarshalBinary decodes a previously marshaled EvaluationKey in the target EvaluationKey.
-func (rlk *RelinearizationKey) UnmarshalBinary(data []byte) (err error) {
+func (rlk *RelinearizationKey) decode(data []byte) (err error) {
 
-	deg := int(data[0])
+	if len(data) < 1 {
+		return errTruncated("relinearization key")
+	}
 
-	//rlk.Value = make([]*SwitchingKey, deg)
+	if deg := int(data[0]); deg != len(rlk.Value) {
+		return errMalformed("relinearization key has %d switching keys", deg)
+	}
 
 	pointer := 1
 	var inc int
-	for i := 0; i < deg; i++ {
+	for i := range rlk.Value {
 		rlk.Value[i] = new(SwitchingKey)
 		if inc, err = rlk.Value[i].decode(data[pointer:]); err != nil {
 			return err
@@ -138,10 +177,58 @@ func (rlk *RelinearizationKey) UnmarshalBinary(data []byte) (err error) {
 
 	rlk.ID = string(data[pointer:])
 
+	return checkDecodedID(rlk.ID)
+}
+
+// GetDataLen returns the length in bytes of the payload of the target PartySwitchingKey, without its ID.
+func (swk *PartySwitchingKey) GetDataLen(WithMetadata bool) (dataLen int) {
+	return swk.Value[0].GetDataLen(WithMetadata) + swk.Value[1].GetDataLen(WithMetadata)
+}
+
+// MarshalBinary encodes a PartySwitchingKey in a byte slice.
+func (swk *PartySwitchingKey) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindPartySwitchingKey, noParamHash, swk.GetDataLen(true)+len(swk.ID), swk.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled PartySwitchingKey in the target PartySwitchingKey.
+func (swk *PartySwitchingKey) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindPartySwitchingKey, data, swk.decode)
+	return
+}
+
+func (swk *PartySwitchingKey) encode(data []byte) (err error) {
+	if err = ValidateID(swk.ID); err != nil {
+		return err
+	}
+
+	var pointer int
+	for _, evakey := range swk.Value {
+		if pointer, err = evakey.encode(pointer, data); err != nil {
+			return err
+		}
+	}
+
+	copy(data[pointer:], []byte(swk.ID))
+
 	return nil
 }
 
-// GetDataLen returns the length in bytes of the target SwitchingKey.
+func (swk *PartySwitchingKey) decode(data []byte) (err error) {
+	var pointer, inc int
+	for i := range swk.Value {
+		swk.Value[i] = new(SwitchingKey)
+		if inc, err = swk.Value[i].decode(data[pointer:]); err != nil {
+			return err
+		}
+		pointer += inc
+	}
+
+	swk.ID = string(data[pointer:])
+
+	return checkDecodedID(swk.ID)
+}
+
+// GetDataLen returns the length in bytes of the payload of the target SwitchingKey.
 func (swk *SwitchingKey) GetDataLen(WithMetadata bool) (dataLen int) {
 
 	if WithMetadata {
@@ -157,24 +244,22 @@ func (swk *SwitchingKey) GetDataLen(WithMetadata bool) (dataLen int) {
 
 // MarshalBinary encodes an SwitchingKey in a byte slice.
 func (swk *SwitchingKey) MarshalBinary() (data []byte, err error) {
-
-	data = make([]byte, swk.GetDataLen(true))
-
-	if _, err = swk.encode(0, data); err != nil {
-		return nil, err
-	}
-
-	return data, nil
+	return MarshalEnvelope(KindSwitchingKey, noParamHash, swk.GetDataLen(true), func(payload []byte) (err error) {
+		_, err = swk.encode(0, payload)
+		return
+	})
 }
 
 // UnmarshalBinary decode a previously marshaled SwitchingKey in the target SwitchingKey.
 func (swk *SwitchingKey) UnmarshalBinary(data []byte) (err error) {
-
-	if _, err = swk.decode(data); err != nil {
-		return err
-	}
-
-	return nil
+	_, err = UnmarshalEnvelope(KindSwitchingKey, data, func(payload []byte) (err error) {
+		var pointer int
+		if pointer, err = swk.decode(payload); err == nil && pointer != len(payload) {
+			err = errMalformed("remaining unparsed data")
+		}
+		return
+	})
+	return
 }
 
 func (swk *SwitchingKey) encode(pointer int, data []byte) (int, error) {
@@ -200,6 +285,10 @@ func (swk *SwitchingKey) encode(pointer int, data []byte) (int, error) {
 
 func (swk *SwitchingKey) decode(data []byte) (pointer int, err error) {
 
+	if len(data) < 1 {
+		return 0, errTruncated("switching key")
+	}
+
 	decomposition := int(data[0])
 
 	pointer = 1
@@ -210,8 +299,7 @@ func (swk *SwitchingKey) decode(data []byte) (pointer int, err error) {
 
 	for j := 0; j < decomposition; j++ {
 
-		swk.Value[j].Q = new(ring.Poly)
-		if inc, err = swk.Value[j].DecodePolyNew(data[pointer:]); err != nil {
+		if swk.Value[j], inc, err = decodePolyQP(data[pointer:]); err != nil {
 			return
 		}
 		pointer += inc
@@ -221,16 +309,11 @@ func (swk *SwitchingKey) decode(data []byte) (pointer int, err error) {
 	return
 }
 
-// GetDataLen returns the length in bytes of the target SwitchingKey.
+// GetDataLen returns the length in bytes of the target RotationKey.
 func (rtk *RotationKey) GetDataLen(WithMetadata bool) (dataLen int) {
 
 	dataLen = rtk.Value.GetDataLen(WithMetadata)
-
-	if WithMetadata {
-		dataLen++
-	}
-
-	dataLen += len(rtk.ID)
+	dataLen += idDataLen(rtk.ID, WithMetadata)
 	dataLen += 8
 	return
 }
@@ -238,12 +321,12 @@ func (rtk *RotationKey) GetDataLen(WithMetadata bool) (dataLen int) {
 func (rtk *RotationKey) encode(pointer int, data []byte) (int, error) {
 
 	var err error
+	var inc int
 
-	data[pointer] = uint8(len(rtk.ID))
-	pointer++
-
-	copy(data[pointer:], []byte(rtk.ID))
-	pointer += len(rtk.ID)
+	if inc, err = encodeID(data[pointer:], rtk.ID); err != nil {
+		return pointer, err
+	}
+	pointer += inc
 
 	binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(rtk.RotIdx))
 	pointer += 8
@@ -257,19 +340,21 @@ func (rtk *RotationKey) encode(pointer int, data []byte) (int, error) {
 
 func (rtk *RotationKey) decode(data []byte) (pointer int, err error) {
 
-	idLen := int(data[0])
-	pointer = 1
+	var inc int
+	var rotIdx uint64
 
-	rtk.ID = string(data[pointer : pointer+idLen])
-	pointer += idLen
+	if rtk.ID, pointer, err = decodeID(data); err != nil {
+		return
+	}
 
-	rtk.RotIdx = uint(binary.BigEndian.Uint64(data[pointer : pointer+8]))
+	if rotIdx, err = decodeUint64(data[pointer:]); err != nil {
+		return
+	}
+	rtk.RotIdx = uint(rotIdx)
 	pointer += 8
 
 	rtk.Value = new(SwitchingKey)
 
-	var inc int
-
 	if inc, err = rtk.Value.decode(data[pointer:]); err != nil {
 		return
 	}
@@ -279,15 +364,10 @@ func (rtk *RotationKey) decode(data []byte) (pointer int, err error) {
 	return
 }
 
-// GetDataLen returns the length in bytes of the target RotationKeys.
+// GetDataLen returns the length in bytes of the payload of the target RotationKeySet.
 func (rtks *RotationKeySet) GetDataLen(WithMetaData bool) (dataLen int) {
 	for ID, rtk := range rtks.Value {
-		if WithMetaData {
-			//存放id的长度
-			dataLen += 1
-		}
-
-		dataLen += len(ID)
+		dataLen += idDataLen(ID, WithMetaData)
 
 		//存放map[uint]的数量
 		dataLen += 8
@@ -304,69 +384,735 @@ func (rtks *RotationKeySet) GetDataLen(WithMetaData bool) (dataLen int) {
 
 // MarshalBinary encodes a RotationKeys struct in a byte slice.
 func (rtks *RotationKeySet) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindRotationKeySet, noParamHash, rtks.GetDataLen(true), rtks.encode)
+}
 
-	data = make([]byte, rtks.GetDataLen(true))
+// UnmarshalBinary decodes a previously marshaled RotationKeys in the target RotationKeys.
+func (rtks *RotationKeySet) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindRotationKeySet, data, rtks.decode)
+	return
+}
 
-	pointer := int(0)
+func (rtks *RotationKeySet) encode(data []byte) (err error) {
 
-	for ID, rtk := range rtks.Value {
-		data[pointer] = uint8(len(ID))
-		pointer += 1
+	var pointer, inc int
+
+	for _, ID := range slices.Sorted(maps.Keys(rtks.Value)) {
+		rtk := rtks.Value[ID]
 
-		copy(data[pointer:], []byte(ID))
-		pointer += len(ID)
+		if inc, err = encodeID(data[pointer:], ID); err != nil {
+			return err
+		}
+		pointer += inc
 
 		binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(len(rtk)))
 		pointer += 8
 
-		for idx, key := range rtk {
+		for _, idx := range slices.Sorted(maps.Keys(rtk)) {
+			key := rtk[idx]
 
 			binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(idx))
 			pointer += 8
 
 			if pointer, err = key.encode(pointer, data); err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
 
-	return data, nil
+	return nil
 }
 
-// UnmarshalBinary decodes a previously marshaled RotationKeys in the target RotationKeys.
-func (rtks *RotationKeySet) UnmarshalBinary(data []byte) (err error) {
+func (rtks *RotationKeySet) decode(data []byte) (err error) {
+
+	var pointer, inc int
+	var ID string
+	var keyLen, idx uint64
 
-	var pointer = 0
 	rtks.Value = make(map[string]map[uint]*RotationKey)
 
 	for pointer < len(data) {
-		idLen := int(data[pointer])
-		pointer++
 
-		ID := string(data[pointer : pointer+idLen])
-		pointer += idLen
+		if ID, inc, err = decodeID(data[pointer:]); err != nil {
+			return err
+		}
+		pointer += inc
+
+		if _, in := rtks.Value[ID]; in {
+			return errMalformed("duplicate id %s", ID)
+		}
 
 		rtks.Value[ID] = make(map[uint]*RotationKey)
 
-		keyLen := uint(binary.BigEndian.Uint64(data[pointer : pointer+8]))
+		if keyLen, err = decodeUint64(data[pointer:]); err != nil {
+			return err
+		}
 		pointer += 8
 
-		var inc int
-
-		for i := uint(0); i < keyLen; i++ {
+		for i := uint64(0); i < keyLen; i++ {
 
-			idx := uint(binary.BigEndian.Uint64(data[pointer : pointer+8]))
+			if idx, err = decodeUint64(data[pointer:]); err != nil {
+				return err
+			}
 			pointer += 8
 
-			rtks.Value[ID][idx] = new(RotationKey)
+			rtk := new(RotationKey)
 
-			if inc, err = rtks.Value[ID][idx].decode(data[pointer:]); err != nil {
+			if inc, err = rtk.decode(data[pointer:]); err != nil {
 				return err
 			}
-
 			pointer += inc
+
+			if rtk.ID != ID || uint64(rtk.RotIdx) != idx {
+				return errMalformed("rotation key %s/%d stored under %s/%d", rtk.ID, rtk.RotIdx, ID, idx)
+			}
+
+			rtks.Value[ID][rtk.RotIdx] = rtk
+		}
+	}
+
+	return nil
+}
+
+// GetDataLen returns the length in bytes of the payload of the target ConjugationKey.
+func (cjk *ConjugationKey) GetDataLen(WithMetadata bool) (dataLen int) {
+
+	dataLen = cjk.Value.GetDataLen(WithMetadata)
+	dataLen += idDataLen(cjk.ID, WithMetadata)
+	return
+}
+
+// MarshalBinary encodes a ConjugationKey in a byte slice.
+func (cjk *ConjugationKey) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindConjugationKey, noParamHash, cjk.GetDataLen(true), func(payload []byte) (err error) {
+		_, err = cjk.encode(0, payload)
+		return
+	})
+}
+
+// UnmarshalBinary decodes a previously marshaled ConjugationKey in the target ConjugationKey.
+func (cjk *ConjugationKey) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindConjugationKey, data, func(payload []byte) (err error) {
+		var pointer int
+		if pointer, err = cjk.decode(payload); err == nil && pointer != len(payload) {
+			err = errMalformed("remaining unparsed data")
+		}
+		return
+	})
+	return
+}
+
+func (cjk *ConjugationKey) encode(pointer int, data []byte) (int, error) {
+
+	var err error
+	var inc int
+
+	if inc, err = encodeID(data[pointer:], cjk.ID); err != nil {
+		return pointer, err
+	}
+	pointer += inc
+
+	if pointer, err = cjk.Value.encode(pointer, data); err != nil {
+		return pointer, err
+	}
+
+	return pointer, nil
+}
+
+func (cjk *ConjugationKey) decode(data []byte) (pointer int, err error) {
+
+	if cjk.ID, pointer, err = decodeID(data); err != nil {
+		return
+	}
+
+	cjk.Value = new(SwitchingKey)
+
+	var inc int
+
+	if inc, err = cjk.Value.decode(data[pointer:]); err != nil {
+		return
+	}
+
+	pointer += inc
+
+	return
+}
+
+// GetDataLen returns the length in bytes of the payload of the target ConjugationKeySet.
+func (cjks *ConjugationKeySet) GetDataLen(WithMetaData bool) (dataLen int) {
+	for _, cjk := range cjks.Value {
+		dataLen += cjk.GetDataLen(WithMetaData)
+	}
+	return
+}
+
+// MarshalBinary encodes a ConjugationKeySet in a byte slice.
+func (cjks *ConjugationKeySet) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindConjugationKeySet, noParamHash, cjks.GetDataLen(true), cjks.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled ConjugationKeySet in the target ConjugationKeySet.
+func (cjks *ConjugationKeySet) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindConjugationKeySet, data, cjks.decode)
+	return
+}
+
+func (cjks *ConjugationKeySet) encode(data []byte) (err error) {
+
+	pointer := int(0)
+
+	for _, id := range slices.Sorted(maps.Keys(cjks.Value)) {
+		if pointer, err = cjks.Value[id].encode(pointer, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cjks *ConjugationKeySet) decode(data []byte) (err error) {
+
+	var pointer, inc int
+	cjks.Value = make(map[string]*ConjugationKey)
+
+	for pointer < len(data) {
+
+		cjk := new(ConjugationKey)
+
+		if inc, err = cjk.decode(data[pointer:]); err != nil {
+			return err
 		}
 
+		pointer += inc
+
+		cjks.Value[cjk.ID] = cjk
+	}
+
+	return nil
+}
+
+// GetDataLen returns the length in bytes of the payload of the target DecryptionShare, without its ID.
+func (share *DecryptionShare) GetDataLen(WithMetadata bool) (dataLen int) {
+	return share.Value.GetDataLen(WithMetadata)
+}
+
+// MarshalBinary encodes a DecryptionShare in a byte slice.
+func (share *DecryptionShare) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindDecryptionShare, noParamHash, share.GetDataLen(true)+len(share.ID), share.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled DecryptionShare in the target DecryptionShare.
+func (share *DecryptionShare) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindDecryptionShare, data, share.decode)
+	return
+}
+
+func (share *DecryptionShare) encode(data []byte) (err error) {
+	if err = ValidateID(share.ID); err != nil {
+		return err
+	}
+
+	var pt int
+	if pt, err = share.Value.WriteTo(data); err != nil {
+		return err
+	}
+
+	copy(data[pt:], []byte(share.ID))
+	return nil
+}
+
+func (share *DecryptionShare) decode(data []byte) (err error) {
+	var pt int
+	if share.Value, pt, err = decodePoly(data); err != nil {
+		return err
+	}
+
+	share.ID = string(data[pt:])
+	return checkDecodedID(share.ID)
+}
+
+// GetDataLen returns the length in bytes of the payload of the target ReencryptionShare, without its IDs.
+func (share *ReencryptionShare) GetDataLen(WithMetadata bool) (dataLen int) {
+	return share.Value[0].GetDataLen(WithMetadata) + share.Value[1].GetDataLen(WithMetadata)
+}
+
+// MarshalBinary encodes a ReencryptionShare in a byte slice.
+func (share *ReencryptionShare) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindReencryptionShare, noParamHash, share.payloadLen(), share.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled ReencryptionShare in the target ReencryptionShare.
+func (share *ReencryptionShare) UnmarshalBinary(data []byte) (err error) {
+	_, err = UnmarshalEnvelope(KindReencryptionShare, data, share.decode)
+	return
+}
+
+// payloadLen returns the length in bytes of the payload of the target ReencryptionShare with its IDs.
+func (share *ReencryptionShare) payloadLen() int {
+	return share.GetDataLen(true) + idDataLen(share.ID, true) + len(share.Recipient)
+}
+
+func (share *ReencryptionShare) encode(data []byte) (err error) {
+	if err = ValidateID(share.Recipient); err != nil {
+		return err
+	}
+
+	var inc, pt int
+	if inc, err = share.Value[0].WriteTo(data[pt:]); err != nil {
+		return err
+	}
+	pt += inc
+
+	if inc, err = share.Value[1].WriteTo(data[pt:]); err != nil {
+		return err
+	}
+	pt += inc
+
+	if inc, err = encodeID(data[pt:], share.ID); err != nil {
+		return err
+	}
+	pt += inc
+
+	copy(data[pt:], []byte(share.Recipient))
+
+	return nil
+}
+
+func (share *ReencryptionShare) decode(data []byte) (err error) {
+	var inc, pt int
+	if share.Value[0], inc, err = decodePoly(data[pt:]); err != nil {
+		return err
+	}
+	pt += inc
+
+	if share.Value[1], inc, err = decodePoly(data[pt:]); err != nil {
+		return err
+	}
+	pt += inc
+
+	if share.ID, inc, err = decodeID(data[pt:]); err != nil {
+		return err
+	}
+	pt += inc
+
+	share.Recipient = string(data[pt:])
+	return checkDecodedID(share.Recipient)
+}
+
+// GetDataLen returns the length in bytes of the payload of the target RelinearizationKeySet.
+func (rlkSet *RelinearizationKeySet) GetDataLen(WithMetaData bool) (dataLen int) {
+	for _, rlk := range rlkSet.Value {
+		if WithMetaData {
+			dataLen += 8
+		}
+		dataLen += rlk.GetDataLen(WithMetaData) + len(rlk.ID)
+	}
+	return
+}
+
+// MarshalBinary encodes a RelinearizationKeySet in a byte slice, bound to the parameters of the set.
+func (rlkSet *RelinearizationKeySet) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindRelinearizationKeySet, rlkSet.params.Fingerprint(), rlkSet.GetDataLen(true), rlkSet.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled RelinearizationKeySet in the target RelinearizationKeySet
+// The target should be created with NewRelinearizationKeyKeySet
+// with the parameters the set was marshaled with.
+func (rlkSet *RelinearizationKeySet) UnmarshalBinary(data []byte) (err error) {
+
+	if rlkSet.Value == nil {
+		return errors.New("cannot UnmarshalBinary: RelinearizationKeySet should be created with NewRelinearizationKeyKeySet")
+	}
+
+	var hdr EnvelopeHeader
+
+	if hdr, err = ReadEnvelopeHeader(data); err != nil {
+		return err
+	}
+
+	if err = hdr.CheckParams(rlkSet.params); err != nil {
+		return err
+	}
+
+	_, err = UnmarshalEnvelope(KindRelinearizationKeySet, data, rlkSet.decode)
+	return
+}
+
+func (rlkSet *RelinearizationKeySet) encode(data []byte) (err error) {
+
+	var pointer, rlkLen int
+
+	for _, id := range slices.Sorted(maps.Keys(rlkSet.Value)) {
+		rlk := rlkSet.Value[id]
+		rlkLen = rlk.GetDataLen(true) + len(rlk.ID)
+
+		binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(rlkLen))
+		pointer += 8
+
+		if err = rlk.encode(data[pointer : pointer+rlkLen]); err != nil {
+			return err
+		}
+		pointer += rlkLen
+	}
+
+	return nil
+}
+
+func (rlkSet *RelinearizationKeySet) decode(data []byte) (err error) {
+
+	rlkSet.Value = make(map[string]*RelinearizationKey)
+
+	var pointer int
+	var rlkLen uint64
+
+	for pointer < len(data) {
+		if rlkLen, err = decodeUint64(data[pointer:]); err != nil {
+			return err
+		}
+		pointer += 8
+
+		if rlkLen > uint64(len(data)-pointer) {
+			return errTruncated("relinearization key")
+		}
+
+		rlk := new(RelinearizationKey)
+		if err = rlk.decode(data[pointer : pointer+int(rlkLen)]); err != nil {
+			return err
+		}
+		pointer += int(rlkLen)
+
+		rlkSet.AddRelinearizationKey(rlk)
+	}
+
+	return nil
+}
+
+// GetDataLen returns the length in bytes of the payload of the target EvaluationKeyBundle.
+// The fingerprint is stored as the parameter hash of the envelope.
+func (bundle *EvaluationKeyBundle) GetDataLen(WithMetaData bool) (dataLen int) {
+
+	if WithMetaData {
+		// flags
+		dataLen++
+	}
+
+	dataLen += idDataLen(bundle.ID, WithMetaData)
+
+	if bundle.PublicKey != nil {
+		if WithMetaData {
+			dataLen += 8
+		}
+		dataLen += bundle.PublicKey.GetDataLen(WithMetaData) + len(bundle.PublicKey.ID)
+	}
+
+	if bundle.RelinearizationKey != nil {
+		if WithMetaData {
+			dataLen += 8
+		}
+		dataLen += bundle.RelinearizationKey.GetDataLen(WithMetaData) + len(bundle.RelinearizationKey.ID)
+	}
+
+	if bundle.ConjugationKey != nil {
+		dataLen += bundle.ConjugationKey.GetDataLen(WithMetaData)
+	}
+
+	if WithMetaData {
+		dataLen += 8
+	}
+
+	for _, rtk := range bundle.RotationKeys {
+		dataLen += rtk.GetDataLen(WithMetaData)
+	}
+
+	return
+}
+
+const (
+	bundleHasPublicKey = 1 << iota
+	bundleHasRelinearizationKey
+	bundleHasConjugationKey
+)
+
+// flags returns the flags indicating which keys are held by the target EvaluationKeyBundle.
+func (bundle *EvaluationKeyBundle) flags() (flags uint8) {
+	if bundle.PublicKey != nil {
+		flags |= bundleHasPublicKey
+	}
+	if bundle.RelinearizationKey != nil {
+		flags |= bundleHasRelinearizationKey
+	}
+	if bundle.ConjugationKey != nil {
+		flags |= bundleHasConjugationKey
+	}
+	return
+}
+
+// MarshalBinary encodes an EvaluationKeyBundle in a byte slice.
+func (bundle *EvaluationKeyBundle) MarshalBinary() (data []byte, err error) {
+	return MarshalEnvelope(KindEvaluationKeyBundle, bundle.Fingerprint, bundle.GetDataLen(true), bundle.encode)
+}
+
+// UnmarshalBinary decodes a previously marshaled EvaluationKeyBundle in the target EvaluationKeyBundle.
+func (bundle *EvaluationKeyBundle) UnmarshalBinary(data []byte) (err error) {
+
+	var hdr EnvelopeHeader
+
+	if hdr, err = UnmarshalEnvelope(KindEvaluationKeyBundle, data, bundle.decode); err != nil {
+		return err
+	}
+
+	bundle.Fingerprint = hdr.ParamHash
+
+	return nil
+}
+
+func (bundle *EvaluationKeyBundle) encode(data []byte) (err error) {
+
+	var pointer, keyLen int
+
+	if pointer, err = encodeID(data, bundle.ID); err != nil {
+		return err
+	}
+
+	data[pointer] = bundle.flags()
+	pointer++
+
+	if bundle.PublicKey != nil {
+		keyLen = bundle.PublicKey.GetDataLen(true) + len(bundle.PublicKey.ID)
+
+		binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(keyLen))
+		pointer += 8
+
+		if err = bundle.PublicKey.encode(data[pointer : pointer+keyLen]); err != nil {
+			return err
+		}
+		pointer += keyLen
+	}
+
+	if bundle.RelinearizationKey != nil {
+		keyLen = bundle.RelinearizationKey.GetDataLen(true) + len(bundle.RelinearizationKey.ID)
+
+		binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(keyLen))
+		pointer += 8
+
+		if err = bundle.RelinearizationKey.encode(data[pointer : pointer+keyLen]); err != nil {
+			return err
+		}
+		pointer += keyLen
+	}
+
+	if bundle.ConjugationKey != nil {
+		if pointer, err = bundle.ConjugationKey.encode(pointer, data); err != nil {
+			return err
+		}
+	}
+
+	binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(len(bundle.RotationKeys)))
+	pointer += 8
+
+	for _, rotidx := range slices.Sorted(maps.Keys(bundle.RotationKeys)) {
+		if pointer, err = bundle.RotationKeys[rotidx].encode(pointer, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (bundle *EvaluationKeyBundle) decode(data []byte) (err error) {
+
+	var pointer, inc int
+
+	if bundle.ID, pointer, err = decodeID(data); err != nil {
+		return err
+	}
+
+	if len(data) < pointer+1 {
+		return errTruncated("flags")
+	}
+
+	flags := data[pointer]
+	pointer++
+
+	readKey := func() ([]byte, error) {
+		keyLen, err := decodeUint64(data[pointer:])
+		if err != nil {
+			return nil, err
+		}
+		pointer += 8
+
+		if keyLen > uint64(len(data)-pointer) {
+			return nil, errTruncated("key")
+		}
+
+		pointer += int(keyLen)
+		return data[pointer-int(keyLen) : pointer], nil
+	}
+
+	var keyBytes []byte
+
+	bundle.PublicKey = nil
+	if flags&bundleHasPublicKey != 0 {
+		if keyBytes, err = readKey(); err != nil {
+			return err
+		}
+
+		bundle.PublicKey = new(PublicKey)
+		if err = bundle.PublicKey.decode(keyBytes); err != nil {
+			return err
+		}
+	}
+
+	bundle.RelinearizationKey = nil
+	if flags&bundleHasRelinearizationKey != 0 {
+		if keyBytes, err = readKey(); err != nil {
+			return err
+		}
+
+		bundle.RelinearizationKey = new(RelinearizationKey)
+		if err = bundle.RelinearizationKey.decode(keyBytes); err != nil {
+			return err
+		}
+	}
+
+	bundle.ConjugationKey = nil
+	if flags&bundleHasConjugationKey != 0 {
+		bundle.ConjugationKey = new(ConjugationKey)
+		if inc, err = bundle.ConjugationKey.decode(data[pointer:]); err != nil {
+			return err
+		}
+		pointer += inc
+	}
+
+	var numRtk uint64
+	if numRtk, err = decodeUint64(data[pointer:]); err != nil {
+		return err
+	}
+	pointer += 8
+
+	bundle.RotationKeys = make(map[uint]*RotationKey)
+
+	for i := uint64(0); i < numRtk; i++ {
+		rtk := new(RotationKey)
+		if inc, err = rtk.decode(data[pointer:]); err != nil {
+			return err
+		}
+		pointer += inc
+
+		bundle.AddRotationKey(rtk)
+	}
+
+	if pointer != len(data) {
+		return errMalformed("remaining unparsed data")
+	}
+
+	return nil
+}
+
+// GetDataLen returns the length in bytes of the components of the target Ciphertext.
+func (el *Ciphertext) GetDataLen(WithMetadata bool) (dataLen int) {
+
+	dataLen = el.Value["0"].GetDataLen(WithMetadata)
+
+	if WithMetadata {
+		dataLen += uvarintLen(uint64(len(el.Value) - 1))
+	}
+
+	for id, pol := range el.Value {
+		if id != "0" {
+			dataLen += idDataLen(id, WithMetadata)
+			dataLen += pol.GetDataLen(WithMetadata)
+		}
+	}
+	return
+}
+
+// Encode writes the target Ciphertext in data: the "0" component followed by the number of IDs
+// and by the other components prefixed by their ID, in increasing order of ID.
+// It returns the number of bytes written.
+func (el *Ciphertext) Encode(data []byte) (pointer int, err error) {
+
+	var inc int
+
+	c0, in := el.Value["0"]
+	if !in {
+		return 0, errors.New("cannot Encode: missing component 0")
+	}
+
+	if pointer, err = c0.WriteTo(data); err != nil {
+		return
+	}
+
+	pointer += binary.PutUvarint(data[pointer:], uint64(len(el.Value)-1))
+
+	for _, id := range slices.Sorted(maps.Keys(el.Value)) {
+
+		if id == "0" {
+			continue
+		}
+
+		if inc, err = encodeID(data[pointer:], id); err != nil {
+			return pointer, err
+		}
+		pointer += inc
+
+		if inc, err = el.Value[id].WriteTo(data[pointer:]); err != nil {
+			return pointer, err
+		}
+		pointer += inc
+	}
+
+	return pointer, nil
+}
+
+// Decode reads a Ciphertext written by Encode from data until its end in the target Ciphertext.
+// It checks that the IDs are valid and sorted and that all the components are at the same level.
+func (el *Ciphertext) Decode(data []byte) (err error) {
+
+	var pointer, inc int
+	var id, prevID string
+	var pol *ring.Poly
+
+	el.Value = make(map[string]*ring.Poly)
+
+	if el.Value["0"], pointer, err = decodePoly(data); err != nil {
+		return err
+	}
+
+	numIDs, n := binary.Uvarint(data[pointer:])
+	if n <= 0 || numIDs > uint64(len(data)-pointer) {
+		return errMalformed("invalid number of components")
+	}
+	pointer += n
+
+	for i := uint64(0); i < numIDs; i++ {
+		if id, inc, err = decodeID(data[pointer:]); err != nil {
+			return err
+		}
+		pointer += inc
+
+		if i > 0 && id <= prevID {
+			return errMalformed("component %s is duplicate or not sorted", id)
+		}
+		prevID = id
+
+		if pol, inc, err = decodePoly(data[pointer:]); err != nil {
+			return err
+		}
+		pointer += inc
+
+		el.Value[id] = pol
+	}
+
+	if pointer != len(data) {
+		return errMalformed("remaining unparsed data")
+	}
+
+	c0 := el.Value["0"]
+	for id, pol := range el.Value {
+		if pol.Degree() != c0.Degree() || pol.LenModuli() != c0.LenModuli() {
+			return errMalformed("component %s does not match component 0", id)
+		}
 	}
 
 	return nil
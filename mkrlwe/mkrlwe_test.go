@@ -1,12 +1,16 @@
 package mkrlwe
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"math"
 	"math/big"
 	"math/bits"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/ldsec/lattigo/v2/ring"
@@ -74,12 +78,26 @@ func TestMKRLWE(t *testing.T) {
 		mkparams := NewParameters(params, gamma)
 		kgen := NewKeyGenerator(mkparams)
 
+		testSeededCRS(mkparams, t)
+		testRotationPlanner(mkparams, t)
 		testGenKeyPair(kgen, t)
 		testSwitchKeyGen(kgen, t)
 		testRelinKeyGen(kgen, t)
 
 		testEncryptor(kgen, t)
 		testDecryptor(kgen, t)
+		testDecryptionShare(kgen, t)
+		testReencryptionShare(kgen, t)
+		testSwitchPartyKey(kgen, t)
+		testCollective(kgen, t)
+		testSession(kgen, t)
+
+		testMarshalConjugationKey(kgen, t)
+		testMarshalEvaluationKeyBundle(kgen, t)
+		testMarshalEnvelope(kgen, t)
+		testMarshalCompressed(kgen, t)
+		testStreaming(kgen, t)
+		testPartyID(kgen, t)
 
 		testDecompose(kgen, t)
 		testExternalProduct(kgen, t)
@@ -677,3 +695,1115 @@ func testHadamardProduct(kgen *KeyGenerator, t *testing.T) {
 	})
 
 }
+
+func testRotationPlanner(params Parameters, t *testing.T) {
+
+	half := params.N() / 2
+
+	// compose returns the rotation obtained by applying the rotations of the decomposition
+	compose := func(rotidxs []int) (rotidx int) {
+		for _, k := range rotidxs {
+			rotidx += k
+		}
+		return params.NormalizeRotation(rotidx)
+	}
+
+	t.Run(testString(params, "RotationPlanner/Normalize/"), func(t *testing.T) {
+		require.Equal(t, half-1, params.NormalizeRotation(-1))
+		require.Equal(t, 1, params.NormalizeRotation(half+1))
+		require.Equal(t, 0, params.NormalizeRotation(-2*half))
+	})
+
+	t.Run(testString(params, "RotationPlanner/NAF/"), func(t *testing.T) {
+		require.Equal(t, []int{half - 1}, params.nafRotations(-1))
+		require.Equal(t, []int{half - 1, 8}, params.nafRotations(7))
+		require.Equal(t, []int{1, half - 4}, params.nafRotations(-3))
+		require.Empty(t, params.nafRotations(half))
+
+		for _, rotidx := range []int{1, 3, 5, 7, 11, 100, 1023, half - 3, half - 1} {
+			rotidxs := params.nafRotations(rotidx)
+			require.Equal(t, params.NormalizeRotation(rotidx), compose(rotidxs))
+			require.LessOrEqual(t, len(rotidxs), bits.OnesCount(uint(rotidx)))
+		}
+	})
+
+	t.Run(testString(params, "RotationPlanner/Decomposition/"), func(t *testing.T) {
+		params := NewParametersFromSeed(params.Parameters, params.Gamma(), params.Seed())
+
+		require.Empty(t, params.RotationDecomposition(half))
+		require.Equal(t, []int{4}, params.RotationDecomposition(4-half))
+
+		// the non-adjacent form is used only when its signed powers of two have a CRS
+		require.Equal(t, []int{1, 2, 4}, params.RotationDecomposition(7))
+		params.AddCRS(half - 1)
+		require.Equal(t, []int{half - 1, 8}, params.RotationDecomposition(7))
+		params.AddCRS(7)
+		require.Equal(t, []int{7}, params.RotationDecomposition(7))
+	})
+
+	t.Run(testString(params, "RotationPlanner/Plan/"), func(t *testing.T) {
+		planner := NewRotationPlanner(params)
+		planner.AddRotations(1, 3, 4, 5, -3, -5, -half)
+		planner.AddRotation(7, 10)
+
+		// one key per rotation, the keys of 1 and 4 use the default CRS
+		plan := planner.Plan(0)
+		require.Equal(t, []int{1, 3, 4, 5, 7, half - 5, half - 3}, plan.RotIdxs)
+		require.Equal(t, []int{3, 5, 7, half - 5, half - 3}, plan.NewCRS)
+		require.Equal(t, 16, plan.TotalKeySwitches())
+		require.Equal(t, 1, plan.KeySwitches(7+half))
+		require.Equal(t, 0, plan.KeySwitches(half))
+		require.Equal(t, -1, plan.KeySwitches(2))
+
+		// the budget is below the number of signed powers of two needed by the rotations
+		plan = planner.Plan(3)
+		require.Equal(t, []int{1, 4, 8, half - 4, half - 1}, plan.RotIdxs)
+		require.Equal(t, []int{half - 4, half - 1}, plan.NewCRS)
+		require.Equal(t, 2, plan.KeySwitches(7))
+		require.Equal(t, 30, plan.TotalKeySwitches())
+
+		// the most frequent rotation gets its own key, which frees the key of 8
+		plan = planner.Plan(5)
+		require.Equal(t, []int{1, 4, 7, half - 4, half - 1}, plan.RotIdxs)
+		require.Equal(t, 1, plan.KeySwitches(7))
+		require.Equal(t, 2, plan.KeySwitches(-5))
+		require.Equal(t, 20, plan.TotalKeySwitches())
+
+		// the decompositions only use the keys of the plan and match those of the parameters once its CRS are added
+		params := NewParametersFromSeed(params.Parameters, params.Gamma(), params.Seed())
+		plan.AddCRS(&params)
+		for rotidx, rotidxs := range plan.Decompositions {
+			require.Equal(t, rotidx, compose(rotidxs))
+			require.Equal(t, rotidxs, params.RotationDecomposition(rotidx))
+			for _, k := range rotidxs {
+				require.Contains(t, plan.RotIdxs, k)
+			}
+		}
+
+		// a rotation with a CRS is never decomposed
+		planner = NewRotationPlanner(params)
+		planner.AddRotations(7, 9)
+		plan = planner.Plan(1)
+		require.Equal(t, []int{1, 7, 8}, plan.RotIdxs)
+		require.Equal(t, 1, plan.KeySwitches(7))
+		require.Equal(t, 2, plan.KeySwitches(9))
+	})
+}
+
+func testSeededCRS(params Parameters, t *testing.T) {
+
+	t.Run(testString(params, "SeededCRS/"), func(t *testing.T) {
+
+		// the same ring and seed give the same CRS for every index
+		params2 := NewParametersFromSeed(params.Parameters, params.Gamma(), params.Seed())
+		require.Equal(t, params.CRSIndices(), params2.CRSIndices())
+		for idx, crs := range params.CRS {
+			for i := range crs.Value {
+				require.True(t, crs.Value[i].Q.Equals(params2.CRS[idx].Value[i].Q))
+				require.True(t, crs.Value[i].P.Equals(params2.CRS[idx].Value[i].P))
+			}
+		}
+
+		// the index is folded into the derivation
+		require.False(t, params.CRS[0].Value[0].Q.Equals(params.CRS[-1].Value[0].Q))
+
+		// only the seed and the indexes are serialized
+		params2.AddCRS(3)
+		data, err := params2.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, params2.GetDataLen(true)+EnvelopeOverhead, len(data))
+
+		var params3 Parameters
+		require.NoError(t, params3.UnmarshalBinary(data))
+		require.Equal(t, params2.Seed(), params3.Seed())
+		require.Equal(t, params2.Gamma(), params3.Gamma())
+		require.Equal(t, params2.CRSIndices(), params3.CRSIndices())
+		for i := range params2.CRS[3].Value {
+			require.True(t, params2.CRS[3].Value[i].Q.Equals(params3.CRS[3].Value[i].Q))
+			require.True(t, params2.CRS[3].Value[i].P.Equals(params3.CRS[3].Value[i].P))
+		}
+	})
+}
+
+func testDecryptionShare(kgen *KeyGenerator, t *testing.T) {
+	params := kgen.params
+	ringQ := params.RingQ()
+	encryptor := NewEncryptor(params)
+	decryptor := NewDecryptor(params)
+
+	t.Run(testString(params, "DecryptionShare/Multikey/"), func(t *testing.T) {
+		plaintext := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+		plaintext.Value.IsNTT = true
+
+		user1 := "user1"
+		user2 := "user2"
+		idset1 := NewIDSet()
+		idset2 := NewIDSet()
+
+		idset1.Add(user1)
+		idset2.Add(user2)
+		idset := idset1.Union(idset2)
+
+		sk1, pk1 := kgen.GenKeyPair(user1)
+		sk2, pk2 := kgen.GenKeyPair(user2)
+
+		level := plaintext.Level()
+
+		ct1 := NewCiphertextNTT(params, idset1, level)
+		ct2 := NewCiphertextNTT(params, idset2, level)
+		ctOut := NewCiphertextNTT(params, idset, level)
+
+		encryptor.Encrypt(plaintext, pk1, ct1)
+		encryptor.Encrypt(plaintext, pk2, ct2)
+
+		ringQ.AddLvl(level, ct1.Value["0"], ct2.Value["0"], ctOut.Value["0"])
+		ctOut.Value[user1].Copy(ct1.Value[user1])
+		ctOut.Value[user2].Copy(ct2.Value[user2])
+
+		ctCopy := ctOut.CopyNew()
+
+		// each party computes its share with its own secret key only
+		share1 := decryptor.GenDecryptionShare(ctOut, sk1)
+		share2 := decryptor.GenDecryptionShare(ctOut, sk2)
+
+		// shares are not computed in place
+		require.True(t, ctCopy.Value["0"].Equals(ctOut.Value["0"]))
+		require.True(t, ctCopy.Value[user1].Equals(ctOut.Value[user1]))
+		require.True(t, ctCopy.Value[user2].Equals(ctOut.Value[user2]))
+
+		// shares are sent to the combiner
+		data, err := share2.MarshalBinary()
+		require.NoError(t, err)
+		share2Recv := new(DecryptionShare)
+		require.NoError(t, share2Recv.UnmarshalBinary(data))
+		require.Equal(t, share2.ID, share2Recv.ID)
+		require.True(t, share2.Value.Equals(share2Recv.Value))
+
+		require.Error(t, decryptor.MergeDecryptionShares(ctOut, []*DecryptionShare{share1}, plaintext))
+		require.Error(t, decryptor.MergeDecryptionShares(ctOut, []*DecryptionShare{share1, share1}, plaintext))
+		require.Error(t, decryptor.MergeDecryptionShares(ct1, []*DecryptionShare{share1, share2Recv}, plaintext))
+
+		require.NoError(t, decryptor.MergeDecryptionShares(ctOut, []*DecryptionShare{share1, share2Recv}, plaintext))
+		ringQ.InvNTTLvl(plaintext.Level(), plaintext.Value, plaintext.Value)
+
+		// the error is dominated by the smudging noise of the two shares
+		log2Bound := bits.Len64(uint64(2*6*DefaultSmudgingSigma)*uint64(params.N())) + 1
+		require.GreaterOrEqual(t, log2Bound, log2OfInnerSum(ctOut.Level(), ringQ, plaintext.Value))
+	})
+	t.Run(testString(params, "DecryptionShare/SmudgingBound/"), func(t *testing.T) {
+		decryptor := NewDecryptor(params)
+		require.Equal(t, DefaultSmudgingSigma, decryptor.SmudgingSigma())
+
+		decryptor.SetSmudgingLogBound(30)
+		require.Equal(t, math.Exp2(30)/6, decryptor.SmudgingSigma())
+
+		require.Panics(t, func() { decryptor.SetSmudgingLogBound(params.LogQ()) })
+		require.Panics(t, func() { decryptor.SetSmudgingSigma(0) })
+
+		var user1 string = "user1"
+		users := NewIDSet()
+		users.Add(user1)
+
+		sk, pk := kgen.GenKeyPair(user1)
+		plaintext := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+		ciphertext := NewCiphertext(params, users, plaintext.Level())
+		encryptor.Encrypt(plaintext, pk, ciphertext)
+
+		share := decryptor.GenDecryptionShare(ciphertext, sk)
+		require.NoError(t, decryptor.MergeDecryptionShares(ciphertext, []*DecryptionShare{share}, plaintext))
+		require.GreaterOrEqual(t, 31+params.LogN(), log2OfInnerSum(ciphertext.Level(), ringQ, plaintext.Value))
+	})
+}
+
+func testReencryptionShare(kgen *KeyGenerator, t *testing.T) {
+	params := kgen.params
+	ringQ := params.RingQ()
+	encryptor := NewEncryptor(params)
+	decryptor := NewDecryptor(params)
+
+	for _, isNTT := range []bool{false, true} {
+		t.Run(testString(params, "ReencryptionShare/Multikey/NTT="+strconv.FormatBool(isNTT)+"/"), func(t *testing.T) {
+			plaintext := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+			plaintext.Value.IsNTT = isNTT
+
+			user1 := "user1"
+			user2 := "user2"
+			recipient := "buyer"
+			idset1 := NewIDSet()
+			idset2 := NewIDSet()
+
+			idset1.Add(user1)
+			idset2.Add(user2)
+			idset := idset1.Union(idset2)
+
+			sk1, pk1 := kgen.GenKeyPair(user1)
+			sk2, pk2 := kgen.GenKeyPair(user2)
+			skr, pkr := kgen.GenKeyPair(recipient)
+			_, pkOther := kgen.GenKeyPair("auditor")
+
+			level := plaintext.Level()
+
+			newCiphertext := NewCiphertext
+			if isNTT {
+				newCiphertext = NewCiphertextNTT
+			}
+
+			ct1 := newCiphertext(params, idset1, level)
+			ct2 := newCiphertext(params, idset2, level)
+			ct := newCiphertext(params, idset, level)
+
+			encryptor.Encrypt(plaintext, pk1, ct1)
+			encryptor.Encrypt(plaintext, pk2, ct2)
+
+			ringQ.AddLvl(level, ct1.Value["0"], ct2.Value["0"], ct.Value["0"])
+			ct.Value[user1].Copy(ct1.Value[user1])
+			ct.Value[user2].Copy(ct2.Value[user2])
+
+			ctCopy := ct.CopyNew()
+
+			// each party computes its share towards the recipient with its own secret key only
+			share1 := decryptor.GenReencryptionShare(ct, sk1, pkr)
+			share2 := decryptor.GenReencryptionShare(ct, sk2, pkr)
+
+			// shares are not computed in place
+			require.True(t, ctCopy.Value["0"].Equals(ct.Value["0"]))
+			require.True(t, ctCopy.Value[user1].Equals(ct.Value[user1]))
+			require.True(t, ctCopy.Value[user2].Equals(ct.Value[user2]))
+
+			// shares are sent to the combiner
+			data, err := share1.MarshalBinary()
+			require.NoError(t, err)
+			share1Recv := new(ReencryptionShare)
+			require.NoError(t, share1Recv.UnmarshalBinary(data))
+			require.Equal(t, share1.ID, share1Recv.ID)
+			require.Equal(t, share1.Recipient, share1Recv.Recipient)
+			require.True(t, share1.Value[0].Equals(share1Recv.Value[0]))
+			require.True(t, share1.Value[1].Equals(share1Recv.Value[1]))
+
+			buf := new(bytes.Buffer)
+			_, err = share2.WriteTo(buf)
+			require.NoError(t, err)
+			share2Recv := new(ReencryptionShare)
+			_, err = share2Recv.ReadFrom(buf)
+			require.NoError(t, err)
+			require.Equal(t, share2.ID, share2Recv.ID)
+			require.True(t, share2.Value[0].Equals(share2Recv.Value[0]))
+			require.True(t, share2.Value[1].Equals(share2Recv.Value[1]))
+
+			_, err = decryptor.MergeReencryptionShares(ct, []*ReencryptionShare{share1Recv})
+			require.Error(t, err)
+			_, err = decryptor.MergeReencryptionShares(ct, []*ReencryptionShare{share1Recv, share1Recv})
+			require.Error(t, err)
+			_, err = decryptor.MergeReencryptionShares(ct, []*ReencryptionShare{share1Recv, decryptor.GenReencryptionShare(ct, sk2, pkOther)})
+			require.Error(t, err)
+
+			ctOut, err := decryptor.MergeReencryptionShares(ct, []*ReencryptionShare{share1Recv, share2Recv})
+			require.NoError(t, err)
+			require.True(t, ctOut.IDSet().Has(recipient))
+			require.Equal(t, 1, ctOut.IDSet().Size())
+			require.Equal(t, level, ctOut.Level())
+
+			// the recipient decrypts alone
+			skSet := NewSecretKeySet()
+			skSet.AddSecretKey(skr)
+			decryptor.Decrypt(ctOut, skSet, plaintext)
+			if plaintext.Value.IsNTT {
+				ringQ.InvNTTLvl(plaintext.Level(), plaintext.Value, plaintext.Value)
+			}
+
+			// the error is dominated by the smudging noise of the two shares
+			log2Bound := bits.Len64(uint64(2*6*DefaultSmudgingSigma)*uint64(params.N())) + 1
+			require.GreaterOrEqual(t, log2Bound, log2OfInnerSum(ctOut.Level(), ringQ, plaintext.Value))
+		})
+	}
+}
+
+func testSwitchPartyKey(kgen *KeyGenerator, t *testing.T) {
+	params := kgen.params
+	ringQ := params.RingQ()
+	encryptor := NewEncryptor(params)
+	decryptor := NewDecryptor(params)
+	ks := NewKeySwitcher(params)
+
+	for _, isNTT := range []bool{false, true} {
+		t.Run(testString(params, "SwitchPartyKey/NTT="+strconv.FormatBool(isNTT)+"/"), func(t *testing.T) {
+			plaintext := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+			plaintext.Value.IsNTT = isNTT
+
+			user1 := "user1"
+			user2 := "user2"
+			idset1 := NewIDSet()
+			idset2 := NewIDSet()
+
+			idset1.Add(user1)
+			idset2.Add(user2)
+			idset := idset1.Union(idset2)
+
+			sk1, pk1 := kgen.GenKeyPair(user1)
+			sk2, pk2 := kgen.GenKeyPair(user2)
+			sk1New := kgen.GenSecretKey(user1)
+
+			level := plaintext.Level()
+
+			newCiphertext := NewCiphertext
+			if isNTT {
+				newCiphertext = NewCiphertextNTT
+			}
+
+			ct1 := newCiphertext(params, idset1, level)
+			ct2 := newCiphertext(params, idset2, level)
+			ct := newCiphertext(params, idset, level)
+
+			encryptor.Encrypt(plaintext, pk1, ct1)
+			encryptor.Encrypt(plaintext, pk2, ct2)
+
+			ringQ.AddLvl(level, ct1.Value["0"], ct2.Value["0"], ct.Value["0"])
+			ct.Value[user1].Copy(ct1.Value[user1])
+			ct.Value[user2].Copy(ct2.Value[user2])
+
+			require.Panics(t, func() { kgen.GenPartySwitchingKey(sk1, kgen.GenSecretKey(user2)) })
+
+			// the switching key is sent to the evaluator
+			swk := kgen.GenPartySwitchingKey(sk1, sk1New)
+			data, err := swk.MarshalBinary()
+			require.NoError(t, err)
+			swkRecv := new(PartySwitchingKey)
+			require.NoError(t, swkRecv.UnmarshalBinary(data))
+			require.Equal(t, swk.ID, swkRecv.ID)
+
+			ctOut := newCiphertext(params, idset, level)
+			ks.SwitchPartyKey(ct, swkRecv, ctOut)
+
+			// the component of user2 is untouched
+			require.True(t, ct.Value[user2].Equals(ctOut.Value[user2]))
+
+			skSet := NewSecretKeySet()
+			skSet.AddSecretKey(sk1New)
+			skSet.AddSecretKey(sk2)
+			decryptor.Decrypt(ctOut, skSet, plaintext)
+			if plaintext.Value.IsNTT {
+				ringQ.InvNTTLvl(plaintext.Level(), plaintext.Value, plaintext.Value)
+			}
+			require.GreaterOrEqual(t, 10+params.LogN(), log2OfInnerSum(level, ringQ, plaintext.Value))
+
+			// the old secret key does not decrypt anymore
+			skSet.AddSecretKey(sk1)
+			decryptor.Decrypt(ctOut, skSet, plaintext)
+			if plaintext.Value.IsNTT {
+				ringQ.InvNTTLvl(plaintext.Level(), plaintext.Value, plaintext.Value)
+			}
+			require.Less(t, 10+params.LogN(), log2OfInnerSum(level, ringQ, plaintext.Value))
+		})
+	}
+}
+
+func testCollective(kgen *KeyGenerator, t *testing.T) {
+	params := kgen.params
+	ringQ := params.RingQ()
+	ringQP := params.RingQP()
+	levelQ, levelP := params.QCount()-1, params.PCount()-1
+	encryptor := NewEncryptor(params)
+	decryptor := NewDecryptor(params)
+
+	t.Run(testString(params, "Collective/"), func(t *testing.T) {
+		plaintext := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+		level := plaintext.Level()
+
+		users := []string{"user1", "user2", "user3"}
+		sks := make([]*SecretKey, len(users))
+		pks := make([]*PublicKey, len(users))
+		idset := NewIDSet()
+		for i, id := range users {
+			sks[i], pks[i] = kgen.GenKeyPair(id)
+			idset.Add(id)
+		}
+
+		// the group gathers the first two parties, no party knows the sum of their secret keys
+		cpk, err := GenCollectivePublicKey(params, "group", pks[:2])
+		require.NoError(t, err)
+
+		skGroup := NewSecretKey(params, "group")
+		for _, sk := range sks[:2] {
+			ringQP.AddLvl(levelQ, levelP, skGroup.Value, sk.Value, skGroup.Value)
+		}
+
+		// a fresh encryption under the collective public key is decrypted with the sum of the secret keys
+		group := NewIDSet()
+		group.Add("group")
+		ctGroup := NewCiphertext(params, group, level)
+		encryptor.Encrypt(plaintext, cpk.PublicKey, ctGroup)
+
+		skSet := NewSecretKeySet()
+		skSet.AddSecretKey(skGroup)
+		decryptor.Decrypt(ctGroup, skSet, plaintext)
+		require.GreaterOrEqual(t, 10+params.LogN(), log2OfInnerSum(level, ringQ, plaintext.Value))
+
+		// the parties of the group convert their components of a ciphertext of the three parties
+		ct := NewCiphertext(params, idset, level)
+		for i, id := range users {
+			idi := NewIDSet()
+			idi.Add(id)
+			cti := NewCiphertext(params, idi, level)
+			encryptor.Encrypt(plaintext, pks[i], cti)
+			ringQ.AddLvl(level, ct.Value["0"], cti.Value["0"], ct.Value["0"])
+			ct.Value[id].Copy(cti.Value[id])
+		}
+
+		share1 := decryptor.GenReencryptionShare(ct, sks[0], cpk.PublicKey)
+		share2 := decryptor.GenReencryptionShare(ct, sks[1], cpk.PublicKey)
+		share3 := decryptor.GenReencryptionShare(ct, sks[2], cpk.PublicKey)
+
+		_, err = decryptor.ConvertToCollective(ct, cpk, []*ReencryptionShare{share1})
+		require.Error(t, err)
+		_, err = decryptor.ConvertToCollective(ct, cpk, []*ReencryptionShare{share1, share2, share3})
+		require.Error(t, err)
+		_, err = decryptor.ConvertToCollective(ct, cpk, []*ReencryptionShare{share1, share1})
+		require.Error(t, err)
+
+		ctOut, err := decryptor.ConvertToCollective(ct, cpk, []*ReencryptionShare{share1, share2})
+		require.NoError(t, err)
+		require.Equal(t, []string{"group", "user3"}, ctOut.IDSet().Sorted())
+		require.Equal(t, level, ctOut.Level())
+
+		// the component of the party outside the group is kept
+		require.True(t, ct.Value["user3"].Equals(ctOut.Value["user3"]))
+
+		skSet.AddSecretKey(sks[2])
+		decryptor.Decrypt(ctOut, skSet, plaintext)
+
+		// the error is dominated by the smudging noise of the two shares
+		log2Bound := bits.Len64(uint64(2*6*DefaultSmudgingSigma)*uint64(params.N())) + 1
+		require.GreaterOrEqual(t, log2Bound, log2OfInnerSum(level, ringQ, plaintext.Value))
+	})
+}
+
+func testSession(kgen *KeyGenerator, t *testing.T) {
+	params := kgen.params
+	ringQ := params.RingQ()
+	encryptor := NewEncryptor(params)
+	decryptor := NewDecryptor(params)
+
+	t.Run(testString(params, "Session/JoinAndLeave/"), func(t *testing.T) {
+		plaintext := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+		level := plaintext.Level()
+
+		sk1 := kgen.GenSecretKey("user1")
+		sk2 := kgen.GenSecretKey("user2")
+		sk3 := kgen.GenSecretKey("user3")
+
+		session := NewSession(params)
+		require.NoError(t, session.Join(kgen.GenEvaluationKeyBundle(sk1, nil)))
+		require.NoError(t, session.Join(kgen.GenEvaluationKeyBundle(sk2, nil)))
+		require.Error(t, session.Join(kgen.GenEvaluationKeyBundle(sk2, nil)))
+		require.Error(t, session.Join(NewEvaluationKeyBundle(params, "user3")))
+
+		pk1 := session.EvaluationKeys().PublicKeySet.GetPublicKey("user1")
+		idset1 := NewIDSet()
+		idset1.Add("user1")
+		ct := NewCiphertext(params, idset1, level)
+		encryptor.Encrypt(plaintext, pk1, ct)
+
+		require.NoError(t, session.Store("model", ct))
+		require.Equal(t, []string{"user1", "user2"}, ct.IDSet().Sorted())
+
+		// the joiner is padded into the stored ciphertexts
+		require.NoError(t, session.Join(kgen.GenEvaluationKeyBundle(sk3, nil)))
+		require.Equal(t, 3, session.Epoch())
+		require.Equal(t, []string{"model"}, session.Names())
+		require.Equal(t, []string{"user1", "user2", "user3"}, ct.IDSet().Sorted())
+
+		// user1 re-encrypts its component towards user3 and leaves
+		shares, err := session.GenExitShares(sk1, "user3")
+		require.NoError(t, err)
+
+		wrong, err := session.GenExitShares(sk1, "user2")
+		require.NoError(t, err)
+		require.Error(t, session.Leave("user1", "user3", wrong))
+		require.Equal(t, 3, session.Epoch())
+
+		require.NoError(t, session.Leave("user1", "user3", shares))
+		require.Equal(t, []string{"user2", "user3"}, ct.IDSet().Sorted())
+		require.Equal(t, []string{"user2", "user3"}, session.IDSet().Sorted())
+		require.NotContains(t, session.EvaluationKeys().RelinearizationKeySet.Value, "user1")
+		require.NotContains(t, session.EvaluationKeys().RotationKeySet.Value, "user1")
+		require.Error(t, session.Leave("user1", "user3", shares))
+
+		// the remaining parties decrypt without user1
+		skSet := NewSecretKeySet()
+		skSet.AddSecretKey(sk2)
+		skSet.AddSecretKey(sk3)
+		decryptor.Decrypt(ct, skSet, plaintext)
+
+		log2Bound := bits.Len64(uint64(6*DefaultSmudgingSigma)*uint64(params.N())) + 1
+		require.GreaterOrEqual(t, log2Bound, log2OfInnerSum(ct.Level(), ringQ, plaintext.Value))
+
+		require.Equal(t, []MembershipEvent{
+			{Epoch: 1, Kind: PartyJoined, ID: "user1"},
+			{Epoch: 2, Kind: PartyJoined, ID: "user2"},
+			{Epoch: 3, Kind: PartyJoined, ID: "user3"},
+			{Epoch: 4, Kind: PartyLeft, ID: "user1", Recipient: "user3"},
+		}, session.Events())
+		require.Equal(t, "leave", PartyLeft.String())
+
+		idset, err := session.IDSetAt(0)
+		require.NoError(t, err)
+		require.Equal(t, 0, idset.Size())
+	})
+}
+
+func testMarshalConjugationKey(kgen *KeyGenerator, t *testing.T) {
+
+	params := kgen.params
+
+	checkEqual := func(t *testing.T, cjk, cjkRecv *ConjugationKey) {
+		require.Equal(t, cjk.ID, cjkRecv.ID)
+		require.Equal(t, len(cjk.Value.Value), len(cjkRecv.Value.Value))
+		for i := range cjk.Value.Value {
+			require.True(t, cjk.Value.Value[i].Q.Equals(cjkRecv.Value.Value[i].Q))
+			require.True(t, cjk.Value.Value[i].P.Equals(cjkRecv.Value.Value[i].P))
+		}
+	}
+
+	t.Run(testString(params, "Marshal/ConjugationKey/"), func(t *testing.T) {
+
+		if params.PCount() == 0 {
+			t.Skip()
+		}
+
+		sk := kgen.GenSecretKey("user1")
+		cjk := kgen.GenConjugationKey(sk)
+
+		data, err := cjk.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, cjk.GetDataLen(true)+EnvelopeOverhead, len(data))
+
+		cjkRecv := new(ConjugationKey)
+		require.NoError(t, cjkRecv.UnmarshalBinary(data))
+		checkEqual(t, cjk, cjkRecv)
+	})
+
+	t.Run(testString(params, "Marshal/ConjugationKeySet/"), func(t *testing.T) {
+
+		if params.PCount() == 0 {
+			t.Skip()
+		}
+
+		cjkSet := NewConjugationKeySet()
+		cjkSet.AddConjugationKey(kgen.GenConjugationKey(kgen.GenSecretKey("user1")))
+		cjkSet.AddConjugationKey(kgen.GenConjugationKey(kgen.GenSecretKey("user2")))
+
+		data, err := cjkSet.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, cjkSet.GetDataLen(true)+EnvelopeOverhead, len(data))
+
+		cjkSetRecv := NewConjugationKeySet()
+		require.NoError(t, cjkSetRecv.UnmarshalBinary(data))
+		require.Equal(t, len(cjkSet.Value), len(cjkSetRecv.Value))
+		for id := range cjkSet.Value {
+			checkEqual(t, cjkSet.GetConjugationKey(id), cjkSetRecv.GetConjugationKey(id))
+		}
+	})
+}
+
+func testMarshalEvaluationKeyBundle(kgen *KeyGenerator, t *testing.T) {
+
+	params := kgen.params
+
+	checkSwk := func(t *testing.T, swk, swkRecv *SwitchingKey) {
+		require.Equal(t, len(swk.Value), len(swkRecv.Value))
+		for i := range swk.Value {
+			require.True(t, swk.Value[i].Q.Equals(swkRecv.Value[i].Q))
+			require.True(t, swk.Value[i].P.Equals(swkRecv.Value[i].P))
+		}
+	}
+
+	checkRlk := func(t *testing.T, rlk, rlkRecv *RelinearizationKey) {
+		require.Equal(t, rlk.ID, rlkRecv.ID)
+		for i := range rlk.Value {
+			checkSwk(t, rlk.Value[i], rlkRecv.Value[i])
+		}
+	}
+
+	t.Run(testString(params, "Marshal/EvaluationKeyBundle/"), func(t *testing.T) {
+
+		if params.PCount() == 0 {
+			t.Skip()
+		}
+
+		params.AddCRS(1)
+
+		sk := kgen.GenSecretKey("user1")
+		bundle := kgen.GenEvaluationKeyBundle(sk, []int{1})
+
+		data, err := bundle.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, bundle.GetDataLen(true)+EnvelopeOverhead, len(data))
+
+		bundleRecv := new(EvaluationKeyBundle)
+		require.NoError(t, bundleRecv.UnmarshalBinary(data))
+
+		require.Equal(t, bundle.ID, bundleRecv.ID)
+		require.Equal(t, bundle.Fingerprint, bundleRecv.Fingerprint)
+		require.Equal(t, bundle.PublicKey.ID, bundleRecv.PublicKey.ID)
+		require.True(t, bundle.PublicKey.Value[0].Q.Equals(bundleRecv.PublicKey.Value[0].Q))
+		require.True(t, bundle.PublicKey.Value[1].Q.Equals(bundleRecv.PublicKey.Value[1].Q))
+		checkRlk(t, bundle.RelinearizationKey, bundleRecv.RelinearizationKey)
+		checkSwk(t, bundle.ConjugationKey.Value, bundleRecv.ConjugationKey.Value)
+		require.Equal(t, len(bundle.RotationKeys), len(bundleRecv.RotationKeys))
+		checkSwk(t, bundle.RotationKeys[1].Value, bundleRecv.RotationKeys[1].Value)
+
+		require.Error(t, bundleRecv.UnmarshalBinary(data[:len(data)-1]))
+
+		evkSet := NewEvaluationKeySet(params)
+		require.NoError(t, evkSet.AddBundle(bundleRecv))
+		require.NotNil(t, evkSet.PublicKeySet.GetPublicKey("user1"))
+		require.NotNil(t, evkSet.RelinearizationKeySet.GetRelinearizationKey("user1"))
+		require.NotNil(t, evkSet.RotationKeySet.GetRotationKey("user1", 1))
+		require.NotNil(t, evkSet.ConjugationKeySet.GetConjugationKey("user1"))
+
+		otherParams := NewParameters(params.Parameters, params.Gamma())
+		require.Error(t, NewEvaluationKeySet(otherParams).AddBundle(bundleRecv))
+	})
+
+	t.Run(testString(params, "Marshal/RelinearizationKeySet/"), func(t *testing.T) {
+
+		if params.PCount() == 0 {
+			t.Skip()
+		}
+
+		rlkSet := NewRelinearizationKeyKeySet(params)
+		for _, id := range []string{"user1", "user2"} {
+			sk := kgen.GenSecretKey(id)
+			rlkSet.AddRelinearizationKey(kgen.GenRelinearizationKey(sk, kgen.GenSecretKey(id)))
+		}
+
+		data, err := rlkSet.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, rlkSet.GetDataLen(true)+EnvelopeOverhead, len(data))
+
+		require.Error(t, new(RelinearizationKeySet).UnmarshalBinary(data))
+
+		rlkSetRecv := NewRelinearizationKeyKeySet(params)
+		require.NoError(t, rlkSetRecv.UnmarshalBinary(data))
+		require.Equal(t, len(rlkSet.Value), len(rlkSetRecv.Value))
+		for id := range rlkSet.Value {
+			checkRlk(t, rlkSet.GetRelinearizationKey(id), rlkSetRecv.GetRelinearizationKey(id))
+		}
+	})
+}
+
+func testMarshalEnvelope(kgen *KeyGenerator, t *testing.T) {
+
+	params := kgen.params
+
+	t.Run(testString(params, "Marshal/Envelope/"), func(t *testing.T) {
+
+		sk, pk := kgen.GenKeyPair("user1")
+
+		data, err := pk.MarshalBinary()
+		require.NoError(t, err)
+
+		hdr, err := ReadEnvelopeHeader(data)
+		require.NoError(t, err)
+		require.Equal(t, KindPublicKey, hdr.Kind)
+		require.Equal(t, uint64(pk.GetDataLen(true)+len(pk.ID)), hdr.PayloadLen)
+
+		pkRecv := new(PublicKey)
+		require.NoError(t, pkRecv.UnmarshalBinary(data))
+		require.Equal(t, pk.ID, pkRecv.ID)
+		require.True(t, pk.Value[0].Q.Equals(pkRecv.Value[0].Q))
+		require.True(t, pk.Value[1].P.Equals(pkRecv.Value[1].P))
+
+		checkErr := func(target error, data []byte) {
+			err := new(PublicKey).UnmarshalBinary(data)
+			require.ErrorIs(t, err, target)
+			var decErr *DecodingError
+			require.ErrorAs(t, err, &decErr)
+		}
+
+		corrupt := func(i int) []byte {
+			buf := append([]byte{}, data...)
+			buf[i] ^= 1
+			return buf
+		}
+
+		checkErr(ErrTruncated, data[:EnvelopeHeaderSize-1])
+		checkErr(ErrTruncated, data[:len(data)-1])
+		checkErr(ErrBadMagic, corrupt(0))
+		checkErr(ErrUnsupportedVersion, corrupt(4))
+		checkErr(ErrKindMismatch, corrupt(5))
+		checkErr(ErrChecksum, corrupt(EnvelopeHeaderSize+10))
+		checkErr(ErrChecksum, corrupt(len(data)-1))
+		checkErr(ErrKindMismatch, func() []byte { data, _ := sk.MarshalBinary(); return data }())
+
+		// payloads with a valid checksum but truncated at any point are rejected without panicking
+		payload := data[EnvelopeHeaderSize : EnvelopeHeaderSize+int(hdr.PayloadLen)]
+		for _, n := range []int{0, 1, 3, 4, 100, len(payload) / 2, pk.GetDataLen(true) - 1} {
+			resealed, err := MarshalEnvelope(KindPublicKey, noParamHash, n, func(buf []byte) error {
+				copy(buf, payload[:n])
+				return nil
+			})
+			require.NoError(t, err)
+
+			err = new(PublicKey).UnmarshalBinary(resealed)
+			require.Error(t, err)
+			require.True(t, errors.Is(err, ErrTruncated) || errors.Is(err, ErrMalformed), err)
+		}
+
+		// so are polynomial headers announcing more coefficients than the payload holds
+		badHeader, err := MarshalEnvelope(KindPublicKey, noParamHash, 4, func(buf []byte) error {
+			copy(buf, []byte{maxPolyLogN + 1, 1, 0, 0})
+			return nil
+		})
+		require.NoError(t, err)
+		require.ErrorIs(t, new(PublicKey).UnmarshalBinary(badHeader), ErrMalformed)
+	})
+
+	t.Run(testString(params, "Marshal/Envelope/ParamHash/"), func(t *testing.T) {
+
+		if params.PCount() == 0 {
+			t.Skip()
+		}
+
+		rlkSet := NewRelinearizationKeyKeySet(params)
+		sk := kgen.GenSecretKey("user1")
+		rlkSet.AddRelinearizationKey(kgen.GenRelinearizationKey(sk, kgen.GenSecretKey("user1")))
+
+		data, err := rlkSet.MarshalBinary()
+		require.NoError(t, err)
+
+		hdr, err := ReadEnvelopeHeader(data)
+		require.NoError(t, err)
+		require.Equal(t, params.Fingerprint(), hdr.ParamHash)
+		require.NoError(t, hdr.CheckParams(params))
+
+		otherParams := NewParameters(params.Parameters, params.Gamma())
+		require.ErrorIs(t, hdr.CheckParams(otherParams), ErrParamsMismatch)
+		require.ErrorIs(t, NewRelinearizationKeyKeySet(otherParams).UnmarshalBinary(data), ErrParamsMismatch)
+	})
+}
+
+func testMarshalCompressed(kgen *KeyGenerator, t *testing.T) {
+
+	params := kgen.params
+
+	t.Run(testString(params, "Marshal/CompressedPublicKey/"), func(t *testing.T) {
+
+		_, pk := kgen.GenKeyPair("user1")
+
+		pkData, err := pk.MarshalBinary()
+		require.NoError(t, err)
+
+		data, err := pk.MarshalBinaryCompressed(params)
+		require.NoError(t, err)
+		require.Less(t, len(data), len(pkData)/2+EnvelopeOverhead)
+
+		pkRecv := NewPublicKey(params, "")
+		require.NoError(t, pkRecv.UnmarshalBinaryCompressed(params, data))
+		require.Equal(t, pk.ID, pkRecv.ID)
+		for i := range pk.Value {
+			require.True(t, pk.Value[i].Q.Equals(pkRecv.Value[i].Q))
+			require.True(t, pk.Value[i].P.Equals(pkRecv.Value[i].P))
+		}
+
+		otherParams := NewParameters(params.Parameters, params.Gamma())
+		require.ErrorIs(t, pkRecv.UnmarshalBinaryCompressed(otherParams, data), ErrParamsMismatch)
+		_, err = pk.MarshalBinaryCompressed(otherParams)
+		require.Error(t, err)
+	})
+
+	t.Run(testString(params, "Marshal/SeededCiphertext/"), func(t *testing.T) {
+
+		sk := kgen.GenSecretKey("user1")
+		skSet := NewSecretKeySet()
+		skSet.AddSecretKey(sk)
+
+		encryptor := NewEncryptor(params)
+		decryptor := NewDecryptor(params)
+
+		plaintext := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+		sct := NewSeededCiphertext(params, "user1", params.MaxLevel())
+		encryptor.EncryptSkSeeded(plaintext, sk, sct)
+
+		data := make([]byte, sct.GetDataLen(true))
+		n, err := sct.Encode(data)
+		require.NoError(t, err)
+		require.Equal(t, len(data), n)
+
+		sctRecv := new(SeededCiphertext)
+		require.NoError(t, sctRecv.Decode(data))
+		require.Error(t, new(SeededCiphertext).Decode(data[:len(data)-1]))
+
+		// the expansion at a lower level is a prefix of the expansion at the full level
+		ct := sctRecv.Expand(params)
+		sctLow := &SeededCiphertext{Value: sctRecv.Value.CopyNew(), ID: sctRecv.ID, Seed: sctRecv.Seed}
+		sctLow.Value.Coeffs = sctLow.Value.Coeffs[:1]
+		ctLow := sctLow.Expand(params)
+		require.Equal(t, ct.Value["user1"].Coeffs[0], ctLow.Value["user1"].Coeffs[0])
+
+		ptOut := rlwe.NewPlaintext(params.Parameters, params.MaxLevel())
+		decryptor.Decrypt(ct, skSet, ptOut)
+		require.GreaterOrEqual(t, 9+params.LogN(), log2OfInnerSum(ct.Level(), params.RingQ(), ptOut.Value))
+	})
+}
+
+func testStreaming(kgen *KeyGenerator, t *testing.T) {
+
+	params := kgen.params
+
+	if params.PCount() == 0 {
+		return
+	}
+
+	params.AddCRS(1)
+	params.AddCRS(2)
+
+	checkSwk := func(t *testing.T, swk, swkRecv *SwitchingKey) {
+		require.Equal(t, len(swk.Value), len(swkRecv.Value))
+		for i := range swk.Value {
+			require.True(t, swk.Value[i].Q.Equals(swkRecv.Value[i].Q))
+			require.True(t, swk.Value[i].P.Equals(swkRecv.Value[i].P))
+		}
+	}
+
+	rtkSet := NewRotationKeySet()
+	for _, id := range []string{"user1", "user2"} {
+		sk := kgen.GenSecretKey(id)
+		rtkSet.AddRotationKey(kgen.GenRotationKey(1, sk))
+		rtkSet.AddRotationKey(kgen.GenRotationKey(2, sk))
+	}
+
+	t.Run(testString(params, "Stream/RotationKeySet/"), func(t *testing.T) {
+
+		buf := new(bytes.Buffer)
+		n, err := rtkSet.WriteTo(buf)
+		require.NoError(t, err)
+		require.Equal(t, int64(buf.Len()), n)
+		require.Equal(t, rtkSet.GetDataLen(true)+EnvelopeOverhead, buf.Len())
+
+		data := buf.Bytes()
+
+		// WriteTo and MarshalBinary produce the same format
+		rtkSetRecv := NewRotationKeySet()
+		require.NoError(t, rtkSetRecv.UnmarshalBinary(data))
+
+		data, err = rtkSet.MarshalBinary()
+		require.NoError(t, err)
+
+		// ReadFrom reads exactly one object from the stream
+		stream := bytes.NewReader(append(append([]byte{}, data...), data...))
+		for i := 0; i < 2; i++ {
+			rtkSetRecv = NewRotationKeySet()
+			n, err = rtkSetRecv.ReadFrom(stream)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(data)), n)
+
+			for id := range rtkSet.Value {
+				for idx := range rtkSet.Value[id] {
+					checkSwk(t, rtkSet.GetRotationKey(id, idx).Value, rtkSetRecv.GetRotationKey(id, idx).Value)
+				}
+			}
+		}
+		require.Equal(t, 0, stream.Len())
+
+		_, err = NewRotationKeySet().ReadFrom(bytes.NewReader(data[:len(data)-100]))
+		require.ErrorIs(t, err, ErrTruncated)
+
+		corrupted := append([]byte{}, data...)
+		corrupted[len(data)/2] ^= 1
+
+		// the checksum is verified before the payload is decoded, so that the target is left untouched
+		rtkSetRecv = NewRotationKeySet()
+		rtkSetRecv.AddRotationKey(rtkSet.GetRotationKey("user1", 1))
+		_, err = rtkSetRecv.ReadFrom(bytes.NewReader(corrupted))
+		require.ErrorIs(t, err, ErrChecksum)
+		require.Equal(t, rtkSet.GetRotationKey("user1", 1), rtkSetRecv.GetRotationKey("user1", 1))
+
+		_, err = NewRotationKeyStore(bytes.NewReader(corrupted), int64(len(corrupted)))
+		require.ErrorIs(t, err, ErrChecksum)
+	})
+
+	t.Run(testString(params, "Stream/Keys/"), func(t *testing.T) {
+
+		sk, pk := kgen.GenKeyPair("user1")
+
+		buf := new(bytes.Buffer)
+		_, err := sk.WriteTo(buf)
+		require.NoError(t, err)
+		_, err = pk.WriteTo(buf)
+		require.NoError(t, err)
+
+		bundle := kgen.GenEvaluationKeyBundle(sk, []int{1, 2})
+		_, err = bundle.WriteTo(buf)
+		require.NoError(t, err)
+
+		rlkSet := NewRelinearizationKeyKeySet(params)
+		rlkSet.AddRelinearizationKey(bundle.RelinearizationKey)
+		_, err = rlkSet.WriteTo(buf)
+		require.NoError(t, err)
+
+		skRecv := new(SecretKey)
+		_, err = skRecv.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Equal(t, sk.ID, skRecv.ID)
+		require.True(t, sk.Value.Q.Equals(skRecv.Value.Q))
+
+		pkRecv := NewPublicKey(params, "")
+		_, err = pkRecv.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Equal(t, pk.ID, pkRecv.ID)
+		require.True(t, pk.Value[0].Q.Equals(pkRecv.Value[0].Q))
+
+		bundleRecv := new(EvaluationKeyBundle)
+		_, err = bundleRecv.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Equal(t, bundle.Fingerprint, bundleRecv.Fingerprint)
+		require.Equal(t, len(bundle.RotationKeys), len(bundleRecv.RotationKeys))
+		checkSwk(t, bundle.RotationKeys[2].Value, bundleRecv.RotationKeys[2].Value)
+		checkSwk(t, bundle.ConjugationKey.Value, bundleRecv.ConjugationKey.Value)
+
+		rlkSetRecv := NewRelinearizationKeyKeySet(params)
+		_, err = rlkSetRecv.ReadFrom(buf)
+		require.NoError(t, err)
+		require.NotNil(t, rlkSetRecv.Value["user1"])
+
+		require.Equal(t, 0, buf.Len())
+	})
+
+	t.Run(testString(params, "Stream/RotationKeyStore/"), func(t *testing.T) {
+
+		data, err := rtkSet.MarshalBinary()
+		require.NoError(t, err)
+
+		src := append([]byte{}, data...)
+		store, err := NewRotationKeyStore(bytes.NewReader(src), int64(len(src)))
+		require.NoError(t, err)
+		require.Equal(t, []uint{1, 2}, store.RotIdxs("user2"))
+		require.False(t, store.Has("user3", 1))
+
+		lazySet := store.RotationKeySet()
+		require.Equal(t, 0, len(lazySet.Value))
+		checkSwk(t, rtkSet.GetRotationKey("user1", 2).Value, lazySet.GetRotationKey("user1", 2).Value)
+		require.Equal(t, 1, len(lazySet.Value["user1"]))
+
+		lazySet.DelRotationKey("user1", 2)
+		checkSwk(t, rtkSet.GetRotationKey("user1", 2).Value, lazySet.GetRotationKey("user1", 2).Value)
+
+		rtk, err := lazySet.LoadRotationKey("user2", 2)
+		require.NoError(t, err)
+		checkSwk(t, rtkSet.GetRotationKey("user2", 2).Value, rtk.Value)
+
+		_, err = lazySet.LoadRotationKey("user3", 1)
+		require.Error(t, err)
+
+		// the source is modified after the store is opened
+		for i := range src {
+			src[i] ^= 1
+		}
+		_, err = store.Load("user2", 1)
+		require.ErrorIs(t, err, ErrChecksum)
+
+		// loading through the set reports the error instead of panicking, the loaded keys are kept
+		_, err = lazySet.LoadRotationKey("user2", 1)
+		require.ErrorIs(t, err, ErrChecksum)
+		require.Panics(t, func() { lazySet.GetRotationKey("user2", 1) })
+		_, err = lazySet.LoadRotationKey("user2", 2)
+		require.NoError(t, err)
+
+		_, err = NewRotationKeyStore(bytes.NewReader(src), int64(len(src)))
+		require.Error(t, err)
+
+		_, err = NewRotationKeyStore(bytes.NewReader(data), int64(len(data)-1))
+		require.ErrorIs(t, err, ErrTruncated)
+	})
+}
+
+func testPartyID(kgen *KeyGenerator, t *testing.T) {
+
+	params := kgen.params
+
+	t.Run(testString(params, "PartyID/Validate/"), func(t *testing.T) {
+
+		for _, id := range []string{"", "0", strings.Repeat("a", MaxIDLength+1), "\xff"} {
+			require.ErrorIs(t, ValidateID(id), ErrInvalidID)
+			require.Panics(t, func() { NewIDSet().Add(id) })
+		}
+
+		require.NoError(t, ValidateID("user1"))
+
+		idset := NewIDSet()
+		for _, id := range []string{"user3", "user1", "user2"} {
+			idset.Add(id)
+		}
+		require.Equal(t, []string{"user1", "user2", "user3"}, idset.Sorted())
+
+		require.Panics(t, func() { kgen.GenSecretKey("") })
+
+		sk := kgen.GenSecretKey("user1")
+		sk.ID = "0"
+		_, err := sk.MarshalBinary()
+		require.ErrorIs(t, err, ErrInvalidID)
+	})
+
+	t.Run(testString(params, "PartyID/LongID/"), func(t *testing.T) {
+
+		if params.PCount() == 0 {
+			t.Skip()
+		}
+
+		params.AddCRS(1)
+
+		longID := strings.Repeat("p", 300)
+
+		rtkSet := NewRotationKeySet()
+		rtkSet.AddRotationKey(kgen.GenRotationKey(1, kgen.GenSecretKey(longID)))
+
+		data, err := rtkSet.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, rtkSet.GetDataLen(true)+EnvelopeOverhead, len(data))
+
+		rtkSetRecv := NewRotationKeySet()
+		require.NoError(t, rtkSetRecv.UnmarshalBinary(data))
+		require.NotNil(t, rtkSetRecv.GetRotationKey(longID, 1))
+
+		buf := new(bytes.Buffer)
+		_, err = rtkSet.WriteTo(buf)
+		require.NoError(t, err)
+
+		rtkSetRecv = NewRotationKeySet()
+		_, err = rtkSetRecv.ReadFrom(buf)
+		require.NoError(t, err)
+		require.NotNil(t, rtkSetRecv.GetRotationKey(longID, 1))
+	})
+
+	t.Run(testString(params, "PartyID/DeterministicCiphertext/"), func(t *testing.T) {
+
+		idset := NewIDSet()
+		for i := 0; i < 8; i++ {
+			idset.Add("user" + strconv.Itoa(i))
+		}
+		idset.Add(strings.Repeat("q", 200))
+
+		ct := NewCiphertext(params, idset, params.MaxLevel())
+
+		data := make([]byte, ct.GetDataLen(true))
+		n, err := ct.Encode(data)
+		require.NoError(t, err)
+		require.Equal(t, len(data), n)
+
+		for i := 0; i < 4; i++ {
+			other := make([]byte, ct.GetDataLen(true))
+			_, err = ct.CopyNew().Encode(other)
+			require.NoError(t, err)
+			require.Equal(t, data, other)
+		}
+
+		ctRecv := new(Ciphertext)
+		require.NoError(t, ctRecv.Decode(data))
+		require.Equal(t, len(ct.Value), len(ctRecv.Value))
+
+		ct.Value[""] = ct.Value["user0"]
+		_, err = ct.Encode(make([]byte, ct.GetDataLen(true)))
+		require.ErrorIs(t, err, ErrInvalidID)
+	})
+}
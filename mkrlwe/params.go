@@ -1,41 +1,52 @@
 package mkrlwe
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/ldsec/lattigo/v2/ring"
 	"github.com/ldsec/lattigo/v2/rlwe"
 	"github.com/ldsec/lattigo/v2/utils"
 )
 
+// CRSSeedSize is the size in bytes of the public seed from which the CRS is expanded
+const CRSSeedSize = 32
+
 type Parameters struct {
 	rlwe.Parameters
 	CRS   map[int]*SwitchingKey
 	gamma int
+	seed  []byte
 }
 
-// NewParameters takes rlwe Parameter as input, generate two CRSs
-// and then return mkrlwe parameter
+// NewParameters takes rlwe Parameter as input, samples a fresh CRS seed,
+// expands the default CRSs from it and then return mkrlwe parameter
 func NewParameters(params rlwe.Parameters, gamma int) Parameters {
-	ret := new(Parameters)
-	ret.Parameters = params
-	ret.gamma = gamma
-
-	ringQP := params.RingQP()
-	levelQ := params.QCount() - 1
-	levelP := params.PCount() - 1
+	seed := make([]byte, CRSSeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		panic(err)
+	}
 
-	alpha := params.PCount() / gamma
-	beta := int(math.Ceil(float64(params.QCount()) / float64(alpha)))
+	return NewParametersFromSeed(params, gamma, seed)
+}
 
-	prng, err := utils.NewPRNG()
-	if err != nil {
-		panic(err)
+// NewParametersFromSeed takes rlwe Parameter and a public seed as input,
+// expands the default CRSs from the seed and then return mkrlwe parameter.
+// Two parties calling it with the same inputs obtain identical parameters.
+func NewParametersFromSeed(params rlwe.Parameters, gamma int, seed []byte) Parameters {
+	if len(seed) != CRSSeedSize {
+		panic(fmt.Sprintf("cannot NewParametersFromSeed: seed should be %d bytes", CRSSeedSize))
 	}
-	uniformSamplerQ := ring.NewUniformSampler(prng, params.RingQ())
-	uniformSamplerP := ring.NewUniformSampler(prng, params.RingP())
+
+	ret := new(Parameters)
+	ret.Parameters = params
+	ret.gamma = gamma
+	ret.seed = make([]byte, CRSSeedSize)
+	copy(ret.seed, seed)
 
 	ret.CRS = make(map[int]*SwitchingKey)
 
@@ -52,14 +63,7 @@ func NewParameters(params rlwe.Parameters, gamma int) Parameters {
 
 	// generate CRS for default indexes
 	for _, idx := range idxs {
-		ret.CRS[idx] = new(SwitchingKey)
-		ret.CRS[idx].Value = make([]rlwe.PolyQP, beta)
-		for i := 0; i < beta; i++ {
-			ret.CRS[idx].Value[i] = ringQP.NewPoly()
-			uniformSamplerQ.Read(ret.CRS[idx].Value[i].Q)
-			uniformSamplerP.Read(ret.CRS[idx].Value[i].P)
-			ringQP.MFormLvl(levelQ, levelP, ret.CRS[idx].Value[i], ret.CRS[idx].Value[i])
-		}
+		ret.AddCRS(idx)
 	}
 
 	return *ret
@@ -79,9 +83,46 @@ func (params Parameters) Gamma() int {
 	return params.gamma
 }
 
+// Seed returns a copy of the public seed from which the CRS is expanded
+func (params Parameters) Seed() []byte {
+	seed := make([]byte, len(params.seed))
+	copy(seed, params.seed)
+	return seed
+}
+
+// Fingerprint returns a SHA-256 digest of the ring parameters, gamma and the CRS seed.
+// Two parameters with the same fingerprint expand identical CRSs.
+func (params Parameters) Fingerprint() (digest [32]byte) {
+	rlweParamsBuf, err := params.Parameters.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	gammaBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(gammaBuf, uint32(params.gamma))
+
+	h := sha256.New()
+	h.Write(rlweParamsBuf)
+	h.Write(gammaBuf)
+	h.Write(params.seed)
+	copy(digest[:], h.Sum(nil))
+
+	return
+}
+
+// AddCRS expands the CRS of given index from the public seed and adds it to the parameters
 func (params *Parameters) AddCRS(idx int) {
+	params.CRS[idx] = params.expandCRS(idx)
+}
+
+// expandCRS deterministically samples the CRS of given index from a PRNG keyed with seed || idx
+func (params Parameters) expandCRS(idx int) (crs *SwitchingKey) {
+
+	key := make([]byte, CRSSeedSize+8)
+	copy(key, params.seed)
+	binary.BigEndian.PutUint64(key[CRSSeedSize:], uint64(int64(idx)))
 
-	prng, err := utils.NewPRNG()
+	prng, err := utils.NewKeyedPRNG(key)
 	if err != nil {
 		panic(err)
 	}
@@ -92,17 +133,31 @@ func (params *Parameters) AddCRS(idx int) {
 	levelP := params.PCount() - 1
 
 	beta := params.Beta(params.MaxLevel())
-	params.CRS[idx] = new(SwitchingKey)
-	params.CRS[idx].Value = make([]rlwe.PolyQP, beta)
+	crs = new(SwitchingKey)
+	crs.Value = make([]rlwe.PolyQP, beta)
 
 	for i := 0; i < beta; i++ {
-		params.CRS[idx].Value[i] = params.RingQP().NewPoly()
-		uniformSamplerQ.Read(params.CRS[idx].Value[i].Q)
-		uniformSamplerP.Read(params.CRS[idx].Value[i].P)
-		params.RingQP().MFormLvl(levelQ, levelP, params.CRS[idx].Value[i], params.CRS[idx].Value[i])
+		crs.Value[i] = params.RingQP().NewPoly()
+		uniformSamplerQ.Read(crs.Value[i].Q)
+		uniformSamplerP.Read(crs.Value[i].P)
+		params.RingQP().MFormLvl(levelQ, levelP, crs.Value[i], crs.Value[i])
 	}
+
+	return
+}
+
+// CRSIndices returns the indexes of the CRSs held by the parameters in increasing order
+func (params Parameters) CRSIndices() (idxs []int) {
+	idxs = make([]int, 0, len(params.CRS))
+	for idx := range params.CRS {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+	return
 }
 
+// GetDataLen returns the length in bytes of the payload of the marshaled parameters.
+// Only the seed and the CRS indexes are stored, the CRSs are expanded again on unmarshaling.
 func (params Parameters) GetDataLen(WithMetaData bool) (dataLen int) {
 
 	if WithMetaData {
@@ -111,92 +166,134 @@ func (params Parameters) GetDataLen(WithMetaData bool) (dataLen int) {
 
 	dataLen += params.Parameters.MarshalBinarySize()
 
-	for _, k := range params.CRS {
-		if WithMetaData {
-			dataLen += 4
-		}
-		dataLen += k.GetDataLen(WithMetaData)
+	// gamma
+	dataLen += 4
+
+	dataLen += CRSSeedSize
+
+	if WithMetaData {
+		dataLen += 4
 	}
 
-	dataLen += 4
+	dataLen += 4 * len(params.CRS)
+
 	return
 }
 
+// MarshalBinary encodes the rlwe parameters, gamma, the CRS seed and the CRS indexes in a byte slice.
 func (params Parameters) MarshalBinary() ([]byte, error) {
 
+	if len(params.seed) != CRSSeedSize {
+		return nil, fmt.Errorf("cannot MarshalBinary: parameters have no CRS seed")
+	}
+
+	return MarshalEnvelope(KindParameters, params.Fingerprint(), params.GetDataLen(true), params.encode)
+}
+
+// UnmarshalBinary decodes previously marshaled parameters and expands their CRSs from the seed.
+func (p *Parameters) UnmarshalBinary(data []byte) (err error) {
+
+	var hdr EnvelopeHeader
+
+	if hdr, err = UnmarshalEnvelope(KindParameters, data, p.decode); err != nil {
+		return err
+	}
+
+	if hdr.ParamHash != p.Fingerprint() {
+		return &DecodingError{Kind: KindParameters, Err: ErrParamsMismatch}
+	}
+
+	return nil
+}
+
+func (params Parameters) encode(data []byte) (err error) {
+
 	var pointer = 0
 	var rlweParamsBuf []byte
-	var err error
-
-	data := make([]byte, params.GetDataLen(true))
 
 	if rlweParamsBuf, err = params.Parameters.MarshalBinary(); err != nil {
-		return []byte{}, err
+		return err
 	}
 
 	binary.BigEndian.PutUint32(data[pointer:pointer+4], uint32(len(rlweParamsBuf)))
-
 	pointer += 4
 
 	copy(data[pointer:], rlweParamsBuf)
-
 	pointer += len(rlweParamsBuf)
 
-	for idx, key := range params.CRS {
-
-		binary.BigEndian.PutUint32(data[pointer:pointer+4], uint32(idx))
+	binary.BigEndian.PutUint32(data[pointer:pointer+4], uint32(params.gamma))
+	pointer += 4
 
-		pointer += 4
+	copy(data[pointer:], params.seed)
+	pointer += CRSSeedSize
 
-		if pointer, err = key.encode(pointer, data); err != nil {
-			return nil, err
-		}
+	idxs := params.CRSIndices()
+	binary.BigEndian.PutUint32(data[pointer:pointer+4], uint32(len(idxs)))
+	pointer += 4
 
+	for _, idx := range idxs {
+		binary.BigEndian.PutUint32(data[pointer:pointer+4], uint32(int32(idx)))
+		pointer += 4
 	}
 
-	binary.BigEndian.PutUint32(data[pointer:pointer+4], uint32(params.gamma))
-
-	return data, nil
+	return nil
 }
 
-func (p *Parameters) UnmarshalBinary(data []byte) error {
-	if len(data) < 11 {
-		return fmt.Errorf("invalid rlwe.Parameter serialization")
+func (p *Parameters) decode(data []byte) (err error) {
+	if len(data) < 4 {
+		return errTruncated("parameters")
 	}
 
 	var pointer = 4
-	var err error
-	var inc = 0
 
 	rlweParamsLen := int(binary.BigEndian.Uint32(data))
 
-	var ckksParams rlwe.Parameters
+	if uint64(len(data)) < uint64(pointer)+uint64(rlweParamsLen)+4+CRSSeedSize+4 {
+		return errTruncated("parameters")
+	}
 
-	ckksParams.UnmarshalBinary(data[pointer : pointer+rlweParamsLen])
+	// rlwe.Parameters.UnmarshalBinary does not check the number of moduli against the data length
+	if rlweParamsLen < 11 || rlweParamsLen != 11+(int(data[pointer+1])+int(data[pointer+2]))<<3 {
+		return errMalformed("invalid rlwe parameters length")
+	}
 
-	p.Parameters = ckksParams
+	var rlweParams rlwe.Parameters
 
-	pointer += rlweParamsLen
+	if err = rlweParams.UnmarshalBinary(data[pointer : pointer+rlweParamsLen]); err != nil {
+		return errMalformed(err.Error())
+	}
 
-	p.CRS = make(map[int]*SwitchingKey)
+	pointer += rlweParamsLen
 
-	for pointer < len(data)-4 {
+	gamma := int(int32(binary.BigEndian.Uint32(data[pointer:])))
+	pointer += 4
 
-		idx := int32(binary.BigEndian.Uint32(data[pointer:]))
-		pointer += 4
+	if gamma < 1 || gamma > rlweParams.PCount() {
+		return errMalformed("invalid gamma %d", gamma)
+	}
 
-		swk := new(SwitchingKey)
+	p.Parameters = rlweParams
+	p.gamma = gamma
 
-		if inc, err = swk.decode(data[pointer:]); err != nil {
-			return err
-		}
+	p.seed = make([]byte, CRSSeedSize)
+	copy(p.seed, data[pointer:pointer+CRSSeedSize])
+	pointer += CRSSeedSize
 
-		pointer += inc
+	numIdx := uint64(binary.BigEndian.Uint32(data[pointer:]))
+	pointer += 4
 
-		p.CRS[int(idx)] = swk
+	if uint64(len(data)-pointer) != 4*numIdx {
+		return errMalformed("invalid number of CRS indexes")
 	}
 
-	p.gamma = int(int32(binary.BigEndian.Uint32(data[pointer:])))
+	p.CRS = make(map[int]*SwitchingKey)
+
+	for i := uint64(0); i < numIdx; i++ {
+		idx := int(int32(binary.BigEndian.Uint32(data[pointer:])))
+		pointer += 4
+
+		p.AddCRS(idx)
+	}
 
-	return err
+	return nil
 }
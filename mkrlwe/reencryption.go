@@ -0,0 +1,168 @@
+package mkrlwe
+
+import (
+	"fmt"
+
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+// ReencryptionShare is a type for a key-switch share (c_i * s_i + u_i * pk_0 + e_smudge, u_i * pk_1 + e_1)
+// of the ID component of a ciphertext towards the public key pk of Recipient.
+// It is computed by the owner of the secret key s_i and can be sent to a combiner without revealing s_i or the plaintext.
+type ReencryptionShare struct {
+	Value     [2]*ring.Poly
+	ID        string
+	Recipient string
+}
+
+// GenReencryptionShare computes the re-encryption share of ct towards pk for the owner of sk.
+// The input ciphertext is not modified and the share has the same level and domain as ct.
+func (decryptor *Decryptor) GenReencryptionShare(ct *Ciphertext, sk *SecretKey, pk *PublicKey) (share *ReencryptionShare) {
+	ringQ := decryptor.ringQ
+	id := sk.ID
+	level := ct.Level()
+
+	c, in := ct.Value[id]
+	if !in {
+		panic("Cannot GenReencryptionShare: ciphertext does not contain the component of given secretkey")
+	}
+
+	share = new(ReencryptionShare)
+	share.ID = id
+	share.Recipient = pk.ID
+	share.Value[0] = ringQ.NewPolyLvl(level)
+	share.Value[1] = ringQ.NewPolyLvl(level)
+
+	// (u * pk_0, u * pk_1)
+	decryptor.ternarySampler.ReadLvl(level, decryptor.pool)
+	ringQ.NTTLvl(level, decryptor.pool, decryptor.pool)
+	ringQ.MFormLvl(level, decryptor.pool, decryptor.pool)
+	ringQ.MulCoeffsMontgomeryLvl(level, decryptor.pool, pk.Value[0].Q, share.Value[0])
+	ringQ.MulCoeffsMontgomeryLvl(level, decryptor.pool, pk.Value[1].Q, share.Value[1])
+	ringQ.InvNTTLvl(level, share.Value[0], share.Value[0])
+	ringQ.InvNTTLvl(level, share.Value[1], share.Value[1])
+
+	// the first component is flooded with smudging noise to hide c_i * s_i
+	decryptor.smudgingSampler.ReadAndAddLvl(level, share.Value[0])
+	decryptor.gaussianSampler.ReadAndAddLvl(level, share.Value[1])
+
+	if c.IsNTT {
+		ringQ.NTTLvl(level, share.Value[0], share.Value[0])
+		ringQ.NTTLvl(level, share.Value[1], share.Value[1])
+	}
+	share.Value[0].IsNTT = c.IsNTT
+	share.Value[1].IsNTT = c.IsNTT
+
+	decryptor.mulSecret(level, c, sk, decryptor.pool)
+	ringQ.AddLvl(level, share.Value[0], decryptor.pool, share.Value[0])
+
+	return share
+}
+
+// MergeReencryptionShares adds the re-encryption shares of every party engaged in ct and returns the result
+// as a ciphertext at the level and domain of ct, encrypted under the public key of the recipient of the shares only.
+// It returns an error if a share is missing, duplicated, foreign to ct, not in the same domain as ct
+// or if the shares do not have the same recipient.
+func (decryptor *Decryptor) MergeReencryptionShares(ct *Ciphertext, shares []*ReencryptionShare) (ctOut *Ciphertext, err error) {
+	ringQ := decryptor.ringQ
+	level := ct.Level()
+
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("cannot MergeReencryptionShares: there is no share")
+	}
+
+	recipient := shares[0].Recipient
+	idset := ct.IDSet()
+	merged := NewIDSet()
+
+	for _, share := range shares {
+		if share.Recipient != recipient {
+			return nil, fmt.Errorf("cannot MergeReencryptionShares: shares for recipients %s and %s", recipient, share.Recipient)
+		}
+
+		if !idset.Has(share.ID) {
+			return nil, fmt.Errorf("cannot MergeReencryptionShares: ciphertext has no component for %s", share.ID)
+		}
+
+		if merged.Has(share.ID) {
+			return nil, fmt.Errorf("cannot MergeReencryptionShares: duplicated share for %s", share.ID)
+		}
+
+		if share.Value[0].Level() < level || share.Value[1].Level() < level {
+			return nil, fmt.Errorf("cannot MergeReencryptionShares: share of %s has a lower level than the ciphertext", share.ID)
+		}
+
+		if share.Value[0].IsNTT != ct.Value["0"].IsNTT || share.Value[1].IsNTT != ct.Value["0"].IsNTT {
+			return nil, fmt.Errorf("cannot MergeReencryptionShares: share of %s is not in the ciphertext domain", share.ID)
+		}
+
+		merged.Add(share.ID)
+	}
+
+	if merged.Size() != idset.Size() {
+		return nil, fmt.Errorf("cannot MergeReencryptionShares: there is a missing share")
+	}
+
+	recipientSet := NewIDSet()
+	recipientSet.Add(recipient)
+
+	if ct.Value["0"].IsNTT {
+		ctOut = NewCiphertextNTT(decryptor.params, recipientSet, level)
+	} else {
+		ctOut = NewCiphertext(decryptor.params, recipientSet, level)
+	}
+
+	ring.CopyValuesLvl(level, ct.Value["0"], ctOut.Value["0"])
+	for _, share := range shares {
+		ringQ.AddLvl(level, ctOut.Value["0"], share.Value[0], ctOut.Value["0"])
+		ringQ.AddLvl(level, ctOut.Value[recipient], share.Value[1], ctOut.Value[recipient])
+	}
+
+	return ctOut, nil
+}
+
+// checkExitShare returns an error if share cannot replace the component of its party in ct.
+func checkExitShare(ct *Ciphertext, share *ReencryptionShare) error {
+	level := ct.Level()
+	isNTT := ct.Value["0"].IsNTT
+
+	switch {
+	case share.Recipient == share.ID:
+		return fmt.Errorf("share of %s is for itself", share.ID)
+	case ValidateID(share.Recipient) != nil:
+		return fmt.Errorf("share of %s is for invalid recipient %q", share.ID, share.Recipient)
+	case !ct.IDSet().Has(share.ID):
+		return fmt.Errorf("ciphertext has no component for %s", share.ID)
+	case share.Value[0].Level() < level || share.Value[1].Level() < level:
+		return fmt.Errorf("share of %s has a lower level than the ciphertext", share.ID)
+	case share.Value[0].IsNTT != isNTT || share.Value[1].IsNTT != isNTT:
+		return fmt.Errorf("share of %s is not in the ciphertext domain", share.ID)
+	}
+
+	return nil
+}
+
+// MergeExitShare removes in place the component of the party of share from ct, which is re-encrypted by the share
+// towards the public key of its recipient: the first value of the share is added to the component of 1
+// and the second one to the component of the recipient, which is added to ct if it is missing.
+// The other components of ct are not modified, so that a party can leave a computation without the cooperation
+// of the others. Returns an error if ct has no component for the party of share, if the share is for the party itself,
+// at a lower level than ct or not in its domain.
+func (decryptor *Decryptor) MergeExitShare(ct *Ciphertext, share *ReencryptionShare) error {
+	if err := checkExitShare(ct, share); err != nil {
+		return fmt.Errorf("cannot MergeExitShare: %w", err)
+	}
+
+	ringQ := decryptor.ringQ
+	level := ct.Level()
+
+	recipient := NewIDSet()
+	recipient.Add(share.Recipient)
+	ct.PadCiphertext(recipient)
+
+	ringQ.AddLvl(level, ct.Value["0"], share.Value[0], ct.Value["0"])
+	ringQ.AddLvl(level, ct.Value[share.Recipient], share.Value[1], ct.Value[share.Recipient])
+	delete(ct.Value, share.ID)
+
+	return nil
+}
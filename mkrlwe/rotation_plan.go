@@ -0,0 +1,234 @@
+package mkrlwe
+
+import (
+	"sort"
+)
+
+// RotationPlanner records the rotations evaluated by a circuit and plans the rotation keys
+// the parties have to generate for them.
+type RotationPlanner struct {
+	params Parameters
+	counts map[int]int
+}
+
+// RotationPlan is the set of rotation keys generated by every party for a circuit,
+// together with the key-switchings each rotation of the circuit is evaluated with.
+type RotationPlan struct {
+	// RotIdxs are the indexes of the rotation keys generated by each party, in increasing order
+	RotIdxs []int
+
+	// NewCRS are the indexes of RotIdxs which have no CRS in the parameters given to the planner
+	NewCRS []int
+
+	// Decompositions maps each rotation of the circuit to the rotations by RotIdxs it is evaluated with,
+	// each of them costing one key-switching
+	Decompositions map[int][]int
+
+	counts map[int]int
+	slots  int
+}
+
+// NewRotationPlanner returns a RotationPlanner with no recorded rotation
+func NewRotationPlanner(params Parameters) *RotationPlanner {
+	return &RotationPlanner{params: params, counts: make(map[int]int)}
+}
+
+// AddRotations records one evaluation of each of the given rotations
+func (planner *RotationPlanner) AddRotations(rotidxs ...int) {
+	for _, rotidx := range rotidxs {
+		planner.AddRotation(rotidx, 1)
+	}
+}
+
+// AddRotation records count evaluations of the rotation by rotidx.
+// The rotations by a multiple of N/2 are ignored.
+func (planner *RotationPlanner) AddRotation(rotidx, count int) {
+	if rotidx = planner.params.NormalizeRotation(rotidx); rotidx != 0 && count > 0 {
+		planner.counts[rotidx] += count
+	}
+}
+
+// Plan returns the plan with the fewest key-switchings holding at most maxKeys rotation keys per party.
+// If maxKeys < 1 or if there are at most maxKeys distinct rotations, each rotation gets its own key.
+// Otherwise the rotations are decomposed in their non-adjacent form, whose signed powers of two get a key,
+// and the rotations saving the most key-switchings are given their own key as long as the budget allows it.
+// The plan holds more than maxKeys keys only if the signed powers of two needed by the rotations do not fit in it.
+// The rotations which already have a CRS in the parameters always get their own key, as they are never decomposed.
+func (planner *RotationPlanner) Plan(maxKeys int) (plan *RotationPlan) {
+
+	params := planner.params
+
+	rotidxs := make([]int, 0, len(planner.counts))
+	for rotidx := range planner.counts {
+		rotidxs = append(rotidxs, rotidx)
+	}
+	sort.Ints(rotidxs)
+
+	direct := make(map[int]bool)
+	for _, rotidx := range rotidxs {
+		if _, in := params.CRS[rotidx]; in || maxKeys < 1 || len(rotidxs) <= maxKeys {
+			direct[rotidx] = true
+		}
+	}
+
+	// keys returns the key indexes needed when the rotations of direct are not decomposed
+	keys := func(direct map[int]bool) (keys map[int]bool) {
+		keys = make(map[int]bool)
+		for _, rotidx := range rotidxs {
+			if direct[rotidx] {
+				keys[rotidx] = true
+				continue
+			}
+			for _, digit := range params.nafRotations(rotidx) {
+				keys[digit] = true
+			}
+		}
+		return
+	}
+
+	// the rotations saving the most key-switchings are given their own key first
+	candidates := make([]int, 0, len(rotidxs))
+	for _, rotidx := range rotidxs {
+		if !direct[rotidx] {
+			candidates = append(candidates, rotidx)
+		}
+	}
+
+	saving := func(rotidx int) int {
+		return planner.counts[rotidx] * (len(params.nafRotations(rotidx)) - 1)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return saving(candidates[i]) > saving(candidates[j])
+	})
+
+	for _, rotidx := range candidates {
+		if saving(rotidx) == 0 {
+			break
+		}
+
+		direct[rotidx] = true
+		if len(keys(direct)) > maxKeys {
+			delete(direct, rotidx)
+		}
+	}
+
+	plan = &RotationPlan{Decompositions: make(map[int][]int), counts: make(map[int]int), slots: params.N() >> 1}
+
+	for rotidx := range keys(direct) {
+		plan.RotIdxs = append(plan.RotIdxs, rotidx)
+		if _, in := params.CRS[rotidx]; !in {
+			plan.NewCRS = append(plan.NewCRS, rotidx)
+		}
+	}
+	sort.Ints(plan.RotIdxs)
+	sort.Ints(plan.NewCRS)
+
+	// the decompositions are those the evaluators will use once the CRS of the plan are added
+	crs := make(map[int]bool)
+	for _, rotidx := range plan.RotIdxs {
+		crs[rotidx] = true
+	}
+
+	for _, rotidx := range rotidxs {
+		if crs[rotidx] {
+			plan.Decompositions[rotidx] = []int{rotidx}
+		} else {
+			plan.Decompositions[rotidx] = params.nafRotations(rotidx)
+		}
+		plan.counts[rotidx] = planner.counts[rotidx]
+	}
+
+	return
+}
+
+// AddCRS adds to the parameters the CRS of the rotation keys of the plan which are missing
+func (plan *RotationPlan) AddCRS(params *Parameters) {
+	for _, rotidx := range plan.RotIdxs {
+		if _, in := params.CRS[rotidx]; !in {
+			params.AddCRS(rotidx)
+		}
+	}
+}
+
+// KeySwitches returns the number of key-switchings of the rotation by rotidx under the plan.
+// It returns 0 for a rotation by a multiple of N/2 and -1 for a rotation which was not planned.
+func (plan *RotationPlan) KeySwitches(rotidx int) int {
+	if rotidx = ((rotidx % plan.slots) + plan.slots) % plan.slots; rotidx == 0 {
+		return 0
+	}
+
+	if decomposition, in := plan.Decompositions[rotidx]; in {
+		return len(decomposition)
+	}
+
+	return -1
+}
+
+// TotalKeySwitches returns the number of key-switchings of all the rotations recorded by the planner.
+func (plan *RotationPlan) TotalKeySwitches() (total int) {
+	for rotidx, count := range plan.counts {
+		total += count * len(plan.Decompositions[rotidx])
+	}
+	return
+}
+
+// GenRotationKeysFromPlan generates the rotation keys of the plan under sk and adds them to rtkSet.
+// The CRS of the plan must have been added to the parameters of the key generator.
+func (keygen *KeyGenerator) GenRotationKeysFromPlan(plan *RotationPlan, sk *SecretKey, rtkSet *RotationKeySet) {
+	for _, rotidx := range plan.RotIdxs {
+		rtkSet.AddRotationKey(keygen.GenRotationKey(rotidx, sk))
+	}
+}
+
+// RotationDecomposition returns the rotations, each of them costing one key-switching, whose composition is the
+// rotation by rotidx. A rotation with a CRS is not decomposed. Otherwise the rotation is decomposed in its
+// non-adjacent form if all its signed powers of two have a CRS, and in powers of two else.
+// The decomposition of a rotation by a multiple of N/2 is empty.
+func (params Parameters) RotationDecomposition(rotidx int) (rotidxs []int) {
+
+	if rotidx = params.NormalizeRotation(rotidx); rotidx == 0 {
+		return []int{}
+	}
+
+	if _, in := params.CRS[rotidx]; in {
+		return []int{rotidx}
+	}
+
+	rotidxs = params.nafRotations(rotidx)
+	for _, digit := range rotidxs {
+		if _, in := params.CRS[digit]; !in {
+			rotidxs = rotidxs[:0]
+			for k := 1; rotidx > 0; k, rotidx = k<<1, rotidx>>1 {
+				if rotidx&1 == 1 {
+					rotidxs = append(rotidxs, k)
+				}
+			}
+			return
+		}
+	}
+
+	return
+}
+
+// NormalizeRotation returns the rotation index equivalent to rotidx in [0, N/2)
+func (params Parameters) NormalizeRotation(rotidx int) int {
+	slots := params.N() >> 1
+	return ((rotidx % slots) + slots) % slots
+}
+
+// nafRotations returns the signed powers of two of the non-adjacent form of rotidx, normalized in [0, N/2).
+// The digit N/2, which may end the non-adjacent form of rotidx in [0, N/2), is dropped.
+func (params Parameters) nafRotations(rotidx int) (rotidxs []int) {
+	rotidx = params.NormalizeRotation(rotidx)
+	for k := 1; rotidx != 0; k, rotidx = k<<1, rotidx>>1 {
+		if rotidx&1 == 1 {
+			digit := 2 - rotidx&3
+			rotidx -= digit
+			if digit = params.NormalizeRotation(digit * k); digit != 0 {
+				rotidxs = append(rotidxs, digit)
+			}
+		}
+	}
+	return
+}
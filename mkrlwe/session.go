@@ -0,0 +1,274 @@
+package mkrlwe
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// MembershipEventKind is the kind of a transition of the membership of a Session.
+type MembershipEventKind int
+
+const (
+	// PartyJoined is the kind of the event of a party registering its evaluation keys.
+	PartyJoined MembershipEventKind = iota
+	// PartyLeft is the kind of the event of a party whose components were handed over to a remaining party.
+	PartyLeft
+)
+
+// String returns the name of the kind of event
+func (kind MembershipEventKind) String() string {
+	switch kind {
+	case PartyJoined:
+		return "join"
+	case PartyLeft:
+		return "leave"
+	}
+	return fmt.Sprintf("MembershipEventKind(%d)", int(kind))
+}
+
+// MembershipEvent is the record of a transition of the membership of a Session.
+// Epoch is the epoch started by the event, and for a leave, Recipient is the remaining party
+// the components of the leaving party were re-encrypted to.
+type MembershipEvent struct {
+	Epoch     int
+	Kind      MembershipEventKind
+	ID        string
+	Recipient string
+}
+
+// Session tracks the parties of a multi-key computation across joins and leaves.
+// Each transition starts a new epoch with its own set of active parties and is recorded in the log of the session.
+// The session holds the evaluation keys of the active parties and the ciphertexts stored by name,
+// such as the model of a training loop, which hold a component for every active party:
+// they are padded when a party joins, and the component of a leaving party is re-encrypted towards a remaining party.
+// A session should not be used concurrently.
+type Session struct {
+	params    Parameters
+	decryptor *Decryptor
+
+	keys        *EvaluationKeySet
+	epochs      []*IDSet
+	events      []MembershipEvent
+	ciphertexts map[string]*Ciphertext
+}
+
+// NewSession returns a new session at epoch 0 without any party
+func NewSession(params Parameters) *Session {
+	s := new(Session)
+	s.params = params
+	s.decryptor = NewDecryptor(params)
+	s.keys = NewEvaluationKeySet(params)
+	s.epochs = []*IDSet{NewIDSet()}
+	s.ciphertexts = make(map[string]*Ciphertext)
+	return s
+}
+
+// Epoch returns the current epoch of the session
+func (s *Session) Epoch() int {
+	return len(s.epochs) - 1
+}
+
+// IDSet returns the IDs of the active parties of the session
+func (s *Session) IDSet() *IDSet {
+	return s.epochs[s.Epoch()].CopyNew()
+}
+
+// IDSetAt returns the IDs of the active parties of the session at given epoch.
+// Returns an error if the session has not reached the epoch.
+func (s *Session) IDSetAt(epoch int) (*IDSet, error) {
+	if epoch < 0 || epoch > s.Epoch() {
+		return nil, fmt.Errorf("cannot IDSetAt: epoch %d is not in [0, %d]", epoch, s.Epoch())
+	}
+	return s.epochs[epoch].CopyNew(), nil
+}
+
+// Events returns the log of the transitions of the session in order
+func (s *Session) Events() []MembershipEvent {
+	return slices.Clone(s.events)
+}
+
+// EvaluationKeys returns the evaluation keys of the active parties.
+// The keys of a party are added by Join and removed by Leave.
+func (s *Session) EvaluationKeys() *EvaluationKeySet {
+	return s.keys
+}
+
+// SetSmudgingSigma sets the standard deviation of the noise flooding the exit shares computed by GenExitShares,
+// which is DefaultSmudgingSigma for a new session. See Decryptor.SetSmudgingSigma.
+func (s *Session) SetSmudgingSigma(sigma float64) {
+	s.decryptor.SetSmudgingSigma(sigma)
+}
+
+// SetSmudgingLogBound sets the noise flooding the exit shares so that it is bounded by 2^logBound in absolute value
+func (s *Session) SetSmudgingLogBound(logBound int) {
+	s.decryptor.SetSmudgingLogBound(logBound)
+}
+
+// SmudgingSigma returns the standard deviation of the noise flooding the exit shares
+func (s *Session) SmudgingSigma() float64 {
+	return s.decryptor.SmudgingSigma()
+}
+
+// Store stores ct under name, replacing the previous ciphertext of that name, and pads it with the active parties.
+// The ciphertext is not copied, so that it is updated in place by the transitions of the session.
+// Returns an error if ct has a component for a party that is not active.
+func (s *Session) Store(name string, ct *Ciphertext) error {
+	active := s.epochs[s.Epoch()]
+
+	for id := range ct.Value {
+		if id != "0" && !active.Has(id) {
+			return fmt.Errorf("cannot Store: %s is not an active party", id)
+		}
+	}
+
+	ct.PadCiphertext(active)
+	s.ciphertexts[name] = ct
+
+	return nil
+}
+
+// Ciphertext returns the ciphertext stored under name, or nil if there is none
+func (s *Session) Ciphertext(name string) *Ciphertext {
+	return s.ciphertexts[name]
+}
+
+// Names returns the names of the stored ciphertexts in increasing order
+func (s *Session) Names() []string {
+	return slices.Sorted(maps.Keys(s.ciphertexts))
+}
+
+// Delete removes the ciphertext stored under name from the session
+func (s *Session) Delete(name string) {
+	delete(s.ciphertexts, name)
+}
+
+// Join registers the evaluation keys of bundle mid-session, pads the stored ciphertexts with a component
+// for its party and starts a new epoch.
+// Returns an error if the ID of bundle is invalid or active, if it has no public key, which the remaining parties
+// need to take over the components of a leaving party, or if it cannot be added to the evaluation keys.
+func (s *Session) Join(bundle *EvaluationKeyBundle) error {
+
+	if err := ValidateID(bundle.ID); err != nil {
+		return fmt.Errorf("cannot Join: %w", err)
+	}
+
+	if s.epochs[s.Epoch()].Has(bundle.ID) {
+		return fmt.Errorf("cannot Join: %s is already an active party", bundle.ID)
+	}
+
+	if bundle.PublicKey == nil {
+		return fmt.Errorf("cannot Join: bundle of %s has no public key", bundle.ID)
+	}
+
+	if err := s.keys.AddBundle(bundle); err != nil {
+		return fmt.Errorf("cannot Join: %w", err)
+	}
+
+	active := s.epochs[s.Epoch()].CopyNew()
+	active.Add(bundle.ID)
+
+	for _, ct := range s.ciphertexts {
+		ct.PadCiphertext(active)
+	}
+
+	s.newEpoch(active, MembershipEvent{Kind: PartyJoined, ID: bundle.ID})
+
+	return nil
+}
+
+// GenExitShares computes the re-encryption shares of the stored ciphertexts of the owner of sk towards
+// the public key of the active party recipient, which are merged by Leave. They are indexed by the names of the ciphertexts.
+// Returns an error if the owner of sk or recipient is not an active party, or if they are the same party.
+func (s *Session) GenExitShares(sk *SecretKey, recipient string) (shares map[string]*ReencryptionShare, err error) {
+
+	pk, err := s.checkLeave(sk.ID, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("cannot GenExitShares: %w", err)
+	}
+
+	shares = make(map[string]*ReencryptionShare)
+	for name, ct := range s.ciphertexts {
+		if _, in := ct.Value[sk.ID]; in {
+			shares[name] = s.decryptor.GenReencryptionShare(ct, sk, pk)
+		}
+	}
+
+	return shares, nil
+}
+
+// Leave removes the party id from the session and starts a new epoch.
+// The component of id in every stored ciphertext is re-encrypted towards the active party recipient
+// by merging the share of the ciphertext computed by id with GenExitShares, so that the remaining parties
+// can keep computing on the stored ciphertexts and decrypt them without id.
+// The evaluation keys of id are removed from the session.
+// Returns an error if id or recipient is not an active party, if they are the same party,
+// or if a share is missing or does not match its ciphertext, in which case the session is not modified.
+func (s *Session) Leave(id, recipient string, shares map[string]*ReencryptionShare) error {
+
+	if _, err := s.checkLeave(id, recipient); err != nil {
+		return fmt.Errorf("cannot Leave: %w", err)
+	}
+
+	for name, ct := range s.ciphertexts {
+		if _, in := ct.Value[id]; !in {
+			continue
+		}
+
+		share, in := shares[name]
+		switch {
+		case !in:
+			return fmt.Errorf("cannot Leave: there is no share for ciphertext %s", name)
+		case share.ID != id || share.Recipient != recipient:
+			return fmt.Errorf("cannot Leave: share for ciphertext %s is of %s for recipient %s", name, share.ID, share.Recipient)
+		}
+
+		if err := checkExitShare(ct, share); err != nil {
+			return fmt.Errorf("cannot Leave: ciphertext %s: %w", name, err)
+		}
+	}
+
+	for name, ct := range s.ciphertexts {
+		if _, in := ct.Value[id]; in {
+			if err := s.decryptor.MergeExitShare(ct, shares[name]); err != nil {
+				panic(err) // shares were checked above
+			}
+		}
+	}
+
+	s.keys.PublicKeySet.DelPublicKey(id)
+	s.keys.RelinearizationKeySet.DelRelinearizationKey(id)
+	s.keys.RotationKeySet.DelRotationKeys(id)
+	s.keys.ConjugationKeySet.DelConjugationKey(id)
+
+	active := s.epochs[s.Epoch()].CopyNew()
+	active.Remove(id)
+
+	s.newEpoch(active, MembershipEvent{Kind: PartyLeft, ID: id, Recipient: recipient})
+
+	return nil
+}
+
+// checkLeave returns the public key of recipient, or an error if id or recipient is not an active party
+// or if they are the same party.
+func (s *Session) checkLeave(id, recipient string) (*PublicKey, error) {
+	active := s.epochs[s.Epoch()]
+
+	switch {
+	case !active.Has(id):
+		return nil, fmt.Errorf("%s is not an active party", id)
+	case !active.Has(recipient):
+		return nil, fmt.Errorf("recipient %s is not an active party", recipient)
+	case id == recipient:
+		return nil, fmt.Errorf("%s cannot be its own recipient", id)
+	}
+
+	return s.keys.PublicKeySet.GetPublicKey(recipient), nil
+}
+
+// newEpoch starts a new epoch with given active parties and records event as its transition
+func (s *Session) newEpoch(active *IDSet, event MembershipEvent) {
+	s.epochs = append(s.epochs, active)
+	event.Epoch = s.Epoch()
+	s.events = append(s.events, event)
+}
@@ -0,0 +1,811 @@
+package mkrlwe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"slices"
+)
+
+// The WriteTo and ReadFrom methods stream the same envelopes as MarshalBinary and UnmarshalBinary.
+// Key sets are written one key at a time, so that the memory used never exceeds the size of their largest key.
+// ReadFrom buffers the payload to verify its checksum before decoding it, and a RotationKeyStore
+// indexes a RotationKeySet without buffering it.
+
+// countingWriter counts and hashes the bytes written to w.
+type countingWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	n    int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.hash.Write(p[:n])
+	cw.n += int64(n)
+	return
+}
+
+// countingReader counts and hashes the bytes read from r and records the errors of r.
+type countingReader struct {
+	r     io.Reader
+	hash  hash.Hash
+	n     int64
+	ioErr error
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.hash.Write(p[:n])
+	cr.n += int64(n)
+	if err != nil && err != io.EOF {
+		cr.ioErr = err
+	}
+	return
+}
+
+// WriteEnvelope writes to w an envelope of given kind and parameter hash for a payload of payloadLen bytes,
+// whose payload is written by encode. It returns the number of bytes written.
+func WriteEnvelope(w io.Writer, kind ObjectKind, paramHash [32]byte, payloadLen int, encode func(w io.Writer) error) (n int64, err error) {
+
+	cw := &countingWriter{w: w, hash: sha256.New()}
+
+	header := make([]byte, EnvelopeHeaderSize)
+	copy(header[:4], envelopeMagic[:])
+	header[4] = EnvelopeVersion
+	header[5] = uint8(kind)
+	copy(header[6:38], paramHash[:])
+	binary.BigEndian.PutUint64(header[38:46], uint64(payloadLen))
+
+	if _, err = cw.Write(header); err != nil {
+		return cw.n, err
+	}
+
+	if err = encode(cw); err != nil {
+		return cw.n, err
+	}
+
+	if cw.n != int64(EnvelopeHeaderSize+payloadLen) {
+		return cw.n, fmt.Errorf("cannot WriteTo: %s payload is %d bytes instead of %d", kind, cw.n-EnvelopeHeaderSize, payloadLen)
+	}
+
+	var m int
+	m, err = w.Write(cw.hash.Sum(nil))
+
+	return cw.n + int64(m), err
+}
+
+// ReadEnvelope reads from r an envelope of given kind and calls decode on its header and on a reader of its payload.
+// It reads exactly the bytes of the envelope and returns its header and their number.
+// The payload is buffered and its checksum is verified before decode is called, as by UnmarshalEnvelope.
+// Decoding errors are returned as a *DecodingError, while the errors of r other than a premature end
+// of the stream are wrapped as they are.
+func ReadEnvelope(r io.Reader, kind ObjectKind, decode func(hdr EnvelopeHeader, payload io.Reader) error) (hdr EnvelopeHeader, n int64, err error) {
+
+	var data []byte
+
+	hdr, n, err = readEnvelope(r, kind, func(payload io.Reader) (err error) {
+		data, err = io.ReadAll(payload)
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	payload := &io.LimitedReader{R: bytes.NewReader(data), N: int64(len(data))}
+
+	if err = decode(hdr, payload); err != nil {
+		return hdr, n, asDecodingError(kind, err)
+	}
+
+	if payload.N != 0 {
+		return hdr, n, &DecodingError{Kind: kind, Err: ErrMalformed, Msg: "remaining unparsed data"}
+	}
+
+	return hdr, n, nil
+}
+
+// readEnvelope reads from r an envelope of given kind, calls read on a reader of its payload and verifies
+// the checksum of the envelope once read has consumed the payload.
+func readEnvelope(r io.Reader, kind ObjectKind, read func(payload io.Reader) error) (hdr EnvelopeHeader, n int64, err error) {
+
+	cr := &countingReader{r: r, hash: sha256.New()}
+
+	defer func() {
+		n = cr.n
+
+		if cr.ioErr != nil {
+			err = fmt.Errorf("cannot ReadFrom: %w", cr.ioErr)
+			return
+		}
+
+		err = asDecodingError(kind, err)
+	}()
+
+	header := make([]byte, EnvelopeHeaderSize)
+	if err = readFull(cr, header, "missing envelope header"); err != nil {
+		return
+	}
+
+	if hdr, err = ReadEnvelopeHeader(header); err != nil {
+		return
+	}
+
+	if hdr.Kind != kind {
+		return hdr, 0, &DecodingError{Kind: kind, Err: ErrKindMismatch, Msg: fmt.Sprintf("got %s", hdr.Kind)}
+	}
+
+	if hdr.PayloadLen > 1<<62 {
+		return hdr, 0, &DecodingError{Kind: kind, Err: ErrMalformed, Msg: "invalid payload length"}
+	}
+
+	payload := &io.LimitedReader{R: cr, N: int64(hdr.PayloadLen)}
+
+	if err = read(payload); err != nil {
+		return
+	}
+
+	if payload.N != 0 {
+		return hdr, 0, errTruncated("payload")
+	}
+
+	checksum := cr.hash.Sum(nil)
+	received := make([]byte, sha256.Size)
+
+	if err = readFull(cr, received, "missing checksum"); err != nil {
+		return
+	}
+
+	if !bytes.Equal(checksum, received) {
+		return hdr, 0, &DecodingError{Kind: kind, Err: ErrChecksum}
+	}
+
+	return hdr, 0, nil
+}
+
+// writeBuffered returns a function writing a payload of payloadLen bytes encoded by encode in a buffer.
+func writeBuffered(payloadLen int, encode func(data []byte) error) func(w io.Writer) error {
+	return func(w io.Writer) (err error) {
+		data := make([]byte, payloadLen)
+		if err = encode(data); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+}
+
+// readBuffered returns a function reading a whole payload in a buffer and decoding it with decode.
+func readBuffered(decode func(data []byte) error) func(hdr EnvelopeHeader, payload io.Reader) error {
+	return func(hdr EnvelopeHeader, payload io.Reader) error {
+		data, err := io.ReadAll(payload)
+		if err != nil {
+			return err
+		}
+		return decode(data)
+	}
+}
+
+// readFull reads exactly len(buf) bytes from r. A premature end of r is reported as ErrTruncated.
+func readFull(r io.Reader, buf []byte, what string) error {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncated(what)
+		}
+		return err
+	}
+	return nil
+}
+
+// appendFull appends n bytes read from r to buf.
+// If r is a payload, n is checked against its remaining bytes before allocating.
+func appendFull(r io.Reader, buf []byte, n int, what string) ([]byte, error) {
+	if lr, ok := r.(*io.LimitedReader); ok && int64(n) > lr.N {
+		return buf, errTruncated(what)
+	}
+	start := len(buf)
+	buf = append(buf, make([]byte, n)...)
+	return buf, readFull(r, buf[start:], what)
+}
+
+// appendRawID appends to buf an ID written by encodeID read from r.
+func appendRawID(r io.Reader, buf []byte) ([]byte, error) {
+
+	var err error
+	var idLen uint64
+
+	// the length is read one byte at a time to not read past the varint
+	for shift := 0; ; shift += 7 {
+		if buf, err = appendFull(r, buf, 1, "id"); err != nil {
+			return buf, err
+		}
+
+		b := buf[len(buf)-1]
+		idLen |= uint64(b&0x7f) << shift
+
+		if idLen > MaxIDLength {
+			return buf, errMalformed("invalid id length")
+		}
+
+		if b < 0x80 {
+			break
+		}
+	}
+
+	return appendFull(r, buf, int(idLen), "id")
+}
+
+// appendRawPoly appends to buf a polynomial written by ring.Poly.WriteTo read from r.
+func appendRawPoly(r io.Reader, buf []byte) ([]byte, error) {
+
+	var err error
+
+	start := len(buf)
+	if buf, err = appendFull(r, buf, 4, "polynomial header"); err != nil {
+		return buf, err
+	}
+
+	logN, numModuli := int(buf[start]), int(buf[start+1])
+
+	if logN > maxPolyLogN || numModuli == 0 {
+		return buf, errMalformed("invalid polynomial header")
+	}
+
+	return appendFull(r, buf, numModuli<<(logN+3), "polynomial coefficients")
+}
+
+// appendRawSwitchingKey appends to buf a SwitchingKey written by SwitchingKey.encode read from r.
+func appendRawSwitchingKey(r io.Reader, buf []byte) ([]byte, error) {
+
+	var err error
+
+	if buf, err = appendFull(r, buf, 1, "switching key"); err != nil {
+		return buf, err
+	}
+
+	decomposition := int(buf[len(buf)-1])
+
+	for j := 0; j < 2*decomposition; j++ {
+		if buf, err = appendRawPoly(r, buf); err != nil {
+			return buf, err
+		}
+	}
+
+	return buf, nil
+}
+
+// readRawRotationKey reads a RotationKey written by RotationKey.encode from r.
+func readRawRotationKey(r io.Reader) (data []byte, err error) {
+
+	if data, err = appendRawID(r, nil); err != nil {
+		return
+	}
+
+	if data, err = appendFull(r, data, 8, "rotation index"); err != nil {
+		return
+	}
+
+	return appendRawSwitchingKey(r, data)
+}
+
+// readRawConjugationKey reads a ConjugationKey written by ConjugationKey.encode from r.
+func readRawConjugationKey(r io.Reader) (data []byte, err error) {
+
+	if data, err = appendRawID(r, nil); err != nil {
+		return
+	}
+
+	return appendRawSwitchingKey(r, data)
+}
+
+// readRawLengthPrefixed reads a slice prefixed by its length on 8 bytes from r.
+// The length is bounded by the remaining bytes of the payload.
+func readRawLengthPrefixed(r *io.LimitedReader, what string) (data []byte, err error) {
+
+	lenData := make([]byte, 8)
+	if err = readFull(r, lenData, what); err != nil {
+		return
+	}
+
+	dataLen := binary.BigEndian.Uint64(lenData)
+	if dataLen > uint64(r.N) {
+		return nil, errTruncated(what)
+	}
+
+	return appendFull(r, nil, int(dataLen), what)
+}
+
+// atEnd returns true if the payload r has been entirely read.
+func atEnd(r *io.LimitedReader) bool {
+	return r.N == 0
+}
+
+// WriteTo writes the target SecretKey to w.
+func (sk *SecretKey) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := sk.GetDataLen(true) + len(sk.ID)
+	return WriteEnvelope(w, KindSecretKey, noParamHash, payloadLen, writeBuffered(payloadLen, sk.encode))
+}
+
+// ReadFrom reads a SecretKey written by WriteTo or MarshalBinary from r in the target SecretKey.
+func (sk *SecretKey) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindSecretKey, readBuffered(sk.decode))
+	return
+}
+
+// WriteTo writes the target PublicKey to w.
+func (pk *PublicKey) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := pk.GetDataLen(true) + len(pk.ID)
+	return WriteEnvelope(w, KindPublicKey, noParamHash, payloadLen, writeBuffered(payloadLen, pk.encode))
+}
+
+// ReadFrom reads a PublicKey written by WriteTo or MarshalBinary from r in the target PublicKey.
+func (pk *PublicKey) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindPublicKey, readBuffered(pk.decode))
+	return
+}
+
+// WriteTo writes the target SwitchingKey to w.
+func (swk *SwitchingKey) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := swk.GetDataLen(true)
+	return WriteEnvelope(w, KindSwitchingKey, noParamHash, payloadLen, writeBuffered(payloadLen, func(payload []byte) (err error) {
+		_, err = swk.encode(0, payload)
+		return
+	}))
+}
+
+// ReadFrom reads a SwitchingKey written by WriteTo or MarshalBinary from r in the target SwitchingKey.
+func (swk *SwitchingKey) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindSwitchingKey, readBuffered(func(payload []byte) (err error) {
+		var pointer int
+		if pointer, err = swk.decode(payload); err == nil && pointer != len(payload) {
+			err = errMalformed("remaining unparsed data")
+		}
+		return
+	}))
+	return
+}
+
+// WriteTo writes the target RelinearizationKey to w.
+func (rlk *RelinearizationKey) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := rlk.GetDataLen(true) + len(rlk.ID)
+	return WriteEnvelope(w, KindRelinearizationKey, noParamHash, payloadLen, writeBuffered(payloadLen, rlk.encode))
+}
+
+// ReadFrom reads a RelinearizationKey written by WriteTo or MarshalBinary from r in the target RelinearizationKey.
+func (rlk *RelinearizationKey) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindRelinearizationKey, readBuffered(rlk.decode))
+	return
+}
+
+// WriteTo writes the target PartySwitchingKey to w.
+func (swk *PartySwitchingKey) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := swk.GetDataLen(true) + len(swk.ID)
+	return WriteEnvelope(w, KindPartySwitchingKey, noParamHash, payloadLen, writeBuffered(payloadLen, swk.encode))
+}
+
+// ReadFrom reads a PartySwitchingKey written by WriteTo or MarshalBinary from r in the target PartySwitchingKey.
+func (swk *PartySwitchingKey) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindPartySwitchingKey, readBuffered(swk.decode))
+	return
+}
+
+// WriteTo writes the target ConjugationKey to w.
+func (cjk *ConjugationKey) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := cjk.GetDataLen(true)
+	return WriteEnvelope(w, KindConjugationKey, noParamHash, payloadLen, writeBuffered(payloadLen, func(payload []byte) (err error) {
+		_, err = cjk.encode(0, payload)
+		return
+	}))
+}
+
+// ReadFrom reads a ConjugationKey written by WriteTo or MarshalBinary from r in the target ConjugationKey.
+func (cjk *ConjugationKey) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindConjugationKey, readBuffered(func(payload []byte) (err error) {
+		var pointer int
+		if pointer, err = cjk.decode(payload); err == nil && pointer != len(payload) {
+			err = errMalformed("remaining unparsed data")
+		}
+		return
+	}))
+	return
+}
+
+// WriteTo writes the target DecryptionShare to w.
+func (share *DecryptionShare) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := share.GetDataLen(true) + len(share.ID)
+	return WriteEnvelope(w, KindDecryptionShare, noParamHash, payloadLen, writeBuffered(payloadLen, share.encode))
+}
+
+// ReadFrom reads a DecryptionShare written by WriteTo or MarshalBinary from r in the target DecryptionShare.
+func (share *DecryptionShare) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindDecryptionShare, readBuffered(share.decode))
+	return
+}
+
+// WriteTo writes the target ReencryptionShare to w.
+func (share *ReencryptionShare) WriteTo(w io.Writer) (n int64, err error) {
+	payloadLen := share.payloadLen()
+	return WriteEnvelope(w, KindReencryptionShare, noParamHash, payloadLen, writeBuffered(payloadLen, share.encode))
+}
+
+// ReadFrom reads a ReencryptionShare written by WriteTo or MarshalBinary from r in the target ReencryptionShare.
+func (share *ReencryptionShare) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindReencryptionShare, readBuffered(share.decode))
+	return
+}
+
+// WriteTo writes the target RotationKeySet to w, one rotation key at a time.
+func (rtks *RotationKeySet) WriteTo(w io.Writer) (n int64, err error) {
+	return WriteEnvelope(w, KindRotationKeySet, noParamHash, rtks.GetDataLen(true), func(w io.Writer) (err error) {
+
+		for _, ID := range slices.Sorted(maps.Keys(rtks.Value)) {
+			rtk := rtks.Value[ID]
+
+			header := make([]byte, idDataLen(ID, true)+8)
+
+			var pointer int
+			if pointer, err = encodeID(header, ID); err != nil {
+				return err
+			}
+			binary.BigEndian.PutUint64(header[pointer:], uint64(len(rtk)))
+
+			if _, err = w.Write(header); err != nil {
+				return err
+			}
+
+			for _, idx := range slices.Sorted(maps.Keys(rtk)) {
+				key := rtk[idx]
+
+				data := make([]byte, 8+key.GetDataLen(true))
+				binary.BigEndian.PutUint64(data[:8], uint64(idx))
+
+				if _, err = key.encode(8, data); err != nil {
+					return err
+				}
+
+				if _, err = w.Write(data); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// ReadFrom reads a RotationKeySet written by WriteTo or MarshalBinary from r in the target RotationKeySet.
+func (rtks *RotationKeySet) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindRotationKeySet, func(hdr EnvelopeHeader, payload io.Reader) error {
+
+		rtks.Value = make(map[string]map[uint]*RotationKey)
+
+		return scanRotationKeySet(payload.(*io.LimitedReader), func(ID string, idx uint64, offset int64, data []byte) (err error) {
+
+			rtk := new(RotationKey)
+
+			var pointer int
+			if pointer, err = rtk.decode(data); err != nil {
+				return err
+			}
+
+			if pointer != len(data) {
+				return errMalformed("remaining unparsed data")
+			}
+
+			if rtk.ID != ID || uint64(rtk.RotIdx) != idx {
+				return errMalformed("rotation key %s/%d stored under %s/%d", rtk.ID, rtk.RotIdx, ID, idx)
+			}
+
+			rtks.AddRotationKey(rtk)
+
+			return nil
+		})
+	})
+	return
+}
+
+// scanRotationKeySet reads the payload of a RotationKeySet and calls visit on every rotation key
+// with its ID, its index, its offset in the payload and its encoding.
+func scanRotationKeySet(payload *io.LimitedReader, visit func(ID string, idx uint64, offset int64, data []byte) error) (err error) {
+
+	var offset int64
+	var data []byte
+
+	for !atEnd(payload) {
+
+		if data, err = appendRawID(payload, nil); err != nil {
+			return err
+		}
+
+		var ID string
+		if ID, _, err = decodeID(data); err != nil {
+			return err
+		}
+
+		offset += int64(len(data) + 8)
+
+		if data, err = appendFull(payload, data[:0], 8, "number of rotation keys"); err != nil {
+			return err
+		}
+
+		numKeys := binary.BigEndian.Uint64(data)
+
+		for i := uint64(0); i < numKeys; i++ {
+
+			if data, err = appendFull(payload, data[:0], 8, "rotation index"); err != nil {
+				return err
+			}
+
+			idx := binary.BigEndian.Uint64(data)
+			offset += 8
+
+			if data, err = readRawRotationKey(payload); err != nil {
+				return err
+			}
+
+			if err = visit(ID, idx, offset, data); err != nil {
+				return err
+			}
+
+			offset += int64(len(data))
+		}
+	}
+
+	return nil
+}
+
+// WriteTo writes the target ConjugationKeySet to w, one conjugation key at a time.
+func (cjks *ConjugationKeySet) WriteTo(w io.Writer) (n int64, err error) {
+	return WriteEnvelope(w, KindConjugationKeySet, noParamHash, cjks.GetDataLen(true), func(w io.Writer) (err error) {
+		for _, id := range slices.Sorted(maps.Keys(cjks.Value)) {
+			cjk := cjks.Value[id]
+			if err = writeBuffered(cjk.GetDataLen(true), func(data []byte) (err error) {
+				_, err = cjk.encode(0, data)
+				return
+			})(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReadFrom reads a ConjugationKeySet written by WriteTo or MarshalBinary from r in the target ConjugationKeySet.
+func (cjks *ConjugationKeySet) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindConjugationKeySet, func(hdr EnvelopeHeader, payload io.Reader) (err error) {
+
+		cjks.Value = make(map[string]*ConjugationKey)
+
+		var data []byte
+
+		for !atEnd(payload.(*io.LimitedReader)) {
+
+			if data, err = readRawConjugationKey(payload); err != nil {
+				return err
+			}
+
+			cjk := new(ConjugationKey)
+			if _, err = cjk.decode(data); err != nil {
+				return err
+			}
+
+			cjks.Value[cjk.ID] = cjk
+		}
+
+		return nil
+	})
+	return
+}
+
+// WriteTo writes the target RelinearizationKeySet to w, one relinearization key at a time.
+func (rlkSet *RelinearizationKeySet) WriteTo(w io.Writer) (n int64, err error) {
+	return WriteEnvelope(w, KindRelinearizationKeySet, rlkSet.params.Fingerprint(), rlkSet.GetDataLen(true), func(w io.Writer) (err error) {
+		for _, id := range slices.Sorted(maps.Keys(rlkSet.Value)) {
+			rlk := rlkSet.Value[id]
+			if err = writeLengthPrefixed(w, rlk.GetDataLen(true)+len(rlk.ID), rlk.encode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReadFrom reads a RelinearizationKeySet written by WriteTo or MarshalBinary from r in the target RelinearizationKeySet.
+// The target should be created with NewRelinearizationKeyKeySet
+// with the parameters the set was written with.
+func (rlkSet *RelinearizationKeySet) ReadFrom(r io.Reader) (n int64, err error) {
+
+	if rlkSet.Value == nil {
+		return 0, errors.New("cannot ReadFrom: RelinearizationKeySet should be created with NewRelinearizationKeyKeySet")
+	}
+
+	_, n, err = ReadEnvelope(r, KindRelinearizationKeySet, func(hdr EnvelopeHeader, payload io.Reader) (err error) {
+
+		if err = hdr.CheckParams(rlkSet.params); err != nil {
+			return err
+		}
+
+		rlkSet.Value = make(map[string]*RelinearizationKey)
+
+		var data []byte
+
+		for !atEnd(payload.(*io.LimitedReader)) {
+
+			if data, err = readRawLengthPrefixed(payload.(*io.LimitedReader), "relinearization key"); err != nil {
+				return err
+			}
+
+			rlk := new(RelinearizationKey)
+			if err = rlk.decode(data); err != nil {
+				return err
+			}
+
+			rlkSet.AddRelinearizationKey(rlk)
+		}
+
+		return nil
+	})
+	return
+}
+
+// writeLengthPrefixed writes to w a slice of dataLen bytes encoded by encode, prefixed by its length on 8 bytes.
+func writeLengthPrefixed(w io.Writer, dataLen int, encode func(data []byte) error) (err error) {
+
+	data := make([]byte, 8+dataLen)
+	binary.BigEndian.PutUint64(data[:8], uint64(dataLen))
+
+	if err = encode(data[8:]); err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteTo writes the target EvaluationKeyBundle to w, one key at a time.
+func (bundle *EvaluationKeyBundle) WriteTo(w io.Writer) (n int64, err error) {
+	return WriteEnvelope(w, KindEvaluationKeyBundle, bundle.Fingerprint, bundle.GetDataLen(true), func(w io.Writer) (err error) {
+
+		header := make([]byte, idDataLen(bundle.ID, true)+1)
+
+		var pointer int
+		if pointer, err = encodeID(header, bundle.ID); err != nil {
+			return err
+		}
+		header[pointer] = bundle.flags()
+
+		if _, err = w.Write(header); err != nil {
+			return err
+		}
+
+		if bundle.PublicKey != nil {
+			if err = writeLengthPrefixed(w, bundle.PublicKey.GetDataLen(true)+len(bundle.PublicKey.ID), bundle.PublicKey.encode); err != nil {
+				return err
+			}
+		}
+
+		if bundle.RelinearizationKey != nil {
+			if err = writeLengthPrefixed(w, bundle.RelinearizationKey.GetDataLen(true)+len(bundle.RelinearizationKey.ID), bundle.RelinearizationKey.encode); err != nil {
+				return err
+			}
+		}
+
+		if bundle.ConjugationKey != nil {
+			if err = writeBuffered(bundle.ConjugationKey.GetDataLen(true), func(data []byte) (err error) {
+				_, err = bundle.ConjugationKey.encode(0, data)
+				return
+			})(w); err != nil {
+				return err
+			}
+		}
+
+		numRtk := make([]byte, 8)
+		binary.BigEndian.PutUint64(numRtk, uint64(len(bundle.RotationKeys)))
+
+		if _, err = w.Write(numRtk); err != nil {
+			return err
+		}
+
+		for _, rotidx := range slices.Sorted(maps.Keys(bundle.RotationKeys)) {
+			rtk := bundle.RotationKeys[rotidx]
+			if err = writeBuffered(rtk.GetDataLen(true), func(data []byte) (err error) {
+				_, err = rtk.encode(0, data)
+				return
+			})(w); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ReadFrom reads an EvaluationKeyBundle written by WriteTo or MarshalBinary from r in the target EvaluationKeyBundle.
+func (bundle *EvaluationKeyBundle) ReadFrom(r io.Reader) (n int64, err error) {
+	_, n, err = ReadEnvelope(r, KindEvaluationKeyBundle, func(hdr EnvelopeHeader, r io.Reader) (err error) {
+
+		payload := r.(*io.LimitedReader)
+
+		var data []byte
+
+		if data, err = appendRawID(payload, nil); err != nil {
+			return err
+		}
+
+		if bundle.ID, _, err = decodeID(data); err != nil {
+			return err
+		}
+
+		if data, err = appendFull(payload, data[:0], 1, "flags"); err != nil {
+			return err
+		}
+		flags := data[0]
+
+		bundle.PublicKey = nil
+		if flags&bundleHasPublicKey != 0 {
+			if data, err = readRawLengthPrefixed(payload, "public key"); err != nil {
+				return err
+			}
+
+			bundle.PublicKey = new(PublicKey)
+			if err = bundle.PublicKey.decode(data); err != nil {
+				return err
+			}
+		}
+
+		bundle.RelinearizationKey = nil
+		if flags&bundleHasRelinearizationKey != 0 {
+			if data, err = readRawLengthPrefixed(payload, "relinearization key"); err != nil {
+				return err
+			}
+
+			bundle.RelinearizationKey = new(RelinearizationKey)
+			if err = bundle.RelinearizationKey.decode(data); err != nil {
+				return err
+			}
+		}
+
+		bundle.ConjugationKey = nil
+		if flags&bundleHasConjugationKey != 0 {
+			if data, err = readRawConjugationKey(payload); err != nil {
+				return err
+			}
+
+			bundle.ConjugationKey = new(ConjugationKey)
+			if _, err = bundle.ConjugationKey.decode(data); err != nil {
+				return err
+			}
+		}
+
+		if data, err = appendFull(payload, data[:0], 8, "number of rotation keys"); err != nil {
+			return err
+		}
+		numRtk := binary.BigEndian.Uint64(data)
+
+		bundle.RotationKeys = make(map[uint]*RotationKey)
+
+		for i := uint64(0); i < numRtk; i++ {
+			if data, err = readRawRotationKey(payload); err != nil {
+				return err
+			}
+
+			rtk := new(RotationKey)
+			if _, err = rtk.decode(data); err != nil {
+				return err
+			}
+
+			bundle.AddRotationKey(rtk)
+		}
+
+		bundle.Fingerprint = hdr.ParamHash
+
+		return nil
+	})
+	return
+}
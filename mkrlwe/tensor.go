@@ -0,0 +1,162 @@
+package mkrlwe
+
+import "github.com/ldsec/lattigo/v2/ring"
+
+// TensoredCiphertext is the tensor product of two ciphertexts before relinearization.
+// Value holds the component of 1 (with key "0") and of each s_i (with key i),
+// and Quadratic[i][j] holds the component of s_i * s_j.
+// As s_i * s_j = s_j * s_i, NewTensoredCiphertext only allocates the components for i <= j.
+type TensoredCiphertext struct {
+	Value     map[string]*ring.Poly
+	Quadratic map[string]map[string]*ring.Poly
+}
+
+// NewTensoredCiphertext returns a new TensoredCiphertext with zero values
+func NewTensoredCiphertext(params Parameters, idset *IDSet, level int) *TensoredCiphertext {
+	el := new(TensoredCiphertext)
+	el.Value = make(map[string]*ring.Poly)
+	el.Quadratic = make(map[string]map[string]*ring.Poly)
+
+	el.Value["0"] = ring.NewPoly(params.N(), level+1)
+	el.PadTensoredCiphertext(idset)
+
+	return el
+}
+
+// PadTensoredCiphertext pads a tensored ciphertext with an input idset
+func (el *TensoredCiphertext) PadTensoredCiphertext(idset *IDSet) {
+
+	isNTT := el.Value["0"].IsNTT
+	degree := el.Value["0"].Degree()
+	level := el.Level()
+
+	newPoly := func() *ring.Poly {
+		pol := ring.NewPoly(degree, level+1)
+		pol.IsNTT = isNTT
+		return pol
+	}
+
+	idsetOut := el.IDSet().Union(idset)
+
+	for i := range idsetOut.Value {
+		if _, in := el.Value[i]; !in {
+			el.Value[i] = newPoly()
+		}
+
+		for j := range idsetOut.Value {
+			if i <= j && el.Component(i, j) == nil {
+				if _, in := el.Quadratic[i]; !in {
+					el.Quadratic[i] = make(map[string]*ring.Poly)
+				}
+				el.Quadratic[i][j] = newPoly()
+			}
+		}
+	}
+}
+
+// Component returns the component of s_i * s_j of the target element, where the ID "0" stands for 1,
+// or nil if the target element has no such component.
+func (el *TensoredCiphertext) Component(i, j string) *ring.Poly {
+	switch {
+	case i == "0":
+		return el.Value[j]
+	case j == "0":
+		return el.Value[i]
+	case j < i:
+		i, j = j, i
+	}
+
+	return el.Quadratic[i][j]
+}
+
+// CopyNew creates a new element as a copy of the target element.
+func (el *TensoredCiphertext) CopyNew() *TensoredCiphertext {
+
+	ctxCopy := new(TensoredCiphertext)
+	ctxCopy.Value = make(map[string]*ring.Poly)
+	ctxCopy.Quadratic = make(map[string]map[string]*ring.Poly)
+
+	for id := range el.Value {
+		ctxCopy.Value[id] = el.Value[id].CopyNew()
+	}
+
+	for i, row := range el.Quadratic {
+		ctxCopy.Quadratic[i] = make(map[string]*ring.Poly)
+		for j := range row {
+			ctxCopy.Quadratic[i][j] = row[j].CopyNew()
+		}
+	}
+
+	return ctxCopy
+}
+
+// IDSet returns the IDs engaged in the target element
+func (el *TensoredCiphertext) IDSet() *IDSet {
+	idset := NewIDSet()
+
+	for id := range el.Value {
+		if id != "0" {
+			idset.Add(id)
+		}
+	}
+
+	return idset
+}
+
+// Level returns the level of the target element
+func (el *TensoredCiphertext) Level() int {
+	return el.Value["0"].Level()
+}
+
+// Relinearize relinearizes each quadratic component of ctIn and returns the result in ctOut.
+// The component of s_i * s_j is switched with the relinearization keys of i and j as in [CDKS19].
+// Input and output are in InvNTT form. ctOut should contain the IDs of ctIn and must not share polynomials with ctIn.
+func (ks *KeySwitcher) Relinearize(ctIn *TensoredCiphertext, rlkSet *RelinearizationKeySet, ctOut *Ciphertext) {
+
+	level := ctOut.Level()
+
+	if ctIn.Level() < level {
+		panic("Cannot Relinearize: ctIn and ctOut have different levels")
+	}
+
+	ringQ := ks.Parameters.RingQ()
+
+	for id := range ctIn.Value {
+		if _, in := ctOut.Value[id]; !in {
+			panic("Cannot Relinearize: ctOut does not contain the IDs of ctIn")
+		}
+		ring.CopyValuesLvl(level, ctIn.Value[id], ctOut.Value[id])
+	}
+
+	u := ks.Parameters.CRS[-1]
+	dij := ks.swkPool3
+	t := ks.polyQPool[0]
+	tmp := ks.polyQPool[1]
+
+	for i, row := range ctIn.Quadratic {
+		t.Zero()
+		di := rlkSet.Value[i].Value[1]
+
+		for j, c := range row {
+			bj := rlkSet.Value[j].Value[0]
+
+			// t_i <- t_i + <g^-1(c_ij), b_j> ~ -c_ij * s_j * a
+			ks.Decompose(level, c, dij)
+			ks.ExternalProductHoisted(level, dij, bj, tmp)
+			ringQ.AddLvl(level, t, tmp, t)
+
+			// ctOut_j <- ctOut_j + <g^-1(c_ij), d_i> ~ c_ij * (s_i - r_i * a)
+			ks.ExternalProductHoisted(level, dij, di, tmp)
+			ringQ.AddLvl(level, ctOut.Value[j], tmp, ctOut.Value[j])
+		}
+
+		// ctOut_0 <- ctOut_0 + <g^-1(t_i), v_i>
+		// ctOut_i <- ctOut_i + <g^-1(t_i), u>
+		ks.Decompose(level, t, dij)
+		ks.ExternalProductHoisted(level, dij, rlkSet.Value[i].Value[2], tmp)
+		ringQ.AddLvl(level, ctOut.Value["0"], tmp, ctOut.Value["0"])
+
+		ks.ExternalProductHoisted(level, dij, u, tmp)
+		ringQ.AddLvl(level, ctOut.Value[i], tmp, ctOut.Value[i])
+	}
+}